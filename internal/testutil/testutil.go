@@ -0,0 +1,52 @@
+// Package testutil holds fixtures shared by the tests of packages built on
+// top of the protocol adapters.
+package testutil
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"testing"
+
+	"digital.vasic.filesystem/pkg/client"
+	"digital.vasic.filesystem/pkg/local"
+)
+
+// NewLocal returns a connected local client rooted at a new temporary
+// directory, and that directory.
+func NewLocal(t testing.TB) (*local.Client, string) {
+	t.Helper()
+	dir := t.TempDir()
+	c := local.NewLocalClient(&local.Config{BasePath: dir})
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatalf("failed to connect local client: %v", err)
+	}
+	return c, dir
+}
+
+// Random returns n pseudo-random bytes, the same for every seed.
+func Random(seed int64, n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+// ReadFile reads the whole file at p through c.
+func ReadFile(c client.Client, p string) ([]byte, error) {
+	rc, err := c.ReadFile(context.Background(), p)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// MustReadFile is ReadFile failing the test on error.
+func MustReadFile(t testing.TB, c client.Client, p string) []byte {
+	t.Helper()
+	data, err := ReadFile(c, p)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", p, err)
+	}
+	return data
+}
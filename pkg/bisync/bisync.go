@@ -0,0 +1,756 @@
+// Package bisync implements two-way synchronisation between two
+// client.Client trees. A persistent state file records what both sides
+// looked like after the last run, which tells a deletion apart from a file
+// that was never synced and detects files changed on both sides.
+package bisync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"digital.vasic.filesystem/pkg/checksum"
+	"digital.vasic.filesystem/pkg/client"
+	"digital.vasic.filesystem/pkg/mirror"
+	"digital.vasic.filesystem/pkg/transfer"
+)
+
+// ConflictPolicy decides what happens to a file changed on both sides.
+type ConflictPolicy string
+
+const (
+	// ConflictManual leaves both versions untouched and reports the conflict.
+	// It is re-detected on every run until resolved by hand.
+	ConflictManual ConflictPolicy = "manual"
+	// ConflictNewerWins copies the version with the later modification time
+	// over the other. Equal times fall back to ConflictManual.
+	ConflictNewerWins ConflictPolicy = "newer"
+	// ConflictKeepBoth keeps the newer version under the original name and
+	// the older one under a name with ConflictSuffix, on both sides.
+	ConflictKeepBoth ConflictPolicy = "keep_both"
+)
+
+// DefaultConflictSuffix is inserted before the extension of the losing
+// version under ConflictKeepBoth ("report.txt" -> "report.conflict.txt").
+const DefaultConflictSuffix = ".conflict"
+
+// DefaultMaxDeletePercent is the share of known files a single run may
+// delete before it aborts with ErrTooManyDeletes.
+const DefaultMaxDeletePercent = 50
+
+// ErrTooManyDeletes is returned when a run would delete more files than
+// Options.MaxDeletePercent allows, typically because one side is empty or
+// unmounted.
+var ErrTooManyDeletes = errors.New("too many deletes")
+
+// Options configures a two-way sync.
+type Options struct {
+	// StatePath is the local file holding the sync state. Required.
+	StatePath string
+	// Conflict defaults to ConflictManual.
+	Conflict ConflictPolicy
+	// ConflictSuffix defaults to DefaultConflictSuffix.
+	ConflictSuffix string
+	// Checksum records SHA-256 digests in the state and uses them to ignore
+	// files whose modification time changed but whose contents did not.
+	Checksum bool
+	// Filter selects the paths taking part in the sync.
+	Filter mirror.Filter
+	// MaxDeletePercent bounds deletions per run as a percentage of the files
+	// in the state. Zero uses DefaultMaxDeletePercent; negative disables the
+	// check.
+	MaxDeletePercent int
+	// DryRun computes the plan without changing either side or the state.
+	DryRun bool
+	// PreserveAttributes copies permissions and modification times along
+	// with contents (see transfer.Preserve).
+	PreserveAttributes bool
+}
+
+// Side identifies one of the two synchronised trees.
+type Side string
+
+const (
+	SideA Side = "a"
+	SideB Side = "b"
+)
+
+func (s Side) other() Side {
+	if s == SideA {
+		return SideB
+	}
+	return SideA
+}
+
+// ActionType is the kind of change an action makes to its target side.
+type ActionType string
+
+const (
+	ActionCopy   ActionType = "copy"
+	ActionDelete ActionType = "delete"
+	ActionMkdir  ActionType = "mkdir"
+)
+
+// Action is a single planned change on Target. Copies read SourcePath (or
+// Path when empty) from Source, which is the target side itself for the
+// conflict copies made by ConflictKeepBoth.
+type Action struct {
+	Type       ActionType `json:"type"`
+	Path       string     `json:"path"`
+	Target     Side       `json:"target"`
+	Source     Side       `json:"source,omitempty"`
+	SourcePath string     `json:"source_path,omitempty"`
+	IsDir      bool       `json:"is_dir,omitempty"`
+	Size       int64      `json:"size"`
+	Reason     string     `json:"reason,omitempty"`
+}
+
+// String formats the action as a line of plan output.
+func (a Action) String() string {
+	var s string
+	switch a.Type {
+	case ActionCopy:
+		from := a.Path
+		if a.SourcePath != "" {
+			from = a.SourcePath
+		}
+		s = fmt.Sprintf("copy   %s:%s -> %s:%s (%d bytes)", a.Source, from, a.Target, a.Path, a.Size)
+	default:
+		s = fmt.Sprintf("%-6s %s:%s", a.Type, a.Target, a.Path)
+	}
+	if a.Reason != "" {
+		s += " [" + a.Reason + "]"
+	}
+	return s
+}
+
+// Conflict describes a path changed on both sides.
+type Conflict struct {
+	Path       string         `json:"path"`
+	Reason     string         `json:"reason"`
+	A          *FileState     `json:"a,omitempty"`
+	B          *FileState     `json:"b,omitempty"`
+	Resolution ConflictPolicy `json:"resolution"`
+}
+
+// Plan lists the actions of a run in execution order: deletions (deepest
+// first), directory creation (parents first), then copies.
+type Plan struct {
+	Actions   []Action   `json:"actions"`
+	Conflicts []Conflict `json:"conflicts,omitempty"`
+	// InSync counts paths already identical on both sides.
+	InSync int `json:"in_sync"`
+	// FirstSync is set when no state existed; nothing is deleted then.
+	FirstSync bool `json:"first_sync"`
+
+	state      *State
+	a, b       mirror.Tree
+	settled    []string
+	dropped    []string
+	unresolved map[string]bool
+	hashes     map[string]string
+}
+
+// WriteTo writes the plan as human-readable text, one action per line.
+func (p *Plan) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	for _, a := range p.Actions {
+		b.WriteString(a.String())
+		b.WriteByte('\n')
+	}
+	for _, c := range p.Conflicts {
+		fmt.Fprintf(&b, "conflict %s [%s; %s]\n", c.Path, c.Reason, c.Resolution)
+	}
+	fmt.Fprintf(&b, "%d action(s), %d conflict(s), %d in sync\n", len(p.Actions), len(p.Conflicts), p.InSync)
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// Result is the outcome of one executed action.
+type Result struct {
+	Action
+	client.CopyResult
+}
+
+// Report summarises a sync run.
+type Report struct {
+	Plan        *Plan
+	DryRun      bool
+	Results     []Result
+	Copied      int
+	Deleted     int
+	DirsCreated int
+	// Unresolved counts conflicts left for manual resolution.
+	Unresolved  int
+	Failed      int
+	BytesCopied int64
+	TimeTaken   time.Duration
+}
+
+// Err joins the errors of all failed actions, or returns nil.
+func (r *Report) Err() error {
+	var errs []error
+	for _, res := range r.Results {
+		if res.Error != nil {
+			errs = append(errs, fmt.Errorf("%s %s:%s: %w", res.Type, res.Target, res.Path, res.Error))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Sync synchronises ARoot on A with BRoot on B in both directions.
+type Sync struct {
+	A       client.Client
+	ARoot   string
+	B       client.Client
+	BRoot   string
+	Options Options
+}
+
+// New creates a Sync between aRoot on a and bRoot on b.
+func New(a client.Client, aRoot string, b client.Client, bRoot string, opts Options) *Sync {
+	return &Sync{A: a, ARoot: aRoot, B: b, BRoot: bRoot, Options: opts}
+}
+
+func (s *Sync) client(side Side) client.Client {
+	if side == SideA {
+		return s.A
+	}
+	return s.B
+}
+
+func (s *Sync) path(side Side, rel string) string {
+	if side == SideA {
+		return client.JoinPath(s.ARoot, rel)
+	}
+	return client.JoinPath(s.BRoot, rel)
+}
+
+// Plan loads the state, compares both trees with it and returns the actions
+// a run would perform. When the deletion limit is exceeded the plan is
+// returned together with ErrTooManyDeletes.
+func (s *Sync) Plan(ctx context.Context) (*Plan, error) {
+	if s.Options.StatePath == "" {
+		return nil, fmt.Errorf("sync state path is required")
+	}
+	if err := s.Options.Filter.Validate(); err != nil {
+		return nil, err
+	}
+	state, err := LoadState(s.Options.StatePath)
+	if err != nil {
+		return nil, err
+	}
+	ta, err := mirror.ListTree(ctx, s.A, s.ARoot, s.Options.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list side a: %w", err)
+	}
+	tb, err := mirror.ListTree(ctx, s.B, s.BRoot, s.Options.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list side b: %w", err)
+	}
+
+	p := &Plan{
+		FirstSync:  len(state.Entries) == 0,
+		state:      state,
+		a:          ta,
+		b:          tb,
+		unresolved: make(map[string]bool),
+		hashes:     make(map[string]string),
+	}
+
+	paths := make(map[string]bool)
+	for rel := range ta {
+		paths[rel] = true
+	}
+	for rel := range tb {
+		paths[rel] = true
+	}
+	for rel, e := range state.Entries {
+		if e.IsDir && s.Options.Filter.Excluded(rel) || !e.IsDir && !s.Options.Filter.Match(rel) {
+			continue
+		}
+		paths[rel] = true
+	}
+	sorted := make([]string, 0, len(paths))
+	for rel := range paths {
+		sorted = append(sorted, rel)
+	}
+	sort.Strings(sorted)
+
+	var deletes, mkdirs, copies []Action
+	var dirs []string
+	reserved := make(map[string]bool)
+	var mismatched []string
+	for _, rel := range sorted {
+		if under(rel, mismatched) {
+			continue
+		}
+		a, b, e := ta[rel], tb[rel], state.Entries[rel]
+		if a != nil && b != nil && a.IsDir != b.IsDir {
+			mismatched = append(mismatched, rel)
+			p.Conflicts = append(p.Conflicts, Conflict{Path: rel, Reason: "file on one side, directory on the other", A: fileState(a), B: fileState(b), Resolution: ConflictManual})
+			p.unresolved[rel] = true
+			continue
+		}
+		if (a != nil && a.IsDir) || (b != nil && b.IsDir) || (a == nil && b == nil && e != nil && e.IsDir) {
+			dirs = append(dirs, rel)
+			continue
+		}
+
+		chA, err := s.changed(ctx, p, SideA, rel, a, e)
+		if err != nil {
+			return nil, err
+		}
+		chB, err := s.changed(ctx, p, SideB, rel, b, e)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case a != nil && b != nil:
+			switch {
+			case e != nil && !chA && !chB:
+				p.settled = append(p.settled, rel)
+			case e != nil && chA && !chB:
+				copies = append(copies, copyAction(rel, SideA, a, "changed on a"))
+			case e != nil && chB && !chA:
+				copies = append(copies, copyAction(rel, SideB, b, "changed on b"))
+			default:
+				same, err := s.sameContent(ctx, p, rel, a, b)
+				if err != nil {
+					return nil, err
+				}
+				if same {
+					p.settled = append(p.settled, rel)
+					continue
+				}
+				reason := "changed on both sides"
+				if e == nil {
+					reason = "created on both sides"
+				}
+				copies = append(copies, s.resolve(p, rel, a, b, reason, ta, tb, reserved)...)
+			}
+		case a != nil:
+			switch {
+			case e == nil:
+				copies = append(copies, copyAction(rel, SideA, a, "new on a"))
+			case chA:
+				copies = append(copies, copyAction(rel, SideA, a, "changed on a, deleted on b"))
+			default:
+				deletes = append(deletes, Action{Type: ActionDelete, Path: rel, Target: SideA, Size: a.Size, Reason: "deleted on b"})
+			}
+		case b != nil:
+			switch {
+			case e == nil:
+				copies = append(copies, copyAction(rel, SideB, b, "new on b"))
+			case chB:
+				copies = append(copies, copyAction(rel, SideB, b, "changed on b, deleted on a"))
+			default:
+				deletes = append(deletes, Action{Type: ActionDelete, Path: rel, Target: SideB, Size: b.Size, Reason: "deleted on a"})
+			}
+		default:
+			p.dropped = append(p.dropped, rel)
+		}
+	}
+
+	for _, rel := range dirs {
+		a, b, e := ta[rel], tb[rel], state.Entries[rel]
+		switch {
+		case a != nil && b != nil:
+			p.settled = append(p.settled, rel)
+		case a == nil && b == nil:
+			p.dropped = append(p.dropped, rel)
+		default:
+			present := SideA
+			if a == nil {
+				present = SideB
+			}
+			missing := present.other()
+			if e == nil || copiesInto(copies, missing, rel) {
+				mkdirs = append(mkdirs, Action{Type: ActionMkdir, Path: rel, Target: missing, IsDir: true, Reason: "new on " + string(present)})
+			} else {
+				deletes = append(deletes, Action{Type: ActionDelete, Path: rel, Target: present, IsDir: true, Reason: "deleted on " + string(missing)})
+			}
+		}
+	}
+
+	sort.SliceStable(deletes, func(i, j int) bool {
+		di, dj := strings.Count(deletes[i].Path, "/"), strings.Count(deletes[j].Path, "/")
+		if di != dj {
+			return di > dj
+		}
+		return !deletes[i].IsDir && deletes[j].IsDir
+	})
+	sort.SliceStable(mkdirs, func(i, j int) bool { return mkdirs[i].Path < mkdirs[j].Path })
+	p.Actions = append(append(deletes, mkdirs...), copies...)
+	p.InSync = len(p.settled)
+
+	if err := s.checkDeletes(p, deletes); err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+// checkDeletes enforces Options.MaxDeletePercent.
+func (s *Sync) checkDeletes(p *Plan, deletes []Action) error {
+	limit := s.Options.MaxDeletePercent
+	if limit == 0 {
+		limit = DefaultMaxDeletePercent
+	}
+	if limit < 0 {
+		return nil
+	}
+	known, n := 0, 0
+	for _, e := range p.state.Entries {
+		if !e.IsDir {
+			known++
+		}
+	}
+	for _, d := range deletes {
+		if !d.IsDir {
+			n++
+		}
+	}
+	if known > 0 && n*100 > limit*known {
+		return fmt.Errorf("%w: %d of %d known files (limit %d%%)", ErrTooManyDeletes, n, known, limit)
+	}
+	return nil
+}
+
+// resolve applies the conflict policy to a file changed on both sides.
+func (s *Sync) resolve(p *Plan, rel string, a, b *client.FileInfo, reason string, ta, tb mirror.Tree, reserved map[string]bool) []Action {
+	policy := s.Options.Conflict
+	if policy == "" {
+		policy = ConflictManual
+	}
+	winner, loser := SideA, SideB
+	if b.ModTime.After(a.ModTime) {
+		winner, loser = SideB, SideA
+	}
+	if policy == ConflictNewerWins && a.ModTime.Equal(b.ModTime) {
+		policy = ConflictManual
+	}
+	p.Conflicts = append(p.Conflicts, Conflict{Path: rel, Reason: reason, A: fileState(a), B: fileState(b), Resolution: policy})
+
+	infos := map[Side]*client.FileInfo{SideA: a, SideB: b}
+	switch policy {
+	case ConflictNewerWins:
+		return []Action{copyAction(rel, winner, infos[winner], "conflict: "+string(winner)+" is newer")}
+	case ConflictKeepBoth:
+		suffix := s.Options.ConflictSuffix
+		if suffix == "" {
+			suffix = DefaultConflictSuffix
+		}
+		alt := conflictName(rel, suffix, func(c string) bool {
+			return ta[c] != nil || tb[c] != nil || reserved[c]
+		})
+		reserved[alt] = true
+		size := infos[loser].Size
+		return []Action{
+			{Type: ActionCopy, Path: alt, Target: loser, Source: loser, SourcePath: rel, Size: size, Reason: "conflict: keep " + string(loser) + " version"},
+			{Type: ActionCopy, Path: alt, Target: winner, Source: loser, SourcePath: rel, Size: size, Reason: "conflict: keep " + string(loser) + " version"},
+			copyAction(rel, winner, infos[winner], "conflict: "+string(winner)+" is newer"),
+		}
+	default:
+		p.unresolved[rel] = true
+		return nil
+	}
+}
+
+// changed reports whether info differs from the side's state in e. A file
+// with no state entry counts as changed.
+func (s *Sync) changed(ctx context.Context, p *Plan, side Side, rel string, info *client.FileInfo, e *Entry) (bool, error) {
+	if info == nil || e == nil {
+		return info != nil, nil
+	}
+	prev := e.A
+	if side == SideB {
+		prev = e.B
+	}
+	if info.Size != prev.Size || e.IsDir {
+		return true, nil
+	}
+	if info.ModTime.Equal(prev.ModTime) {
+		return false, nil
+	}
+	if s.Options.Checksum && e.Hash != "" {
+		sum, err := s.hash(ctx, p, side, rel)
+		if err != nil {
+			return false, err
+		}
+		return sum != e.Hash, nil
+	}
+	return true, nil
+}
+
+// sameContent reports whether both versions of a file are identical.
+func (s *Sync) sameContent(ctx context.Context, p *Plan, rel string, a, b *client.FileInfo) (bool, error) {
+	if a.Size != b.Size {
+		return false, nil
+	}
+	sumA, err := s.hash(ctx, p, SideA, rel)
+	if err != nil {
+		return false, err
+	}
+	sumB, err := s.hash(ctx, p, SideB, rel)
+	if err != nil {
+		return false, err
+	}
+	return sumA == sumB, nil
+}
+
+// hash returns the SHA-256 digest of a file, memoised per plan.
+func (s *Sync) hash(ctx context.Context, p *Plan, side Side, rel string) (string, error) {
+	key := string(side) + ":" + rel
+	if sum, ok := p.hashes[key]; ok {
+		return sum, nil
+	}
+	sum, err := checksum.Sum(ctx, s.client(side), s.path(side, rel), client.HashSHA256)
+	if err != nil {
+		return "", err
+	}
+	p.hashes[key] = sum
+	return sum, nil
+}
+
+// Run plans the sync and, unless DryRun is set, executes the plan and saves
+// the new state. Failed actions are recorded in the report and leave their
+// paths' state untouched, so the next run retries them.
+func (s *Sync) Run(ctx context.Context) (*Report, error) {
+	start := time.Now()
+	plan, err := s.Plan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{Plan: plan, DryRun: s.Options.DryRun, Unresolved: len(plan.unresolved)}
+	if s.Options.DryRun {
+		report.TimeTaken = time.Since(start)
+		return report, nil
+	}
+
+	var runErr error
+	for _, a := range plan.Actions {
+		if err := ctx.Err(); err != nil {
+			runErr = err
+			break
+		}
+		res := Result{Action: a, CopyResult: *s.execute(ctx, a)}
+		report.Results = append(report.Results, res)
+		if !res.Success {
+			report.Failed++
+			continue
+		}
+		report.BytesCopied += res.BytesCopied
+		switch a.Type {
+		case ActionCopy:
+			report.Copied++
+		case ActionDelete:
+			report.Deleted++
+		case ActionMkdir:
+			report.DirsCreated++
+		}
+	}
+
+	next, err := s.nextState(context.WithoutCancel(ctx), plan, report.Results)
+	if err == nil {
+		err = next.Save(s.Options.StatePath)
+	}
+	report.TimeTaken = time.Since(start)
+	if runErr != nil {
+		return report, runErr
+	}
+	return report, err
+}
+
+// execute performs a single action.
+func (s *Sync) execute(ctx context.Context, a Action) *client.CopyResult {
+	target := s.client(a.Target)
+	full := s.path(a.Target, a.Path)
+	if a.Type == ActionCopy {
+		from := a.Path
+		if a.SourcePath != "" {
+			from = a.SourcePath
+		}
+		if a.Source == a.Target {
+			start := time.Now()
+			err := target.CopyFile(ctx, s.path(a.Source, from), full)
+			res := &client.CopyResult{Success: err == nil, Error: err, TimeTaken: time.Since(start)}
+			if err == nil {
+				res.BytesCopied = a.Size
+			}
+			return res
+		}
+		return transfer.Copy(ctx, s.client(a.Source), target, client.CopyOperation{
+			SourcePath:         s.path(a.Source, from),
+			DestinationPath:    full,
+			OverwriteExisting:  true,
+			PreserveAttributes: s.Options.PreserveAttributes,
+		})
+	}
+
+	start := time.Now()
+	var err error
+	switch a.Type {
+	case ActionMkdir:
+		err = target.CreateDirectory(ctx, full)
+	case ActionDelete:
+		if a.IsDir {
+			err = deleteEmptyDirectory(ctx, target, full)
+		} else {
+			err = target.DeleteFile(ctx, full)
+		}
+	default:
+		err = fmt.Errorf("unknown action %s", a.Type)
+	}
+	return &client.CopyResult{Success: err == nil, Error: err, TimeTaken: time.Since(start)}
+}
+
+// nextState derives the state to save from the plan and the action results.
+func (s *Sync) nextState(ctx context.Context, p *Plan, results []Result) (*State, error) {
+	next := p.state.clone()
+	for _, rel := range p.dropped {
+		delete(next.Entries, rel)
+	}
+	for _, rel := range p.settled {
+		a, b := p.a[rel], p.b[rel]
+		e := &Entry{IsDir: a.IsDir, A: *fileState(a), B: *fileState(b)}
+		if s.Options.Checksum && !a.IsDir {
+			sum, err := s.entryHash(ctx, p, rel)
+			if err != nil {
+				return nil, err
+			}
+			e.Hash = sum
+		}
+		next.Entries[rel] = e
+	}
+
+	failed := make(map[string]bool)
+	touched := make(map[string]bool)
+	for _, r := range results {
+		touched[r.Path] = true
+		if !r.Success {
+			failed[r.Path] = true
+		}
+	}
+	for rel := range touched {
+		if failed[rel] {
+			continue
+		}
+		a, errA := s.stat(ctx, SideA, rel)
+		b, errB := s.stat(ctx, SideB, rel)
+		if errA != nil || errB != nil {
+			return nil, errors.Join(errA, errB)
+		}
+		if a == nil || b == nil {
+			delete(next.Entries, rel)
+			continue
+		}
+		e := &Entry{IsDir: a.IsDir, A: *fileState(a), B: *fileState(b)}
+		if s.Options.Checksum && !a.IsDir {
+			delete(p.hashes, string(SideA)+":"+rel)
+			sum, err := s.hash(ctx, p, SideA, rel)
+			if err != nil {
+				return nil, err
+			}
+			e.Hash = sum
+		}
+		next.Entries[rel] = e
+	}
+	next.LastSync = time.Now()
+	return next, nil
+}
+
+// entryHash returns the digest of a settled file, reusing the previous
+// state's digest when the file is unchanged on side a.
+func (s *Sync) entryHash(ctx context.Context, p *Plan, rel string) (string, error) {
+	if sum, ok := p.hashes[string(SideA)+":"+rel]; ok {
+		return sum, nil
+	}
+	if e := p.state.Entries[rel]; e != nil && e.Hash != "" && e.A.Size == p.a[rel].Size && e.A.ModTime.Equal(p.a[rel].ModTime) {
+		return e.Hash, nil
+	}
+	return s.hash(ctx, p, SideA, rel)
+}
+
+// stat returns the file information of rel on side, or nil if it is missing.
+func (s *Sync) stat(ctx context.Context, side Side, rel string) (*client.FileInfo, error) {
+	c := s.client(side)
+	full := s.path(side, rel)
+	exists, err := c.FileExists(ctx, full)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check %s: %w", full, err)
+	}
+	if !exists {
+		return nil, nil
+	}
+	info, err := c.GetFileInfo(ctx, full)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", full, err)
+	}
+	return info, nil
+}
+
+// deleteEmptyDirectory deletes dir only if it has no entries left, because
+// some backends delete recursively.
+func deleteEmptyDirectory(ctx context.Context, c client.Client, dir string) error {
+	files, err := c.ListDirectory(ctx, dir)
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %w", dir, err)
+	}
+	for _, f := range files {
+		if f.Name != "" && f.Name != "." && f.Name != ".." {
+			return fmt.Errorf("directory %s is not empty", dir)
+		}
+	}
+	return c.DeleteDirectory(ctx, dir)
+}
+
+func copyAction(rel string, from Side, info *client.FileInfo, reason string) Action {
+	return Action{Type: ActionCopy, Path: rel, Target: from.other(), Source: from, Size: info.Size, Reason: reason}
+}
+
+// copiesInto reports whether a copy writes below dir on side.
+func copiesInto(copies []Action, side Side, dir string) bool {
+	for _, c := range copies {
+		if c.Target == side && strings.HasPrefix(c.Path, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// under reports whether rel lies below one of dirs.
+func under(rel string, dirs []string) bool {
+	for _, d := range dirs {
+		if strings.HasPrefix(rel, d+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// conflictName inserts suffix before the extension of rel, adding a
+// counter while taken reports the name as used.
+func conflictName(rel, suffix string, taken func(string) bool) string {
+	ext := path.Ext(rel)
+	if ext == path.Base(rel) {
+		ext = ""
+	}
+	stem := strings.TrimSuffix(rel, ext)
+	name := stem + suffix + ext
+	for i := 1; taken(name); i++ {
+		name = fmt.Sprintf("%s%s-%d%s", stem, suffix, i, ext)
+	}
+	return name
+}
+
+func fileState(info *client.FileInfo) *FileState {
+	if info == nil {
+		return nil
+	}
+	return &FileState{Size: info.Size, ModTime: info.ModTime}
+}
@@ -0,0 +1,274 @@
+package bisync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"digital.vasic.filesystem/pkg/local"
+)
+
+type fixture struct {
+	aDir, bDir string
+	sync       *Sync
+}
+
+func newFixture(t *testing.T, opts Options) *fixture {
+	t.Helper()
+	aDir, bDir := t.TempDir(), t.TempDir()
+	a := local.NewLocalClient(&local.Config{BasePath: aDir})
+	b := local.NewLocalClient(&local.Config{BasePath: bDir})
+	require.NoError(t, a.Connect(context.Background()))
+	require.NoError(t, b.Connect(context.Background()))
+	if opts.StatePath == "" {
+		opts.StatePath = filepath.Join(t.TempDir(), "state.json")
+	}
+	return &fixture{aDir: aDir, bDir: bDir, sync: New(a, "/", b, "/", opts)}
+}
+
+func (f *fixture) run(t *testing.T) *Report {
+	t.Helper()
+	report, err := f.sync.Run(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, report.Err())
+	return report
+}
+
+func write(t *testing.T, dir, rel, content string, mtime time.Time) {
+	t.Helper()
+	p := filepath.Join(dir, filepath.FromSlash(rel))
+	require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+	require.NoError(t, os.WriteFile(p, []byte(content), 0644))
+	require.NoError(t, os.Chtimes(p, mtime, mtime))
+}
+
+func read(t *testing.T, dir, rel string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(rel)))
+	require.NoError(t, err)
+	return string(data)
+}
+
+var (
+	t0 = time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	t1 = t0.Add(time.Hour)
+)
+
+func TestSync_FirstSyncMerges(t *testing.T) {
+	f := newFixture(t, Options{})
+	write(t, f.aDir, "a.txt", "from a", t0)
+	write(t, f.aDir, "dir/nested.txt", "nested", t0)
+	write(t, f.bDir, "b.txt", "from b", t0)
+	write(t, f.bDir, "same.txt", "same", t0)
+	write(t, f.aDir, "same.txt", "same", t1)
+
+	report := f.run(t)
+	assert.True(t, report.Plan.FirstSync)
+	assert.Equal(t, 3, report.Copied)
+	assert.Equal(t, 1, report.DirsCreated)
+	assert.Equal(t, "from a", read(t, f.bDir, "a.txt"))
+	assert.Equal(t, "nested", read(t, f.bDir, "dir/nested.txt"))
+	assert.Equal(t, "from b", read(t, f.aDir, "b.txt"))
+
+	state, err := LoadState(f.sync.Options.StatePath)
+	require.NoError(t, err)
+	assert.Len(t, state.Entries, 5)
+	assert.True(t, state.Entries["dir"].IsDir)
+
+	report = f.run(t)
+	assert.Empty(t, report.Plan.Actions)
+	assert.Equal(t, 5, report.Plan.InSync)
+}
+
+func TestSync_PropagatesChanges(t *testing.T) {
+	f := newFixture(t, Options{})
+	write(t, f.aDir, "a.txt", "v1", t0)
+	write(t, f.aDir, "b.txt", "v1", t0)
+	f.run(t)
+
+	write(t, f.aDir, "a.txt", "v2 from a", t1)
+	write(t, f.bDir, "b.txt", "v2 from b", t1)
+	report := f.run(t)
+	assert.Equal(t, 2, report.Copied)
+	assert.Equal(t, "v2 from a", read(t, f.bDir, "a.txt"))
+	assert.Equal(t, "v2 from b", read(t, f.aDir, "b.txt"))
+}
+
+func TestSync_PropagatesDeletes(t *testing.T) {
+	f := newFixture(t, Options{MaxDeletePercent: -1})
+	write(t, f.aDir, "keep.txt", "keep", t0)
+	write(t, f.aDir, "gone.txt", "gone", t0)
+	write(t, f.aDir, "olddir/x.txt", "x", t0)
+	f.run(t)
+
+	require.NoError(t, os.Remove(filepath.Join(f.bDir, "gone.txt")))
+	require.NoError(t, os.RemoveAll(filepath.Join(f.aDir, "olddir")))
+	report := f.run(t)
+	assert.Equal(t, 3, report.Deleted)
+	assert.NoFileExists(t, filepath.Join(f.aDir, "gone.txt"))
+	assert.NoDirExists(t, filepath.Join(f.bDir, "olddir"))
+	assert.FileExists(t, filepath.Join(f.bDir, "keep.txt"))
+
+	state, err := LoadState(f.sync.Options.StatePath)
+	require.NoError(t, err)
+	assert.Len(t, state.Entries, 1)
+}
+
+func TestSync_ModifiedWinsOverDelete(t *testing.T) {
+	f := newFixture(t, Options{MaxDeletePercent: -1})
+	write(t, f.aDir, "doc.txt", "v1", t0)
+	f.run(t)
+
+	require.NoError(t, os.Remove(filepath.Join(f.aDir, "doc.txt")))
+	write(t, f.bDir, "doc.txt", "v2", t1)
+	report := f.run(t)
+	assert.Equal(t, 1, report.Copied)
+	assert.Equal(t, "v2", read(t, f.aDir, "doc.txt"))
+}
+
+func TestSync_ConflictManual(t *testing.T) {
+	f := newFixture(t, Options{})
+	write(t, f.aDir, "doc.txt", "v1", t0)
+	f.run(t)
+
+	write(t, f.aDir, "doc.txt", "edited on a", t1)
+	write(t, f.bDir, "doc.txt", "edited on b", t1.Add(time.Minute))
+	report := f.run(t)
+	assert.Equal(t, 1, report.Unresolved)
+	require.Len(t, report.Plan.Conflicts, 1)
+	assert.Equal(t, ConflictManual, report.Plan.Conflicts[0].Resolution)
+	assert.Equal(t, "changed on both sides", report.Plan.Conflicts[0].Reason)
+	assert.Equal(t, "edited on a", read(t, f.aDir, "doc.txt"))
+	assert.Equal(t, "edited on b", read(t, f.bDir, "doc.txt"))
+
+	// Still a conflict on the next run.
+	report = f.run(t)
+	assert.Equal(t, 1, report.Unresolved)
+}
+
+func TestSync_ConflictNewerWins(t *testing.T) {
+	f := newFixture(t, Options{Conflict: ConflictNewerWins})
+	write(t, f.aDir, "doc.txt", "v1", t0)
+	f.run(t)
+
+	write(t, f.aDir, "doc.txt", "edited on a", t1)
+	write(t, f.bDir, "doc.txt", "edited on b later", t1.Add(time.Minute))
+	report := f.run(t)
+	assert.Zero(t, report.Unresolved)
+	assert.Equal(t, "edited on b later", read(t, f.aDir, "doc.txt"))
+
+	report = f.run(t)
+	assert.Empty(t, report.Plan.Actions)
+}
+
+func TestSync_ConflictKeepBoth(t *testing.T) {
+	f := newFixture(t, Options{Conflict: ConflictKeepBoth})
+	write(t, f.aDir, "doc.txt", "v1", t0)
+	f.run(t)
+
+	write(t, f.aDir, "doc.txt", "edited on a later", t1.Add(time.Minute))
+	write(t, f.bDir, "doc.txt", "edited on b", t1)
+	f.run(t)
+
+	for _, dir := range []string{f.aDir, f.bDir} {
+		assert.Equal(t, "edited on a later", read(t, dir, "doc.txt"))
+		assert.Equal(t, "edited on b", read(t, dir, "doc.conflict.txt"))
+	}
+	report := f.run(t)
+	assert.Empty(t, report.Plan.Actions)
+}
+
+func TestSync_TooManyDeletes(t *testing.T) {
+	f := newFixture(t, Options{})
+	for _, name := range []string{"1", "2", "3", "4"} {
+		write(t, f.aDir, name+".txt", name, t0)
+	}
+	f.run(t)
+
+	for _, name := range []string{"1", "2", "3"} {
+		require.NoError(t, os.Remove(filepath.Join(f.aDir, name+".txt")))
+	}
+	_, err := f.sync.Run(context.Background())
+	assert.True(t, errors.Is(err, ErrTooManyDeletes))
+	assert.FileExists(t, filepath.Join(f.bDir, "1.txt"))
+
+	plan, err := f.sync.Plan(context.Background())
+	assert.ErrorIs(t, err, ErrTooManyDeletes)
+	require.NotNil(t, plan)
+	assert.Len(t, plan.Actions, 3)
+}
+
+func TestSync_ChecksumIgnoresTouch(t *testing.T) {
+	f := newFixture(t, Options{Checksum: true})
+	write(t, f.aDir, "doc.txt", "same", t0)
+	f.run(t)
+
+	state, err := LoadState(f.sync.Options.StatePath)
+	require.NoError(t, err)
+	assert.NotEmpty(t, state.Entries["doc.txt"].Hash)
+
+	require.NoError(t, os.Chtimes(filepath.Join(f.aDir, "doc.txt"), t1, t1))
+	report := f.run(t)
+	assert.Empty(t, report.Plan.Actions)
+}
+
+func TestSync_DryRun(t *testing.T) {
+	f := newFixture(t, Options{DryRun: true})
+	write(t, f.aDir, "a.txt", "a", t0)
+
+	report := f.run(t)
+	assert.True(t, report.DryRun)
+	assert.NoFileExists(t, filepath.Join(f.bDir, "a.txt"))
+	assert.NoFileExists(t, f.sync.Options.StatePath)
+
+	var buf bytes.Buffer
+	_, err := report.Plan.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, "copy   a:a.txt -> b:a.txt (1 bytes) [new on a]\n1 action(s), 0 conflict(s), 0 in sync\n", buf.String())
+}
+
+func TestSync_RequiresStatePath(t *testing.T) {
+	f := newFixture(t, Options{})
+	f.sync.Options.StatePath = ""
+	_, err := f.sync.Run(context.Background())
+	assert.Error(t, err)
+}
+
+func TestConflictName(t *testing.T) {
+	none := func(string) bool { return false }
+	assert.Equal(t, "a/report.conflict.txt", conflictName("a/report.txt", ".conflict", none))
+	assert.Equal(t, "Makefile.conflict", conflictName("Makefile", ".conflict", none))
+	assert.Equal(t, "dir/.bashrc.conflict", conflictName("dir/.bashrc", ".conflict", none))
+
+	taken := map[string]bool{"x.conflict.txt": true, "x.conflict-1.txt": true}
+	assert.Equal(t, "x.conflict-2.txt", conflictName("x.txt", ".conflict", func(n string) bool { return taken[n] }))
+}
+
+func TestLoadState(t *testing.T) {
+	dir := t.TempDir()
+	state, err := LoadState(filepath.Join(dir, "missing.json"))
+	require.NoError(t, err)
+	assert.Empty(t, state.Entries)
+
+	p := filepath.Join(dir, "state.json")
+	state.Entries["x"] = &Entry{A: FileState{Size: 1, ModTime: t0}, B: FileState{Size: 1, ModTime: t1}, Hash: "abc"}
+	require.NoError(t, state.Save(p))
+	loaded, err := LoadState(p)
+	require.NoError(t, err)
+	assert.Equal(t, "abc", loaded.Entries["x"].Hash)
+	assert.True(t, loaded.Entries["x"].B.ModTime.Equal(t1))
+
+	require.NoError(t, os.WriteFile(p, []byte("{bad"), 0644))
+	_, err = LoadState(p)
+	assert.Error(t, err)
+	require.NoError(t, os.WriteFile(p, []byte(`{"version": 99}`), 0644))
+	_, err = LoadState(p)
+	assert.Error(t, err)
+}
@@ -0,0 +1,100 @@
+package bisync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// stateVersion is the version written to new state files.
+const stateVersion = 1
+
+// FileState is what one side looked like after the last successful sync.
+type FileState struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Entry records a path both sides agreed on after the last sync.
+type Entry struct {
+	IsDir bool      `json:"is_dir,omitempty"`
+	A     FileState `json:"a"`
+	B     FileState `json:"b"`
+	// Hash is the hex SHA-256 digest of the contents, recorded when
+	// Options.Checksum is set.
+	Hash string `json:"hash,omitempty"`
+}
+
+// State is the persistent sync database, keyed by path relative to the
+// sync roots.
+type State struct {
+	Version  int               `json:"version"`
+	LastSync time.Time         `json:"last_sync"`
+	Entries  map[string]*Entry `json:"entries"`
+}
+
+// LoadState reads a state file. A missing file yields an empty state, which
+// makes the next run a first sync that never deletes.
+func LoadState(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &State{Version: stateVersion, Entries: make(map[string]*Entry)}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sync state %s: %w", path, err)
+	}
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse sync state %s: %w", path, err)
+	}
+	if s.Version > stateVersion {
+		return nil, fmt.Errorf("sync state %s has unsupported version %d", path, s.Version)
+	}
+	if s.Entries == nil {
+		s.Entries = make(map[string]*Entry)
+	}
+	return &s, nil
+}
+
+// Save writes the state to path through a temporary file and a rename, so
+// an interrupted save never leaves a truncated database behind.
+func (s *State) Save(path string) error {
+	s.Version = stateVersion
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode sync state: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create sync state %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write sync state %s: %w", path, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync sync state %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close sync state %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace sync state %s: %w", path, err)
+	}
+	return nil
+}
+
+// clone returns a deep copy of the state.
+func (s *State) clone() *State {
+	c := &State{Version: s.Version, LastSync: s.LastSync, Entries: make(map[string]*Entry, len(s.Entries))}
+	for k, v := range s.Entries {
+		e := *v
+		c.Entries[k] = &e
+	}
+	return c
+}
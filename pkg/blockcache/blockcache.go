@@ -0,0 +1,227 @@
+// Package blockcache provides a block-level read cache for seekable remote
+// files. Players probing container headers while seeking through video
+// over SMB or WebDAV read the same byte ranges repeatedly; the cache keeps
+// fixed-size blocks in memory (and optionally on local disk), evicts them
+// least-recently-used first, and reads ahead when access is sequential.
+package blockcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// Client wraps a client.Client and serves OpenSeekable through a Cache.
+// All other operations go straight to the wrapped client.
+type Client struct {
+	client.Client
+	cache *Cache
+	id    uint64
+}
+
+// New wraps c with a new block cache configured by opts.
+func New(c client.Client, opts Options) (*Client, error) {
+	cache, err := NewCache(opts)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithCache(c, cache), nil
+}
+
+// NewWithCache wraps c with an existing cache, so that several clients can
+// share one memory and disk budget. Each client gets its own namespace in
+// the cache, so equal paths on different backends never share blocks.
+func NewWithCache(c client.Client, cache *Cache) *Client {
+	return &Client{Client: c, cache: cache, id: cache.clients.Add(1)}
+}
+
+// Unwrap returns the wrapped client.
+func (c *Client) Unwrap() client.Client {
+	return c.Client
+}
+
+// Cache returns the cache used by the client.
+func (c *Client) Cache() *Cache {
+	return c.cache
+}
+
+// OpenSeekable opens path for cached random-access reads. The file's size
+// and modification time are looked up first and become part of the cache
+// key, so blocks of an older version of the file are never served.
+func (c *Client) OpenSeekable(ctx context.Context, path string) (client.ReadSeekCloser, error) {
+	sc, ok := c.Client.(client.SeekableClient)
+	if !ok {
+		return nil, fmt.Errorf("open seekable %s: %w", path, client.ErrNotSupported)
+	}
+	info, err := c.Client.GetFileInfo(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir {
+		return nil, fmt.Errorf("cannot open directory %s for reading", path)
+	}
+	file := fileKey{client: c.id, path: path, size: info.Size, modTime: modTimeKey(info.ModTime)}
+	c.cache.observe(file)
+
+	return &reader{
+		cache: c.cache,
+		file:  file,
+		open: func() (client.ReadSeekCloser, error) {
+			return sc.OpenSeekable(ctx, path)
+		},
+		lastBlock: -1,
+	}, nil
+}
+
+// reader is a client.ReadSeekCloser backed by the block cache. The remote
+// file is opened on the first cache miss and shared with prefetching.
+type reader struct {
+	cache *Cache
+	file  fileKey
+	open  func() (client.ReadSeekCloser, error)
+
+	pos       int64
+	lastBlock int64
+	closed    bool
+
+	srcMu  sync.Mutex
+	src    client.ReadSeekCloser
+	srcErr error
+
+	prefetching sync.WaitGroup
+}
+
+// Read reads from the current position, filling blocks from the cache.
+func (r *reader) Read(p []byte) (int, error) {
+	if r.closed {
+		return 0, errors.New("read on closed file")
+	}
+	if r.pos >= r.file.size {
+		return 0, io.EOF
+	}
+	bs := r.cache.BlockSize()
+	n := 0
+	for n < len(p) && r.pos < r.file.size {
+		index := r.pos / bs
+		data, err := r.block(index, false)
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		offset := r.pos - index*bs
+		if offset >= int64(len(data)) {
+			// The remote file is shorter than its recorded size.
+			if n > 0 {
+				return n, nil
+			}
+			return 0, io.ErrUnexpectedEOF
+		}
+		copied := copy(p[n:], data[offset:])
+		n += copied
+		r.pos += int64(copied)
+		r.maybePrefetch(index)
+	}
+	return n, nil
+}
+
+// Seek sets the position for the next Read.
+func (r *reader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.pos + offset
+	case io.SeekEnd:
+		abs = r.file.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.pos = abs
+	return abs, nil
+}
+
+// Close waits for running prefetches and closes the remote file.
+func (r *reader) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	r.prefetching.Wait()
+	r.srcMu.Lock()
+	defer r.srcMu.Unlock()
+	if r.src != nil {
+		return r.src.Close()
+	}
+	return nil
+}
+
+// maybePrefetch starts reading ahead when index directly follows the
+// previously read block.
+func (r *reader) maybePrefetch(index int64) {
+	sequential := index == r.lastBlock+1
+	if index == r.lastBlock {
+		return
+	}
+	r.lastBlock = index
+	if !sequential || r.cache.opts.Prefetch < 0 {
+		return
+	}
+	bs := r.cache.BlockSize()
+	for i := index + 1; i <= index+int64(r.cache.opts.Prefetch) && i*bs < r.file.size; i++ {
+		if r.cache.cached(blockKey{file: r.file, index: i}) {
+			continue
+		}
+		r.prefetching.Add(1)
+		go func(i int64) {
+			defer r.prefetching.Done()
+			_, _ = r.block(i, true)
+		}(i)
+	}
+}
+
+// block returns block index from the cache, loading it from the remote
+// file on a miss.
+func (r *reader) block(index int64, prefetch bool) ([]byte, error) {
+	key := blockKey{file: r.file, index: index}
+	return r.cache.get(key, func() ([]byte, error) {
+		return r.load(index)
+	}, prefetch)
+}
+
+// load reads block index from the remote file.
+func (r *reader) load(index int64) ([]byte, error) {
+	r.srcMu.Lock()
+	defer r.srcMu.Unlock()
+	if r.src == nil && r.srcErr == nil {
+		r.src, r.srcErr = r.open()
+	}
+	if r.srcErr != nil {
+		return nil, r.srcErr
+	}
+
+	bs := r.cache.BlockSize()
+	offset := index * bs
+	size := bs
+	if remaining := r.file.size - offset; remaining < size {
+		size = remaining
+	}
+	if _, err := r.src.Seek(offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek %s to %d: %w", r.file.path, offset, err)
+	}
+	data := make([]byte, size)
+	n, err := io.ReadFull(r.src, data)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to read block %d of %s: %w", index, r.file.path, err)
+	}
+	return data[:n], nil
+}
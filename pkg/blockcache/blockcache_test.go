@@ -0,0 +1,344 @@
+package blockcache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"digital.vasic.filesystem/pkg/client"
+	"digital.vasic.filesystem/pkg/local"
+)
+
+// Verify Client implements the interfaces it decorates.
+var (
+	_ client.Client         = (*Client)(nil)
+	_ client.SeekableClient = (*Client)(nil)
+)
+
+// countingClient counts the bytes read from the backend through OpenSeekable.
+type countingClient struct {
+	*local.Client
+	opens     atomic.Int64
+	bytesRead atomic.Int64
+}
+
+func (c *countingClient) OpenSeekable(ctx context.Context, path string) (client.ReadSeekCloser, error) {
+	c.opens.Add(1)
+	f, err := c.Client.OpenSeekable(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return &countingReader{ReadSeekCloser: f, n: &c.bytesRead}, nil
+}
+
+type countingReader struct {
+	client.ReadSeekCloser
+	n *atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadSeekCloser.Read(p)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+// nonSeekable hides every optional extension of the wrapped client.
+type nonSeekable struct {
+	client.Client
+}
+
+func testData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	return data
+}
+
+func newBackend(t *testing.T, name string, data []byte) *countingClient {
+	t.Helper()
+	lc := local.NewLocalClient(&local.Config{BasePath: t.TempDir()})
+	require.NoError(t, lc.Connect(context.Background()))
+	require.NoError(t, lc.WriteFile(context.Background(), name, bytes.NewReader(data)))
+	return &countingClient{Client: lc}
+}
+
+func readAt(t *testing.T, r io.ReadSeeker, offset int64, n int) []byte {
+	t.Helper()
+	_, err := r.Seek(offset, io.SeekStart)
+	require.NoError(t, err)
+	buf := make([]byte, n)
+	got, err := io.ReadFull(r, buf)
+	require.NoError(t, err)
+	return buf[:got]
+}
+
+func TestNewCache_Defaults(t *testing.T) {
+	c, err := NewCache(Options{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(defaultBlockSize), c.BlockSize())
+	assert.Equal(t, int64(defaultMaxMemory), c.opts.MaxMemory)
+	assert.Equal(t, defaultPrefetch, c.opts.Prefetch)
+	assert.Nil(t, c.disk)
+}
+
+func TestClient_ReadsMatchSource(t *testing.T) {
+	data := testData(10_000)
+	backend := newBackend(t, "video.mkv", data)
+	c, err := New(backend, Options{BlockSize: 1024, Prefetch: -1})
+	require.NoError(t, err)
+
+	r, err := c.OpenSeekable(context.Background(), "video.mkv")
+	require.NoError(t, err)
+	defer r.Close()
+
+	all, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, data, all)
+
+	assert.Equal(t, data[1000:3100], readAt(t, r, 1000, 2100))
+	assert.Equal(t, data[9990:], readAt(t, r, 9990, 10))
+
+	pos, err := r.Seek(-10, io.SeekEnd)
+	require.NoError(t, err)
+	assert.Equal(t, int64(9990), pos)
+	pos, err = r.Seek(5, io.SeekCurrent)
+	require.NoError(t, err)
+	assert.Equal(t, int64(9995), pos)
+
+	_, err = r.Seek(-1, io.SeekStart)
+	assert.Error(t, err)
+
+	_, err = r.Seek(20_000, io.SeekStart)
+	require.NoError(t, err)
+	n, err := r.Read(make([]byte, 10))
+	assert.Equal(t, 0, n)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestClient_RepeatedReadsHitCache(t *testing.T) {
+	data := testData(8192)
+	backend := newBackend(t, "video.mkv", data)
+	c, err := New(backend, Options{BlockSize: 1024, Prefetch: -1})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		r, err := c.OpenSeekable(ctx, "video.mkv")
+		require.NoError(t, err)
+		assert.Equal(t, data[100:200], readAt(t, r, 100, 100))
+		assert.Equal(t, data[7000:7100], readAt(t, r, 7000, 100))
+		require.NoError(t, r.Close())
+	}
+
+	assert.Equal(t, int64(2048), backend.bytesRead.Load(), "only the two touched blocks are fetched")
+	assert.Equal(t, int64(1), backend.opens.Load(), "later readers never open the remote file")
+	stats := c.Cache().Stats()
+	assert.Equal(t, uint64(2), stats.Misses)
+	assert.Equal(t, uint64(8), stats.Hits)
+}
+
+func TestClient_StaleBlocksRejected(t *testing.T) {
+	backend := newBackend(t, "a.bin", []byte("old content"))
+	c, err := New(backend, Options{BlockSize: 4, Prefetch: -1})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	r, err := c.OpenSeekable(ctx, "a.bin")
+	require.NoError(t, err)
+	old, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "old content", string(old))
+	require.NoError(t, r.Close())
+
+	require.NoError(t, backend.WriteFile(ctx, "a.bin", bytes.NewReader([]byte("new content!"))))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(filepath.Join(backend.GetConfig().(*local.Config).BasePath, "a.bin"), later, later))
+
+	r, err = c.OpenSeekable(ctx, "a.bin")
+	require.NoError(t, err)
+	fresh, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "new content!", string(fresh))
+	require.NoError(t, r.Close())
+
+	assert.Equal(t, int64(12), c.Cache().Stats().MemoryUsed, "blocks of the old version were dropped")
+}
+
+func TestClient_MemoryCapEvictsLRU(t *testing.T) {
+	data := testData(4096)
+	backend := newBackend(t, "a.bin", data)
+	c, err := New(backend, Options{BlockSize: 1024, MaxMemory: 2048, Prefetch: -1})
+	require.NoError(t, err)
+
+	r, err := c.OpenSeekable(context.Background(), "a.bin")
+	require.NoError(t, err)
+	defer r.Close()
+	_, err = io.ReadAll(r)
+	require.NoError(t, err)
+
+	stats := c.Cache().Stats()
+	assert.LessOrEqual(t, stats.MemoryUsed, int64(2048))
+	assert.Equal(t, uint64(2), stats.Evictions)
+
+	readAt(t, r, 3000, 10)
+	assert.Equal(t, int64(4096), backend.bytesRead.Load(), "most recent block is still cached")
+	readAt(t, r, 0, 10)
+	assert.Equal(t, int64(5120), backend.bytesRead.Load(), "evicted block is fetched again")
+}
+
+func TestClient_DiskTier(t *testing.T) {
+	data := testData(4096)
+	backend := newBackend(t, "a.bin", data)
+	dir := filepath.Join(t.TempDir(), "blocks")
+	c, err := New(backend, Options{BlockSize: 1024, MaxMemory: 1024, DiskDir: dir, Prefetch: -1})
+	require.NoError(t, err)
+
+	r, err := c.OpenSeekable(context.Background(), "a.bin")
+	require.NoError(t, err)
+	defer r.Close()
+	_, err = io.ReadAll(r)
+	require.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.blk"))
+	require.NoError(t, err)
+	assert.Len(t, files, 4)
+
+	assert.Equal(t, data[:10], readAt(t, r, 0, 10))
+	assert.Equal(t, int64(4096), backend.bytesRead.Load(), "evicted block is served from disk")
+	stats := c.Cache().Stats()
+	assert.Equal(t, uint64(1), stats.DiskHits)
+	assert.Equal(t, int64(4096), stats.DiskUsed)
+
+	c.Cache().Purge()
+	files, err = filepath.Glob(filepath.Join(dir, "*.blk"))
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestNewCache_RemovesStaleFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"old.blk", "123.tmp", "keep.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("x"), 0600))
+	}
+	_, err := NewCache(Options{DiskDir: dir})
+	require.NoError(t, err)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "blocks and temporary files of a crashed process are removed")
+	assert.Equal(t, "keep.txt", entries[0].Name())
+}
+
+func TestClient_DiskCap(t *testing.T) {
+	backend := newBackend(t, "a.bin", testData(4096))
+	dir := t.TempDir()
+	c, err := New(backend, Options{BlockSize: 1024, MaxMemory: 1024, DiskDir: dir, MaxDisk: 2048, Prefetch: -1})
+	require.NoError(t, err)
+
+	r, err := c.OpenSeekable(context.Background(), "a.bin")
+	require.NoError(t, err)
+	defer r.Close()
+	_, err = io.ReadAll(r)
+	require.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.blk"))
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+	assert.Equal(t, int64(2048), c.Cache().Stats().DiskUsed)
+}
+
+func TestClient_SequentialPrefetch(t *testing.T) {
+	data := testData(8192)
+	backend := newBackend(t, "a.bin", data)
+	c, err := New(backend, Options{BlockSize: 1024, Prefetch: 2})
+	require.NoError(t, err)
+
+	r, err := c.OpenSeekable(context.Background(), "a.bin")
+	require.NoError(t, err)
+	assert.Equal(t, data[:1024], readAt(t, r, 0, 1024))
+	require.NoError(t, r.Close())
+
+	stats := c.Cache().Stats()
+	assert.Equal(t, uint64(2), stats.Prefetched)
+	assert.Equal(t, int64(3*1024), stats.MemoryUsed)
+
+	r, err = c.OpenSeekable(context.Background(), "a.bin")
+	require.NoError(t, err)
+	defer r.Close()
+	assert.Equal(t, data[1024:3072], readAt(t, r, 1024, 2048))
+	assert.GreaterOrEqual(t, c.Cache().Stats().Hits, uint64(2))
+}
+
+func TestClient_SharedCache(t *testing.T) {
+	cache, err := NewCache(Options{BlockSize: 512, Prefetch: -1, DiskDir: t.TempDir()})
+	require.NoError(t, err)
+	// Same path, size and modification time on both backends: only the
+	// client namespace tells the files apart.
+	backendA := newBackend(t, "v.bin", []byte("from a"))
+	backendB := newBackend(t, "v.bin", []byte("from b"))
+	mtime := time.Unix(1700000000, 0)
+	for _, backend := range []*countingClient{backendA, backendB} {
+		require.NoError(t, backend.Client.Chtimes(context.Background(), "v.bin", mtime, mtime))
+	}
+	a := NewWithCache(backendA, cache)
+	b := NewWithCache(backendB, cache)
+	assert.Same(t, a.Cache(), b.Cache())
+
+	read := func(c *Client) string {
+		r, err := c.OpenSeekable(context.Background(), "v.bin")
+		require.NoError(t, err)
+		defer r.Close()
+		got, err := io.ReadAll(r)
+		require.NoError(t, err)
+		return string(got)
+	}
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, "from a", read(a))
+		assert.Equal(t, "from b", read(b))
+	}
+	assert.Equal(t, int64(12), cache.Stats().MemoryUsed)
+	assert.Equal(t, uint64(2), cache.Stats().Hits, "opening a path on one client keeps the other's blocks")
+
+	cache.memory.clear(nil)
+	assert.Equal(t, "from a", read(a))
+	assert.Equal(t, "from b", read(b))
+	assert.Equal(t, uint64(2), cache.Stats().DiskHits)
+}
+
+func TestClient_OpenSeekable_Errors(t *testing.T) {
+	backend := newBackend(t, "a.bin", []byte("data"))
+	require.NoError(t, backend.CreateDirectory(context.Background(), "dir"))
+
+	c, err := New(backend, Options{})
+	require.NoError(t, err)
+	_, err = c.OpenSeekable(context.Background(), "missing.bin")
+	assert.Error(t, err)
+	_, err = c.OpenSeekable(context.Background(), "dir")
+	assert.Error(t, err)
+
+	plain, err := New(nonSeekable{backend}, Options{})
+	require.NoError(t, err)
+	_, err = plain.OpenSeekable(context.Background(), "a.bin")
+	assert.True(t, errors.Is(err, client.ErrNotSupported))
+	assert.Same(t, backend, plain.Unwrap().(nonSeekable).Client)
+}
+
+func TestReader_ReadAfterClose(t *testing.T) {
+	c, err := New(newBackend(t, "a.bin", []byte("data")), Options{})
+	require.NoError(t, err)
+	r, err := c.OpenSeekable(context.Background(), "a.bin")
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.NoError(t, r.Close())
+	_, err = r.Read(make([]byte, 4))
+	assert.Error(t, err)
+}
@@ -0,0 +1,373 @@
+package blockcache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Options configures a Cache. Zero values select the defaults.
+type Options struct {
+	// BlockSize is the size of a cached block in bytes (default 1 MiB).
+	BlockSize int64
+	// MaxMemory caps the bytes held in memory (default 64 MiB).
+	MaxMemory int64
+	// DiskDir enables a second cache tier on local disk when non-empty.
+	// Blocks evicted from memory are read back from disk.
+	DiskDir string
+	// MaxDisk caps the bytes held in DiskDir (default 1 GiB).
+	MaxDisk int64
+	// Prefetch is the number of blocks read ahead once sequential access is
+	// detected (default 2, negative disables prefetching).
+	Prefetch int
+}
+
+const (
+	defaultBlockSize = 1 << 20
+	defaultMaxMemory = 64 << 20
+	defaultMaxDisk   = 1 << 30
+	defaultPrefetch  = 2
+)
+
+// Stats reports cache effectiveness.
+type Stats struct {
+	Hits       uint64
+	DiskHits   uint64
+	Misses     uint64
+	Prefetched uint64
+	Evictions  uint64
+	MemoryUsed int64
+	DiskUsed   int64
+}
+
+// fileKey identifies one version of a remote file of one client. A
+// changed size or modification time yields a new key, so stale blocks are
+// never served.
+type fileKey struct {
+	client  uint64
+	path    string
+	size    int64
+	modTime int64
+}
+
+// pathKey identifies a path of one client regardless of its version.
+type pathKey struct {
+	client uint64
+	path   string
+}
+
+func (k fileKey) pathKey() pathKey {
+	return pathKey{client: k.client, path: k.path}
+}
+
+type blockKey struct {
+	file  fileKey
+	index int64
+}
+
+// Cache is a block cache shared by any number of readers and clients.
+// It is safe for concurrent use.
+type Cache struct {
+	opts    Options
+	clients atomic.Uint64
+
+	mu       sync.Mutex
+	memory   *tier
+	disk     *tier
+	versions map[pathKey]fileKey
+	inflight map[blockKey]*fetch
+	stats    Stats
+}
+
+// fetch is an in-progress block read that concurrent readers wait for.
+type fetch struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// NewCache creates a block cache. If opts.DiskDir is set the directory is
+// created and any blocks or temporary files left in it by a previous
+// process are removed.
+func NewCache(opts Options) (*Cache, error) {
+	if opts.BlockSize <= 0 {
+		opts.BlockSize = defaultBlockSize
+	}
+	if opts.MaxMemory <= 0 {
+		opts.MaxMemory = defaultMaxMemory
+	}
+	if opts.MaxDisk <= 0 {
+		opts.MaxDisk = defaultMaxDisk
+	}
+	if opts.Prefetch == 0 {
+		opts.Prefetch = defaultPrefetch
+	}
+	c := &Cache{
+		opts:     opts,
+		memory:   newTier(opts.MaxMemory),
+		versions: make(map[pathKey]fileKey),
+		inflight: make(map[blockKey]*fetch),
+	}
+	if opts.DiskDir != "" {
+		if err := os.MkdirAll(opts.DiskDir, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create block cache directory %s: %w", opts.DiskDir, err)
+		}
+		for _, pattern := range []string{"*.blk", "*.tmp"} {
+			stale, _ := filepath.Glob(filepath.Join(opts.DiskDir, pattern))
+			for _, name := range stale {
+				_ = os.Remove(name)
+			}
+		}
+		c.disk = newTier(opts.MaxDisk)
+	}
+	return c, nil
+}
+
+// BlockSize returns the configured block size.
+func (c *Cache) BlockSize() int64 {
+	return c.opts.BlockSize
+}
+
+// Stats returns a snapshot of the cache statistics.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.MemoryUsed = c.memory.used
+	if c.disk != nil {
+		stats.DiskUsed = c.disk.used
+	}
+	return stats
+}
+
+// Purge drops every cached block.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.memory.clear(nil)
+	if c.disk != nil {
+		c.disk.clear(c.removeDiskBlock)
+	}
+	c.versions = make(map[pathKey]fileKey)
+}
+
+// observe records file as the current version of its path and drops the
+// blocks of any previous version.
+func (c *Cache) observe(file fileKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prev, ok := c.versions[file.pathKey()]
+	c.versions[file.pathKey()] = file
+	if !ok || prev == file {
+		return
+	}
+	match := func(k blockKey) bool { return k.file == prev }
+	c.memory.removeFunc(match, nil)
+	if c.disk != nil {
+		c.disk.removeFunc(match, c.removeDiskBlock)
+	}
+}
+
+// get returns block key, reading it with load on a miss. Concurrent
+// requests for the same block share one load.
+func (c *Cache) get(key blockKey, load func() ([]byte, error), prefetch bool) ([]byte, error) {
+	c.mu.Lock()
+	if data, ok := c.memory.get(key); ok {
+		if !prefetch {
+			c.stats.Hits++
+		}
+		c.mu.Unlock()
+		return data, nil
+	}
+	if f, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		<-f.done
+		return f.data, f.err
+	}
+	f := &fetch{done: make(chan struct{})}
+	c.inflight[key] = f
+	onDisk := c.disk != nil && c.disk.contains(key)
+	c.mu.Unlock()
+
+	var data []byte
+	var err error
+	fromDisk := false
+	if onDisk {
+		data, err = os.ReadFile(c.diskPath(key))
+		fromDisk = err == nil
+	}
+	if !fromDisk {
+		data, err = load()
+	}
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	if err == nil {
+		switch {
+		case prefetch:
+			c.stats.Prefetched++
+		case fromDisk:
+			c.stats.DiskHits++
+		default:
+			c.stats.Misses++
+		}
+		c.stats.Evictions += uint64(c.memory.put(key, data, int64(len(data)), nil))
+		if fromDisk {
+			c.disk.touch(key)
+		}
+	}
+	c.mu.Unlock()
+
+	f.data, f.err = data, err
+	close(f.done)
+	if err == nil && c.disk != nil && !fromDisk {
+		c.storeDisk(key, data)
+	}
+	return data, err
+}
+
+// cached reports whether key is in memory or being fetched.
+func (c *Cache) cached(key blockKey) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.inflight[key]; ok {
+		return true
+	}
+	return c.memory.contains(key)
+}
+
+// storeDisk writes a block to the disk tier. The file is written without
+// holding c.mu, which is only taken to index it; disk errors only disable
+// caching of that block.
+func (c *Cache) storeDisk(key blockKey, data []byte) {
+	path := c.diskPath(key)
+	tmp, err := os.CreateTemp(c.opts.DiskDir, "*.tmp")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.versions[key.file.pathKey()] != key.file {
+		// The file changed while the block was written.
+		_ = os.Remove(path)
+		return
+	}
+	c.disk.put(key, nil, int64(len(data)), c.removeDiskBlock)
+}
+
+func (c *Cache) removeDiskBlock(key blockKey) {
+	_ = os.Remove(c.diskPath(key))
+}
+
+func (c *Cache) diskPath(key blockKey) string {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%d\x00%s\x00%d\x00%d\x00%d", key.file.client, key.file.path, key.file.size, key.file.modTime, key.index)))
+	return filepath.Join(c.opts.DiskDir, hex.EncodeToString(h[:16])+".blk")
+}
+
+// tier is a byte-bounded LRU of blocks. The memory tier keeps the data;
+// the disk tier keeps only sizes and leaves data in files.
+type tier struct {
+	max   int64
+	used  int64
+	ll    *list.List
+	items map[blockKey]*list.Element
+	sizes map[blockKey]int64
+}
+
+type tierEntry struct {
+	key  blockKey
+	data []byte
+}
+
+func newTier(max int64) *tier {
+	return &tier{
+		max:   max,
+		ll:    list.New(),
+		items: make(map[blockKey]*list.Element),
+		sizes: make(map[blockKey]int64),
+	}
+}
+
+func (t *tier) get(key blockKey) ([]byte, bool) {
+	el, ok := t.items[key]
+	if !ok {
+		return nil, false
+	}
+	t.ll.MoveToFront(el)
+	return el.Value.(*tierEntry).data, true
+}
+
+func (t *tier) contains(key blockKey) bool {
+	_, ok := t.items[key]
+	return ok
+}
+
+func (t *tier) touch(key blockKey) {
+	if el, ok := t.items[key]; ok {
+		t.ll.MoveToFront(el)
+	}
+}
+
+// put inserts a block of size bytes and evicts least recently used blocks
+// until the tier fits its cap. It returns the number of evicted blocks.
+func (t *tier) put(key blockKey, data []byte, size int64, onEvict func(blockKey)) int {
+	if el, ok := t.items[key]; ok {
+		t.ll.MoveToFront(el)
+		return 0
+	}
+	t.items[key] = t.ll.PushFront(&tierEntry{key: key, data: data})
+	t.sizes[key] = size
+	t.used += size
+	evicted := 0
+	for t.used > t.max && t.ll.Len() > 1 {
+		t.removeElement(t.ll.Back(), onEvict)
+		evicted++
+	}
+	return evicted
+}
+
+func (t *tier) removeFunc(match func(blockKey) bool, onEvict func(blockKey)) {
+	for key, el := range t.items {
+		if match(key) {
+			t.removeElement(el, onEvict)
+		}
+	}
+}
+
+func (t *tier) clear(onEvict func(blockKey)) {
+	t.removeFunc(func(blockKey) bool { return true }, onEvict)
+}
+
+func (t *tier) removeElement(el *list.Element, onEvict func(blockKey)) {
+	key := el.Value.(*tierEntry).key
+	t.ll.Remove(el)
+	delete(t.items, key)
+	t.used -= t.sizes[key]
+	delete(t.sizes, key)
+	if onEvict != nil {
+		onEvict(key)
+	}
+}
+
+// modTimeKey converts a modification time into the form stored in fileKey.
+func modTimeKey(t time.Time) int64 {
+	return t.UnixNano()
+}
@@ -0,0 +1,470 @@
+// Package cas provides a client.Client decorator that stores file content
+// as deduplicated, content-addressed chunks. Written data is split with
+// FastCDC, each unique chunk is stored once under its SHA-256 in a chunk
+// directory on the wrapped client, and the user-visible path holds a small
+// JSON manifest listing the chunks. Many versions of a large, mostly
+// unchanged file therefore cost little more than one.
+package cas
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// Options configures the store. Zero values select the defaults.
+type Options struct {
+	// ChunkDir is where chunks are stored on the wrapped client (default
+	// ".chunks"). It is hidden from listings through the Client.
+	ChunkDir string
+	// MinChunkSize, AvgChunkSize and MaxChunkSize bound the chunk sizes
+	// (defaults 16 KiB, 64 KiB and 256 KiB). AvgChunkSize is rounded down
+	// to a power of two.
+	MinChunkSize int
+	AvgChunkSize int
+	MaxChunkSize int
+}
+
+const (
+	defaultChunkDir = ".chunks"
+	defaultMinChunk = 16 << 10
+	defaultAvgChunk = 64 << 10
+	defaultMaxChunk = 256 << 10
+)
+
+// manifestFormat identifies manifests. It is the first field of every
+// manifest, so a file can be recognised from its first bytes.
+const manifestFormat = "digital.vasic.filesystem/cas/v1"
+
+// manifestPrefix is how every manifest starts, followed by its size.
+var manifestPrefix = []byte(`{"format":"` + manifestFormat + `","size":`)
+
+// ErrCorrupt is returned when a chunk does not match its hash or a
+// manifest cannot be decoded.
+var ErrCorrupt = errors.New("corrupt content-addressed data")
+
+// Chunk is one entry of a manifest.
+type Chunk struct {
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+}
+
+// Manifest is what the Client stores under a user-visible path.
+type Manifest struct {
+	Format string  `json:"format"`
+	Size   int64   `json:"size"`
+	Chunks []Chunk `json:"chunks"`
+}
+
+// Client wraps a client.Client and stores files as chunk manifests. Files
+// on the wrapped client that are not manifests, such as those written
+// before the wrapper was introduced, are read and listed unchanged.
+// Deleting or overwriting a file leaves its chunks in place until GC
+// removes those no manifest references.
+type Client struct {
+	client.Client
+
+	opts Options
+
+	// gc is held for reading by writers and for writing by GC, so a
+	// collection never sees chunks whose manifest is not written yet.
+	gc sync.RWMutex
+
+	mu   sync.Mutex
+	dirs map[string]bool
+}
+
+// New wraps c with content-addressed storage.
+func New(c client.Client, opts Options) *Client {
+	if opts.ChunkDir == "" {
+		opts.ChunkDir = defaultChunkDir
+	}
+	opts.ChunkDir = strings.Trim(opts.ChunkDir, "/")
+	if opts.MinChunkSize <= 0 {
+		opts.MinChunkSize = defaultMinChunk
+	}
+	if opts.AvgChunkSize <= 0 {
+		opts.AvgChunkSize = defaultAvgChunk
+	}
+	if opts.MaxChunkSize <= 0 {
+		opts.MaxChunkSize = defaultMaxChunk
+	}
+	opts.AvgChunkSize = 1 << (bits.Len(uint(opts.AvgChunkSize)) - 1)
+	if opts.AvgChunkSize < opts.MinChunkSize {
+		opts.AvgChunkSize = opts.MinChunkSize
+	}
+	if opts.MaxChunkSize < opts.AvgChunkSize {
+		opts.MaxChunkSize = opts.AvgChunkSize
+	}
+	return &Client{Client: c, opts: opts, dirs: make(map[string]bool)}
+}
+
+// Unwrap returns the wrapped client.
+func (c *Client) Unwrap() client.Client {
+	return c.Client
+}
+
+// WriteFile splits data into chunks, stores the chunks not already
+// present and writes the manifest to path.
+func (c *Client) WriteFile(ctx context.Context, path string, data io.Reader) error {
+	c.gc.RLock()
+	defer c.gc.RUnlock()
+
+	m := Manifest{Format: manifestFormat, Chunks: []Chunk{}}
+	ch := newChunker(data, c.opts.MinChunkSize, c.opts.AvgChunkSize, c.opts.MaxChunkSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		chunk, err := ch.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read data for %s: %w", path, err)
+		}
+		sum := sha256.Sum256(chunk)
+		hash := hex.EncodeToString(sum[:])
+		if err := c.putChunk(ctx, hash, chunk); err != nil {
+			return err
+		}
+		m.Chunks = append(m.Chunks, Chunk{Hash: hash, Size: int64(len(chunk))})
+		m.Size += int64(len(chunk))
+	}
+
+	body, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest for %s: %w", path, err)
+	}
+	return c.Client.WriteFile(ctx, path, bytes.NewReader(body))
+}
+
+// putChunk stores chunk unless a chunk of the same hash and size exists.
+// A chunk of the wrong size, left by an interrupted write, is replaced.
+// Chunks are written atomically where the wrapped client can, including
+// decorators such as client.Sub that expose client.AtomicWriter but fail
+// with client.ErrNotSupported over clients without it.
+func (c *Client) putChunk(ctx context.Context, hash string, chunk []byte) error {
+	p := c.chunkPath(hash)
+	if info, err := c.Client.GetFileInfo(ctx, p); err == nil && info.Size == int64(len(chunk)) {
+		return nil
+	}
+	if err := c.ensureDir(ctx, path.Dir(p)); err != nil {
+		return err
+	}
+	err := client.ErrNotSupported
+	if aw, ok := c.Client.(client.AtomicWriter); ok {
+		err = aw.WriteFileAtomic(ctx, p, bytes.NewReader(chunk))
+	}
+	if errors.Is(err, client.ErrNotSupported) {
+		err = c.Client.WriteFile(ctx, p, bytes.NewReader(chunk))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store chunk %s: %w", hash, err)
+	}
+	return nil
+}
+
+// ensureDir creates the chunk directory dir and its parents once.
+func (c *Client) ensureDir(ctx context.Context, dir string) error {
+	c.mu.Lock()
+	done := c.dirs[dir]
+	c.mu.Unlock()
+	if done {
+		return nil
+	}
+	if parent := path.Dir(dir); parent != "." && parent != "/" {
+		if err := c.ensureDir(ctx, parent); err != nil {
+			return err
+		}
+	}
+	exists, err := c.Client.FileExists(ctx, dir)
+	if err != nil {
+		return fmt.Errorf("failed to check chunk directory %s: %w", dir, err)
+	}
+	if !exists {
+		if err := c.Client.CreateDirectory(ctx, dir); err != nil {
+			return fmt.Errorf("failed to create chunk directory %s: %w", dir, err)
+		}
+	}
+	c.mu.Lock()
+	c.dirs[dir] = true
+	c.mu.Unlock()
+	return nil
+}
+
+// chunkPath returns where the chunk with hash is stored, fanned out over
+// 256 subdirectories by its first byte.
+func (c *Client) chunkPath(hash string) string {
+	return c.opts.ChunkDir + "/" + hash[:2] + "/" + hash
+}
+
+// ReadFile rebuilds the file at path from its chunks, verifying each one.
+// Files that are not manifests are returned as stored.
+func (c *Client) ReadFile(ctx context.Context, path string) (io.ReadCloser, error) {
+	m, raw, err := c.open(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return raw, nil
+	}
+	return &reader{c: c, ctx: ctx, m: m}, nil
+}
+
+// OpenSeekable returns a seekable reader over the rebuilt file. Only the
+// chunk being read is held in memory. Files that are not manifests are
+// opened through the wrapped client when it is a client.SeekableClient.
+func (c *Client) OpenSeekable(ctx context.Context, path string) (client.ReadSeekCloser, error) {
+	m, raw, err := c.open(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		raw.Close()
+		sc, ok := c.Client.(client.SeekableClient)
+		if !ok {
+			return nil, fmt.Errorf("open seekable %s: %w", path, client.ErrNotSupported)
+		}
+		return sc.OpenSeekable(ctx, path)
+	}
+	return &reader{c: c, ctx: ctx, m: m}, nil
+}
+
+// open reads the manifest at path. If path holds ordinary content it
+// returns a nil manifest and a reader over that content instead. A
+// manifest whose size is not the sum of its chunk sizes is corrupt.
+func (c *Client) open(ctx context.Context, path string) (*Manifest, io.ReadCloser, error) {
+	rc, err := c.Client.ReadFile(ctx, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	br := bufio.NewReader(rc)
+	head, _ := br.Peek(len(manifestPrefix))
+	if !bytes.Equal(head, manifestPrefix) {
+		return nil, readCloser{Reader: br, Closer: rc}, nil
+	}
+	defer rc.Close()
+	var m Manifest
+	if err := json.NewDecoder(br).Decode(&m); err != nil {
+		return nil, nil, fmt.Errorf("%w: manifest %s: %v", ErrCorrupt, path, err)
+	}
+	var total int64
+	for _, ch := range m.Chunks {
+		if ch.Size < 0 || total+ch.Size < total {
+			return nil, nil, fmt.Errorf("%w: manifest %s: invalid chunk size %d", ErrCorrupt, path, ch.Size)
+		}
+		total += ch.Size
+	}
+	if total != m.Size {
+		return nil, nil, fmt.Errorf("%w: manifest %s: size %d, chunks hold %d", ErrCorrupt, path, m.Size, total)
+	}
+	return &m, nil, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// GetFileInfo reports the rebuilt size of manifests.
+func (c *Client) GetFileInfo(ctx context.Context, path string) (*client.FileInfo, error) {
+	info, err := c.Client.GetFileInfo(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.resize(ctx, path, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// ListDirectory hides the chunk directory and reports the rebuilt size of
+// manifests, reading the first bytes of every file.
+func (c *Client) ListDirectory(ctx context.Context, dir string) ([]*client.FileInfo, error) {
+	files, err := c.Client.ListDirectory(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	out := files[:0]
+	for _, f := range files {
+		p := client.JoinPath(dir, f.Name)
+		if strings.Trim(p, "/") == c.opts.ChunkDir {
+			continue
+		}
+		if err := c.resize(ctx, p, f); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// CopyFile copies the manifest only, so the copy shares every chunk.
+// Ordinary files are copied by the wrapped client.
+func (c *Client) CopyFile(ctx context.Context, srcPath, dstPath string) error {
+	c.gc.RLock()
+	defer c.gc.RUnlock()
+	return c.Client.CopyFile(ctx, srcPath, dstPath)
+}
+
+// resize replaces the size of a manifest's info with the rebuilt size.
+func (c *Client) resize(ctx context.Context, p string, info *client.FileInfo) error {
+	if info.IsDir || info.LinkType == client.LinkSymlink || info.Size < int64(len(manifestPrefix)) {
+		return nil
+	}
+	size, ok, err := c.manifestSize(ctx, p)
+	if err != nil {
+		return err
+	}
+	if ok {
+		info.Size = size
+	}
+	return nil
+}
+
+// manifestSize reads the size from the first bytes of the file at p and
+// reports whether it is a manifest.
+func (c *Client) manifestSize(ctx context.Context, p string) (int64, bool, error) {
+	rc, err := c.Client.ReadFile(ctx, p)
+	if err != nil {
+		return 0, false, err
+	}
+	defer rc.Close()
+	head := make([]byte, len(manifestPrefix)+20)
+	n, err := io.ReadFull(rc, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return 0, false, fmt.Errorf("failed to read %s: %w", p, err)
+	}
+	head = head[:n]
+	if !bytes.HasPrefix(head, manifestPrefix) {
+		return 0, false, nil
+	}
+	digits := head[len(manifestPrefix):]
+	end := bytes.IndexByte(digits, ',')
+	if end < 0 {
+		return 0, false, fmt.Errorf("%w: manifest %s", ErrCorrupt, p)
+	}
+	size, err := strconv.ParseInt(string(digits[:end]), 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("%w: manifest %s: %v", ErrCorrupt, p, err)
+	}
+	return size, true, nil
+}
+
+// reader rebuilds a file from its manifest. It loads one chunk at a time
+// and verifies it against its hash.
+type reader struct {
+	c   *Client
+	ctx context.Context
+	m   *Manifest
+
+	pos     int64
+	base    int64
+	data    []byte
+	offsets []int64
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if r.pos >= r.m.Size {
+		return 0, io.EOF
+	}
+	if r.data == nil || r.pos < r.base || r.pos >= r.base+int64(len(r.data)) {
+		if err := r.load(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.data[r.pos-r.base:])
+	r.pos += int64(n)
+	return n, nil
+}
+
+// load fetches the chunk holding r.pos.
+func (r *reader) load() error {
+	if r.offsets == nil {
+		r.offsets = make([]int64, len(r.m.Chunks)+1)
+		for i, ch := range r.m.Chunks {
+			r.offsets[i+1] = r.offsets[i] + ch.Size
+		}
+	}
+	i := searchOffsets(r.offsets, r.pos)
+	ch := r.m.Chunks[i]
+	data, err := r.c.readChunk(r.ctx, ch)
+	if err != nil {
+		return err
+	}
+	r.base, r.data = r.offsets[i], data
+	return nil
+}
+
+func (r *reader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.pos + offset
+	case io.SeekEnd:
+		abs = r.m.Size + offset
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if abs < 0 {
+		return 0, fmt.Errorf("negative position %d", abs)
+	}
+	r.pos = abs
+	return abs, nil
+}
+
+func (r *reader) Close() error {
+	r.data = nil
+	return nil
+}
+
+// searchOffsets returns the chunk whose range of offsets holds pos.
+func searchOffsets(offsets []int64, pos int64) int {
+	lo, hi := 0, len(offsets)-2
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if offsets[mid] <= pos {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return lo
+}
+
+// readChunk reads and verifies the chunk ch.
+func (c *Client) readChunk(ctx context.Context, ch Chunk) ([]byte, error) {
+	if len(ch.Hash) != sha256.Size*2 {
+		return nil, fmt.Errorf("%w: invalid chunk hash %q", ErrCorrupt, ch.Hash)
+	}
+	rc, err := c.Client.ReadFile(ctx, c.chunkPath(ch.Hash))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunk %s: %w", ch.Hash, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, ch.Size+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunk %s: %w", ch.Hash, err)
+	}
+	sum := sha256.Sum256(data)
+	if int64(len(data)) != ch.Size || hex.EncodeToString(sum[:]) != ch.Hash {
+		return nil, fmt.Errorf("%w: chunk %s", ErrCorrupt, ch.Hash)
+	}
+	return data, nil
+}
@@ -0,0 +1,295 @@
+package cas
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"digital.vasic.filesystem/internal/testutil"
+	"digital.vasic.filesystem/pkg/client"
+	"digital.vasic.filesystem/pkg/local"
+)
+
+var _ client.SeekableClient = (*Client)(nil)
+
+// small chunk sizes keep the test data small.
+var small = Options{MinChunkSize: 256, AvgChunkSize: 1024, MaxChunkSize: 4096}
+
+// chunks splits data with the small options.
+func chunks(t *testing.T, data []byte) [][]byte {
+	t.Helper()
+	ch := newChunker(bytes.NewReader(data), small.MinChunkSize, small.AvgChunkSize, small.MaxChunkSize)
+	var out [][]byte
+	for {
+		c, err := ch.next()
+		if err == io.EOF {
+			return out
+		}
+		require.NoError(t, err)
+		out = append(out, append([]byte(nil), c...))
+	}
+}
+
+func TestChunker(t *testing.T) {
+	data := testutil.Random(1, 200<<10)
+	parts := chunks(t, data)
+	require.Greater(t, len(parts), 100)
+	assert.Equal(t, data, bytes.Join(parts, nil))
+	for i, p := range parts[:len(parts)-1] {
+		assert.GreaterOrEqual(t, len(p), small.MinChunkSize, i)
+		assert.LessOrEqual(t, len(p), small.MaxChunkSize, i)
+	}
+	assert.InDelta(t, small.AvgChunkSize, len(data)/len(parts), float64(small.AvgChunkSize)/2)
+
+	// Inserting bytes near the start moves the boundaries around the
+	// insertion only.
+	edited := append(append(append([]byte(nil), data[:1000]...), "inserted"...), data[1000:]...)
+	seen := make(map[string]bool)
+	for _, p := range parts {
+		seen[string(p)] = true
+	}
+	shared := 0
+	editedParts := chunks(t, edited)
+	for _, p := range editedParts {
+		if seen[string(p)] {
+			shared++
+		}
+	}
+	assert.GreaterOrEqual(t, shared, len(editedParts)-3)
+
+	assert.Empty(t, chunks(t, nil))
+	assert.Equal(t, [][]byte{[]byte("tiny")}, chunks(t, []byte("tiny")))
+}
+
+// chunkCount counts the chunk files stored below dir.
+func chunkCount(t *testing.T, dir string) int {
+	t.Helper()
+	n := 0
+	err := filepath.WalkDir(filepath.Join(dir, ".chunks"), func(p string, d os.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return filepath.SkipDir
+		}
+		if err == nil && !d.IsDir() {
+			n++
+		}
+		return err
+	})
+	require.NoError(t, err)
+	return n
+}
+
+func TestClient_WriteRead(t *testing.T) {
+	l, dir := testutil.NewLocal(t)
+	c := New(l, small)
+	ctx := context.Background()
+	v1 := testutil.Random(2, 100<<10)
+	v2 := append(append([]byte(nil), v1[:50<<10]...), v1[50<<10+100:]...)
+
+	require.NoError(t, c.WriteFile(ctx, "video/v1.bin", bytes.NewReader(v1)))
+	stored := chunkCount(t, dir)
+	require.NoError(t, c.WriteFile(ctx, "video/v2.bin", bytes.NewReader(v2)))
+	assert.LessOrEqual(t, chunkCount(t, dir)-stored, 3, "a small edit stores a few new chunks")
+	stored = chunkCount(t, dir)
+	require.NoError(t, c.CopyFile(ctx, "video/v1.bin", "video/v1-copy.bin"))
+	assert.Equal(t, stored, chunkCount(t, dir), "copies share chunks")
+
+	assert.Equal(t, v1, testutil.MustReadFile(t, c, "video/v1.bin"))
+	assert.Equal(t, v2, testutil.MustReadFile(t, c, "video/v2.bin"))
+	assert.Equal(t, v1, testutil.MustReadFile(t, c, "video/v1-copy.bin"))
+
+	raw, err := os.ReadFile(filepath.Join(dir, "video", "v1.bin"))
+	require.NoError(t, err)
+	assert.Less(t, len(raw), 10<<10, "the visible path holds a manifest")
+	assert.True(t, bytes.HasPrefix(raw, manifestPrefix))
+
+	info, err := c.GetFileInfo(ctx, "video/v2.bin")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(v2)), info.Size)
+
+	root, err := c.ListDirectory(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, root, 1, "the chunk directory is hidden")
+	assert.Equal(t, "video", root[0].Name)
+	files, err := c.ListDirectory(ctx, "video")
+	require.NoError(t, err)
+	sizes := map[string]int64{}
+	for _, f := range files {
+		sizes[f.Name] = f.Size
+	}
+	assert.Equal(t, map[string]int64{"v1.bin": int64(len(v1)), "v2.bin": int64(len(v2)), "v1-copy.bin": int64(len(v1))}, sizes)
+
+	require.NoError(t, c.WriteFile(ctx, "empty", bytes.NewReader(nil)))
+	assert.Empty(t, testutil.MustReadFile(t, c, "empty"))
+
+	require.NoError(t, l.WriteFile(ctx, "plain.txt", bytes.NewReader([]byte("written before"))))
+	assert.Equal(t, []byte("written before"), testutil.MustReadFile(t, c, "plain.txt"), "ordinary files pass through")
+	info, err = c.GetFileInfo(ctx, "plain.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(14), info.Size)
+}
+
+// atomicCounter counts atomic writes, failing them with
+// client.ErrNotSupported when unsupported is set.
+type atomicCounter struct {
+	*local.Client
+	unsupported bool
+	calls       int
+}
+
+func (a *atomicCounter) WriteFileAtomic(ctx context.Context, path string, data io.Reader) error {
+	a.calls++
+	if a.unsupported {
+		return fmt.Errorf("atomic write %s: %w", path, client.ErrNotSupported)
+	}
+	return a.Client.WriteFileAtomic(ctx, path, data)
+}
+
+func TestClient_AtomicChunks(t *testing.T) {
+	ctx := context.Background()
+	data := testutil.Random(8, 20<<10)
+	for _, unsupported := range []bool{false, true} {
+		l, dir := testutil.NewLocal(t)
+		ac := &atomicCounter{Client: l, unsupported: unsupported}
+		c := New(ac, small)
+		require.NoError(t, c.WriteFile(ctx, "f.bin", bytes.NewReader(data)))
+		assert.Equal(t, chunkCount(t, dir), ac.calls, "every chunk is written atomically first")
+		assert.Equal(t, data, testutil.MustReadFile(t, c, "f.bin"), "unsupported=%v", unsupported)
+	}
+}
+
+func TestClient_OpenSeekable(t *testing.T) {
+	l, _ := testutil.NewLocal(t)
+	c := New(l, small)
+	ctx := context.Background()
+	data := testutil.Random(3, 64<<10)
+	require.NoError(t, c.WriteFile(ctx, "f.bin", bytes.NewReader(data)))
+
+	r, err := c.OpenSeekable(ctx, "f.bin")
+	require.NoError(t, err)
+	defer r.Close()
+	rng := rand.New(rand.NewSource(4))
+	for i := 0; i < 50; i++ {
+		off := rng.Int63n(int64(len(data)))
+		n := rng.Intn(8000)
+		_, err := r.Seek(off, io.SeekStart)
+		require.NoError(t, err)
+		buf := make([]byte, n)
+		got, err := io.ReadFull(r, buf)
+		if int(off)+n > len(data) {
+			assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		} else {
+			require.NoError(t, err)
+		}
+		assert.Equal(t, data[off:int(off)+got], buf[:got])
+	}
+	end, err := r.Seek(-10, io.SeekEnd)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)-10), end)
+	tail, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, data[len(data)-10:], tail)
+	_, err = r.Seek(-1, io.SeekStart)
+	assert.Error(t, err)
+
+	require.NoError(t, l.WriteFile(ctx, "plain.txt", bytes.NewReader([]byte("plain"))))
+	pr, err := c.OpenSeekable(ctx, "plain.txt")
+	require.NoError(t, err)
+	defer pr.Close()
+	_, err = pr.Seek(2, io.SeekStart)
+	require.NoError(t, err)
+	rest, err := io.ReadAll(pr)
+	require.NoError(t, err)
+	assert.Equal(t, "ain", string(rest))
+}
+
+func TestClient_Corrupt(t *testing.T) {
+	l, dir := testutil.NewLocal(t)
+	c := New(l, small)
+	ctx := context.Background()
+	require.NoError(t, c.WriteFile(ctx, "f.bin", bytes.NewReader(testutil.Random(5, 8<<10))))
+
+	err := filepath.WalkDir(filepath.Join(dir, ".chunks"), func(p string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			data, rerr := os.ReadFile(p)
+			require.NoError(t, rerr)
+			data[0] ^= 0xff
+			require.NoError(t, os.WriteFile(p, data, 0644))
+			return filepath.SkipAll
+		}
+		return err
+	})
+	require.NoError(t, err)
+
+	rc, err := c.ReadFile(ctx, "f.bin")
+	require.NoError(t, err)
+	defer rc.Close()
+	_, err = io.ReadAll(rc)
+	assert.ErrorIs(t, err, ErrCorrupt)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken"), append(append([]byte(nil), manifestPrefix...), "12,garbage"...), 0644))
+	_, err = c.ReadFile(ctx, "broken")
+	assert.ErrorIs(t, err, ErrCorrupt)
+	_, err = c.GC(ctx)
+	assert.ErrorIs(t, err, ErrCorrupt, "an unreadable manifest stops the collection")
+	assert.Positive(t, chunkCount(t, dir))
+	require.NoError(t, os.Remove(filepath.Join(dir, "broken")))
+
+	hash := strings.Repeat("a", 64)
+	for name, manifest := range map[string]string{
+		"no-chunks":      `10,"chunks":[]}`,
+		"short-chunks":   `10,"chunks":[{"hash":"` + hash + `","size":4}]}`,
+		"negative-chunk": `0,"chunks":[{"hash":"` + hash + `","size":-4},{"hash":"` + hash + `","size":4}]}`,
+	} {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(p, append(append([]byte(nil), manifestPrefix...), manifest...), 0644))
+		_, err = c.ReadFile(ctx, name)
+		assert.ErrorIs(t, err, ErrCorrupt, name)
+		_, err = c.OpenSeekable(ctx, name)
+		assert.ErrorIs(t, err, ErrCorrupt, name)
+		require.NoError(t, os.Remove(p))
+	}
+}
+
+func TestClient_GC(t *testing.T) {
+	l, dir := testutil.NewLocal(t)
+	c := New(l, small)
+	ctx := context.Background()
+	a := testutil.Random(6, 40<<10)
+	b := testutil.Random(7, 40<<10)
+	require.NoError(t, c.WriteFile(ctx, "a.bin", bytes.NewReader(a)))
+	require.NoError(t, c.WriteFile(ctx, "sub/b.bin", bytes.NewReader(b)))
+	require.NoError(t, c.CopyFile(ctx, "a.bin", "sub/a-copy.bin"))
+	total := chunkCount(t, dir)
+
+	report, err := c.GC(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &GCReport{Manifests: 3, Chunks: total}, report, "nothing is collected while referenced")
+
+	require.NoError(t, c.DeleteFile(ctx, "a.bin"))
+	report, err = c.GC(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, report.Removed, "the copy still references a's chunks")
+
+	require.NoError(t, c.DeleteFile(ctx, "sub/a-copy.bin"))
+	report, err = c.GC(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Manifests)
+	assert.Positive(t, report.Removed)
+	assert.Equal(t, int64(len(a)), report.Freed)
+	assert.Equal(t, total-report.Removed, chunkCount(t, dir))
+	assert.Equal(t, b, testutil.MustReadFile(t, c, "sub/b.bin"))
+
+	empty, _ := testutil.NewLocal(t)
+	report, err = New(empty, small).GC(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &GCReport{}, report)
+}
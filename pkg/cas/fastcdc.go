@@ -0,0 +1,130 @@
+package cas
+
+import (
+	"io"
+	"math/bits"
+)
+
+// gear is the FastCDC gear table. It is derived from a fixed seed so that
+// the same content is cut at the same boundaries by every build; changing
+// it would not corrupt stored files but would stop new writes from
+// sharing chunks with old ones.
+var gear = func() [256]uint64 {
+	var t [256]uint64
+	state := uint64(0x6a09e667f3bcc908)
+	for i := range t {
+		// splitmix64
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		t[i] = z ^ (z >> 31)
+	}
+	return t
+}()
+
+// chunker splits a stream into content-defined chunks with FastCDC's
+// normalized chunking: below the average size a boundary needs two more
+// matching fingerprint bits, above it two fewer, which keeps most chunks
+// close to the average.
+type chunker struct {
+	r                 io.Reader
+	min, avg, max     int
+	maskSmall, maskLg uint64
+	buf               []byte
+	start, end        int
+	eof               bool
+}
+
+// newChunker returns a chunker over r. The sizes must satisfy
+// 0 < min <= avg <= max, with avg a power of two.
+func newChunker(r io.Reader, min, avg, max int) *chunker {
+	b := bits.Len(uint(avg)) - 1
+	return &chunker{
+		r:         r,
+		min:       min,
+		avg:       avg,
+		max:       max,
+		maskSmall: mask(b + 2),
+		maskLg:    mask(b - 2),
+		buf:       make([]byte, 2*max),
+	}
+}
+
+// mask returns n one bits at the top of a word, where the gear
+// fingerprint carries the longest history.
+func mask(n int) uint64 {
+	if n <= 0 {
+		return 0
+	}
+	if n >= 64 {
+		return ^uint64(0)
+	}
+	return ((uint64(1) << n) - 1) << (64 - n)
+}
+
+// next returns the next chunk, or io.EOF after the last one. The slice is
+// only valid until the following call.
+func (c *chunker) next() ([]byte, error) {
+	if err := c.fill(); err != nil {
+		return nil, err
+	}
+	if c.start == c.end {
+		return nil, io.EOF
+	}
+	n := c.cut(c.buf[c.start:c.end])
+	chunk := c.buf[c.start : c.start+n]
+	c.start += n
+	return chunk, nil
+}
+
+// fill tops the buffer up to max bytes unless the reader is exhausted.
+func (c *chunker) fill() error {
+	if c.end-c.start >= c.max || c.eof {
+		return nil
+	}
+	if c.start > 0 {
+		c.end = copy(c.buf, c.buf[c.start:c.end])
+		c.start = 0
+	}
+	for c.end < c.max && !c.eof {
+		n, err := c.r.Read(c.buf[c.end:])
+		c.end += n
+		if err == io.EOF {
+			c.eof = true
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cut returns the length of the first chunk of data.
+func (c *chunker) cut(data []byte) int {
+	n := len(data)
+	if n <= c.min {
+		return n
+	}
+	if n > c.max {
+		n = c.max
+	}
+	normal := c.avg
+	if n < normal {
+		normal = n
+	}
+	var fp uint64
+	i := c.min
+	for ; i < normal; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&c.maskSmall == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&c.maskLg == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
@@ -0,0 +1,122 @@
+package cas
+
+import (
+	"context"
+	"fmt"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// GCReport summarises a garbage collection.
+type GCReport struct {
+	// Manifests counts the manifests found outside the chunk directory.
+	Manifests int `json:"manifests"`
+	// Chunks counts the chunks found; Removed of them were unreferenced
+	// and deleted, freeing Freed bytes.
+	Chunks  int   `json:"chunks"`
+	Removed int   `json:"removed"`
+	Freed   int64 `json:"freed"`
+}
+
+// GC deletes the chunks no manifest references. Every file on the wrapped
+// client outside the chunk directory is checked, so manifests must not be
+// stored elsewhere. Writes through this Client wait for GC to finish;
+// writers using another Client on the same storage must be stopped first,
+// or their new chunks may be collected before their manifest is written. A
+// manifest that cannot be decoded aborts the collection before anything is
+// deleted.
+func (c *Client) GC(ctx context.Context) (*GCReport, error) {
+	c.gc.Lock()
+	defer c.gc.Unlock()
+
+	report := &GCReport{}
+	live := make(map[string]bool)
+	if err := c.mark(ctx, "", live, report); err != nil {
+		return nil, err
+	}
+
+	exists, err := c.Client.FileExists(ctx, c.opts.ChunkDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check chunk directory %s: %w", c.opts.ChunkDir, err)
+	}
+	if !exists {
+		return report, nil
+	}
+	fanout, err := c.Client.ListDirectory(ctx, c.opts.ChunkDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chunk directory %s: %w", c.opts.ChunkDir, err)
+	}
+	for _, d := range fanout {
+		if !d.IsDir {
+			continue
+		}
+		dir := client.JoinPath(c.opts.ChunkDir, d.Name)
+		chunks, err := c.Client.ListDirectory(ctx, dir)
+		if err != nil {
+			return report, fmt.Errorf("failed to list chunk directory %s: %w", dir, err)
+		}
+		for _, f := range chunks {
+			if f.IsDir {
+				continue
+			}
+			report.Chunks++
+			if live[f.Name] {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return report, err
+			}
+			if err := c.Client.DeleteFile(ctx, client.JoinPath(dir, f.Name)); err != nil {
+				return report, fmt.Errorf("failed to delete chunk %s: %w", f.Name, err)
+			}
+			report.Removed++
+			report.Freed += f.Size
+		}
+	}
+	return report, nil
+}
+
+// mark records the chunks referenced by the manifests below dir.
+func (c *Client) mark(ctx context.Context, dir string, live map[string]bool, report *GCReport) error {
+	var subdirs []string
+	for f, err := range client.StreamDirectory(ctx, c.Client, dir) {
+		if err != nil {
+			return fmt.Errorf("failed to list %s: %w", dir, err)
+		}
+		if f.Name == "" || f.Name == "." || f.Name == ".." || f.LinkType == client.LinkSymlink {
+			continue
+		}
+		p := client.JoinPath(dir, f.Name)
+		if p == c.opts.ChunkDir {
+			continue
+		}
+		if f.IsDir {
+			subdirs = append(subdirs, p)
+			continue
+		}
+		if f.Size < int64(len(manifestPrefix)) {
+			continue
+		}
+		m, raw, err := c.open(ctx, p)
+		if err != nil {
+			return err
+		}
+		if m == nil {
+			raw.Close()
+			continue
+		}
+		report.Manifests++
+		for _, ch := range m.Chunks {
+			live[ch.Hash] = true
+		}
+	}
+	for _, sub := range subdirs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := c.mark(ctx, sub, live, report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
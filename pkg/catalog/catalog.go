@@ -0,0 +1,309 @@
+// Package catalog loads sets of storage configurations from JSON, YAML or
+// .properties files, validates them, and keeps the clients built from them
+// up to date when the file changes.
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// Change describes the difference between two catalog generations by
+// storage ID.
+type Change struct {
+	Added   []string
+	Updated []string
+	Removed []string
+}
+
+// Empty returns true if the change does not add, update or remove anything.
+func (ch *Change) Empty() bool {
+	return len(ch.Added) == 0 && len(ch.Updated) == 0 && len(ch.Removed) == 0
+}
+
+// Catalog holds the enabled storages of a catalog file and lazily creates
+// one client per storage through a client.Factory.
+type Catalog struct {
+	factory client.Factory
+
+	mu      sync.RWMutex
+	path    string
+	stamp   fileStamp
+	order   []string
+	configs map[string]*client.StorageConfig
+	clients map[string]client.Client
+}
+
+// fileStamp identifies a version of the catalog file for change detection.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// New creates an empty catalog whose clients are created by factory.
+func New(factory client.Factory) *Catalog {
+	return &Catalog{
+		factory: factory,
+		configs: make(map[string]*client.StorageConfig),
+		clients: make(map[string]client.Client),
+	}
+}
+
+// Validate checks that every entry has a unique ID, a protocol supported by
+// factory and, if named, a unique name.
+func Validate(configs []*client.StorageConfig, factory client.Factory) error {
+	supported := make(map[string]bool)
+	for _, p := range factory.SupportedProtocols() {
+		supported[p] = true
+	}
+	ids := make(map[string]bool)
+	names := make(map[string]bool)
+	for i, cfg := range configs {
+		if cfg == nil {
+			return fmt.Errorf("storage %d: empty entry", i)
+		}
+		if cfg.ID == "" {
+			return fmt.Errorf("storage %d: id is required", i)
+		}
+		if ids[cfg.ID] {
+			return fmt.Errorf("storage %s: duplicate id", cfg.ID)
+		}
+		ids[cfg.ID] = true
+		if cfg.Name != "" {
+			if names[cfg.Name] {
+				return fmt.Errorf("storage %s: duplicate name %s", cfg.ID, cfg.Name)
+			}
+			names[cfg.Name] = true
+		}
+		if cfg.Protocol == "" {
+			return fmt.Errorf("storage %s: protocol is required", cfg.ID)
+		}
+		if !supported[cfg.Protocol] {
+			return fmt.Errorf("storage %s: unsupported protocol: %s", cfg.ID, cfg.Protocol)
+		}
+	}
+	return nil
+}
+
+// Load reads the catalog file at path and applies it. The path is
+// remembered for Reload and Watch.
+func (c *Catalog) Load(ctx context.Context, path string) (*Change, error) {
+	stamp, err := statFile(path)
+	if err != nil {
+		return nil, err
+	}
+	configs, err := LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	change, err := c.Apply(ctx, configs)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.path = path
+	c.stamp = stamp
+	c.mu.Unlock()
+	return change, nil
+}
+
+// Reload re-reads the file passed to Load and applies it.
+func (c *Catalog) Reload(ctx context.Context) (*Change, error) {
+	c.mu.RLock()
+	path := c.path
+	c.mu.RUnlock()
+	if path == "" {
+		return nil, fmt.Errorf("catalog was not loaded from a file")
+	}
+	return c.Load(ctx, path)
+}
+
+// Apply replaces the catalog contents with the enabled entries of configs.
+// Disabled entries are skipped before validation. Clients of unchanged
+// storages are kept; clients of updated and removed storages are
+// disconnected and dropped so the next Client call rebuilds them. If
+// validation fails the catalog is left unchanged.
+func (c *Catalog) Apply(ctx context.Context, configs []*client.StorageConfig) (*Change, error) {
+	var enabled []*client.StorageConfig
+	for _, cfg := range configs {
+		if cfg != nil && !cfg.Enabled {
+			continue
+		}
+		enabled = append(enabled, cfg)
+	}
+	if err := Validate(enabled, c.factory); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	change := &Change{}
+	next := make(map[string]*client.StorageConfig, len(enabled))
+	order := make([]string, 0, len(enabled))
+	var stale []client.Client
+	for _, cfg := range enabled {
+		next[cfg.ID] = cfg
+		order = append(order, cfg.ID)
+		prev, ok := c.configs[cfg.ID]
+		switch {
+		case !ok:
+			change.Added = append(change.Added, cfg.ID)
+		case !reflect.DeepEqual(prev, cfg):
+			change.Updated = append(change.Updated, cfg.ID)
+			if cl, ok := c.clients[cfg.ID]; ok {
+				stale = append(stale, cl)
+				delete(c.clients, cfg.ID)
+			}
+		}
+	}
+	for _, id := range c.order {
+		if _, ok := next[id]; ok {
+			continue
+		}
+		change.Removed = append(change.Removed, id)
+		if cl, ok := c.clients[id]; ok {
+			stale = append(stale, cl)
+			delete(c.clients, id)
+		}
+	}
+	c.configs = next
+	c.order = order
+	c.mu.Unlock()
+
+	for _, cl := range stale {
+		if cl.IsConnected() {
+			_ = cl.Disconnect(ctx)
+		}
+	}
+	return change, nil
+}
+
+// Get returns the storage configuration with the given ID.
+func (c *Catalog) Get(id string) (*client.StorageConfig, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	cfg, ok := c.configs[id]
+	return cfg, ok
+}
+
+// GetByName returns the storage configuration with the given name.
+func (c *Catalog) GetByName(name string) (*client.StorageConfig, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, id := range c.order {
+		if cfg := c.configs[id]; cfg.Name == name {
+			return cfg, true
+		}
+	}
+	return nil, false
+}
+
+// List returns the enabled storage configurations in file order.
+func (c *Catalog) List() []*client.StorageConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	configs := make([]*client.StorageConfig, 0, len(c.order))
+	for _, id := range c.order {
+		configs = append(configs, c.configs[id])
+	}
+	return configs
+}
+
+// Client returns the client for the storage with the given ID, creating it
+// through the factory on first use. The client is not connected.
+func (c *Catalog) Client(id string) (client.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cl, ok := c.clients[id]; ok {
+		return cl, nil
+	}
+	cfg, ok := c.configs[id]
+	if !ok {
+		return nil, fmt.Errorf("storage %s not found in catalog", id)
+	}
+	cl, err := c.factory.CreateClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client for storage %s: %w", id, err)
+	}
+	c.clients[id] = cl
+	return cl, nil
+}
+
+// Watch polls the catalog file every interval and reloads it when its size
+// or modification time changes. onChange, if non-nil, is called with every
+// non-empty change and with every reload error; a failed reload keeps the
+// previous catalog. Watch blocks until ctx is cancelled.
+func (c *Catalog) Watch(ctx context.Context, interval time.Duration, onChange func(*Change, error)) error {
+	c.mu.RLock()
+	path := c.path
+	c.mu.RUnlock()
+	if path == "" {
+		return fmt.Errorf("catalog was not loaded from a file")
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		stamp, err := statFile(path)
+		c.mu.RLock()
+		unchanged := err == nil && stamp == c.stamp
+		c.mu.RUnlock()
+		if unchanged {
+			continue
+		}
+
+		var change *Change
+		if err == nil {
+			change, err = c.Load(ctx, path)
+		}
+		if onChange == nil {
+			continue
+		}
+		if err != nil {
+			onChange(nil, err)
+		} else if !change.Empty() {
+			onChange(change, nil)
+		}
+	}
+}
+
+// Close disconnects every client created by the catalog.
+func (c *Catalog) Close(ctx context.Context) error {
+	c.mu.Lock()
+	clients := c.clients
+	c.clients = make(map[string]client.Client)
+	c.mu.Unlock()
+
+	var errs []error
+	for id, cl := range clients {
+		if !cl.IsConnected() {
+			continue
+		}
+		if err := cl.Disconnect(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("storage %s: %w", id, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("errors closing catalog clients: %v", errs)
+	}
+	return nil
+}
+
+func statFile(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, fmt.Errorf("failed to stat catalog file %s: %w", path, err)
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
@@ -0,0 +1,323 @@
+package catalog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"digital.vasic.filesystem/pkg/client"
+	"digital.vasic.filesystem/pkg/factory"
+)
+
+const jsonCatalog = `{
+  "storages": [
+    {"id": "media", "name": "Media", "protocol": "local", "enabled": true,
+     "settings": {"base_path": "/data/media"}},
+    {"id": "backup", "name": "Backup", "protocol": "webdav", "enabled": true,
+     "settings": {"url": "http://dav.local", "port": 8080}},
+    {"id": "old", "name": "Old", "protocol": "ftp", "enabled": false,
+     "settings": {"host": "ftp.local"}}
+  ]
+}`
+
+const yamlCatalog = `
+storages:
+  - id: media
+    name: Media
+    protocol: local
+    enabled: true
+    max_depth: 5
+    settings:
+      base_path: /data/media
+  - id: nas
+    name: NAS
+    protocol: smb
+    enabled: true
+    settings:
+      host: nas.local
+      port: 445
+      password: env:SMB_PASS
+`
+
+const propertiesCatalog = `
+# Storages
+PROJECT_NAME=Filesystem
+storage.media.name=Media
+storage.media.protocol=local
+storage.media.enabled=true
+storage.media.max_depth=3
+storage.media.settings.base_path=/data/media
+storage.ftp.name=FTP
+storage.ftp.protocol=ftp
+storage.ftp.enabled=false
+storage.ftp.settings.port=2121
+`
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestParse_JSON(t *testing.T) {
+	configs, err := Parse([]byte(jsonCatalog), FormatJSON)
+	require.NoError(t, err)
+	require.Len(t, configs, 3)
+	assert.Equal(t, "media", configs[0].ID)
+	assert.Equal(t, "/data/media", configs[0].Settings["base_path"])
+	assert.Equal(t, float64(8080), configs[1].Settings["port"])
+	assert.False(t, configs[2].Enabled)
+}
+
+func TestParse_JSONArray(t *testing.T) {
+	configs, err := Parse([]byte(`[{"id": "a", "protocol": "local", "enabled": true}]`), FormatJSON)
+	require.NoError(t, err)
+	require.Len(t, configs, 1)
+	assert.Equal(t, "a", configs[0].ID)
+}
+
+func TestParse_YAML(t *testing.T) {
+	configs, err := Parse([]byte(yamlCatalog), FormatYAML)
+	require.NoError(t, err)
+	require.Len(t, configs, 2)
+	assert.Equal(t, 5, configs[0].MaxDepth)
+	assert.Equal(t, "smb", configs[1].Protocol)
+	assert.Equal(t, 445, factory.GetIntSetting(configs[1].Settings, "port", 0))
+	assert.Equal(t, "env:SMB_PASS", configs[1].Settings["password"])
+}
+
+func TestParse_Properties(t *testing.T) {
+	configs, err := Parse([]byte(propertiesCatalog), FormatProperties)
+	require.NoError(t, err)
+	require.Len(t, configs, 2)
+
+	assert.Equal(t, "ftp", configs[0].ID)
+	assert.False(t, configs[0].Enabled)
+	assert.Equal(t, 2121, factory.GetIntSetting(configs[0].Settings, "port", 21))
+
+	assert.Equal(t, "media", configs[1].ID)
+	assert.Equal(t, "Media", configs[1].Name)
+	assert.True(t, configs[1].Enabled)
+	assert.Equal(t, 3, configs[1].MaxDepth)
+	assert.Equal(t, "/data/media", configs[1].Settings["base_path"])
+}
+
+func TestParse_PropertiesErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"missing separator", "storage.a.protocol"},
+		{"unknown field", "storage.a.colour=blue"},
+		{"bad enabled", "storage.a.enabled=maybe"},
+		{"bad max depth", "storage.a.max_depth=deep"},
+		{"missing field", "storage.a=local"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.input), FormatProperties)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestFormatFromPath(t *testing.T) {
+	for path, expected := range map[string]Format{
+		"a.json":       FormatJSON,
+		"a.YAML":       FormatYAML,
+		"a.yml":        FormatYAML,
+		"a.properties": FormatProperties,
+	} {
+		format, err := FormatFromPath(path)
+		require.NoError(t, err)
+		assert.Equal(t, expected, format)
+	}
+	_, err := FormatFromPath("a.toml")
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	f := factory.NewDefaultFactory()
+	tests := []struct {
+		name    string
+		configs []*client.StorageConfig
+		errMsg  string
+	}{
+		{"missing id", []*client.StorageConfig{{Protocol: "local"}}, "id is required"},
+		{"duplicate id", []*client.StorageConfig{{ID: "a", Protocol: "local"}, {ID: "a", Protocol: "ftp"}}, "duplicate id"},
+		{"duplicate name", []*client.StorageConfig{{ID: "a", Name: "x", Protocol: "local"}, {ID: "b", Name: "x", Protocol: "ftp"}}, "duplicate name"},
+		{"missing protocol", []*client.StorageConfig{{ID: "a"}}, "protocol is required"},
+		{"unsupported protocol", []*client.StorageConfig{{ID: "a", Protocol: "gopher"}}, "unsupported protocol"},
+		{"nil entry", []*client.StorageConfig{nil}, "empty entry"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.configs, f)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errMsg)
+		})
+	}
+	assert.NoError(t, Validate([]*client.StorageConfig{{ID: "a", Protocol: "local"}}, f))
+}
+
+func TestCatalog_Load_SkipsDisabled(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "storages.json", jsonCatalog)
+	cat := New(factory.NewDefaultFactory())
+
+	change, err := cat.Load(context.Background(), path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"media", "backup"}, change.Added)
+
+	list := cat.List()
+	require.Len(t, list, 2)
+	assert.Equal(t, "media", list[0].ID)
+
+	_, ok := cat.Get("old")
+	assert.False(t, ok)
+
+	cfg, ok := cat.GetByName("Backup")
+	require.True(t, ok)
+	assert.Equal(t, "backup", cfg.ID)
+
+	_, ok = cat.GetByName("Missing")
+	assert.False(t, ok)
+}
+
+func TestCatalog_Load_InvalidKeepsPrevious(t *testing.T) {
+	dir := t.TempDir()
+	cat := New(factory.NewDefaultFactory())
+	_, err := cat.Load(context.Background(), writeFile(t, dir, "good.json", jsonCatalog))
+	require.NoError(t, err)
+
+	_, err = cat.Load(context.Background(), writeFile(t, dir, "bad.json", `[{"id": "x", "protocol": "gopher", "enabled": true}]`))
+	assert.Error(t, err)
+	assert.Len(t, cat.List(), 2)
+}
+
+func TestCatalog_Client_CachedAndRebuiltOnChange(t *testing.T) {
+	dir := t.TempDir()
+	cat := New(factory.NewDefaultFactory())
+	ctx := context.Background()
+
+	_, err := cat.Apply(ctx, []*client.StorageConfig{
+		{ID: "a", Protocol: "local", Enabled: true, Settings: map[string]interface{}{"base_path": dir}},
+		{ID: "b", Protocol: "local", Enabled: true, Settings: map[string]interface{}{"base_path": dir}},
+	})
+	require.NoError(t, err)
+
+	a1, err := cat.Client("a")
+	require.NoError(t, err)
+	require.NoError(t, a1.Connect(ctx))
+	b1, err := cat.Client("b")
+	require.NoError(t, err)
+	require.NoError(t, b1.Connect(ctx))
+
+	a2, err := cat.Client("a")
+	require.NoError(t, err)
+	assert.Same(t, a1, a2)
+
+	change, err := cat.Apply(ctx, []*client.StorageConfig{
+		{ID: "a", Protocol: "local", Enabled: true, Settings: map[string]interface{}{"base_path": dir}},
+		{ID: "b", Protocol: "local", Enabled: true, Settings: map[string]interface{}{"base_path": t.TempDir()}},
+		{ID: "c", Protocol: "local", Enabled: true, Settings: map[string]interface{}{"base_path": dir}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c"}, change.Added)
+	assert.Equal(t, []string{"b"}, change.Updated)
+	assert.Empty(t, change.Removed)
+
+	a3, err := cat.Client("a")
+	require.NoError(t, err)
+	assert.Same(t, a1, a3, "unchanged storage keeps its client")
+	assert.True(t, a1.IsConnected())
+
+	b2, err := cat.Client("b")
+	require.NoError(t, err)
+	assert.NotSame(t, b1, b2, "updated storage gets a new client")
+	assert.False(t, b1.IsConnected(), "replaced client is disconnected")
+
+	change, err = cat.Apply(ctx, nil)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, change.Removed)
+	assert.False(t, a1.IsConnected())
+
+	_, err = cat.Client("a")
+	assert.Error(t, err)
+}
+
+func TestCatalog_Reload_NotLoaded(t *testing.T) {
+	cat := New(factory.NewDefaultFactory())
+	_, err := cat.Reload(context.Background())
+	assert.Error(t, err)
+	assert.Error(t, cat.Watch(context.Background(), time.Millisecond, nil))
+}
+
+func TestCatalog_Watch_HotReload(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "storages.yaml", yamlCatalog)
+	cat := New(factory.NewDefaultFactory())
+	_, err := cat.Load(context.Background(), path)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var changes []*Change
+	done := make(chan error, 1)
+	go func() {
+		done <- cat.Watch(ctx, 10*time.Millisecond, func(ch *Change, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				changes = append(changes, ch)
+			}
+		})
+	}()
+
+	updated := yamlCatalog + `  - id: extra
+    protocol: local
+    enabled: true
+`
+	require.NoError(t, os.WriteFile(path, []byte(updated), 0644))
+	future := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(path, future, future))
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(changes) > 0
+	}, 2*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	assert.Equal(t, []string{"extra"}, changes[0].Added)
+	mu.Unlock()
+	_, ok := cat.Get("extra")
+	assert.True(t, ok)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestCatalog_Close(t *testing.T) {
+	dir := t.TempDir()
+	cat := New(factory.NewDefaultFactory())
+	ctx := context.Background()
+	_, err := cat.Apply(ctx, []*client.StorageConfig{
+		{ID: "a", Protocol: "local", Enabled: true, Settings: map[string]interface{}{"base_path": dir}},
+	})
+	require.NoError(t, err)
+	c, err := cat.Client("a")
+	require.NoError(t, err)
+	require.NoError(t, c.Connect(ctx))
+
+	require.NoError(t, cat.Close(ctx))
+	assert.False(t, c.IsConnected())
+}
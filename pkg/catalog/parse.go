@@ -0,0 +1,203 @@
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// Format identifies the encoding of a catalog file.
+type Format string
+
+// Supported catalog file formats.
+const (
+	FormatJSON       Format = "json"
+	FormatYAML       Format = "yaml"
+	FormatProperties Format = "properties"
+)
+
+// FormatFromPath returns the catalog format implied by the file extension.
+func FormatFromPath(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON, nil
+	case ".yaml", ".yml":
+		return FormatYAML, nil
+	case ".properties":
+		return FormatProperties, nil
+	default:
+		return "", fmt.Errorf("unsupported catalog file extension: %s", path)
+	}
+}
+
+// LoadFile reads and parses every storage entry in the catalog file at path,
+// including disabled ones.
+func LoadFile(path string) ([]*client.StorageConfig, error) {
+	format, err := FormatFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalog file %s: %w", path, err)
+	}
+	configs, err := Parse(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse catalog file %s: %w", path, err)
+	}
+	return configs, nil
+}
+
+// Parse decodes storage entries from data.
+//
+// JSON and YAML documents are either a list of entries or an object with a
+// "storages" list. Entries use the StorageConfig JSON field names.
+//
+// Properties documents use one key per field:
+//
+//	storage.<id>.name=Media NAS
+//	storage.<id>.protocol=smb
+//	storage.<id>.enabled=true
+//	storage.<id>.max_depth=10
+//	storage.<id>.settings.host=nas.local
+//
+// Setting values from properties files are kept as strings; the factory's
+// setting helpers convert them as needed.
+func Parse(data []byte, format Format) ([]*client.StorageConfig, error) {
+	switch format {
+	case FormatJSON:
+		return parseJSON(data)
+	case FormatYAML:
+		return parseYAML(data)
+	case FormatProperties:
+		return parseProperties(data)
+	default:
+		return nil, fmt.Errorf("unsupported catalog format: %s", format)
+	}
+}
+
+// document is the object form of a JSON or YAML catalog.
+type document struct {
+	Storages []*client.StorageConfig `json:"storages"`
+}
+
+func parseJSON(data []byte) ([]*client.StorageConfig, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var configs []*client.StorageConfig
+		if err := json.Unmarshal(data, &configs); err != nil {
+			return nil, err
+		}
+		return configs, nil
+	}
+	var doc document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc.Storages, nil
+}
+
+// parseYAML decodes the document generically and re-encodes it as JSON so
+// that entries are mapped with the same field names as JSON catalogs.
+func parseYAML(data []byte) ([]*client.StorageConfig, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, nil
+	}
+	jsonData, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	return parseJSON(jsonData)
+}
+
+func parseProperties(data []byte) ([]*client.StorageConfig, error) {
+	byID := make(map[string]*client.StorageConfig)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+		sep := strings.IndexAny(line, "=:")
+		if sep == -1 {
+			return nil, fmt.Errorf("line %d: missing '=' separator", lineNo)
+		}
+		key := strings.TrimSpace(line[:sep])
+		value := strings.TrimSpace(line[sep+1:])
+
+		rest, ok := strings.CutPrefix(key, "storage.")
+		if !ok {
+			continue
+		}
+		id, field, ok := strings.Cut(rest, ".")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("line %d: malformed key %s", lineNo, key)
+		}
+		cfg, ok := byID[id]
+		if !ok {
+			cfg = &client.StorageConfig{ID: id, Settings: make(map[string]interface{})}
+			byID[id] = cfg
+		}
+		if err := setPropertyField(cfg, field, value); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(byID))
+	for id := range byID {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	configs := make([]*client.StorageConfig, 0, len(ids))
+	for _, id := range ids {
+		configs = append(configs, byID[id])
+	}
+	return configs, nil
+}
+
+func setPropertyField(cfg *client.StorageConfig, field, value string) error {
+	if name, ok := strings.CutPrefix(field, "settings."); ok {
+		cfg.Settings[name] = value
+		return nil
+	}
+	switch field {
+	case "name":
+		cfg.Name = value
+	case "protocol":
+		cfg.Protocol = value
+	case "enabled":
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid enabled value %q: %w", value, err)
+		}
+		cfg.Enabled = enabled
+	case "max_depth":
+		depth, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid max_depth value %q: %w", value, err)
+		}
+		cfg.MaxDepth = depth
+	default:
+		return fmt.Errorf("unknown storage field %s", field)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+// Package checksum computes content digests of files on any client.Client,
+// preferring server-side digests from client.Hasher and streaming the file
+// otherwise, and verifies copies between clients.
+package checksum
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/cespare/xxhash/v2"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// ErrMismatch is returned by VerifyCopy when the copies differ.
+var ErrMismatch = errors.New("checksum mismatch")
+
+// preferred lists the algorithms tried against a client.Hasher when the
+// caller leaves the choice to Compare.
+var preferred = []client.HashAlgorithm{client.HashSHA256, client.HashSHA1, client.HashMD5}
+
+// New returns a hash.Hash for algo.
+func New(algo client.HashAlgorithm) (hash.Hash, error) {
+	switch algo {
+	case client.HashSHA256:
+		return sha256.New(), nil
+	case client.HashSHA1:
+		return sha1.New(), nil
+	case client.HashMD5:
+		return md5.New(), nil
+	case client.HashXXH64:
+		return xxhash.New(), nil
+	default:
+		return nil, fmt.Errorf("unknown hash algorithm %q", algo)
+	}
+}
+
+// SumReader returns the lowercase hex digest of everything read from r.
+func SumReader(r io.Reader, algo client.HashAlgorithm) (string, error) {
+	h, err := New(algo)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Sum returns the digest of path on c, asking the server first when c is a
+// client.Hasher and reading the file otherwise.
+func Sum(ctx context.Context, c client.Client, path string, algo client.HashAlgorithm) (string, error) {
+	if h, ok := c.(client.Hasher); ok {
+		sum, err := h.Hash(ctx, path, algo)
+		if err == nil {
+			return sum, nil
+		}
+		if !errors.Is(err, client.ErrNotSupported) {
+			return "", err
+		}
+	}
+	r, err := c.ReadFile(ctx, path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	defer r.Close()
+	sum, err := SumReader(r, algo)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return sum, nil
+}
+
+// Compare reports whether two files have the same digest. With an empty
+// algo it picks the first algorithm either server offers, so at most one
+// side is streamed, and falls back to SHA-256.
+func Compare(ctx context.Context, src client.Client, srcPath string, dst client.Client, dstPath string, algo client.HashAlgorithm) (bool, error) {
+	var srcSum, dstSum string
+	var err error
+	if algo == "" {
+		if algo, srcSum, err = serverSum(ctx, src, srcPath); err != nil {
+			return false, err
+		}
+		if algo == "" {
+			if algo, dstSum, err = serverSum(ctx, dst, dstPath); err != nil {
+				return false, err
+			}
+		}
+		if algo == "" {
+			algo = client.HashSHA256
+		}
+	}
+	if srcSum == "" {
+		if srcSum, err = Sum(ctx, src, srcPath, algo); err != nil {
+			return false, err
+		}
+	}
+	if dstSum == "" {
+		if dstSum, err = Sum(ctx, dst, dstPath, algo); err != nil {
+			return false, err
+		}
+	}
+	return srcSum == dstSum, nil
+}
+
+// VerifyCopy checks that dstPath on dst is an exact copy of srcPath on src:
+// sizes are compared first, then digests as in Compare. A difference is
+// reported as an error wrapping ErrMismatch.
+func VerifyCopy(ctx context.Context, src client.Client, srcPath string, dst client.Client, dstPath string, algo client.HashAlgorithm) error {
+	srcInfo, err := src.GetFileInfo(ctx, srcPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat source %s: %w", srcPath, err)
+	}
+	dstInfo, err := dst.GetFileInfo(ctx, dstPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat destination %s: %w", dstPath, err)
+	}
+	if srcInfo.Size != dstInfo.Size {
+		return fmt.Errorf("%w: %s is %d bytes, %s is %d bytes", ErrMismatch, srcPath, srcInfo.Size, dstPath, dstInfo.Size)
+	}
+	same, err := Compare(ctx, src, srcPath, dst, dstPath, algo)
+	if err != nil {
+		return err
+	}
+	if !same {
+		return fmt.Errorf("%w: %s and %s differ", ErrMismatch, srcPath, dstPath)
+	}
+	return nil
+}
+
+// serverSum asks c for the first preferred algorithm it can serve, with a
+// single request when c is a client.MultiHasher that supports it. It returns empty strings
+// when c computes no digests itself, and errors other than
+// client.ErrNotSupported.
+func serverSum(ctx context.Context, c client.Client, path string) (client.HashAlgorithm, string, error) {
+	if m, ok := c.(client.MultiHasher); ok {
+		sums, err := m.Hashes(ctx, path)
+		if err == nil {
+			for _, algo := range preferred {
+				if sum, ok := sums[algo]; ok {
+					return algo, sum, nil
+				}
+			}
+			return "", "", nil
+		}
+		if !errors.Is(err, client.ErrNotSupported) {
+			return "", "", fmt.Errorf("failed to get digests of %s: %w", path, err)
+		}
+	}
+	h, ok := c.(client.Hasher)
+	if !ok {
+		return "", "", nil
+	}
+	for _, algo := range preferred {
+		sum, err := h.Hash(ctx, path, algo)
+		if err == nil {
+			return algo, sum, nil
+		}
+		if !errors.Is(err, client.ErrNotSupported) {
+			return "", "", fmt.Errorf("failed to get %s digest of %s: %w", algo, path, err)
+		}
+	}
+	return "", "", nil
+}
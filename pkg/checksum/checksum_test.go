@@ -0,0 +1,182 @@
+package checksum
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"digital.vasic.filesystem/pkg/client"
+	"digital.vasic.filesystem/pkg/local"
+)
+
+// hashingClient serves digests from a fixed table and counts file reads.
+type hashingClient struct {
+	client.Client
+	sums  map[client.HashAlgorithm]string
+	reads int
+}
+
+func (h *hashingClient) Hash(ctx context.Context, path string, algo client.HashAlgorithm) (string, error) {
+	if sum, ok := h.sums[algo]; ok {
+		return sum, nil
+	}
+	return "", client.ErrNotSupported
+}
+
+func (h *hashingClient) ReadFile(ctx context.Context, path string) (io.ReadCloser, error) {
+	h.reads++
+	return h.Client.ReadFile(ctx, path)
+}
+
+func newLocal(t *testing.T, files map[string]string) *local.Client {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	c := local.NewLocalClient(&local.Config{BasePath: dir})
+	require.NoError(t, c.Connect(context.Background()))
+	return c
+}
+
+func TestSumReader(t *testing.T) {
+	cases := map[client.HashAlgorithm]string{
+		client.HashSHA256: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		client.HashSHA1:   "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3",
+		client.HashMD5:    "098f6bcd4621d373cade4e832627b4f6",
+		client.HashXXH64:  "4fdcca5ddb678139",
+	}
+	for algo, want := range cases {
+		sum, err := SumReader(strings.NewReader("test"), algo)
+		require.NoError(t, err, algo)
+		assert.Equal(t, want, sum, algo)
+	}
+
+	_, err := SumReader(strings.NewReader("test"), "crc64")
+	assert.Error(t, err)
+}
+
+func TestSum_Streaming(t *testing.T) {
+	c := newLocal(t, map[string]string{"a.txt": "test"})
+	sum, err := Sum(context.Background(), c, "a.txt", client.HashMD5)
+	require.NoError(t, err)
+	assert.Equal(t, "098f6bcd4621d373cade4e832627b4f6", sum)
+
+	_, err = Sum(context.Background(), c, "missing.txt", client.HashMD5)
+	assert.Error(t, err)
+}
+
+func TestSum_PrefersServer(t *testing.T) {
+	c := &hashingClient{
+		Client: newLocal(t, map[string]string{"a.txt": "test"}),
+		sums:   map[client.HashAlgorithm]string{client.HashSHA1: "server-sha1"},
+	}
+	sum, err := Sum(context.Background(), c, "a.txt", client.HashSHA1)
+	require.NoError(t, err)
+	assert.Equal(t, "server-sha1", sum)
+	assert.Zero(t, c.reads)
+
+	// Unsupported algorithms fall back to streaming.
+	sum, err = Sum(context.Background(), c, "a.txt", client.HashMD5)
+	require.NoError(t, err)
+	assert.Equal(t, "098f6bcd4621d373cade4e832627b4f6", sum)
+}
+
+func TestCompare_NegotiatesServerAlgorithm(t *testing.T) {
+	src := &hashingClient{
+		Client: newLocal(t, map[string]string{"a.txt": "test"}),
+		sums:   map[client.HashAlgorithm]string{client.HashSHA1: "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3"},
+	}
+	dst := newLocal(t, map[string]string{"b.txt": "test"})
+
+	same, err := Compare(context.Background(), src, "a.txt", dst, "b.txt", "")
+	require.NoError(t, err)
+	assert.True(t, same)
+	assert.Zero(t, src.reads, "source digest must come from the server")
+}
+
+// multiHashingClient serves all digests in one call and counts the calls.
+type multiHashingClient struct {
+	hashingClient
+	calls int
+	err   error
+}
+
+func (m *multiHashingClient) Hash(ctx context.Context, path string, algo client.HashAlgorithm) (string, error) {
+	m.calls++
+	return m.hashingClient.Hash(ctx, path, algo)
+}
+
+func (m *multiHashingClient) Hashes(ctx context.Context, path string) (map[client.HashAlgorithm]string, error) {
+	m.calls++
+	return m.sums, m.err
+}
+
+func TestCompare_MultiHasher(t *testing.T) {
+	src := &multiHashingClient{hashingClient: hashingClient{
+		Client: newLocal(t, map[string]string{"a.txt": "test"}),
+		sums:   map[client.HashAlgorithm]string{client.HashMD5: "098f6bcd4621d373cade4e832627b4f6"},
+	}}
+	dst := newLocal(t, map[string]string{"b.txt": "test"})
+	ctx := context.Background()
+
+	same, err := Compare(ctx, src, "a.txt", dst, "b.txt", "")
+	require.NoError(t, err)
+	assert.True(t, same)
+	assert.Equal(t, 1, src.calls, "all digests come from one request")
+	assert.Zero(t, src.reads)
+
+	src.err = errors.New("503 service unavailable")
+	_, err = Compare(ctx, src, "a.txt", dst, "b.txt", "")
+	assert.ErrorContains(t, err, "503")
+	assert.Zero(t, src.reads, "server errors are returned, not hidden by a download")
+
+	src.err = client.ErrNotSupported
+	src.calls = 0
+	same, err = Compare(ctx, src, "a.txt", dst, "b.txt", "")
+	require.NoError(t, err)
+	assert.True(t, same)
+	assert.Equal(t, 4, src.calls, "unsupported Hashes falls back to Hash per algorithm")
+}
+
+func TestCompare_HasherError(t *testing.T) {
+	src := &failingHasher{Client: newLocal(t, map[string]string{"a.txt": "test"})}
+	dst := newLocal(t, map[string]string{"b.txt": "test"})
+	_, err := Compare(context.Background(), src, "a.txt", dst, "b.txt", "")
+	assert.ErrorContains(t, err, "timeout")
+}
+
+// failingHasher fails every digest request with a server error.
+type failingHasher struct {
+	client.Client
+}
+
+func (f *failingHasher) Hash(ctx context.Context, path string, algo client.HashAlgorithm) (string, error) {
+	return "", errors.New("timeout")
+}
+
+func TestVerifyCopy(t *testing.T) {
+	src := newLocal(t, map[string]string{"a.txt": "hello", "b.txt": "hellO", "c.txt": "hi"})
+	dst := newLocal(t, map[string]string{"a.txt": "hello"})
+	ctx := context.Background()
+
+	require.NoError(t, VerifyCopy(ctx, src, "a.txt", dst, "a.txt", ""))
+	require.NoError(t, VerifyCopy(ctx, src, "a.txt", dst, "a.txt", client.HashXXH64))
+
+	err := VerifyCopy(ctx, src, "b.txt", dst, "a.txt", "")
+	assert.True(t, errors.Is(err, ErrMismatch))
+	err = VerifyCopy(ctx, src, "c.txt", dst, "a.txt", "")
+	assert.ErrorIs(t, err, ErrMismatch)
+	assert.Contains(t, err.Error(), "bytes")
+
+	err = VerifyCopy(ctx, src, "missing", dst, "a.txt", "")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrMismatch)
+}
@@ -0,0 +1,27 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"strings"
+)
+
+// AtomicWriter is an optional extension of Client for writes that readers
+// never observe half-done: data goes to a hidden temporary file in the
+// target directory, which is flushed and renamed over path. A failed or
+// cancelled write removes the temporary file and leaves path untouched.
+// Backends with an AtomicWrites config option use it for WriteFile too.
+type AtomicWriter interface {
+	WriteFileAtomic(ctx context.Context, path string, data io.Reader) error
+}
+
+// AtomicTempName returns a hidden, randomised temporary name in the same
+// directory as p, for writers that rename the result into place.
+func AtomicTempName(p string) string {
+	var b [6]byte
+	_, _ = rand.Read(b[:])
+	i := strings.LastIndexAny(p, `/\`)
+	return p[:i+1] + "." + p[i+1:] + ".tmp-" + hex.EncodeToString(b[:])
+}
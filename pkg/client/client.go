@@ -4,6 +4,7 @@ package client
 
 import (
 	"context"
+	"errors"
 	"io"
 	"os"
 	"time"
@@ -17,8 +18,30 @@ type FileInfo struct {
 	IsDir   bool
 	Mode    os.FileMode
 	Path    string
+	// LinkType tells whether the entry is a link. LinkTarget is a symlink's
+	// target as stored, not resolved.
+	LinkType   LinkType
+	LinkTarget string
+	// FileID identifies the underlying file where the backend can tell; it
+	// is set by GetFileInfo. Local and NFS report the device and inode, so
+	// equal non-empty IDs from any such clients on one host name the same
+	// file, whatever path reached it.
+	FileID string
 }
 
+// LinkType identifies the kind of link a FileInfo describes.
+type LinkType string
+
+// Link types reported in FileInfo.LinkType.
+const (
+	// LinkNone is a plain file or directory.
+	LinkNone LinkType = ""
+	// LinkSymlink is a symbolic link, or a symlink reparse point on SMB.
+	LinkSymlink LinkType = "symlink"
+	// LinkHard is a regular file with more than one hard link.
+	LinkHard LinkType = "hardlink"
+)
+
 // ReadSeekCloser combines io.Reader, io.Seeker, and io.Closer.
 // Returned by SeekableClient.OpenSeekable for protocols that support
 // random access (SMB, local filesystem). Enables http.ServeContent to
@@ -70,6 +93,104 @@ type SeekableClient interface {
 	OpenSeekable(ctx context.Context, path string) (ReadSeekCloser, error)
 }
 
+// EventType identifies the kind of change reported by a Watcher.
+type EventType string
+
+// Event types reported by Watcher implementations.
+const (
+	EventCreate EventType = "create"
+	EventModify EventType = "modify"
+	EventDelete EventType = "delete"
+	EventRename EventType = "rename"
+	// EventError reports a watch failure in Event.Err. Watching continues
+	// unless the channel is closed afterwards.
+	EventError EventType = "error"
+)
+
+// Event is a change observed by a Watcher. Paths are in the client's own
+// namespace (relative to its base path or share), joined with "/".
+type Event struct {
+	Type    EventType
+	Path    string
+	OldPath string // previous path of an EventRename
+	IsDir   bool
+	Err     error // set for EventError
+}
+
+// Watcher is an optional extension of Client for reporting changes below a
+// path. Local uses inotify on Linux; SMB, FTP, WebDAV and NFS poll with
+// ListDirectory and diff successive snapshots.
+type Watcher interface {
+	// Watch reports changes to path, and to its whole subtree when recursive
+	// is true. The returned channel is closed when ctx is cancelled or the
+	// watch fails permanently.
+	Watch(ctx context.Context, path string, recursive bool) (<-chan Event, error)
+}
+
+// HashAlgorithm names a content digest algorithm.
+type HashAlgorithm string
+
+// Hash algorithms understood by Hasher implementations and pkg/checksum.
+const (
+	HashSHA256 HashAlgorithm = "sha256"
+	HashSHA1   HashAlgorithm = "sha1"
+	HashMD5    HashAlgorithm = "md5"
+	HashXXH64  HashAlgorithm = "xxh64"
+)
+
+// Hasher is an optional extension of Client for digests the server computes
+// itself, so verifying a file does not require downloading it. WebDAV reads
+// ownCloud/Nextcloud oc:checksums. Use checksum.Sum for a streaming fallback.
+type Hasher interface {
+	// Hash returns the lowercase hex digest of path, or an error wrapping
+	// ErrNotSupported when the server cannot provide algo for it.
+	Hash(ctx context.Context, path string, algo HashAlgorithm) (string, error)
+}
+
+// MultiHasher is an optional extension of Hasher for servers that return
+// every digest they hold for a file in one request, so callers can pick an
+// algorithm without asking for each. WebDAV implements it.
+type MultiHasher interface {
+	// Hashes returns the lowercase hex digests of path the server holds,
+	// which may be none. It fails with ErrNotSupported only when the server
+	// keeps no digests at all.
+	Hashes(ctx context.Context, path string) (map[HashAlgorithm]string, error)
+}
+
+// Linker is an optional extension of Client for symbolic and hard links.
+// Local and NFS implement all of it; SMB creates and reads symlink reparse
+// points and returns ErrNotSupported from Link.
+type Linker interface {
+	// Symlink creates a symbolic link at path pointing to target, which is
+	// stored as given.
+	Symlink(ctx context.Context, target, path string) error
+	// Readlink returns the target of the symbolic link at path.
+	Readlink(ctx context.Context, path string) (string, error)
+	// Link creates path as a hard link to the existing file target.
+	Link(ctx context.Context, target, path string) error
+}
+
+// AttributeSetter is an optional extension of Client for file metadata,
+// used to preserve permissions and times when copying. Backends return an
+// error wrapping ErrNotSupported for the parts their protocol cannot set:
+// SMB maps Chmod to the read-only attribute, FTP only sets the modification
+// time (MFMT), WebDAV only sets getlastmodified where the server allows it,
+// and only local and NFS support Chown.
+type AttributeSetter interface {
+	// Chmod sets the permission bits of path.
+	Chmod(ctx context.Context, path string, mode os.FileMode) error
+	// Chtimes sets the access and modification times of path. A zero time
+	// leaves that time unchanged.
+	Chtimes(ctx context.Context, path string, atime, mtime time.Time) error
+	// Chown sets the numeric owner and group of path; -1 keeps either.
+	Chown(ctx context.Context, path string, uid, gid int) error
+}
+
+// ErrNotSupported is returned, possibly wrapped, by optional extension methods
+// when the backend cannot perform the operation. Decorators that always expose
+// an extension return it when the wrapped client does not implement it.
+var ErrNotSupported = errors.New("operation not supported")
+
 // StorageConfig represents the configuration for a storage backend.
 type StorageConfig struct {
 	ID        string                 `json:"id"`
@@ -93,6 +214,9 @@ type CopyOperation struct {
 	SourcePath        string
 	DestinationPath   string
 	OverwriteExisting bool
+	// PreserveAttributes copies the source's permission bits and
+	// modification time to the destination through AttributeSetter.
+	PreserveAttributes bool
 }
 
 // CopyResult represents the result of a copy operation.
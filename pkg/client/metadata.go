@@ -0,0 +1,46 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// MetadataStore is an optional extension of Client for user metadata kept
+// with a file, such as an ingest job ID. Local and NFS use "user." extended
+// attributes, SMB an alternate data stream and WebDAV dead properties. Keys
+// must pass ValidMetadataKey so that every backend can store them.
+type MetadataStore interface {
+	// GetMetadata returns the metadata of path, empty when it has none.
+	GetMetadata(ctx context.Context, path string) (map[string]string, error)
+	// SetMetadata adds or replaces the given keys, keeping the others.
+	SetMetadata(ctx context.Context, path string, meta map[string]string) error
+	// DeleteMetadata removes keys; missing keys are ignored.
+	DeleteMetadata(ctx context.Context, path string, keys ...string) error
+}
+
+// MaxMetadataKeyLength bounds metadata keys; with the "user." prefix it
+// stays within the 255-byte xattr name limit.
+const MaxMetadataKeyLength = 128
+
+// ErrInvalidMetadataKey is returned, wrapped, for keys ValidMetadataKey
+// rejects.
+var ErrInvalidMetadataKey = errors.New("invalid metadata key")
+
+// ValidMetadataKey checks that key starts with a letter or underscore and
+// continues with letters, digits, '.', '_' or '-'. Such keys are valid as
+// xattr names, XML element names and JSON keys alike.
+func ValidMetadataKey(key string) error {
+	if key == "" || len(key) > MaxMetadataKeyLength {
+		return fmt.Errorf("%w: %q", ErrInvalidMetadataKey, key)
+	}
+	for i, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+		case i > 0 && (r >= '0' && r <= '9' || r == '.' || r == '-'):
+		default:
+			return fmt.Errorf("%w: %q", ErrInvalidMetadataKey, key)
+		}
+	}
+	return nil
+}
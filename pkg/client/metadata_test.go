@@ -0,0 +1,17 @@
+package client
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidMetadataKey(t *testing.T) {
+	for _, key := range []string{"job", "ingest_job-id", "_x", "sha256.sum", "A1"} {
+		assert.NoError(t, ValidMetadataKey(key), key)
+	}
+	for _, key := range []string{"", "1job", "-x", ".x", "has space", "a/b", "a:b", "ключ", strings.Repeat("k", MaxMetadataKeyLength+1)} {
+		assert.ErrorIs(t, ValidMetadataKey(key), ErrInvalidMetadataKey, key)
+	}
+}
@@ -0,0 +1,39 @@
+package client
+
+import (
+	"path"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// JoinPath joins a root and a relative path in a client's namespace, where
+// paths are separated by "/" on every platform. Either part may be empty.
+func JoinPath(root, rel string) string {
+	if rel == "" {
+		return root
+	}
+	if root == "" {
+		return rel
+	}
+	return strings.TrimSuffix(root, "/") + "/" + rel
+}
+
+// MatchPath reports whether rel matches one of patterns. Patterns use
+// doublestar syntax ("**" spans directories) and are matched against rel
+// relative to its root; leading slashes on both are ignored. A pattern
+// without "/" matches the base name at any depth, so "*.tmp" selects
+// temporary files everywhere. Malformed patterns match nothing.
+func MatchPath(patterns []string, rel string) bool {
+	rel = strings.TrimPrefix(rel, "/")
+	for _, p := range patterns {
+		target := rel
+		if !strings.Contains(p, "/") {
+			target = path.Base(rel)
+		}
+		if ok, _ := doublestar.Match(strings.TrimPrefix(p, "/"), target); ok {
+			return true
+		}
+	}
+	return false
+}
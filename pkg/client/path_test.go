@@ -0,0 +1,35 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJoinPath(t *testing.T) {
+	assert.Equal(t, "media/a.mkv", JoinPath("media", "a.mkv"))
+	assert.Equal(t, "media/a.mkv", JoinPath("media/", "a.mkv"))
+	assert.Equal(t, "/a.mkv", JoinPath("/", "a.mkv"))
+	assert.Equal(t, "a.mkv", JoinPath("", "a.mkv"))
+	assert.Equal(t, "media", JoinPath("media", ""))
+}
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		rel      string
+		want     bool
+	}{
+		{[]string{"*.tmp"}, "a/b/c.tmp", true},
+		{[]string{"*.tmp"}, "c.tmp.bak", false},
+		{[]string{"media/**"}, "media/2024/a.mkv", true},
+		{[]string{"/media/**"}, "/media/a.mkv", true},
+		{[]string{"media/*"}, "media/2024/a.mkv", false},
+		{[]string{"docs/*.md", "*.mkv"}, "media/a.mkv", true},
+		{[]string{"[unclosed"}, "x", false},
+		{nil, "x", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, MatchPath(tt.patterns, tt.rel), "%v %q", tt.patterns, tt.rel)
+	}
+}
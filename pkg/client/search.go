@@ -0,0 +1,33 @@
+package client
+
+import (
+	"context"
+	"iter"
+	"time"
+)
+
+// SearchCriteria is the part of a search a backend may evaluate itself.
+// Zero fields impose no condition.
+type SearchCriteria struct {
+	// Names are base-name globs using only "*" and "?"; an entry matches
+	// when any of them does.
+	Names          []string
+	MinSize        int64
+	MaxSize        int64
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	FilesOnly      bool
+	DirsOnly       bool
+	// MaxDepth limits how far below the root entries may lie; 1 means
+	// direct children only.
+	MaxDepth int
+}
+
+// Searcher is an optional extension of Client that searches a tree on the
+// server, used by search.Search. Results may be a superset of the criteria,
+// which callers check again; their Path is relative to root, joined with
+// "/". Backends that cannot search fail with ErrNotSupported before
+// yielding anything.
+type Searcher interface {
+	Search(ctx context.Context, root string, criteria SearchCriteria) iter.Seq2[*FileInfo, error]
+}
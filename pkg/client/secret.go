@@ -0,0 +1,83 @@
+package client
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// RedactedSecret replaces secret values in GetConfig results and in
+// JSON-marshalled configurations.
+const RedactedSecret = "********"
+
+// SecretResolver resolves a secret reference found in StorageConfig.Settings.
+// A reference has the form "<scheme>:<ref>" (e.g. "env:SMB_PASS" or
+// "file:/run/secrets/ftp"); the resolver registered for the scheme receives
+// the part after the colon and returns the plain-text secret.
+type SecretResolver interface {
+	ResolveSecret(ref string) (string, error)
+}
+
+// SecretResolverFunc adapts an ordinary function to the SecretResolver interface.
+type SecretResolverFunc func(ref string) (string, error)
+
+// ResolveSecret calls f(ref).
+func (f SecretResolverFunc) ResolveSecret(ref string) (string, error) {
+	return f(ref)
+}
+
+// secretKeyHints are the substrings that mark a settings key as secret.
+var secretKeyHints = []string{"password", "passwd", "secret", "token", "passphrase", "private_key", "api_key", "access_key"}
+
+// IsSecretKey reports whether a settings key holds a secret value that must
+// not be exposed by GetConfig or JSON marshalling.
+func IsSecretKey(key string) bool {
+	lower := strings.ToLower(key)
+	for _, hint := range secretKeyHints {
+		if strings.Contains(lower, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactSecret returns RedactedSecret for a non-empty value and "" otherwise,
+// so callers can still tell whether a secret was configured.
+func RedactSecret(value string) string {
+	if value == "" {
+		return ""
+	}
+	return RedactedSecret
+}
+
+// RedactSettings returns a copy of settings with the values of secret keys
+// redacted. Non-secret values are copied as-is.
+func RedactSettings(settings map[string]interface{}) map[string]interface{} {
+	if settings == nil {
+		return nil
+	}
+	redacted := make(map[string]interface{}, len(settings))
+	for key, val := range settings {
+		if IsSecretKey(key) {
+			if str, ok := val.(string); ok && str == "" {
+				redacted[key] = ""
+			} else {
+				redacted[key] = RedactedSecret
+			}
+			continue
+		}
+		redacted[key] = val
+	}
+	return redacted
+}
+
+// Redacted returns a copy of the configuration with secret settings redacted.
+func (c StorageConfig) Redacted() StorageConfig {
+	c.Settings = RedactSettings(c.Settings)
+	return c
+}
+
+// MarshalJSON encodes the configuration with secret settings redacted.
+func (c StorageConfig) MarshalJSON() ([]byte, error) {
+	type plain StorageConfig
+	return json.Marshal(plain(c.Redacted()))
+}
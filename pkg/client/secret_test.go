@@ -0,0 +1,85 @@
+package client
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsSecretKey(t *testing.T) {
+	tests := []struct {
+		key      string
+		expected bool
+	}{
+		{"password", true},
+		{"Password", true},
+		{"smb_password", true},
+		{"client_secret", true},
+		{"api_token", true},
+		{"host", false},
+		{"username", false},
+		{"base_path", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			assert.Equal(t, tt.expected, IsSecretKey(tt.key))
+		})
+	}
+}
+
+func TestRedactSecret(t *testing.T) {
+	assert.Equal(t, RedactedSecret, RedactSecret("hunter2"))
+	assert.Equal(t, "", RedactSecret(""))
+}
+
+func TestRedactSettings(t *testing.T) {
+	settings := map[string]interface{}{
+		"host":     "nas.local",
+		"port":     445,
+		"password": "hunter2",
+		"token":    "",
+	}
+	redacted := RedactSettings(settings)
+
+	assert.Equal(t, "nas.local", redacted["host"])
+	assert.Equal(t, 445, redacted["port"])
+	assert.Equal(t, RedactedSecret, redacted["password"])
+	assert.Equal(t, "", redacted["token"])
+	assert.Equal(t, "hunter2", settings["password"], "original settings must not be modified")
+	assert.Nil(t, RedactSettings(nil))
+}
+
+func TestStorageConfig_MarshalJSON_RedactsSecrets(t *testing.T) {
+	cfg := StorageConfig{
+		ID:       "nas",
+		Protocol: "smb",
+		Settings: map[string]interface{}{
+			"host":     "nas.local",
+			"password": "hunter2",
+		},
+	}
+	data, err := json.Marshal(cfg)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "hunter2")
+	assert.Contains(t, string(data), `"host":"nas.local"`)
+
+	data, err = json.Marshal(&cfg)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "hunter2")
+
+	var decoded StorageConfig
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, "nas", decoded.ID)
+	assert.Equal(t, RedactedSecret, decoded.Settings["password"])
+}
+
+func TestSecretResolverFunc(t *testing.T) {
+	var r SecretResolver = SecretResolverFunc(func(ref string) (string, error) {
+		return "resolved-" + ref, nil
+	})
+	val, err := r.ResolveSecret("x")
+	require.NoError(t, err)
+	assert.Equal(t, "resolved-x", val)
+}
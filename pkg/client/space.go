@@ -0,0 +1,39 @@
+package client
+
+import "context"
+
+// SpaceInfo describes the storage behind a path, in bytes.
+type SpaceInfo struct {
+	// Total is the size of the volume, or zero when the backend only
+	// reports a quota.
+	Total int64 `json:"total"`
+	// Free is what the caller can still write, after reserved blocks and
+	// any quota the backend accounts for.
+	Free int64 `json:"free"`
+	// Used is the space already taken on the volume, or against the quota.
+	Used int64 `json:"used"`
+	// Quota is the caller's limit, or zero when none is reported.
+	Quota int64 `json:"quota,omitempty"`
+}
+
+// SpaceReporter is an optional extension of Client that reports the free
+// space behind a path. Backends that cannot tell fail with ErrNotSupported.
+type SpaceReporter interface {
+	GetSpace(ctx context.Context, path string) (*SpaceInfo, error)
+}
+
+// DirUsage totals the tree below a directory. Dirs does not count the
+// directory itself.
+type DirUsage struct {
+	Bytes int64 `json:"bytes"`
+	// Files and Dirs are -1 when only the byte total is known.
+	Files int64 `json:"files"`
+	Dirs  int64 `json:"dirs"`
+}
+
+// UsageReporter is an optional extension of Client that totals a
+// directory tree faster than listing it level by level, used by
+// usage.DiskUsage. Backends that cannot fail with ErrNotSupported.
+type UsageReporter interface {
+	DirUsage(ctx context.Context, path string) (*DirUsage, error)
+}
@@ -0,0 +1,48 @@
+package client
+
+import (
+	"context"
+	"iter"
+)
+
+// DirectoryStreamer is an optional extension of Client that yields the
+// entries of a directory as the backend reads them, so huge directories
+// need not be held in memory and the first entries arrive early. Entries
+// come in backend order. A failure is yielded once, with a nil FileInfo,
+// and ends the sequence; stopping early releases the listing. Backends
+// implementing it build ListDirectory on top of it.
+type DirectoryStreamer interface {
+	StreamDirectory(ctx context.Context, path string) iter.Seq2[*FileInfo, error]
+}
+
+// StreamDirectory lists path on c through DirectoryStreamer where c
+// implements it, and from ListDirectory otherwise.
+func StreamDirectory(ctx context.Context, c Client, path string) iter.Seq2[*FileInfo, error] {
+	if s, ok := c.(DirectoryStreamer); ok {
+		return s.StreamDirectory(ctx, path)
+	}
+	return func(yield func(*FileInfo, error) bool) {
+		files, err := c.ListDirectory(ctx, path)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		for _, f := range files {
+			if !yield(f, nil) {
+				return
+			}
+		}
+	}
+}
+
+// CollectFiles gathers the entries of seq, stopping at the first error.
+func CollectFiles(seq iter.Seq2[*FileInfo, error]) ([]*FileInfo, error) {
+	var files []*FileInfo
+	for f, err := range seq {
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
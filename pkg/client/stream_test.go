@@ -0,0 +1,81 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sliceClient answers ListDirectory from a fixed slice; the other methods
+// are unused.
+type sliceClient struct {
+	Client
+	files []*FileInfo
+	err   error
+}
+
+func (s sliceClient) ListDirectory(ctx context.Context, path string) ([]*FileInfo, error) {
+	return s.files, s.err
+}
+
+// streamClient yields names from StreamDirectory.
+type streamClient struct {
+	sliceClient
+	names []string
+}
+
+func (s streamClient) StreamDirectory(ctx context.Context, path string) iter.Seq2[*FileInfo, error] {
+	return func(yield func(*FileInfo, error) bool) {
+		for _, name := range s.names {
+			if !yield(&FileInfo{Name: name}, nil) {
+				return
+			}
+		}
+	}
+}
+
+func TestStreamDirectory(t *testing.T) {
+	ctx := context.Background()
+	listed := sliceClient{files: []*FileInfo{{Name: "a"}, {Name: "b"}, {Name: "c"}}}
+
+	files, err := CollectFiles(StreamDirectory(ctx, listed, "/"))
+	require.NoError(t, err)
+	assert.Equal(t, listed.files, files)
+
+	var first []string
+	for f, err := range StreamDirectory(ctx, listed, "/") {
+		require.NoError(t, err)
+		first = append(first, f.Name)
+		break
+	}
+	assert.Equal(t, []string{"a"}, first, "stopping early is allowed")
+
+	files, err = CollectFiles(StreamDirectory(ctx, streamClient{names: []string{"x", "y"}}, "/"))
+	require.NoError(t, err)
+	require.Len(t, files, 2, "DirectoryStreamer is preferred")
+	assert.Equal(t, "x", files[0].Name)
+
+	boom := errors.New("boom")
+	_, err = CollectFiles(StreamDirectory(ctx, sliceClient{err: boom}, "/"))
+	assert.ErrorIs(t, err, boom)
+}
+
+func TestCollectFiles(t *testing.T) {
+	boom := errors.New("boom")
+	seq := func(yield func(*FileInfo, error) bool) {
+		if yield(&FileInfo{Name: "a"}, nil) {
+			yield(nil, boom)
+		}
+	}
+	files, err := CollectFiles(seq)
+	assert.ErrorIs(t, err, boom)
+	assert.Nil(t, files, "partial results are dropped")
+
+	files, err = CollectFiles(func(yield func(*FileInfo, error) bool) {})
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
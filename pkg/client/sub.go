@@ -0,0 +1,475 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"digital.vasic.filesystem/pkg/confine"
+)
+
+// Sub returns a view of c rooted at prefix, so that "/" and "" name prefix
+// itself, for handing out sub-folders of one share. Paths are cleaned and
+// those climbing above the view fail with an error wrapping
+// confine.ErrEscape before reaching c; so does every call when prefix
+// itself climbs out of c's root. FileInfo.Path and Event paths are
+// rewritten relative to the view, joined with "/".
+//
+// The view implements every optional extension. Calls whose extension c
+// lacks fail with ErrNotSupported. Symlink refuses absolute targets,
+// targets with a ".." element and targets naming a directory, so every
+// link made through the view leads downwards from its own directory and
+// no chain of such links can reach above prefix. Links created on c
+// directly are not checked.
+func Sub(c Client, prefix string) Client {
+	s := &subClient{Client: c}
+	rel, err := confine.Clean(prefix)
+	switch {
+	case err != nil:
+		s.err = fmt.Errorf("invalid sub-tree prefix: %w", err)
+	case rel != ".":
+		s.prefix = rel
+	}
+	return s
+}
+
+// subClient is the Client returned by Sub.
+type subClient struct {
+	Client
+
+	prefix string
+	err    error
+}
+
+// full returns the path on the wrapped client for p.
+func (s *subClient) full(p string) (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+	rel, err := confine.Clean(p)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case rel == ".":
+		return s.prefix, nil
+	case s.prefix == "":
+		return rel, nil
+	default:
+		return s.prefix + "/" + rel, nil
+	}
+}
+
+// rel returns the view path of a path reported by the wrapped client, or
+// false when it lies outside the view.
+func (s *subClient) rel(p string) (string, bool) {
+	p = strings.Trim(strings.ReplaceAll(p, `\`, "/"), "/")
+	if s.prefix == "" || p == s.prefix {
+		return strings.TrimPrefix(p, s.prefix), true
+	}
+	return strings.CutPrefix(p, s.prefix+"/")
+}
+
+// rewrite makes f.Path relative to the view, falling back to fallback.
+func (s *subClient) rewrite(f *FileInfo, fallback string) {
+	if f == nil || f.Path == "" {
+		return
+	}
+	if rel, ok := s.rel(f.Path); ok {
+		f.Path = rel
+	} else {
+		f.Path = fallback
+	}
+}
+
+func (s *subClient) ReadFile(ctx context.Context, p string) (io.ReadCloser, error) {
+	full, err := s.full(p)
+	if err != nil {
+		return nil, err
+	}
+	return s.Client.ReadFile(ctx, full)
+}
+
+func (s *subClient) WriteFile(ctx context.Context, p string, data io.Reader) error {
+	full, err := s.full(p)
+	if err != nil {
+		return err
+	}
+	return s.Client.WriteFile(ctx, full, data)
+}
+
+func (s *subClient) GetFileInfo(ctx context.Context, p string) (*FileInfo, error) {
+	full, err := s.full(p)
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.Client.GetFileInfo(ctx, full)
+	if err != nil {
+		return nil, err
+	}
+	s.rewrite(info, p)
+	return info, nil
+}
+
+func (s *subClient) FileExists(ctx context.Context, p string) (bool, error) {
+	full, err := s.full(p)
+	if err != nil {
+		return false, err
+	}
+	return s.Client.FileExists(ctx, full)
+}
+
+func (s *subClient) DeleteFile(ctx context.Context, p string) error {
+	full, err := s.full(p)
+	if err != nil {
+		return err
+	}
+	return s.Client.DeleteFile(ctx, full)
+}
+
+func (s *subClient) CopyFile(ctx context.Context, srcPath, dstPath string) error {
+	src, err := s.full(srcPath)
+	if err != nil {
+		return err
+	}
+	dst, err := s.full(dstPath)
+	if err != nil {
+		return err
+	}
+	return s.Client.CopyFile(ctx, src, dst)
+}
+
+func (s *subClient) ListDirectory(ctx context.Context, p string) ([]*FileInfo, error) {
+	full, err := s.full(p)
+	if err != nil {
+		return nil, err
+	}
+	files, err := s.Client.ListDirectory(ctx, full)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		s.rewrite(f, JoinPath(strings.Trim(p, "/"), f.Name))
+	}
+	return files, nil
+}
+
+func (s *subClient) CreateDirectory(ctx context.Context, p string) error {
+	full, err := s.full(p)
+	if err != nil {
+		return err
+	}
+	return s.Client.CreateDirectory(ctx, full)
+}
+
+func (s *subClient) DeleteDirectory(ctx context.Context, p string) error {
+	full, err := s.full(p)
+	if err != nil {
+		return err
+	}
+	return s.Client.DeleteDirectory(ctx, full)
+}
+
+func (s *subClient) StreamDirectory(ctx context.Context, p string) iter.Seq2[*FileInfo, error] {
+	return func(yield func(*FileInfo, error) bool) {
+		full, err := s.full(p)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		for f, err := range StreamDirectory(ctx, s.Client, full) {
+			if err == nil {
+				s.rewrite(f, JoinPath(strings.Trim(p, "/"), f.Name))
+			}
+			if !yield(f, err) {
+				return
+			}
+		}
+	}
+}
+
+func (s *subClient) OpenSeekable(ctx context.Context, p string) (ReadSeekCloser, error) {
+	sc, ok := s.Client.(SeekableClient)
+	if !ok {
+		return nil, fmt.Errorf("open seekable %s: %w", p, ErrNotSupported)
+	}
+	full, err := s.full(p)
+	if err != nil {
+		return nil, err
+	}
+	return sc.OpenSeekable(ctx, full)
+}
+
+func (s *subClient) WriteFileAtomic(ctx context.Context, p string, data io.Reader) error {
+	aw, ok := s.Client.(AtomicWriter)
+	if !ok {
+		return fmt.Errorf("atomic write %s: %w", p, ErrNotSupported)
+	}
+	full, err := s.full(p)
+	if err != nil {
+		return err
+	}
+	return aw.WriteFileAtomic(ctx, full, data)
+}
+
+func (s *subClient) Create(ctx context.Context, p string) (io.WriteCloser, error) {
+	wc, ok := s.Client.(WritableClient)
+	if !ok {
+		return nil, fmt.Errorf("create %s: %w", p, ErrNotSupported)
+	}
+	full, err := s.full(p)
+	if err != nil {
+		return nil, err
+	}
+	return wc.Create(ctx, full)
+}
+
+func (s *subClient) OpenAppend(ctx context.Context, p string) (io.WriteCloser, error) {
+	wc, ok := s.Client.(WritableClient)
+	if !ok {
+		return nil, fmt.Errorf("open append %s: %w", p, ErrNotSupported)
+	}
+	full, err := s.full(p)
+	if err != nil {
+		return nil, err
+	}
+	return wc.OpenAppend(ctx, full)
+}
+
+func (s *subClient) Watch(ctx context.Context, p string, recursive bool) (<-chan Event, error) {
+	w, ok := s.Client.(Watcher)
+	if !ok {
+		return nil, fmt.Errorf("watch %s: %w", p, ErrNotSupported)
+	}
+	full, err := s.full(p)
+	if err != nil {
+		return nil, err
+	}
+	events, err := w.Watch(ctx, full, recursive)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan Event)
+	go func() {
+		defer close(out)
+		for ev := range events {
+			rel, ok := s.rel(ev.Path)
+			if !ok && ev.Type != EventError {
+				continue
+			}
+			if !ok {
+				rel = p
+			}
+			ev.Path = rel
+			if ev.OldPath != "" {
+				ev.OldPath, _ = s.rel(ev.OldPath)
+			}
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (s *subClient) Hash(ctx context.Context, p string, algo HashAlgorithm) (string, error) {
+	h, ok := s.Client.(Hasher)
+	if !ok {
+		return "", fmt.Errorf("hash %s: %w", p, ErrNotSupported)
+	}
+	full, err := s.full(p)
+	if err != nil {
+		return "", err
+	}
+	return h.Hash(ctx, full, algo)
+}
+
+func (s *subClient) Hashes(ctx context.Context, p string) (map[HashAlgorithm]string, error) {
+	h, ok := s.Client.(MultiHasher)
+	if !ok {
+		return nil, fmt.Errorf("hashes %s: %w", p, ErrNotSupported)
+	}
+	full, err := s.full(p)
+	if err != nil {
+		return nil, err
+	}
+	return h.Hashes(ctx, full)
+}
+
+func (s *subClient) Symlink(ctx context.Context, target, p string) error {
+	l, ok := s.Client.(Linker)
+	if !ok {
+		return fmt.Errorf("symlink %s: %w", p, ErrNotSupported)
+	}
+	full, err := s.full(p)
+	if err != nil {
+		return err
+	}
+	slashed := strings.ReplaceAll(target, `\`, "/")
+	if slashed == "" || path.IsAbs(slashed) {
+		return fmt.Errorf("invalid link target %s: %w", target, confine.ErrEscape)
+	}
+	for _, elem := range strings.Split(slashed, "/") {
+		if elem == ".." {
+			return fmt.Errorf("invalid link target %s: %w", target, confine.ErrEscape)
+		}
+	}
+	rel, _ := confine.Clean(p)
+	if info, err := s.GetFileInfo(ctx, path.Join(path.Dir(rel), slashed)); err == nil && info.IsDir {
+		return fmt.Errorf("invalid link target %s: directory links are refused in a sub-tree view: %w", target, confine.ErrEscape)
+	}
+	return l.Symlink(ctx, target, full)
+}
+
+func (s *subClient) Readlink(ctx context.Context, p string) (string, error) {
+	l, ok := s.Client.(Linker)
+	if !ok {
+		return "", fmt.Errorf("readlink %s: %w", p, ErrNotSupported)
+	}
+	full, err := s.full(p)
+	if err != nil {
+		return "", err
+	}
+	return l.Readlink(ctx, full)
+}
+
+func (s *subClient) Link(ctx context.Context, target, p string) error {
+	l, ok := s.Client.(Linker)
+	if !ok {
+		return fmt.Errorf("link %s: %w", p, ErrNotSupported)
+	}
+	fullTarget, err := s.full(target)
+	if err != nil {
+		return err
+	}
+	full, err := s.full(p)
+	if err != nil {
+		return err
+	}
+	return l.Link(ctx, fullTarget, full)
+}
+
+func (s *subClient) Chmod(ctx context.Context, p string, mode os.FileMode) error {
+	a, ok := s.Client.(AttributeSetter)
+	if !ok {
+		return fmt.Errorf("chmod %s: %w", p, ErrNotSupported)
+	}
+	full, err := s.full(p)
+	if err != nil {
+		return err
+	}
+	return a.Chmod(ctx, full, mode)
+}
+
+func (s *subClient) Chtimes(ctx context.Context, p string, atime, mtime time.Time) error {
+	a, ok := s.Client.(AttributeSetter)
+	if !ok {
+		return fmt.Errorf("chtimes %s: %w", p, ErrNotSupported)
+	}
+	full, err := s.full(p)
+	if err != nil {
+		return err
+	}
+	return a.Chtimes(ctx, full, atime, mtime)
+}
+
+func (s *subClient) Chown(ctx context.Context, p string, uid, gid int) error {
+	a, ok := s.Client.(AttributeSetter)
+	if !ok {
+		return fmt.Errorf("chown %s: %w", p, ErrNotSupported)
+	}
+	full, err := s.full(p)
+	if err != nil {
+		return err
+	}
+	return a.Chown(ctx, full, uid, gid)
+}
+
+func (s *subClient) GetMetadata(ctx context.Context, p string) (map[string]string, error) {
+	m, ok := s.Client.(MetadataStore)
+	if !ok {
+		return nil, fmt.Errorf("get metadata %s: %w", p, ErrNotSupported)
+	}
+	full, err := s.full(p)
+	if err != nil {
+		return nil, err
+	}
+	return m.GetMetadata(ctx, full)
+}
+
+func (s *subClient) SetMetadata(ctx context.Context, p string, meta map[string]string) error {
+	m, ok := s.Client.(MetadataStore)
+	if !ok {
+		return fmt.Errorf("set metadata %s: %w", p, ErrNotSupported)
+	}
+	full, err := s.full(p)
+	if err != nil {
+		return err
+	}
+	return m.SetMetadata(ctx, full, meta)
+}
+
+func (s *subClient) DeleteMetadata(ctx context.Context, p string, keys ...string) error {
+	m, ok := s.Client.(MetadataStore)
+	if !ok {
+		return fmt.Errorf("delete metadata %s: %w", p, ErrNotSupported)
+	}
+	full, err := s.full(p)
+	if err != nil {
+		return err
+	}
+	return m.DeleteMetadata(ctx, full, keys...)
+}
+
+// Search searches below root in the view. Result paths are relative to root
+// and need no rewriting.
+func (s *subClient) Search(ctx context.Context, root string, criteria SearchCriteria) iter.Seq2[*FileInfo, error] {
+	return func(yield func(*FileInfo, error) bool) {
+		sr, ok := s.Client.(Searcher)
+		if !ok {
+			yield(nil, fmt.Errorf("search %s: %w", root, ErrNotSupported))
+			return
+		}
+		full, err := s.full(root)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		for f, err := range sr.Search(ctx, full, criteria) {
+			if !yield(f, err) {
+				return
+			}
+		}
+	}
+}
+
+func (s *subClient) GetSpace(ctx context.Context, p string) (*SpaceInfo, error) {
+	r, ok := s.Client.(SpaceReporter)
+	if !ok {
+		return nil, fmt.Errorf("get space %s: %w", p, ErrNotSupported)
+	}
+	full, err := s.full(p)
+	if err != nil {
+		return nil, err
+	}
+	return r.GetSpace(ctx, full)
+}
+
+func (s *subClient) DirUsage(ctx context.Context, p string) (*DirUsage, error) {
+	r, ok := s.Client.(UsageReporter)
+	if !ok {
+		return nil, fmt.Errorf("dir usage %s: %w", p, ErrNotSupported)
+	}
+	full, err := s.full(p)
+	if err != nil {
+		return nil, err
+	}
+	return r.DirUsage(ctx, full)
+}
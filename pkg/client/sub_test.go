@@ -0,0 +1,332 @@
+package client
+
+import (
+	"context"
+	"io"
+	"iter"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"digital.vasic.filesystem/pkg/confine"
+)
+
+// recorder records the method and paths of every call and implements all
+// optional extensions. Reported paths echo the request, as backends do.
+type recorder struct {
+	Client
+	calls  []string
+	events chan Event
+}
+
+func (r *recorder) record(method string, paths ...string) {
+	r.calls = append(r.calls, method+" "+strings.Join(paths, " "))
+}
+
+func (r *recorder) last() string {
+	return r.calls[len(r.calls)-1]
+}
+
+func (r *recorder) ReadFile(ctx context.Context, p string) (io.ReadCloser, error) {
+	r.record("ReadFile", p)
+	return io.NopCloser(strings.NewReader(p)), nil
+}
+
+func (r *recorder) WriteFile(ctx context.Context, p string, data io.Reader) error {
+	r.record("WriteFile", p)
+	return nil
+}
+
+func (r *recorder) GetFileInfo(ctx context.Context, p string) (*FileInfo, error) {
+	r.record("GetFileInfo", p)
+	return &FileInfo{Name: path.Base(p), Path: p}, nil
+}
+
+func (r *recorder) FileExists(ctx context.Context, p string) (bool, error) {
+	r.record("FileExists", p)
+	return true, nil
+}
+
+func (r *recorder) DeleteFile(ctx context.Context, p string) error {
+	r.record("DeleteFile", p)
+	return nil
+}
+
+func (r *recorder) CopyFile(ctx context.Context, src, dst string) error {
+	r.record("CopyFile", src, dst)
+	return nil
+}
+
+func (r *recorder) ListDirectory(ctx context.Context, p string) ([]*FileInfo, error) {
+	r.record("ListDirectory", p)
+	return []*FileInfo{
+		{Name: "a.txt", Path: p + "/a.txt"},
+		{Name: "b", Path: `\` + strings.ReplaceAll(p, "/", `\`) + `\b`, IsDir: true},
+	}, nil
+}
+
+func (r *recorder) CreateDirectory(ctx context.Context, p string) error {
+	r.record("CreateDirectory", p)
+	return nil
+}
+
+func (r *recorder) DeleteDirectory(ctx context.Context, p string) error {
+	r.record("DeleteDirectory", p)
+	return nil
+}
+
+func (r *recorder) OpenSeekable(ctx context.Context, p string) (ReadSeekCloser, error) {
+	r.record("OpenSeekable", p)
+	return nil, nil
+}
+
+func (r *recorder) WriteFileAtomic(ctx context.Context, p string, data io.Reader) error {
+	r.record("WriteFileAtomic", p)
+	return nil
+}
+
+func (r *recorder) Create(ctx context.Context, p string) (io.WriteCloser, error) {
+	r.record("Create", p)
+	return nil, nil
+}
+
+func (r *recorder) OpenAppend(ctx context.Context, p string) (io.WriteCloser, error) {
+	r.record("OpenAppend", p)
+	return nil, nil
+}
+
+func (r *recorder) Watch(ctx context.Context, p string, recursive bool) (<-chan Event, error) {
+	r.record("Watch", p)
+	return r.events, nil
+}
+
+func (r *recorder) Hash(ctx context.Context, p string, algo HashAlgorithm) (string, error) {
+	r.record("Hash", p)
+	return "", nil
+}
+
+func (r *recorder) Hashes(ctx context.Context, p string) (map[HashAlgorithm]string, error) {
+	r.record("Hashes", p)
+	return nil, nil
+}
+
+func (r *recorder) Symlink(ctx context.Context, target, p string) error {
+	r.record("Symlink", target, p)
+	return nil
+}
+
+func (r *recorder) Readlink(ctx context.Context, p string) (string, error) {
+	r.record("Readlink", p)
+	return "", nil
+}
+
+func (r *recorder) Link(ctx context.Context, target, p string) error {
+	r.record("Link", target, p)
+	return nil
+}
+
+func (r *recorder) Chmod(ctx context.Context, p string, mode os.FileMode) error {
+	r.record("Chmod", p)
+	return nil
+}
+
+func (r *recorder) Chtimes(ctx context.Context, p string, atime, mtime time.Time) error {
+	r.record("Chtimes", p)
+	return nil
+}
+
+func (r *recorder) Chown(ctx context.Context, p string, uid, gid int) error {
+	r.record("Chown", p)
+	return nil
+}
+
+func (r *recorder) GetMetadata(ctx context.Context, p string) (map[string]string, error) {
+	r.record("GetMetadata", p)
+	return nil, nil
+}
+
+func (r *recorder) SetMetadata(ctx context.Context, p string, meta map[string]string) error {
+	r.record("SetMetadata", p)
+	return nil
+}
+
+func (r *recorder) DeleteMetadata(ctx context.Context, p string, keys ...string) error {
+	r.record("DeleteMetadata", p)
+	return nil
+}
+
+func (r *recorder) Search(ctx context.Context, root string, criteria SearchCriteria) iter.Seq2[*FileInfo, error] {
+	r.record("Search", root)
+	return func(yield func(*FileInfo, error) bool) {
+		yield(&FileInfo{Name: "hit", Path: "x/hit"}, nil)
+	}
+}
+
+func (r *recorder) GetSpace(ctx context.Context, p string) (*SpaceInfo, error) {
+	r.record("GetSpace", p)
+	return &SpaceInfo{}, nil
+}
+
+func (r *recorder) DirUsage(ctx context.Context, p string) (*DirUsage, error) {
+	r.record("DirUsage", p)
+	return &DirUsage{}, nil
+}
+
+func TestSub_Paths(t *testing.T) {
+	rec := &recorder{}
+	s := Sub(rec, "/tenants/acme/")
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		call func() error
+		want string
+	}{
+		{func() error { _, err := s.ReadFile(ctx, "/docs/a.txt"); return err }, "ReadFile tenants/acme/docs/a.txt"},
+		{func() error { return s.WriteFile(ctx, "docs/../b.txt", nil) }, "WriteFile tenants/acme/b.txt"},
+		{func() error { _, err := s.FileExists(ctx, "/"); return err }, "FileExists tenants/acme"},
+		{func() error { return s.DeleteFile(ctx, `docs\a.txt`) }, "DeleteFile tenants/acme/docs/a.txt"},
+		{func() error { return s.CopyFile(ctx, "a", "/b") }, "CopyFile tenants/acme/a tenants/acme/b"},
+		{func() error { return s.CreateDirectory(ctx, "new") }, "CreateDirectory tenants/acme/new"},
+		{func() error { return s.DeleteDirectory(ctx, "new/") }, "DeleteDirectory tenants/acme/new"},
+	} {
+		require.NoError(t, tc.call())
+		assert.Equal(t, tc.want, rec.last())
+	}
+
+	info, err := s.GetFileInfo(ctx, "/docs/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "GetFileInfo tenants/acme/docs/a.txt", rec.last())
+	assert.Equal(t, "docs/a.txt", info.Path)
+	assert.Equal(t, "a.txt", info.Name)
+
+	files, err := s.ListDirectory(ctx, "docs")
+	require.NoError(t, err)
+	assert.Equal(t, "ListDirectory tenants/acme/docs", rec.last())
+	require.Len(t, files, 2)
+	assert.Equal(t, "docs/a.txt", files[0].Path)
+	assert.Equal(t, "docs/b", files[1].Path, "backslash paths are rewritten too")
+
+	files, err = CollectFiles(StreamDirectory(ctx, s, ""))
+	require.NoError(t, err)
+	assert.Equal(t, "ListDirectory tenants/acme", rec.last())
+	assert.Equal(t, []string{"a.txt", "b"}, []string{files[0].Path, files[1].Path})
+
+	root := Sub(rec, "/")
+	info, err = root.GetFileInfo(ctx, "/x")
+	require.NoError(t, err)
+	assert.Equal(t, "GetFileInfo x", rec.last())
+	assert.Equal(t, "x", info.Path)
+}
+
+func TestSub_Escapes(t *testing.T) {
+	rec := &recorder{}
+	s := Sub(rec, "tenants/acme")
+	ctx := context.Background()
+
+	_, err := s.ReadFile(ctx, "../other/secret")
+	assert.ErrorIs(t, err, confine.ErrEscape)
+	assert.ErrorIs(t, s.CopyFile(ctx, "a", "docs/../../b"), confine.ErrEscape)
+	assert.ErrorIs(t, s.(Linker).Link(ctx, "../x", "y"), confine.ErrEscape)
+	assert.ErrorIs(t, s.(Linker).Symlink(ctx, "../../other", "link"), confine.ErrEscape)
+	assert.ErrorIs(t, s.(Linker).Symlink(ctx, "/etc/passwd", "link"), confine.ErrEscape)
+	assert.ErrorIs(t, s.(Linker).Symlink(ctx, "../a", "docs/link"), confine.ErrEscape, "no .. even when it stays inside")
+	assert.ErrorIs(t, s.(Linker).Symlink(ctx, `sub\..\..\x`, "docs/link"), confine.ErrEscape)
+	assert.Empty(t, rec.calls, "escapes never reach the wrapped client")
+	require.NoError(t, s.(Linker).Symlink(ctx, "a/b", "docs/link"))
+	assert.Equal(t, []string{"GetFileInfo tenants/acme/docs/a/b", "Symlink a/b tenants/acme/docs/link"}, rec.calls)
+
+	require.NoError(t, s.DeleteFile(ctx, "/../../a"))
+	assert.Equal(t, "DeleteFile tenants/acme/a", rec.last(), "like a chroot, /.. is /")
+
+	bad := Sub(rec, "../up")
+	_, err = bad.ListDirectory(ctx, "")
+	assert.ErrorIs(t, err, confine.ErrEscape)
+}
+
+func TestSub_Extensions(t *testing.T) {
+	rec := &recorder{events: make(chan Event, 4)}
+	s := Sub(rec, "t")
+	ctx := context.Background()
+
+	_, err := s.(SeekableClient).OpenSeekable(ctx, "v.mp4")
+	require.NoError(t, err)
+	require.NoError(t, s.(AtomicWriter).WriteFileAtomic(ctx, "a", nil))
+	_, err = s.(WritableClient).Create(ctx, "a")
+	require.NoError(t, err)
+	_, err = s.(WritableClient).OpenAppend(ctx, "a")
+	require.NoError(t, err)
+	_, err = s.(Hasher).Hash(ctx, "a", HashSHA256)
+	require.NoError(t, err)
+	_, err = s.(MultiHasher).Hashes(ctx, "a")
+	require.NoError(t, err)
+	_, err = s.(Linker).Readlink(ctx, "l")
+	require.NoError(t, err)
+	require.NoError(t, s.(Linker).Link(ctx, "a", "b"))
+	require.NoError(t, s.(AttributeSetter).Chmod(ctx, "a", 0644))
+	require.NoError(t, s.(AttributeSetter).Chtimes(ctx, "a", time.Time{}, time.Now()))
+	require.NoError(t, s.(AttributeSetter).Chown(ctx, "a", -1, -1))
+	_, err = s.(MetadataStore).GetMetadata(ctx, "a")
+	require.NoError(t, err)
+	require.NoError(t, s.(MetadataStore).SetMetadata(ctx, "a", nil))
+	require.NoError(t, s.(MetadataStore).DeleteMetadata(ctx, "a"))
+	_, err = s.(SpaceReporter).GetSpace(ctx, "")
+	require.NoError(t, err)
+	_, err = s.(UsageReporter).DirUsage(ctx, "d")
+	require.NoError(t, err)
+	hits, err := CollectFiles(s.(Searcher).Search(ctx, "d", SearchCriteria{}))
+	require.NoError(t, err)
+	assert.Equal(t, "x/hit", hits[0].Path, "search results stay relative to the root")
+	assert.Equal(t, []string{
+		"OpenSeekable t/v.mp4", "WriteFileAtomic t/a", "Create t/a", "OpenAppend t/a",
+		"Hash t/a", "Hashes t/a", "Readlink t/l", "Link t/a t/b", "Chmod t/a", "Chtimes t/a", "Chown t/a",
+		"GetMetadata t/a", "SetMetadata t/a", "DeleteMetadata t/a", "GetSpace t",
+		"DirUsage t/d", "Search t/d",
+	}, rec.calls)
+
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events, err := s.(Watcher).Watch(wctx, "", true)
+	require.NoError(t, err)
+	assert.Equal(t, "Watch t", rec.last())
+	rec.events <- Event{Type: EventCreate, Path: "t/new.txt"}
+	rec.events <- Event{Type: EventRename, Path: "/t/b", OldPath: "t/a"}
+	rec.events <- Event{Type: EventModify, Path: "elsewhere/x"}
+	rec.events <- Event{Type: EventError, Path: "t"}
+	close(rec.events)
+	var got []Event
+	for ev := range events {
+		got = append(got, ev)
+	}
+	assert.Equal(t, []Event{
+		{Type: EventCreate, Path: "new.txt"},
+		{Type: EventRename, Path: "b", OldPath: "a"},
+		{Type: EventError, Path: ""},
+	}, got)
+}
+
+func TestSub_NotSupported(t *testing.T) {
+	s := Sub(&sliceClient{}, "t")
+	ctx := context.Background()
+	_, err := s.(SeekableClient).OpenSeekable(ctx, "a")
+	assert.ErrorIs(t, err, ErrNotSupported)
+	assert.ErrorIs(t, s.(AtomicWriter).WriteFileAtomic(ctx, "a", nil), ErrNotSupported)
+	_, err = s.(Watcher).Watch(ctx, "", false)
+	assert.ErrorIs(t, err, ErrNotSupported)
+	assert.ErrorIs(t, s.(Linker).Symlink(ctx, "a", "b"), ErrNotSupported)
+	assert.ErrorIs(t, s.(AttributeSetter).Chmod(ctx, "a", 0), ErrNotSupported)
+	_, err = s.(MetadataStore).GetMetadata(ctx, "a")
+	assert.ErrorIs(t, err, ErrNotSupported)
+	_, err = CollectFiles(s.(Searcher).Search(ctx, "", SearchCriteria{}))
+	assert.ErrorIs(t, err, ErrNotSupported)
+	_, err = s.(UsageReporter).DirUsage(ctx, "")
+	assert.ErrorIs(t, err, ErrNotSupported)
+
+	files, err := CollectFiles(s.(DirectoryStreamer).StreamDirectory(ctx, ""))
+	require.NoError(t, err)
+	assert.Empty(t, files, "streaming falls back to ListDirectory")
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// WritableClient is an optional extension of Client for producers that push
+// data (encoders, archivers, loggers) instead of handing WriteFile a reader.
+// Data is only guaranteed to be stored once Close returns nil; Close reports
+// any error from the underlying upload or file.
+type WritableClient interface {
+	// Create opens path for writing, truncating an existing file. Missing
+	// parent directories are handled as by WriteFile.
+	Create(ctx context.Context, path string) (io.WriteCloser, error)
+	// OpenAppend opens path for writing at its end, creating it if missing.
+	OpenAppend(ctx context.Context, path string) (io.WriteCloser, error)
+}
+
+// NewPipeWriter returns a writer whose data is consumed by upload, which
+// runs in its own goroutine with the reading end of a pipe. Backends use it
+// to turn a reader-based upload (an FTP STOR, an HTTP PUT) into a writer.
+// If upload fails early, later writes return its error; Close waits for
+// upload to finish and returns its error.
+func NewPipeWriter(upload func(r io.Reader) error) io.WriteCloser {
+	pr, pw := io.Pipe()
+	w := &pipeWriter{pw: pw, done: make(chan struct{})}
+	go func() {
+		err := upload(pr)
+		if err != nil {
+			pr.CloseWithError(err)
+		} else {
+			// Writes after a successful upload have nowhere to go.
+			pr.CloseWithError(io.ErrClosedPipe)
+		}
+		w.err = err
+		close(w.done)
+	}()
+	return w
+}
+
+// pipeWriter is the io.WriteCloser returned by NewPipeWriter.
+type pipeWriter struct {
+	pw        *io.PipeWriter
+	done      chan struct{}
+	err       error
+	closeOnce sync.Once
+}
+
+func (w *pipeWriter) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+func (w *pipeWriter) Close() error {
+	w.closeOnce.Do(func() { w.pw.Close() })
+	<-w.done
+	return w.err
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPipeWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewPipeWriter(func(r io.Reader) error {
+		_, err := io.Copy(&buf, r)
+		return err
+	})
+
+	_, err := w.Write([]byte("hello "))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("world"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Equal(t, "hello world", buf.String())
+
+	// Close is idempotent.
+	assert.NoError(t, w.Close())
+}
+
+func TestNewPipeWriter_UploadError(t *testing.T) {
+	uploadErr := errors.New("disk full")
+	w := NewPipeWriter(func(r io.Reader) error {
+		buf := make([]byte, 2)
+		_, _ = r.Read(buf)
+		return uploadErr
+	})
+
+	var writeErr error
+	for i := 0; i < 10 && writeErr == nil; i++ {
+		_, writeErr = w.Write([]byte("data"))
+	}
+	assert.ErrorIs(t, writeErr, uploadErr)
+	assert.ErrorIs(t, w.Close(), uploadErr)
+}
+
+func TestNewPipeWriter_EmptyUpload(t *testing.T) {
+	called := false
+	w := NewPipeWriter(func(r io.Reader) error {
+		data, err := io.ReadAll(r)
+		called = true
+		assert.Empty(t, data)
+		return err
+	})
+	require.NoError(t, w.Close())
+	assert.True(t, called)
+}
+
+func TestAtomicTempName(t *testing.T) {
+	name := AtomicTempName("dir/sub/file.txt")
+	assert.Regexp(t, `^dir/sub/\.file\.txt\.tmp-[0-9a-f]{12}$`, name)
+	assert.Regexp(t, `^\.file\.tmp-[0-9a-f]{12}$`, AtomicTempName("file"))
+	assert.Regexp(t, `^share\\\.doc\.tmp-[0-9a-f]{12}$`, AtomicTempName(`share\doc`))
+	assert.NotEqual(t, AtomicTempName("a"), AtomicTempName("a"))
+}
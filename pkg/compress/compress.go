@@ -0,0 +1,506 @@
+// Package compress provides a client.Client decorator that compresses the
+// files matching include rules on write and decompresses them on read, so
+// callers keep using plain names. Compressed files are stored with a
+// ".zst" or ".gz" suffix next to a hidden sidecar recording their
+// uncompressed size; zstd output uses the seekable format, so OpenSeekable
+// decompresses only the frames it reads. Everything else passes through.
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/klauspost/compress/zstd"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// Algorithm selects the compression format.
+type Algorithm string
+
+const (
+	// AlgorithmZstd writes seekable zstd (".zst").
+	AlgorithmZstd Algorithm = "zstd"
+	// AlgorithmGzip writes gzip (".gz"), which cannot be read seekably.
+	AlgorithmGzip Algorithm = "gzip"
+)
+
+// extensions maps algorithms to the suffix of their stored files.
+var extensions = map[Algorithm]string{AlgorithmZstd: ".zst", AlgorithmGzip: ".gz"}
+
+// algorithms lists every algorithm, for reads of files written with a
+// different setting.
+var algorithms = []Algorithm{AlgorithmZstd, AlgorithmGzip}
+
+// DefaultFrameSize is the uncompressed size of a seekable zstd frame when
+// Options.FrameSize is zero.
+const DefaultFrameSize = 1 << 20
+
+// sidecarSuffix ends the name of the hidden file next to every compressed
+// file: "logs/app.log.zst" has "logs/.app.log.zst.size".
+const sidecarSuffix = ".size"
+
+// ErrCorrupt is returned, possibly wrapped, when compressed data or its
+// seek table cannot be decoded.
+var ErrCorrupt = errors.New("corrupt compressed data")
+
+// Options configures compression. Zero values select the defaults.
+type Options struct {
+	// Algorithm compresses new files (default AlgorithmZstd). Files written
+	// with the other algorithm stay readable.
+	Algorithm Algorithm
+	// Level is the compression level: 1-22 for zstd (mapped to the
+	// nearest encoder level) and 1-9 for gzip. Zero uses the default.
+	Level int
+	// Include lists doublestar globs of paths to compress; a pattern
+	// without "/" matches the base name. Empty compresses every file.
+	Include []string
+	// Exclude lists globs of paths never to compress.
+	Exclude []string
+	// FrameSize is the uncompressed size of a seekable zstd frame (default
+	// DefaultFrameSize). Smaller frames make seeks cheaper and compress
+	// worse.
+	FrameSize int
+}
+
+// sidecar is the content of a compressed file's sidecar.
+type sidecar struct {
+	Size int64 `json:"size"`
+}
+
+// Client wraps a client.Client and compresses the files matching its
+// rules. A path is served from its compressed form when that form's sidecar
+// exists and from the wrapped client unchanged otherwise.
+type Client struct {
+	client.Client
+
+	opts Options
+	enc  *zstd.Encoder
+	dec  *zstd.Decoder
+}
+
+// New wraps c with compression.
+func New(c client.Client, opts Options) (*Client, error) {
+	if opts.Algorithm == "" {
+		opts.Algorithm = AlgorithmZstd
+	}
+	if _, ok := extensions[opts.Algorithm]; !ok {
+		return nil, fmt.Errorf("compress: unknown algorithm %q", opts.Algorithm)
+	}
+	for _, p := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		if !doublestar.ValidatePattern(p) {
+			return nil, fmt.Errorf("compress: invalid glob pattern %q", p)
+		}
+	}
+	if opts.Algorithm == AlgorithmGzip && (opts.Level < 0 || opts.Level > gzip.BestCompression) {
+		return nil, fmt.Errorf("compress: gzip level %d out of range", opts.Level)
+	}
+	if opts.FrameSize <= 0 {
+		opts.FrameSize = DefaultFrameSize
+	}
+	encOpts := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+	if opts.Algorithm == AlgorithmZstd && opts.Level != 0 {
+		encOpts = append(encOpts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(opts.Level)))
+	}
+	enc, err := zstd.NewWriter(nil, encOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("compress: %w", err)
+	}
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, fmt.Errorf("compress: %w", err)
+	}
+	return &Client{Client: c, opts: opts, enc: enc, dec: dec}, nil
+}
+
+// Unwrap returns the wrapped client.
+func (c *Client) Unwrap() client.Client {
+	return c.Client
+}
+
+// Compresses reports whether new files at p are compressed.
+func (c *Client) Compresses(p string) bool {
+	if client.MatchPath(c.opts.Exclude, p) {
+		return false
+	}
+	return len(c.opts.Include) == 0 || client.MatchPath(c.opts.Include, p)
+}
+
+// WriteFile compresses data to path's compressed form when path matches
+// the rules and writes it unchanged otherwise. The other forms of path are
+// removed afterwards, so a read never finds stale content.
+func (c *Client) WriteFile(ctx context.Context, p string, data io.Reader) error {
+	if !c.Compresses(p) {
+		if err := c.Client.WriteFile(ctx, p, data); err != nil {
+			return err
+		}
+		return c.removeCompressed(ctx, p, "")
+	}
+
+	algo := c.opts.Algorithm
+	stored := p + extensions[algo]
+	var size int64
+	var err error
+	if algo == AlgorithmZstd {
+		fe := newFrameEncoder(data, c.enc, c.opts.FrameSize)
+		err = c.Client.WriteFile(ctx, stored, fe)
+		size = fe.n
+	} else {
+		size, err = c.writeGzip(ctx, stored, data)
+	}
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(sidecar{Size: size})
+	if err != nil {
+		return err
+	}
+	if err := c.Client.WriteFile(ctx, sidecarPath(stored), bytes.NewReader(body)); err != nil {
+		return fmt.Errorf("failed to write size of %s: %w", p, err)
+	}
+	if err := c.removeCompressed(ctx, p, algo); err != nil {
+		return err
+	}
+	return c.removeIfExists(ctx, p)
+}
+
+// writeGzip gzips data to stored and returns the uncompressed size.
+func (c *Client) writeGzip(ctx context.Context, stored string, data io.Reader) (int64, error) {
+	level := c.opts.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	pr, pw := io.Pipe()
+	counter := &countingReader{r: data}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		zw, err := gzip.NewWriterLevel(pw, level)
+		if err == nil {
+			if _, err = io.Copy(zw, counter); err == nil {
+				err = zw.Close()
+			}
+		}
+		pw.CloseWithError(err)
+	}()
+	err := c.Client.WriteFile(ctx, stored, pr)
+	pr.CloseWithError(io.ErrClosedPipe)
+	<-done
+	return counter.n, err
+}
+
+// removeCompressed deletes the compressed forms of p and their sidecars,
+// except the one written with keep. Files with a compression suffix but no
+// sidecar were not written by a Client and are left alone.
+func (c *Client) removeCompressed(ctx context.Context, p string, keep Algorithm) error {
+	for _, algo := range algorithms {
+		if algo == keep {
+			continue
+		}
+		stored := p + extensions[algo]
+		exists, err := c.Client.FileExists(ctx, sidecarPath(stored))
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		if err := c.removeIfExists(ctx, stored); err != nil {
+			return err
+		}
+		if err := c.Client.DeleteFile(ctx, sidecarPath(stored)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) removeIfExists(ctx context.Context, p string) error {
+	exists, err := c.Client.FileExists(ctx, p)
+	if err != nil || !exists {
+		return err
+	}
+	info, err := c.Client.GetFileInfo(ctx, p)
+	if err != nil || info.IsDir {
+		return err
+	}
+	return c.Client.DeleteFile(ctx, p)
+}
+
+// ReadFile decompresses path's compressed form, or reads path unchanged.
+func (c *Client) ReadFile(ctx context.Context, p string) (io.ReadCloser, error) {
+	algo, stored, err := c.locate(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if algo == "" {
+		return c.Client.ReadFile(ctx, p)
+	}
+	rc, err := c.Client.ReadFile(ctx, stored)
+	if err != nil {
+		return nil, err
+	}
+	switch algo {
+	case AlgorithmZstd:
+		zr, err := zstd.NewReader(rc, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			rc.Close()
+			return nil, fmt.Errorf("%w: %s: %v", ErrCorrupt, p, err)
+		}
+		return &zstdReadCloser{zr: zr, rc: rc}, nil
+	default:
+		zr, err := gzip.NewReader(rc)
+		if err != nil {
+			rc.Close()
+			return nil, fmt.Errorf("%w: %s: %v", ErrCorrupt, p, err)
+		}
+		return &gzipReadCloser{zr: zr, rc: rc}, nil
+	}
+}
+
+// OpenSeekable reads a seekable zstd file frame by frame, or opens an
+// uncompressed path through the wrapped client. Gzip files and wrapped
+// clients that are not a client.SeekableClient report
+// client.ErrNotSupported.
+func (c *Client) OpenSeekable(ctx context.Context, p string) (client.ReadSeekCloser, error) {
+	sc, ok := c.Client.(client.SeekableClient)
+	if !ok {
+		return nil, fmt.Errorf("open seekable %s: %w", p, client.ErrNotSupported)
+	}
+	algo, stored, err := c.locate(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	switch algo {
+	case "":
+		return sc.OpenSeekable(ctx, p)
+	case AlgorithmGzip:
+		return nil, fmt.Errorf("open seekable %s: gzip: %w", p, client.ErrNotSupported)
+	}
+	src, err := sc.OpenSeekable(ctx, stored)
+	if err != nil {
+		return nil, err
+	}
+	table, err := readSeekTable(src)
+	if err != nil {
+		src.Close()
+		return nil, fmt.Errorf("failed to open %s: %w", p, err)
+	}
+	return &seekReader{src: src, dec: c.dec, table: table, frame: -1}, nil
+}
+
+// GetFileInfo reports the uncompressed size of a compressed path under its
+// plain name.
+func (c *Client) GetFileInfo(ctx context.Context, p string) (*client.FileInfo, error) {
+	algo, stored, err := c.locate(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if algo == "" {
+		return c.Client.GetFileInfo(ctx, p)
+	}
+	info, err := c.Client.GetFileInfo(ctx, stored)
+	if err != nil {
+		return nil, err
+	}
+	size, err := c.readSidecar(ctx, stored)
+	if err != nil {
+		return nil, err
+	}
+	info.Size = size
+	info.Name = path.Base(p)
+	if info.Path != "" {
+		info.Path = p
+	}
+	return info, nil
+}
+
+// ListDirectory lists compressed files under their plain names and sizes
+// and hides the sidecars.
+func (c *Client) ListDirectory(ctx context.Context, dir string) ([]*client.FileInfo, error) {
+	files, err := c.Client.ListDirectory(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(files))
+	for _, f := range files {
+		names[f.Name] = true
+	}
+	out := files[:0]
+	for _, f := range files {
+		if strings.HasPrefix(f.Name, ".") && strings.HasSuffix(f.Name, sidecarSuffix) &&
+			names[strings.TrimSuffix(f.Name[1:], sidecarSuffix)] {
+			continue
+		}
+		if !f.IsDir && names["."+f.Name+sidecarSuffix] && algorithmOf(f.Name) != "" {
+			stored := client.JoinPath(dir, f.Name)
+			size, err := c.readSidecar(ctx, stored)
+			if err != nil {
+				return nil, err
+			}
+			f.Name = strings.TrimSuffix(f.Name, extensions[algorithmOf(f.Name)])
+			f.Size = size
+			if f.Path != "" {
+				f.Path = client.JoinPath(dir, f.Name)
+			}
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// FileExists reports whether path exists in either form.
+func (c *Client) FileExists(ctx context.Context, p string) (bool, error) {
+	algo, _, err := c.locate(ctx, p)
+	if err != nil || algo != "" {
+		return algo != "", err
+	}
+	return c.Client.FileExists(ctx, p)
+}
+
+// DeleteFile deletes path's compressed form and sidecar, or path itself.
+func (c *Client) DeleteFile(ctx context.Context, p string) error {
+	algo, stored, err := c.locate(ctx, p)
+	if err != nil {
+		return err
+	}
+	if algo == "" {
+		return c.Client.DeleteFile(ctx, p)
+	}
+	if err := c.Client.DeleteFile(ctx, stored); err != nil {
+		return err
+	}
+	return c.Client.DeleteFile(ctx, sidecarPath(stored))
+}
+
+// CopyFile copies path's stored form and sidecar without recompressing.
+func (c *Client) CopyFile(ctx context.Context, srcPath, dstPath string) error {
+	algo, stored, err := c.locate(ctx, srcPath)
+	if err != nil {
+		return err
+	}
+	if algo == "" {
+		if err := c.Client.CopyFile(ctx, srcPath, dstPath); err != nil {
+			return err
+		}
+		return c.removeCompressed(ctx, dstPath, "")
+	}
+	dstStored := dstPath + extensions[algo]
+	if err := c.Client.CopyFile(ctx, stored, dstStored); err != nil {
+		return err
+	}
+	if err := c.Client.CopyFile(ctx, sidecarPath(stored), sidecarPath(dstStored)); err != nil {
+		return err
+	}
+	if err := c.removeCompressed(ctx, dstPath, algo); err != nil {
+		return err
+	}
+	return c.removeIfExists(ctx, dstPath)
+}
+
+// locate returns the algorithm and stored path of p's compressed form, or
+// an empty algorithm when p is stored uncompressed.
+func (c *Client) locate(ctx context.Context, p string) (Algorithm, string, error) {
+	order := []Algorithm{c.opts.Algorithm}
+	for _, algo := range algorithms {
+		if algo != c.opts.Algorithm {
+			order = append(order, algo)
+		}
+	}
+	for _, algo := range order {
+		stored := p + extensions[algo]
+		exists, err := c.Client.FileExists(ctx, sidecarPath(stored))
+		if err != nil {
+			return "", "", err
+		}
+		if exists {
+			return algo, stored, nil
+		}
+	}
+	return "", "", nil
+}
+
+// readSidecar returns the uncompressed size recorded for stored.
+func (c *Client) readSidecar(ctx context.Context, stored string) (int64, error) {
+	rc, err := c.Client.ReadFile(ctx, sidecarPath(stored))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read size of %s: %w", stored, err)
+	}
+	defer rc.Close()
+	var s sidecar
+	if err := json.NewDecoder(io.LimitReader(rc, 4096)).Decode(&s); err != nil {
+		return 0, fmt.Errorf("%w: size of %s: %v", ErrCorrupt, stored, err)
+	}
+	return s.Size, nil
+}
+
+// sidecarPath returns the sidecar of a stored compressed file.
+func sidecarPath(stored string) string {
+	dir, name := path.Split(stored)
+	return dir + "." + name + sidecarSuffix
+}
+
+// algorithmOf returns the algorithm whose suffix name has.
+func algorithmOf(name string) Algorithm {
+	for _, algo := range algorithms {
+		if strings.HasSuffix(name, extensions[algo]) && len(name) > len(extensions[algo]) {
+			return algo
+		}
+	}
+	return ""
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type zstdReadCloser struct {
+	zr *zstd.Decoder
+	rc io.ReadCloser
+}
+
+func (z *zstdReadCloser) Read(p []byte) (int, error) {
+	n, err := z.zr.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	return n, err
+}
+
+func (z *zstdReadCloser) Close() error {
+	z.zr.Close()
+	return z.rc.Close()
+}
+
+type gzipReadCloser struct {
+	zr *gzip.Reader
+	rc io.ReadCloser
+}
+
+func (g *gzipReadCloser) Read(p []byte) (int, error) {
+	n, err := g.zr.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	return n, err
+}
+
+func (g *gzipReadCloser) Close() error {
+	g.zr.Close()
+	return g.rc.Close()
+}
@@ -0,0 +1,221 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"digital.vasic.filesystem/internal/testutil"
+	"digital.vasic.filesystem/pkg/client"
+)
+
+var _ client.SeekableClient = (*Client)(nil)
+
+func newCompress(t *testing.T, l client.Client, opts Options) *Client {
+	t.Helper()
+	c, err := New(l, opts)
+	require.NoError(t, err)
+	return c
+}
+
+// logData returns n bytes of highly compressible log lines.
+func logData(n int) []byte {
+	var b bytes.Buffer
+	for i := 0; b.Len() < n; i++ {
+		fmt.Fprintf(&b, "2026-10-18T12:00:%02d INFO request %d served in %dms\n", i%60, i, i%97)
+	}
+	return b.Bytes()[:n]
+}
+
+func names(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var out []string
+	for _, e := range entries {
+		out = append(out, e.Name())
+	}
+	return out
+}
+
+func TestClient_Zstd(t *testing.T) {
+	l, dir := testutil.NewLocal(t)
+	c := newCompress(t, l, Options{Include: []string{"*.log"}, FrameSize: 4096})
+	ctx := context.Background()
+	data := logData(100 << 10)
+
+	require.NoError(t, c.WriteFile(ctx, "logs/app.log", bytes.NewReader(data)))
+	assert.Equal(t, []string{".app.log.zst.size", "app.log.zst"}, names(t, filepath.Join(dir, "logs")))
+	raw, err := os.ReadFile(filepath.Join(dir, "logs", "app.log.zst"))
+	require.NoError(t, err)
+	assert.Less(t, len(raw), len(data)/4, "logs compress well")
+
+	assert.Equal(t, data, testutil.MustReadFile(t, c, "logs/app.log"))
+	zr, err := zstd.NewReader(bytes.NewReader(raw))
+	require.NoError(t, err)
+	plain, err := io.ReadAll(zr)
+	zr.Close()
+	require.NoError(t, err)
+	assert.Equal(t, data, plain, "any zstd decoder reads the seekable format")
+
+	info, err := c.GetFileInfo(ctx, "logs/app.log")
+	require.NoError(t, err)
+	assert.Equal(t, "app.log", info.Name)
+	assert.Equal(t, int64(len(data)), info.Size)
+	files, err := c.ListDirectory(ctx, "logs")
+	require.NoError(t, err)
+	require.Len(t, files, 1, "the sidecar is hidden")
+	assert.Equal(t, "app.log", files[0].Name)
+	assert.Equal(t, int64(len(data)), files[0].Size)
+
+	exists, err := c.FileExists(ctx, "logs/app.log")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	require.NoError(t, c.CopyFile(ctx, "logs/app.log", "logs/copy.log"))
+	assert.Equal(t, data, testutil.MustReadFile(t, c, "logs/copy.log"))
+	require.NoError(t, c.DeleteFile(ctx, "logs/app.log"))
+	assert.Equal(t, []string{".copy.log.zst.size", "copy.log.zst"}, names(t, filepath.Join(dir, "logs")))
+
+	require.NoError(t, c.WriteFile(ctx, "empty.log", bytes.NewReader(nil)))
+	assert.Empty(t, testutil.MustReadFile(t, c, "empty.log"))
+	info, err = c.GetFileInfo(ctx, "empty.log")
+	require.NoError(t, err)
+	assert.Zero(t, info.Size)
+}
+
+func TestClient_OpenSeekable(t *testing.T) {
+	l, _ := testutil.NewLocal(t)
+	c := newCompress(t, l, Options{FrameSize: 4096})
+	ctx := context.Background()
+	data := logData(50 << 10)
+	require.NoError(t, c.WriteFile(ctx, "app.log", bytes.NewReader(data)))
+
+	r, err := c.OpenSeekable(ctx, "app.log")
+	require.NoError(t, err)
+	defer r.Close()
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 50; i++ {
+		off := rng.Int63n(int64(len(data)))
+		buf := make([]byte, rng.Intn(10000))
+		_, err := r.Seek(off, io.SeekStart)
+		require.NoError(t, err)
+		n, _ := io.ReadFull(r, buf)
+		assert.Equal(t, min(len(buf), len(data)-int(off)), n)
+		assert.Equal(t, data[off:off+int64(n)], buf[:n])
+	}
+	end, err := r.Seek(0, io.SeekEnd)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), end)
+}
+
+func TestClient_Gzip(t *testing.T) {
+	l, dir := testutil.NewLocal(t)
+	c := newCompress(t, l, Options{Algorithm: AlgorithmGzip, Level: gzip.BestCompression})
+	ctx := context.Background()
+	data := logData(20 << 10)
+	require.NoError(t, c.WriteFile(ctx, "app.log", bytes.NewReader(data)))
+	assert.Equal(t, []string{".app.log.gz.size", "app.log.gz"}, names(t, dir))
+	assert.Equal(t, data, testutil.MustReadFile(t, c, "app.log"))
+
+	raw, err := os.Open(filepath.Join(dir, "app.log.gz"))
+	require.NoError(t, err)
+	defer raw.Close()
+	zr, err := gzip.NewReader(raw)
+	require.NoError(t, err)
+	plain, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, data, plain, "stored files are ordinary gzip")
+
+	_, err = c.OpenSeekable(ctx, "app.log")
+	assert.ErrorIs(t, err, client.ErrNotSupported)
+
+	zc, err := New(c.Unwrap(), Options{})
+	require.NoError(t, err)
+	assert.Equal(t, data, testutil.MustReadFile(t, zc, "app.log"), "files written with another algorithm stay readable")
+	require.NoError(t, zc.WriteFile(ctx, "app.log", bytes.NewReader(data)))
+	assert.Equal(t, []string{".app.log.zst.size", "app.log.zst"}, names(t, dir), "the old form is replaced")
+}
+
+func TestClient_PassThrough(t *testing.T) {
+	l, dir := testutil.NewLocal(t)
+	c := newCompress(t, l, Options{Include: []string{"logs/**"}, Exclude: []string{"*.jpg"}})
+	ctx := context.Background()
+
+	assert.True(t, c.Compresses("logs/2026/app.log"))
+	assert.False(t, c.Compresses("logs/photo.jpg"))
+	assert.False(t, c.Compresses("notes.txt"))
+
+	require.NoError(t, c.WriteFile(ctx, "notes.txt", strings.NewReader("plain")))
+	require.NoError(t, c.WriteFile(ctx, "logs/photo.jpg", strings.NewReader("jpeg")))
+	require.NoError(t, l.WriteFile(ctx, "archive.tar.gz", strings.NewReader("not ours")))
+	assert.ElementsMatch(t, []string{"archive.tar.gz", "logs", "notes.txt"}, names(t, dir))
+	assert.Equal(t, []string{"photo.jpg"}, names(t, filepath.Join(dir, "logs")))
+	assert.Equal(t, "plain", string(testutil.MustReadFile(t, c, "notes.txt")))
+	assert.Equal(t, "not ours", string(testutil.MustReadFile(t, c, "archive.tar.gz")), "foreign .gz files are not decompressed")
+
+	files, err := c.ListDirectory(ctx, "")
+	require.NoError(t, err)
+	var listed []string
+	for _, f := range files {
+		listed = append(listed, f.Name)
+	}
+	assert.ElementsMatch(t, []string{"archive.tar.gz", "logs", "notes.txt"}, listed)
+
+	// A path that moves between the rules keeps a single form.
+	require.NoError(t, l.WriteFile(ctx, "logs/app.log", strings.NewReader("old plain")))
+	require.NoError(t, c.WriteFile(ctx, "logs/app.log", strings.NewReader("new compressed")))
+	assert.ElementsMatch(t, []string{".app.log.zst.size", "app.log.zst", "photo.jpg"}, names(t, filepath.Join(dir, "logs")))
+	plainOnly, err := New(l, Options{Include: []string{"none"}})
+	require.NoError(t, err)
+	require.NoError(t, plainOnly.WriteFile(ctx, "logs/app.log", strings.NewReader("plain again")))
+	assert.ElementsMatch(t, []string{"app.log", "photo.jpg"}, names(t, filepath.Join(dir, "logs")))
+	assert.Equal(t, "plain again", string(testutil.MustReadFile(t, c, "logs/app.log")))
+}
+
+func TestClient_Errors(t *testing.T) {
+	l, dir := testutil.NewLocal(t)
+	for _, opts := range []Options{
+		{Algorithm: "lz4"},
+		{Include: []string{"[unclosed"}},
+		{Algorithm: AlgorithmGzip, Level: 12},
+	} {
+		_, err := New(l, opts)
+		assert.Error(t, err, "%+v", opts)
+	}
+
+	c, err := New(l, Options{FrameSize: 1024})
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, c.WriteFile(ctx, "a.log", bytes.NewReader(logData(8<<10))))
+	p := filepath.Join(dir, "a.log.zst")
+	raw, err := os.ReadFile(p)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(p, raw[:len(raw)-1], 0644))
+	_, err = c.OpenSeekable(ctx, "a.log")
+	assert.ErrorIs(t, err, ErrCorrupt, "a damaged seek table is detected")
+
+	corrupt := append([]byte(nil), raw...)
+	corrupt[20] ^= 0xff
+	require.NoError(t, os.WriteFile(p, corrupt, 0644))
+	rc, err := c.ReadFile(ctx, "a.log")
+	require.NoError(t, err)
+	_, err = io.ReadAll(rc)
+	rc.Close()
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".a.log.zst.size"), []byte("{"), 0644))
+	_, err = c.GetFileInfo(ctx, "a.log")
+	assert.ErrorIs(t, err, ErrCorrupt)
+}
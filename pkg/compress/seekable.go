@@ -0,0 +1,228 @@
+package compress
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/klauspost/compress/zstd"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// The zstd seekable format (contrib/seekable_format in the zstd sources):
+// independent zstd frames followed by a skippable frame holding the seek
+// table, so any zstd decoder reads the data and a seekable reader can jump
+// to the frame holding an offset.
+//
+//	skippable frame magic (4) | frame size (4)
+//	| per frame: compressed size (4), decompressed size (4)
+//	| number of frames (4) | descriptor (1) | seekable magic (4)
+const (
+	skippableMagic   = 0x184D2A5E
+	seekableMagic    = 0x8F92EAB1
+	seekFooterSize   = 9
+	seekEntrySize    = 8
+	checksumFlag     = 1 << 7
+	maxSeekTableSize = 1 << 30
+)
+
+// frameEncoder compresses src as it is read into independent frames of
+// frameSize uncompressed bytes and appends the seek table.
+type frameEncoder struct {
+	src       io.Reader
+	enc       *zstd.Encoder
+	plain     []byte
+	out       []byte
+	entries   []byte
+	frames    uint32
+	done      bool
+	tableSent bool
+	n         int64
+}
+
+func newFrameEncoder(src io.Reader, enc *zstd.Encoder, frameSize int) *frameEncoder {
+	return &frameEncoder{src: src, enc: enc, plain: make([]byte, frameSize)}
+}
+
+func (e *frameEncoder) Read(p []byte) (int, error) {
+	for len(e.out) == 0 {
+		if e.tableSent {
+			return 0, io.EOF
+		}
+		if e.done {
+			e.out = e.seekTable()
+			e.tableSent = true
+			continue
+		}
+		n, err := io.ReadFull(e.src, e.plain)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			e.done = true
+		} else if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			continue
+		}
+		e.n += int64(n)
+		e.out = e.enc.EncodeAll(e.plain[:n], e.out[:0])
+		e.entries = binary.LittleEndian.AppendUint32(e.entries, uint32(len(e.out)))
+		e.entries = binary.LittleEndian.AppendUint32(e.entries, uint32(n))
+		e.frames++
+	}
+	n := copy(p, e.out)
+	e.out = e.out[n:]
+	return n, nil
+}
+
+// seekTable returns the skippable frame holding the seek table.
+func (e *frameEncoder) seekTable() []byte {
+	size := len(e.entries) + seekFooterSize
+	t := make([]byte, 0, 8+size)
+	t = binary.LittleEndian.AppendUint32(t, skippableMagic)
+	t = binary.LittleEndian.AppendUint32(t, uint32(size))
+	t = append(t, e.entries...)
+	t = binary.LittleEndian.AppendUint32(t, e.frames)
+	t = append(t, 0)
+	return binary.LittleEndian.AppendUint32(t, seekableMagic)
+}
+
+// seekTable locates the frames of a seekable zstd stream.
+type seekTable struct {
+	// offsets[i] and starts[i] are where frame i begins in the compressed
+	// and uncompressed stream; the final elements are the totals.
+	offsets []int64
+	starts  []int64
+}
+
+// readSeekTable reads the seek table at the end of src.
+func readSeekTable(src io.ReadSeeker) (*seekTable, error) {
+	end, err := src.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if end < 8+seekFooterSize {
+		return nil, fmt.Errorf("%w: no seek table", ErrCorrupt)
+	}
+	footer := make([]byte, seekFooterSize)
+	if _, err := src.Seek(end-seekFooterSize, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(src, footer); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(footer[5:]) != seekableMagic {
+		return nil, fmt.Errorf("%w: no seek table", ErrCorrupt)
+	}
+	frames := int64(binary.LittleEndian.Uint32(footer))
+	entry := int64(seekEntrySize)
+	if footer[4]&checksumFlag != 0 {
+		entry += 4
+	}
+	tableSize := frames*entry + seekFooterSize
+	if tableSize > maxSeekTableSize || 8+tableSize > end {
+		return nil, fmt.Errorf("%w: seek table larger than the file", ErrCorrupt)
+	}
+	raw := make([]byte, 8+tableSize)
+	if _, err := src.Seek(end-int64(len(raw)), io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(src, raw); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(raw) != skippableMagic || int64(binary.LittleEndian.Uint32(raw[4:])) != tableSize {
+		return nil, fmt.Errorf("%w: malformed seek table", ErrCorrupt)
+	}
+
+	t := &seekTable{offsets: make([]int64, frames+1), starts: make([]int64, frames+1)}
+	for i := int64(0); i < frames; i++ {
+		e := raw[8+i*entry:]
+		t.offsets[i+1] = t.offsets[i] + int64(binary.LittleEndian.Uint32(e))
+		t.starts[i+1] = t.starts[i] + int64(binary.LittleEndian.Uint32(e[4:]))
+	}
+	if t.offsets[frames] != end-int64(len(raw)) {
+		return nil, fmt.Errorf("%w: seek table does not match the frames", ErrCorrupt)
+	}
+	return t, nil
+}
+
+// size returns the uncompressed size.
+func (t *seekTable) size() int64 {
+	return t.starts[len(t.starts)-1]
+}
+
+// seekReader decompresses the frame holding the current position on
+// demand, holding one frame at a time.
+type seekReader struct {
+	src   client.ReadSeekCloser
+	dec   *zstd.Decoder
+	table *seekTable
+	pos   int64
+	frame int
+	buf   []byte
+	plain []byte
+}
+
+func (r *seekReader) Read(p []byte) (int, error) {
+	if r.pos >= r.table.size() {
+		return 0, io.EOF
+	}
+	i := sort.Search(len(r.table.starts)-1, func(i int) bool { return r.table.starts[i+1] > r.pos })
+	if i != r.frame {
+		if err := r.load(i); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.plain[r.pos-r.table.starts[i]:])
+	r.pos += int64(n)
+	return n, nil
+}
+
+// load reads and decompresses frame i.
+func (r *seekReader) load(i int) error {
+	r.frame = -1
+	size := r.table.offsets[i+1] - r.table.offsets[i]
+	if int64(cap(r.buf)) < size {
+		r.buf = make([]byte, size)
+	}
+	r.buf = r.buf[:size]
+	if _, err := r.src.Seek(r.table.offsets[i], io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(r.src, r.buf); err != nil {
+		return err
+	}
+	plain, err := r.dec.DecodeAll(r.buf, r.plain[:0])
+	if err != nil {
+		return fmt.Errorf("%w: frame %d: %v", ErrCorrupt, i, err)
+	}
+	if int64(len(plain)) != r.table.starts[i+1]-r.table.starts[i] {
+		return fmt.Errorf("%w: frame %d has the wrong size", ErrCorrupt, i)
+	}
+	r.plain, r.frame = plain, i
+	return nil
+}
+
+func (r *seekReader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.pos + offset
+	case io.SeekEnd:
+		abs = r.table.size() + offset
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if abs < 0 {
+		return 0, fmt.Errorf("negative position %d", abs)
+	}
+	r.pos = abs
+	return abs, nil
+}
+
+func (r *seekReader) Close() error {
+	return r.src.Close()
+}
@@ -0,0 +1,227 @@
+// Package confine keeps client paths inside a root directory. Clean rejects
+// paths that climb out of the root lexically; Join additionally checks the
+// symbolic links on the way according to a SymlinkPolicy. On Linux the
+// check uses openat2 with RESOLVE_BENEATH; elsewhere, on kernels without
+// openat2, and for absolute links the kernel refuses, the path is walked
+// with Lstat and Readlink instead. OpenFile opens a file in the same
+// openat2 call that checks it, closing the window Join leaves between the
+// check and the use of the path.
+package confine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SymlinkPolicy decides how symbolic links below the root are handled.
+type SymlinkPolicy string
+
+const (
+	// SymlinkConfine follows links only while they stay inside the root.
+	SymlinkConfine SymlinkPolicy = "confine"
+	// SymlinkFollow follows every link, wherever it points.
+	SymlinkFollow SymlinkPolicy = "follow"
+	// SymlinkRefuse rejects any path that passes through a link.
+	SymlinkRefuse SymlinkPolicy = "refuse"
+)
+
+// maxLinks bounds link expansion in the userspace walk, like the kernel's
+// limit on nested symlinks.
+const maxLinks = 40
+
+var (
+	// ErrEscape is returned for paths that would leave the root.
+	ErrEscape = errors.New("path escapes root")
+	// ErrSymlink is returned for paths through a link under SymlinkRefuse.
+	ErrSymlink = errors.New("path contains a symbolic link")
+)
+
+// errFallback tells OpenFile that the kernel cannot open the path confined
+// and the check-then-open fallback is needed.
+var errFallback = errors.New("confined open not available")
+
+// ParsePolicy parses a policy name. An empty name selects SymlinkConfine.
+func ParsePolicy(name string) (SymlinkPolicy, error) {
+	switch p := SymlinkPolicy(strings.ToLower(name)); p {
+	case "":
+		return SymlinkConfine, nil
+	case SymlinkConfine, SymlinkFollow, SymlinkRefuse:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown symlink policy %q", name)
+	}
+}
+
+// Clean returns p as a slash-separated path relative to the root, or "."
+// for the root itself. A leading slash is ignored, so "/a" and "a" are the
+// same path. Names containing dots such as "a..b" are kept; only ".."
+// elements that climb above the root are rejected.
+func Clean(p string) (string, error) {
+	cleaned := path.Clean(strings.ReplaceAll(p, `\`, "/"))
+	cleaned = strings.TrimLeft(cleaned, "/")
+	if cleaned == "" {
+		return ".", nil
+	}
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("invalid path %s: %w", p, ErrEscape)
+	}
+	return cleaned, nil
+}
+
+// Join returns the local path of p below root. Unless policy is
+// SymlinkFollow, the links along the existing part of the path are checked:
+// SymlinkRefuse rejects them and SymlinkConfine rejects those resolving
+// outside root. Components that do not exist yet are not links, so paths
+// about to be created are accepted.
+//
+// Join only checks: a link swapped in before the caller uses the returned
+// path is followed, so confinement through Join is best-effort against
+// concurrent changes below root. Open files with OpenFile instead.
+func Join(root, p string, policy SymlinkPolicy) (string, error) {
+	rel, err := Clean(p)
+	if err != nil {
+		return "", err
+	}
+	full := filepath.Join(root, filepath.FromSlash(rel))
+	if policy == SymlinkFollow || rel == "." {
+		return full, nil
+	}
+	if err := beneath(root, rel, policy); err != nil {
+		return "", fmt.Errorf("invalid path %s: %w", p, err)
+	}
+	return full, nil
+}
+
+// OpenFile opens p below root like os.OpenFile, enforcing policy in the
+// same resolution that opens the file. On Linux the file is opened with
+// openat2 and RESOLVE_BENEATH, so a link swapped in after a check cannot
+// redirect the open. Where the kernel cannot do that (other platforms, no
+// openat2, absolute links back into root) the path is checked as by Join
+// and then opened, which leaves a window between check and use.
+func OpenFile(root, p string, policy SymlinkPolicy, flag int, perm os.FileMode) (*os.File, error) {
+	rel, err := Clean(p)
+	if err != nil {
+		return nil, err
+	}
+	full := filepath.Join(root, filepath.FromSlash(rel))
+	if policy == SymlinkFollow {
+		return os.OpenFile(full, flag, perm)
+	}
+	f, err := openBeneath(root, rel, full, policy, flag, perm)
+	if err != errFallback {
+		if err != nil && (errors.Is(err, ErrEscape) || errors.Is(err, ErrSymlink)) {
+			return nil, fmt.Errorf("invalid path %s: %w", p, err)
+		}
+		return f, err
+	}
+	if err := beneath(root, rel, policy); err != nil {
+		return nil, fmt.Errorf("invalid path %s: %w", p, err)
+	}
+	return os.OpenFile(full, flag, perm)
+}
+
+// JoinLink is Join for operations on a link itself, such as Readlink or
+// removing it: the last element of p is not followed, only the directory
+// holding it is checked.
+func JoinLink(root, p string, policy SymlinkPolicy) (string, error) {
+	rel, err := Clean(p)
+	if err != nil {
+		return "", err
+	}
+	dir, err := Join(root, path.Dir(rel), policy)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, path.Base(rel)), nil
+}
+
+// CheckLink returns ErrEscape when a symlink at p pointing to target would
+// lead outside root. Relative targets are resolved from the link's
+// directory; absolute targets must lie below root.
+func CheckLink(root, p, target string) error {
+	if filepath.IsAbs(target) {
+		if _, ok := within([]string{root}, target); !ok {
+			return fmt.Errorf("invalid link target %s: %w", target, ErrEscape)
+		}
+		return nil
+	}
+	rel, err := Clean(p)
+	if err != nil {
+		return err
+	}
+	joined := path.Join(path.Dir(rel), filepath.ToSlash(target))
+	if joined == ".." || strings.HasPrefix(joined, "../") {
+		return fmt.Errorf("invalid link target %s: %w", target, ErrEscape)
+	}
+	return nil
+}
+
+// walk resolves rel below root in userspace, expanding links one component
+// at a time. Errors other than escapes and refused links are left to the
+// operation that uses the path.
+func walk(root, rel string, policy SymlinkPolicy) error {
+	roots := []string{root}
+	if real, err := filepath.EvalSymlinks(root); err == nil && real != root {
+		roots = append(roots, real)
+	}
+	pending := strings.Split(rel, "/")
+	var resolved []string
+	links := 0
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			if len(resolved) == 0 {
+				return ErrEscape
+			}
+			resolved = resolved[:len(resolved)-1]
+			continue
+		}
+		next := filepath.Join(root, filepath.Join(append(resolved, name)...))
+		info, err := os.Lstat(next)
+		if err != nil {
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			resolved = append(resolved, name)
+			continue
+		}
+		if policy == SymlinkRefuse {
+			return ErrSymlink
+		}
+		if links++; links > maxLinks {
+			return fmt.Errorf("too many levels of symbolic links")
+		}
+		target, err := os.Readlink(next)
+		if err != nil {
+			return nil
+		}
+		if filepath.IsAbs(target) {
+			inside, ok := within(roots, target)
+			if !ok {
+				return ErrEscape
+			}
+			target, resolved = inside, nil
+		}
+		pending = append(strings.Split(filepath.ToSlash(target), "/"), pending...)
+	}
+	return nil
+}
+
+// within returns target relative to the first of roots containing it.
+func within(roots []string, target string) (string, bool) {
+	for _, root := range roots {
+		rel, err := filepath.Rel(root, target)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return rel, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,94 @@
+//go:build linux
+// +build linux
+
+package confine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// beneath checks rel with openat2 and RESOLVE_BENEATH, which lets the
+// kernel refuse any resolution step that leaves root. Missing trailing
+// components are stripped until an existing prefix is found. RESOLVE_BENEATH
+// also refuses absolute links that point back inside root, so a refusal is
+// confirmed by the userspace walk, which kernels without openat2 and
+// sandboxes that block it use as well.
+func beneath(root, rel string, policy SymlinkPolicy) error {
+	rootFD, err := unix.Open(root, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return walk(root, rel, policy)
+	}
+	defer unix.Close(rootFD)
+
+	how := unix.OpenHow{
+		Flags:   unix.O_PATH | unix.O_CLOEXEC,
+		Resolve: unix.RESOLVE_BENEATH,
+	}
+	if policy == SymlinkRefuse {
+		how.Resolve |= unix.RESOLVE_NO_SYMLINKS
+	}
+	for p := rel; ; p = filepath.Dir(p) {
+		fd, err := unix.Openat2(rootFD, p, &how)
+		switch {
+		case err == nil:
+			unix.Close(fd)
+			return nil
+		case errors.Is(err, unix.ENOENT) || errors.Is(err, unix.ENOTDIR):
+			if p == "." {
+				return nil
+			}
+		case errors.Is(err, unix.EXDEV):
+			return walk(root, rel, policy)
+		case errors.Is(err, unix.ELOOP):
+			if policy == SymlinkRefuse {
+				return ErrSymlink
+			}
+			return fmt.Errorf("failed to resolve %s: %w", p, err)
+		case errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EPERM) ||
+			errors.Is(err, unix.EINVAL) || errors.Is(err, unix.EAGAIN):
+			return walk(root, rel, policy)
+		default:
+			return nil
+		}
+	}
+}
+
+// openBeneath opens rel below root with openat2 and RESOLVE_BENEATH using
+// the caller's flags, so the confinement holds for the file actually
+// opened. It returns errFallback in the cases where beneath falls back to
+// the userspace walk.
+func openBeneath(root, rel, full string, policy SymlinkPolicy, flag int, perm os.FileMode) (*os.File, error) {
+	rootFD, err := unix.Open(root, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, errFallback
+	}
+	defer unix.Close(rootFD)
+
+	how := unix.OpenHow{
+		Flags:   uint64(flag) | unix.O_CLOEXEC,
+		Resolve: unix.RESOLVE_BENEATH,
+	}
+	if flag&os.O_CREATE != 0 {
+		how.Mode = uint64(perm.Perm())
+	}
+	if policy == SymlinkRefuse {
+		how.Resolve |= unix.RESOLVE_NO_SYMLINKS
+	}
+	fd, err := unix.Openat2(rootFD, rel, &how)
+	switch {
+	case err == nil:
+		return os.NewFile(uintptr(fd), full), nil
+	case errors.Is(err, unix.ELOOP) && policy == SymlinkRefuse:
+		return nil, ErrSymlink
+	case errors.Is(err, unix.EXDEV), errors.Is(err, unix.ENOSYS), errors.Is(err, unix.EPERM),
+		errors.Is(err, unix.EINVAL), errors.Is(err, unix.EAGAIN):
+		return nil, errFallback
+	default:
+		return nil, &os.PathError{Op: "open", Path: full, Err: err}
+	}
+}
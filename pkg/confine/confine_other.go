@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package confine
+
+import "os"
+
+// beneath checks rel with the userspace walk; openat2 is Linux-only.
+func beneath(root, rel string, policy SymlinkPolicy) error {
+	return walk(root, rel, policy)
+}
+
+// openBeneath always falls back to checking and then opening.
+func openBeneath(root, rel, full string, policy SymlinkPolicy, flag int, perm os.FileMode) (*os.File, error) {
+	return nil, errFallback
+}
@@ -0,0 +1,190 @@
+package confine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", "."},
+		{".", "."},
+		{"/", "."},
+		{"a/b", "a/b"},
+		{"/a/b/", "a/b"},
+		{"a/../b", "b"},
+		{"./a/./b", "a/b"},
+		{"a..b/c..", "a..b/c.."},
+		{"...", "..."},
+		{`dir\file.txt`, "dir/file.txt"},
+		{"/../a", "a"},
+	}
+	for _, tt := range tests {
+		got, err := Clean(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+
+	for _, in := range []string{"..", "../a", "a/../../b", `..\a`, "./../a"} {
+		_, err := Clean(in)
+		assert.ErrorIs(t, err, ErrEscape, in)
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	for name, want := range map[string]SymlinkPolicy{
+		"":        SymlinkConfine,
+		"confine": SymlinkConfine,
+		"Follow":  SymlinkFollow,
+		"refuse":  SymlinkRefuse,
+	} {
+		got, err := ParsePolicy(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, want, got, name)
+	}
+	_, err := ParsePolicy("sometimes")
+	assert.Error(t, err)
+}
+
+// tree builds root/{inside/file.txt, in -> inside, up -> ../outside,
+// abs -> <root>/inside, etc -> /etc, dangling -> missing} next to a sibling
+// directory outside.
+func tree(t *testing.T) string {
+	t.Helper()
+	parent := t.TempDir()
+	root := filepath.Join(parent, "root")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "inside"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(parent, "outside"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "inside", "file.txt"), []byte("x"), 0644))
+	links := map[string]string{
+		"in":       "inside",
+		"up":       "../outside",
+		"abs":      filepath.Join(root, "inside"),
+		"etc":      "/etc",
+		"dangling": "missing",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skip("symlinks not supported on this filesystem")
+		}
+	}
+	return root
+}
+
+func TestJoin(t *testing.T) {
+	root := tree(t)
+	checks := map[string]func(root, rel string, policy SymlinkPolicy) error{
+		"kernel": beneath,
+		"walk":   walk,
+	}
+	tests := []struct {
+		path    string
+		confine error
+		refuse  error
+	}{
+		{"inside/file.txt", nil, nil},
+		{"inside/new/deeper.txt", nil, nil},
+		{"in/file.txt", nil, ErrSymlink},
+		{"in/../in/file.txt", nil, ErrSymlink},
+		{"abs/file.txt", nil, ErrSymlink},
+		{"dangling", nil, ErrSymlink},
+		{"up", ErrEscape, ErrSymlink},
+		{"up/new.txt", ErrEscape, ErrSymlink},
+		{"etc/passwd", ErrEscape, ErrSymlink},
+	}
+	for name, check := range checks {
+		for _, tt := range tests {
+			assert.ErrorIs(t, check(root, tt.path, SymlinkConfine), tt.confine, "%s confine %s", name, tt.path)
+			assert.ErrorIs(t, check(root, tt.path, SymlinkRefuse), tt.refuse, "%s refuse %s", name, tt.path)
+		}
+	}
+
+	got, err := Join(root, "/in/file.txt", SymlinkConfine)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "in", "file.txt"), got)
+
+	got, err = Join(root, "up/new.txt", SymlinkFollow)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "up", "new.txt"), got)
+
+	_, err = Join(root, "up/new.txt", SymlinkConfine)
+	assert.ErrorIs(t, err, ErrEscape)
+	_, err = Join(root, "../root/inside", SymlinkFollow)
+	assert.ErrorIs(t, err, ErrEscape)
+}
+
+func TestOpenFile(t *testing.T) {
+	root := tree(t)
+
+	f, err := OpenFile(root, "in/file.txt", SymlinkConfine, os.O_RDONLY, 0)
+	require.NoError(t, err)
+	f.Close()
+	f, err = OpenFile(root, "abs/file.txt", SymlinkConfine, os.O_RDONLY, 0)
+	require.NoError(t, err, "absolute links back into root are allowed")
+	f.Close()
+	f, err = OpenFile(root, "in/new.txt", SymlinkConfine, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	require.NoError(t, err)
+	f.Close()
+	assert.FileExists(t, filepath.Join(root, "inside", "new.txt"))
+
+	_, err = OpenFile(root, "up/new.txt", SymlinkConfine, os.O_WRONLY|os.O_CREATE, 0644)
+	assert.ErrorIs(t, err, ErrEscape)
+	assert.NoFileExists(t, filepath.Join(filepath.Dir(root), "outside", "new.txt"))
+	_, err = OpenFile(root, "etc/passwd", SymlinkConfine, os.O_RDONLY, 0)
+	assert.ErrorIs(t, err, ErrEscape)
+	_, err = OpenFile(root, "in/file.txt", SymlinkRefuse, os.O_RDONLY, 0)
+	assert.ErrorIs(t, err, ErrSymlink)
+	_, err = OpenFile(root, "inside/missing.txt", SymlinkConfine, os.O_RDONLY, 0)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = OpenFile(root, "../x", SymlinkFollow, os.O_RDONLY, 0)
+	assert.ErrorIs(t, err, ErrEscape)
+
+	f, err = OpenFile(root, "up", SymlinkFollow, os.O_RDONLY, 0)
+	require.NoError(t, err, "follow trusts all links")
+	f.Close()
+}
+
+func TestWalk_LinkLoop(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Symlink("b", filepath.Join(root, "a")); err != nil {
+		t.Skip("symlinks not supported on this filesystem")
+	}
+	require.NoError(t, os.Symlink("a", filepath.Join(root, "b")))
+	assert.Error(t, walk(root, "a/file", SymlinkConfine))
+}
+
+func TestJoinLink(t *testing.T) {
+	root := tree(t)
+
+	got, err := JoinLink(root, "up", SymlinkConfine)
+	require.NoError(t, err, "the link itself may be addressed")
+	assert.Equal(t, filepath.Join(root, "up"), got)
+
+	got, err = JoinLink(root, "in/file.txt", SymlinkConfine)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "in", "file.txt"), got)
+
+	_, err = JoinLink(root, "up/new.txt", SymlinkConfine)
+	assert.ErrorIs(t, err, ErrEscape)
+	_, err = JoinLink(root, "in/file.txt", SymlinkRefuse)
+	assert.ErrorIs(t, err, ErrSymlink)
+	_, err = JoinLink(root, "../x", SymlinkFollow)
+	assert.ErrorIs(t, err, ErrEscape)
+}
+
+func TestCheckLink(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, CheckLink(root, "a/link", "../b/file"))
+	assert.NoError(t, CheckLink(root, "a/link", "sub/file"))
+	assert.NoError(t, CheckLink(root, "link", filepath.Join(root, "a")))
+	assert.ErrorIs(t, CheckLink(root, "link", "../outside"), ErrEscape)
+	assert.ErrorIs(t, CheckLink(root, "a/link", "../../outside"), ErrEscape)
+	assert.ErrorIs(t, CheckLink(root, "link", "/etc/passwd"), ErrEscape)
+}
@@ -0,0 +1,344 @@
+// Package crypt provides a client.Client decorator that encrypts file
+// contents, and optionally names, before they reach the wrapped client.
+// Contents use an authenticated, segmented format (AES-256-GCM or
+// XChaCha20-Poly1305 per segment) that supports random access, so
+// OpenSeekable keeps working over seekable backends.
+package crypt
+
+import (
+	"context"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// DefaultSegmentSize is the plaintext size of a segment when
+// Options.SegmentSize is zero.
+const DefaultSegmentSize = 64 << 10
+
+// ErrCorrupt is returned, possibly wrapped, when a file or name fails
+// authentication or is not in the encrypted format.
+var ErrCorrupt = errors.New("encrypted data is corrupt or was tampered with")
+
+// Options configures the encryption.
+type Options struct {
+	// Keys supplies the master keys. Required.
+	Keys KeyProvider
+	// Cipher encrypts new files (default CipherAESGCM). Files record their
+	// cipher, so it can be changed later.
+	Cipher Cipher
+	// SegmentSize is the plaintext size of a segment, a power of two from
+	// 1 KiB to 16 MiB (default DefaultSegmentSize). Sizes reported by
+	// GetFileInfo and ListDirectory assume every file uses it.
+	SegmentSize int
+	// EncryptNames encrypts file and directory names. Names are
+	// deterministic per element, so equal names encrypt equally, and may
+	// be at most MaxNameLength bytes.
+	EncryptNames bool
+	// NameKeyID selects the key for names (default the current key at the
+	// first use). Set it before rotating keys with EncryptNames, since
+	// names encrypted with one key cannot be found with another.
+	NameKeyID string
+}
+
+// Client wraps a client.Client and encrypts everything written through it.
+type Client struct {
+	client.Client
+
+	opts Options
+
+	mu    sync.Mutex
+	names *nameCipher
+}
+
+// New wraps c with encryption.
+func New(c client.Client, opts Options) (*Client, error) {
+	if opts.Keys == nil {
+		return nil, fmt.Errorf("crypt: a key provider is required")
+	}
+	if opts.Cipher == "" {
+		opts.Cipher = CipherAESGCM
+	}
+	if _, ok := cipherCodes[opts.Cipher]; !ok {
+		return nil, fmt.Errorf("crypt: unknown cipher %q (supported: %s)", opts.Cipher, cipherNames())
+	}
+	if opts.SegmentSize == 0 {
+		opts.SegmentSize = DefaultSegmentSize
+	}
+	if !validSegmentSize(opts.SegmentSize) {
+		return nil, fmt.Errorf("crypt: segment size %d is not a power of two from 1 KiB to 16 MiB", opts.SegmentSize)
+	}
+	return &Client{Client: c, opts: opts}, nil
+}
+
+// Unwrap returns the wrapped client.
+func (c *Client) Unwrap() client.Client {
+	return c.Client
+}
+
+// WriteFile encrypts data with the current key as it is uploaded.
+func (c *Client) WriteFile(ctx context.Context, path string, data io.Reader) error {
+	stored, err := c.storedPath(ctx, path)
+	if err != nil {
+		return err
+	}
+	id, key, err := c.opts.Keys.CurrentKey(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get encryption key: %w", err)
+	}
+	if err := checkKey(id, key); err != nil {
+		return err
+	}
+	hdr, err := newHeader(c.opts.Cipher, c.opts.SegmentSize, id)
+	if err != nil {
+		return err
+	}
+	aead, err := hdr.aead(key)
+	if err != nil {
+		return err
+	}
+	return c.Client.WriteFile(ctx, stored, newEncrypter(data, aead, hdr))
+}
+
+// ReadFile returns a reader that decrypts and verifies path as it is read.
+func (c *Client) ReadFile(ctx context.Context, path string) (io.ReadCloser, error) {
+	stored, err := c.storedPath(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := c.Client.ReadFile(ctx, stored)
+	if err != nil {
+		return nil, err
+	}
+	hdr, err := readHeader(rc)
+	if err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	aead, err := c.fileAEAD(ctx, hdr)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return &decrypter{src: rc, aead: aead, hdr: hdr, buf: make([]byte, hdr.seg+overhead)}, nil
+}
+
+// OpenSeekable decrypts path segment by segment at any offset. The wrapped
+// client must be a client.SeekableClient.
+func (c *Client) OpenSeekable(ctx context.Context, path string) (client.ReadSeekCloser, error) {
+	sc, ok := c.Client.(client.SeekableClient)
+	if !ok {
+		return nil, fmt.Errorf("open seekable %s: %w", path, client.ErrNotSupported)
+	}
+	stored, err := c.storedPath(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	src, err := sc.OpenSeekable(ctx, stored)
+	if err != nil {
+		return nil, err
+	}
+	hdr, err := readHeader(src)
+	if err != nil {
+		src.Close()
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	aead, err := c.fileAEAD(ctx, hdr)
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+	s, err := newSeeker(src, aead, hdr)
+	if err != nil {
+		src.Close()
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// GetFileInfo reports the plaintext name and size of path.
+func (c *Client) GetFileInfo(ctx context.Context, path string) (*client.FileInfo, error) {
+	stored, err := c.storedPath(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := c.Client.GetFileInfo(ctx, stored)
+	if err != nil {
+		return nil, err
+	}
+	if c.opts.EncryptNames && info.Name != "" {
+		info.Name = lastElement(path, info.Name)
+	}
+	if info.Path != "" {
+		info.Path = path
+	}
+	c.plainSize(info)
+	return info, nil
+}
+
+// ListDirectory lists path with plaintext names and sizes. Entries whose
+// names do not decrypt, such as files not written through an encrypting
+// client, are left out.
+func (c *Client) ListDirectory(ctx context.Context, path string) ([]*client.FileInfo, error) {
+	stored, err := c.storedPath(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	files, err := c.Client.ListDirectory(ctx, stored)
+	if err != nil {
+		return nil, err
+	}
+	names, err := c.nameCipher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := files[:0]
+	for _, f := range files {
+		if names != nil {
+			name, err := names.decrypt(f.Name)
+			if err != nil {
+				continue
+			}
+			f.Name = name
+			if f.Path != "" {
+				f.Path = client.JoinPath(path, name)
+			}
+		}
+		c.plainSize(f)
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// FileExists checks the stored path of path.
+func (c *Client) FileExists(ctx context.Context, path string) (bool, error) {
+	stored, err := c.storedPath(ctx, path)
+	if err != nil {
+		return false, err
+	}
+	return c.Client.FileExists(ctx, stored)
+}
+
+// DeleteFile deletes the stored path of path.
+func (c *Client) DeleteFile(ctx context.Context, path string) error {
+	stored, err := c.storedPath(ctx, path)
+	if err != nil {
+		return err
+	}
+	return c.Client.DeleteFile(ctx, stored)
+}
+
+// CopyFile copies the encrypted file, which stays readable under the new
+// name because names are not part of the authenticated data.
+func (c *Client) CopyFile(ctx context.Context, srcPath, dstPath string) error {
+	src, err := c.storedPath(ctx, srcPath)
+	if err != nil {
+		return err
+	}
+	dst, err := c.storedPath(ctx, dstPath)
+	if err != nil {
+		return err
+	}
+	return c.Client.CopyFile(ctx, src, dst)
+}
+
+// CreateDirectory creates the stored path of path.
+func (c *Client) CreateDirectory(ctx context.Context, path string) error {
+	stored, err := c.storedPath(ctx, path)
+	if err != nil {
+		return err
+	}
+	return c.Client.CreateDirectory(ctx, stored)
+}
+
+// DeleteDirectory deletes the stored path of path.
+func (c *Client) DeleteDirectory(ctx context.Context, path string) error {
+	stored, err := c.storedPath(ctx, path)
+	if err != nil {
+		return err
+	}
+	return c.Client.DeleteDirectory(ctx, stored)
+}
+
+// StoredPath returns the path on the wrapped client that holds path.
+func (c *Client) StoredPath(ctx context.Context, path string) (string, error) {
+	return c.storedPath(ctx, path)
+}
+
+func (c *Client) storedPath(ctx context.Context, p string) (string, error) {
+	names, err := c.nameCipher(ctx)
+	if err != nil || names == nil {
+		return p, err
+	}
+	return names.encryptPath(p)
+}
+
+// nameCipher returns the name cipher, or nil when names are stored in
+// plaintext.
+func (c *Client) nameCipher(ctx context.Context) (*nameCipher, error) {
+	if !c.opts.EncryptNames {
+		return nil, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.names != nil {
+		return c.names, nil
+	}
+	var key []byte
+	var err error
+	id := c.opts.NameKeyID
+	if id == "" {
+		id, key, err = c.opts.Keys.CurrentKey(ctx)
+	} else {
+		key, err = c.opts.Keys.Key(ctx, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get name encryption key: %w", err)
+	}
+	if err := checkKey(id, key); err != nil {
+		return nil, err
+	}
+	names, err := newNameCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	c.names = names
+	return names, nil
+}
+
+// fileAEAD returns the AEAD for a file with hdr.
+func (c *Client) fileAEAD(ctx context.Context, hdr *header) (cipher.AEAD, error) {
+	key, err := c.opts.Keys.Key(ctx, hdr.keyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get decryption key: %w", err)
+	}
+	if err := checkKey(hdr.keyID, key); err != nil {
+		return nil, err
+	}
+	return hdr.aead(key)
+}
+
+// plainSize replaces the stored size of a file with its plaintext size.
+func (c *Client) plainSize(info *client.FileInfo) {
+	if info.IsDir || info.LinkType == client.LinkSymlink {
+		return
+	}
+	if size, ok := PlaintextSize(info.Size, c.opts.SegmentSize); ok {
+		info.Size = size
+	}
+}
+
+// lastElement returns the base name of p, or fallback for the root.
+func lastElement(p, fallback string) string {
+	p = strings.TrimRight(p, "/")
+	if p == "" {
+		return fallback
+	}
+	return path.Base(p)
+}
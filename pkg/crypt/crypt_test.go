@@ -0,0 +1,289 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"digital.vasic.filesystem/internal/testutil"
+	"digital.vasic.filesystem/pkg/client"
+)
+
+var _ client.SeekableClient = (*Client)(nil)
+
+const segment = 1024
+
+func key(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+// newCrypt wraps l with opts, defaulting to key 1 and small segments.
+func newCrypt(t *testing.T, l client.Client, opts Options) *Client {
+	t.Helper()
+	if opts.Keys == nil {
+		opts.Keys = NewStaticKey("k1", key(1))
+	}
+	if opts.SegmentSize == 0 {
+		opts.SegmentSize = segment
+	}
+	c, err := New(l, opts)
+	require.NoError(t, err)
+	return c
+}
+
+func TestSizes(t *testing.T) {
+	for _, n := range []int64{0, 1, segment - 1, segment, segment + 1, 5*segment + 17} {
+		size := CiphertextSize(n, segment)
+		got, ok := PlaintextSize(size, segment)
+		assert.True(t, ok, n)
+		assert.Equal(t, n, got, n)
+	}
+	_, ok := PlaintextSize(headerSize+overhead-1, segment)
+	assert.False(t, ok)
+	_, ok = PlaintextSize(headerSize+segment+overhead+3, segment)
+	assert.False(t, ok, "a partial tag cannot end a file")
+}
+
+func TestClient_RoundTrip(t *testing.T) {
+	for _, ciph := range []Cipher{CipherAESGCM, CipherXChaCha20Poly1305} {
+		l, dir := testutil.NewLocal(t)
+		c := newCrypt(t, l, Options{Cipher: ciph})
+		ctx := context.Background()
+		for _, n := range []int{0, 10, segment, 3*segment + 5} {
+			data := testutil.Random(int64(n), n)
+			name := "d/" + string(rune('a'+n%26)) + ".bin"
+			require.NoError(t, c.WriteFile(ctx, name, bytes.NewReader(data)), ciph)
+
+			got, err := testutil.ReadFile(c, name)
+			require.NoError(t, err, ciph)
+			assert.Equal(t, data, got, "%s %d", ciph, n)
+
+			info, err := c.GetFileInfo(ctx, name)
+			require.NoError(t, err)
+			assert.Equal(t, int64(n), info.Size, "plaintext size")
+
+			raw, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+			require.NoError(t, err)
+			assert.Equal(t, CiphertextSize(int64(n), segment), int64(len(raw)))
+			if n > 0 {
+				assert.False(t, bytes.Contains(raw, data[:min(n, 16)]), "contents are encrypted")
+			}
+		}
+		files, err := c.ListDirectory(ctx, "d")
+		require.NoError(t, err)
+		for _, f := range files {
+			assert.Contains(t, []int64{0, 10, segment, 3*segment + 5}, f.Size, f.Name)
+		}
+	}
+}
+
+func TestClient_OpenSeekable(t *testing.T) {
+	l, _ := testutil.NewLocal(t)
+	c := newCrypt(t, l, Options{})
+	ctx := context.Background()
+	data := testutil.Random(1, 10*segment+123)
+	require.NoError(t, c.WriteFile(ctx, "f.bin", bytes.NewReader(data)))
+
+	r, err := c.OpenSeekable(ctx, "f.bin")
+	require.NoError(t, err)
+	defer r.Close()
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 50; i++ {
+		off := rng.Int63n(int64(len(data)))
+		n := rng.Intn(3 * segment)
+		_, err := r.Seek(off, io.SeekStart)
+		require.NoError(t, err)
+		buf := make([]byte, n)
+		got, _ := io.ReadFull(r, buf)
+		assert.Equal(t, data[off:off+int64(got)], buf[:got])
+		assert.Equal(t, min(n, len(data)-int(off)), got)
+	}
+	end, err := r.Seek(0, io.SeekEnd)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), end)
+}
+
+// flip inverts one byte of the stored file p at off.
+func flip(t *testing.T, p string, off int) {
+	t.Helper()
+	raw, err := os.ReadFile(p)
+	require.NoError(t, err)
+	raw[off] ^= 1
+	require.NoError(t, os.WriteFile(p, raw, 0644))
+}
+
+func TestClient_Tampering(t *testing.T) {
+	l, dir := testutil.NewLocal(t)
+	c := newCrypt(t, l, Options{})
+	ctx := context.Background()
+	data := testutil.Random(3, 3*segment+10)
+	write := func() string {
+		require.NoError(t, c.WriteFile(ctx, "f.bin", bytes.NewReader(data)))
+		return filepath.Join(dir, "f.bin")
+	}
+
+	flip(t, write(), headerSize+segment+5)
+	_, err := testutil.ReadFile(c, "f.bin")
+	assert.ErrorIs(t, err, ErrCorrupt, "modified segment")
+
+	flip(t, write(), 40)
+	_, err = testutil.ReadFile(c, "f.bin")
+	assert.ErrorIs(t, err, ErrCorrupt, "modified salt")
+
+	p := write()
+	raw, err := os.ReadFile(p)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(p, raw[:headerSize+2*(segment+overhead)], 0644))
+	_, err = testutil.ReadFile(c, "f.bin")
+	assert.ErrorIs(t, err, ErrCorrupt, "truncated at a segment boundary")
+	_, err = c.OpenSeekable(ctx, "f.bin")
+	assert.ErrorIs(t, err, ErrCorrupt)
+
+	// Cut inside the tag after two full segments: the size still looks
+	// like a valid two-segment file whose empty final segment is missing.
+	p = write()
+	raw, err = os.ReadFile(p)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(p, raw[:headerSize+2*(segment+overhead)+overhead], 0644))
+	_, err = testutil.ReadFile(c, "f.bin")
+	assert.ErrorIs(t, err, ErrCorrupt, "truncated inside a tag")
+	_, err = c.OpenSeekable(ctx, "f.bin")
+	assert.ErrorIs(t, err, ErrCorrupt, "truncated inside a tag, seekable")
+
+	p = write()
+	raw, err = os.ReadFile(p)
+	require.NoError(t, err)
+	seg := segment + overhead
+	swapped := append([]byte(nil), raw[:headerSize]...)
+	swapped = append(swapped, raw[headerSize+seg:headerSize+2*seg]...)
+	swapped = append(swapped, raw[headerSize:headerSize+seg]...)
+	swapped = append(swapped, raw[headerSize+2*seg:]...)
+	require.NoError(t, os.WriteFile(p, swapped, 0644))
+	_, err = testutil.ReadFile(c, "f.bin")
+	assert.ErrorIs(t, err, ErrCorrupt, "reordered segments")
+
+	require.NoError(t, os.WriteFile(p, []byte("plain text, not encrypted at all, long enough for a header......"), 0644))
+	_, err = testutil.ReadFile(c, "f.bin")
+	assert.ErrorIs(t, err, ErrCorrupt)
+}
+
+func TestClient_Keys(t *testing.T) {
+	keys := NewStaticKey("old", key(1))
+	l, _ := testutil.NewLocal(t)
+	c := newCrypt(t, l, Options{Keys: keys})
+	ctx := context.Background()
+	require.NoError(t, c.WriteFile(ctx, "a.txt", bytes.NewReader([]byte("before rotation"))))
+
+	keys.Keys["new"] = key(2)
+	keys.Current = "new"
+	require.NoError(t, c.WriteFile(ctx, "b.txt", bytes.NewReader([]byte("after rotation"))))
+	got, err := testutil.ReadFile(c, "a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "before rotation", string(got), "old files keep their key")
+	got, err = testutil.ReadFile(c, "b.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "after rotation", string(got))
+
+	delete(keys.Keys, "old")
+	_, err = testutil.ReadFile(c, "a.txt")
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	other, err := New(l, Options{Keys: NewStaticKey("new", key(3)), SegmentSize: segment})
+	require.NoError(t, err)
+	_, err = testutil.ReadFile(other, "b.txt")
+	assert.ErrorIs(t, err, ErrCorrupt, "a different key with the same ID fails authentication")
+
+	for _, opts := range []Options{
+		{},
+		{Keys: keys, Cipher: "rot13"},
+		{Keys: keys, SegmentSize: 1000},
+		{Keys: keys, SegmentSize: 512},
+	} {
+		_, err := New(l, opts)
+		assert.Error(t, err, "%+v", opts)
+	}
+	bad, err := New(l, Options{Keys: NewStaticKey("short", []byte("too short"))})
+	require.NoError(t, err)
+	assert.Error(t, bad.WriteFile(ctx, "x", bytes.NewReader(nil)))
+	long, err := New(l, Options{Keys: NewStaticKey("an-id-that-is-far-too-long", key(1))})
+	require.NoError(t, err)
+	assert.Error(t, long.WriteFile(ctx, "x", bytes.NewReader(nil)))
+}
+
+func TestClient_EncryptNames(t *testing.T) {
+	l, dir := testutil.NewLocal(t)
+	c := newCrypt(t, l, Options{EncryptNames: true})
+	ctx := context.Background()
+	require.NoError(t, c.CreateDirectory(ctx, "Holidays"))
+	require.NoError(t, c.WriteFile(ctx, "Holidays/Beach Photo.JPG", bytes.NewReader([]byte("jpeg"))))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.NotContains(t, entries[0].Name(), "Holidays")
+	assert.Regexp(t, "^[a-z2-7]+$", entries[0].Name(), "names survive case-insensitive servers")
+
+	stored, err := c.StoredPath(ctx, "Holidays/Beach Photo.JPG")
+	require.NoError(t, err)
+	exists, err := l.FileExists(ctx, stored)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	require.NoError(t, l.WriteFile(ctx, "stray.txt", bytes.NewReader([]byte("not through crypt"))))
+	root, err := c.ListDirectory(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, root, 1, "names that do not decrypt are left out")
+	assert.Equal(t, "Holidays", root[0].Name)
+	files, err := c.ListDirectory(ctx, "Holidays")
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "Beach Photo.JPG", files[0].Name)
+	assert.Equal(t, int64(4), files[0].Size)
+
+	info, err := c.GetFileInfo(ctx, "Holidays/Beach Photo.JPG")
+	require.NoError(t, err)
+	assert.Equal(t, "Beach Photo.JPG", info.Name)
+	exists, err = c.FileExists(ctx, "Holidays/Beach Photo.JPG")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	require.NoError(t, c.CopyFile(ctx, "Holidays/Beach Photo.JPG", "Holidays/copy.jpg"))
+	got, err := testutil.ReadFile(c, "Holidays/copy.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, "jpeg", string(got))
+	require.NoError(t, c.DeleteFile(ctx, "Holidays/copy.jpg"))
+
+	names, err := c.nameCipher(ctx)
+	require.NoError(t, err)
+	enc, err := names.encrypt("x")
+	require.NoError(t, err)
+	tampered := "a" + enc[1:]
+	if enc[0] == 'a' {
+		tampered = "b" + enc[1:]
+	}
+	_, err = names.decrypt(tampered)
+	assert.ErrorIs(t, err, ErrCorrupt)
+	_, err = names.encrypt(string(bytes.Repeat([]byte("n"), MaxNameLength+1)))
+	assert.Error(t, err)
+	long, err := names.encrypt(string(bytes.Repeat([]byte("n"), MaxNameLength)))
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(long), 255)
+}
+
+// plainOnly hides the SeekableClient of the wrapped client.
+type plainOnly struct{ client.Client }
+
+func TestClient_OpenSeekable_NotSupported(t *testing.T) {
+	l, _ := testutil.NewLocal(t)
+	c, err := New(plainOnly{l}, Options{Keys: NewStaticKey("k", key(1))})
+	require.NoError(t, err)
+	_, err = c.OpenSeekable(context.Background(), "f")
+	assert.ErrorIs(t, err, client.ErrNotSupported)
+}
@@ -0,0 +1,358 @@
+package crypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// Encrypted files consist of a fixed-size header followed by segments.
+// Every segment but the last holds SegmentSize bytes of plaintext; the last
+// holds fewer, possibly none, so truncation at a segment boundary is
+// detected. Each segment is sealed with a per-file key derived from the
+// master key and the header's random salt, a nonce built from the segment
+// index and a final-segment flag, and the header as additional data.
+//
+//	magic "VFSCRYPT" (8) | version (1) | cipher (1) | log2 segment size (1)
+//	| key ID length (1) | key ID, zero padded (16) | salt (32)
+const (
+	headerSize = 8 + 1 + 1 + 1 + 1 + MaxKeyIDLength + saltSize
+	saltSize   = 32
+	// overhead is the authentication tag added to every segment.
+	overhead      = 16
+	formatVersion = 1
+)
+
+var magic = []byte("VFSCRYPT")
+
+// Cipher selects the AEAD used for file contents.
+type Cipher string
+
+const (
+	// CipherAESGCM is AES-256-GCM.
+	CipherAESGCM Cipher = "aes-256-gcm"
+	// CipherXChaCha20Poly1305 is XChaCha20-Poly1305, faster than AES-GCM
+	// on CPUs without AES instructions.
+	CipherXChaCha20Poly1305 Cipher = "xchacha20-poly1305"
+)
+
+// cipherCodes maps ciphers to their header byte.
+var cipherCodes = map[Cipher]byte{CipherAESGCM: 1, CipherXChaCha20Poly1305: 2}
+
+// header is the decoded file header; raw is its encoding, authenticated
+// with every segment.
+type header struct {
+	cipher Cipher
+	seg    int
+	keyID  string
+	salt   []byte
+	raw    []byte
+}
+
+// newHeader returns a header with a fresh salt.
+func newHeader(c Cipher, seg int, keyID string) (*header, error) {
+	h := &header{cipher: c, seg: seg, keyID: keyID, salt: make([]byte, saltSize)}
+	if _, err := rand.Read(h.salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	raw := make([]byte, 0, headerSize)
+	raw = append(raw, magic...)
+	raw = append(raw, formatVersion, cipherCodes[c], byte(bits.Len(uint(seg))-1), byte(len(keyID)))
+	id := make([]byte, MaxKeyIDLength)
+	copy(id, keyID)
+	raw = append(raw, id...)
+	h.raw = append(raw, h.salt...)
+	return h, nil
+}
+
+// readHeader reads and decodes a header from r.
+func readHeader(r io.Reader) (*header, error) {
+	raw := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("%w: short header", ErrCorrupt)
+		}
+		return nil, err
+	}
+	if string(raw[:8]) != string(magic) {
+		return nil, fmt.Errorf("%w: not an encrypted file", ErrCorrupt)
+	}
+	if raw[8] != formatVersion {
+		return nil, fmt.Errorf("%w: unknown format version %d", ErrCorrupt, raw[8])
+	}
+	h := &header{raw: raw}
+	for c, code := range cipherCodes {
+		if raw[9] == code {
+			h.cipher = c
+		}
+	}
+	if h.cipher == "" {
+		return nil, fmt.Errorf("%w: unknown cipher %d", ErrCorrupt, raw[9])
+	}
+	if raw[10] < minSegmentShift || raw[10] > maxSegmentShift {
+		return nil, fmt.Errorf("%w: invalid segment size", ErrCorrupt)
+	}
+	h.seg = 1 << raw[10]
+	if int(raw[11]) > MaxKeyIDLength {
+		return nil, fmt.Errorf("%w: invalid key ID", ErrCorrupt)
+	}
+	h.keyID = string(raw[12 : 12+int(raw[11])])
+	h.salt = raw[12+MaxKeyIDLength:]
+	return h, nil
+}
+
+// Segment sizes are powers of two from 1 KiB to 16 MiB.
+const (
+	minSegmentShift = 10
+	maxSegmentShift = 24
+)
+
+// aead derives the file key from master and the salt and returns the AEAD.
+func (h *header) aead(master []byte) (cipher.AEAD, error) {
+	key, err := hkdf.Key(sha256.New, master, h.salt, "digital.vasic.filesystem/crypt/v1 content", 32)
+	if err != nil {
+		return nil, err
+	}
+	switch h.cipher {
+	case CipherAESGCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case CipherXChaCha20Poly1305:
+		return chacha20poly1305.NewX(key)
+	default:
+		return nil, fmt.Errorf("unknown cipher %q", h.cipher)
+	}
+}
+
+// nonce returns the nonce of segment index.
+func nonce(aead cipher.AEAD, index uint64, final bool) []byte {
+	n := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(n[len(n)-8:], index)
+	if final {
+		n[0] = 1
+	}
+	return n
+}
+
+// PlaintextSize returns the plaintext size of an encrypted file of
+// cipherSize bytes written with segment size seg, or false when no
+// encrypted file has that size.
+func PlaintextSize(cipherSize int64, seg int) (int64, bool) {
+	body := cipherSize - headerSize
+	if body < overhead {
+		return 0, false
+	}
+	full := int64(seg + overhead)
+	k := body / full
+	r := body - k*full
+	if r < overhead {
+		return 0, false
+	}
+	return k*int64(seg) + r - overhead, true
+}
+
+// CiphertextSize returns the size of the encrypted form of plain bytes.
+func CiphertextSize(plain int64, seg int) int64 {
+	return headerSize + plain + overhead*(plain/int64(seg)+1)
+}
+
+// encrypter encrypts src as it is read: the header, then one sealed
+// segment at a time.
+type encrypter struct {
+	src   io.Reader
+	aead  cipher.AEAD
+	hdr   *header
+	plain []byte
+	buf   []byte
+	out   []byte
+	index uint64
+	done  bool
+}
+
+func newEncrypter(src io.Reader, aead cipher.AEAD, hdr *header) *encrypter {
+	return &encrypter{
+		src:   src,
+		aead:  aead,
+		hdr:   hdr,
+		plain: make([]byte, hdr.seg),
+		buf:   make([]byte, 0, hdr.seg+overhead),
+		out:   hdr.raw,
+	}
+}
+
+func (e *encrypter) Read(p []byte) (int, error) {
+	for len(e.out) == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(e.src, e.plain)
+		final := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !final {
+			return 0, err
+		}
+		e.out = e.aead.Seal(e.buf[:0], nonce(e.aead, e.index, final), e.plain[:n], e.hdr.raw)
+		e.index++
+		e.done = final
+	}
+	n := copy(p, e.out)
+	e.out = e.out[n:]
+	return n, nil
+}
+
+// decrypter decrypts a stream read from its start.
+type decrypter struct {
+	src   io.ReadCloser
+	aead  cipher.AEAD
+	hdr   *header
+	buf   []byte
+	plain []byte
+	index uint64
+	done  bool
+}
+
+func (d *decrypter) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(d.src, d.buf)
+		final := err == io.ErrUnexpectedEOF
+		switch {
+		case err == io.EOF:
+			return 0, fmt.Errorf("%w: truncated", ErrCorrupt)
+		case err != nil && !final:
+			return 0, err
+		}
+		plain, err := d.aead.Open(d.buf[:0], nonce(d.aead, d.index, final), d.buf[:n], d.hdr.raw)
+		if err != nil {
+			return 0, fmt.Errorf("%w: segment %d", ErrCorrupt, d.index)
+		}
+		d.plain = plain
+		d.index++
+		d.done = final
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+func (d *decrypter) Close() error {
+	return d.src.Close()
+}
+
+// seeker decrypts the segments of a seekable source on demand, holding the
+// current one.
+type seeker struct {
+	src   client.ReadSeekCloser
+	aead  cipher.AEAD
+	hdr   *header
+	size  int64
+	pos   int64
+	index int64
+	buf   []byte
+	plain []byte
+}
+
+// newSeeker returns a seeker over src. When the plaintext fills its last
+// segment exactly, the empty final segment is authenticated here: reads
+// never reach it, and without it a file cut after a segment's tag would
+// pass as a shorter one.
+func newSeeker(src client.ReadSeekCloser, aead cipher.AEAD, hdr *header) (*seeker, error) {
+	end, err := src.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	size, ok := PlaintextSize(end, hdr.seg)
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid size %d", ErrCorrupt, end)
+	}
+	s := &seeker{src: src, aead: aead, hdr: hdr, size: size, index: -1, buf: make([]byte, hdr.seg+overhead)}
+	if size%int64(hdr.seg) == 0 {
+		if err := s.load(size / int64(hdr.seg)); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *seeker) Read(p []byte) (int, error) {
+	if s.pos >= s.size {
+		return 0, io.EOF
+	}
+	i := s.pos / int64(s.hdr.seg)
+	if i != s.index {
+		if err := s.load(i); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, s.plain[s.pos-i*int64(s.hdr.seg):])
+	s.pos += int64(n)
+	return n, nil
+}
+
+// load reads and opens segment i.
+func (s *seeker) load(i int64) error {
+	s.index = -1
+	if _, err := s.src.Seek(headerSize+i*int64(s.hdr.seg+overhead), io.SeekStart); err != nil {
+		return err
+	}
+	n, err := io.ReadFull(s.src, s.buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	final := i == s.size/int64(s.hdr.seg)
+	plain, err := s.aead.Open(s.buf[:0], nonce(s.aead, uint64(i), final), s.buf[:n], s.hdr.raw)
+	if err != nil {
+		return fmt.Errorf("%w: segment %d", ErrCorrupt, i)
+	}
+	s.plain, s.index = plain, i
+	return nil
+}
+
+func (s *seeker) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = s.pos + offset
+	case io.SeekEnd:
+		abs = s.size + offset
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if abs < 0 {
+		return 0, fmt.Errorf("negative position %d", abs)
+	}
+	s.pos = abs
+	return abs, nil
+}
+
+func (s *seeker) Close() error {
+	return s.src.Close()
+}
+
+// validSegmentSize reports whether seg can be stored in a header.
+func validSegmentSize(seg int) bool {
+	shift := bits.Len(uint(seg)) - 1
+	return seg > 0 && seg&(seg-1) == 0 && shift >= minSegmentShift && shift <= maxSegmentShift
+}
+
+// cipherNames lists the supported ciphers for error messages.
+func cipherNames() string {
+	return strings.Join([]string{string(CipherAESGCM), string(CipherXChaCha20Poly1305)}, ", ")
+}
@@ -0,0 +1,68 @@
+package crypt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// KeySize is the length of master keys in bytes.
+const KeySize = 32
+
+// MaxKeyIDLength bounds key IDs, which are stored in every file header.
+const MaxKeyIDLength = 16
+
+// ErrUnknownKey is returned, possibly wrapped, by a KeyProvider that has no
+// key with the requested ID.
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// KeyProvider supplies master keys. New files are encrypted with the
+// current key and record its ID, so older files stay readable after the
+// current key changes as long as Key still returns their key.
+type KeyProvider interface {
+	// CurrentKey returns the ID and the KeySize-byte key for new files.
+	CurrentKey(ctx context.Context) (id string, key []byte, err error)
+	// Key returns the key with id.
+	Key(ctx context.Context, id string) ([]byte, error)
+}
+
+// StaticKeys is a KeyProvider holding its keys in memory.
+type StaticKeys struct {
+	// Current is the ID of the key used for new files.
+	Current string
+	Keys    map[string][]byte
+}
+
+// NewStaticKey returns a provider with the single key id.
+func NewStaticKey(id string, key []byte) *StaticKeys {
+	return &StaticKeys{Current: id, Keys: map[string][]byte{id: key}}
+}
+
+// CurrentKey returns the key named by Current.
+func (s *StaticKeys) CurrentKey(ctx context.Context) (string, []byte, error) {
+	key, err := s.Key(ctx, s.Current)
+	if err != nil {
+		return "", nil, err
+	}
+	return s.Current, key, nil
+}
+
+// Key returns the key with id.
+func (s *StaticKeys) Key(ctx context.Context, id string) ([]byte, error) {
+	key, ok := s.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, id)
+	}
+	return key, nil
+}
+
+// checkKey validates a key returned by a provider.
+func checkKey(id string, key []byte) error {
+	if len(id) > MaxKeyIDLength {
+		return fmt.Errorf("key ID %q is longer than %d bytes", id, MaxKeyIDLength)
+	}
+	if len(key) != KeySize {
+		return fmt.Errorf("key %q is %d bytes, want %d", id, len(key), KeySize)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package crypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"strings"
+)
+
+// nameEncoding is lowercase base32 without padding, safe on
+// case-insensitive servers such as SMB.
+var nameEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// MaxNameLength is the longest plaintext name that still encrypts to 255
+// bytes, the common limit on path elements.
+const MaxNameLength = 143
+
+// nameCipher encrypts path elements deterministically, so a plaintext path
+// always maps to the same stored path: a synthetic IV, the HMAC-SHA256 of
+// the name truncated to 16 bytes, seeds AES-CTR and authenticates the name
+// on decryption.
+type nameCipher struct {
+	mac   []byte
+	block cipher.Block
+}
+
+func newNameCipher(master []byte) (*nameCipher, error) {
+	keys, err := hkdf.Key(sha256.New, master, nil, "digital.vasic.filesystem/crypt/v1 names", 64)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(keys[32:])
+	if err != nil {
+		return nil, err
+	}
+	return &nameCipher{mac: keys[:32], block: block}, nil
+}
+
+func (n *nameCipher) iv(name []byte) []byte {
+	m := hmac.New(sha256.New, n.mac)
+	m.Write(name)
+	return m.Sum(nil)[:aes.BlockSize]
+}
+
+// encrypt returns the stored form of a path element.
+func (n *nameCipher) encrypt(name string) (string, error) {
+	if len(name) > MaxNameLength {
+		return "", fmt.Errorf("name %q is longer than %d bytes", name, MaxNameLength)
+	}
+	iv := n.iv([]byte(name))
+	out := make([]byte, aes.BlockSize+len(name))
+	copy(out, iv)
+	cipher.NewCTR(n.block, iv).XORKeyStream(out[aes.BlockSize:], []byte(name))
+	return nameEncoding.EncodeToString(out), nil
+}
+
+// decrypt returns the plaintext of a stored path element.
+func (n *nameCipher) decrypt(stored string) (string, error) {
+	raw, err := nameEncoding.DecodeString(stored)
+	if err != nil || len(raw) < aes.BlockSize {
+		return "", fmt.Errorf("%w: name %q", ErrCorrupt, stored)
+	}
+	iv := raw[:aes.BlockSize]
+	name := make([]byte, len(raw)-aes.BlockSize)
+	cipher.NewCTR(n.block, iv).XORKeyStream(name, raw[aes.BlockSize:])
+	if !hmac.Equal(iv, n.iv(name)) {
+		return "", fmt.Errorf("%w: name %q", ErrCorrupt, stored)
+	}
+	return string(name), nil
+}
+
+// encryptPath encrypts every element of p, keeping separators, "." and
+// "..".
+func (n *nameCipher) encryptPath(p string) (string, error) {
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		if part == "" || part == "." || part == ".." {
+			continue
+		}
+		enc, err := n.encrypt(part)
+		if err != nil {
+			return "", err
+		}
+		parts[i] = enc
+	}
+	return strings.Join(parts, "/"), nil
+}
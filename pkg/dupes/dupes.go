@@ -0,0 +1,525 @@
+// Package dupes finds duplicate files across one or more client.Client
+// storages. Candidates are grouped by size, then by a digest of their first
+// bytes, then by a digest of the whole file, so only files that may be equal
+// are read in full. Duplicates can then be replaced by hard links or
+// deleted.
+package dupes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"digital.vasic.filesystem/pkg/checksum"
+	"digital.vasic.filesystem/pkg/client"
+	"digital.vasic.filesystem/pkg/search"
+)
+
+// DefaultPartialSize is the number of leading bytes digested in the second
+// pass when Options.PartialSize is zero.
+const DefaultPartialSize = 64 << 10
+
+// DefaultConcurrency is the number of files hashed at once when
+// Options.Concurrency is zero.
+const DefaultConcurrency = 4
+
+// Source is a tree to scan. Name identifies it in reports and must be
+// unique among the sources of one Find call.
+type Source struct {
+	Name   string
+	Client client.Client
+	Root   string
+}
+
+// Options configures Find.
+type Options struct {
+	// MinSize ignores smaller files. Zero ignores empty files only.
+	MinSize int64
+	// PartialSize is the number of leading bytes compared before whole
+	// files are hashed. Zero uses DefaultPartialSize.
+	PartialSize int64
+	// Algorithm is the digest used for both passes. Empty uses SHA-256;
+	// backends implementing client.Hasher supply full digests themselves.
+	Algorithm client.HashAlgorithm
+	// Concurrency bounds the files read at once. Zero uses
+	// DefaultConcurrency.
+	Concurrency int
+	// Patterns and Exclude restrict the scan as in search.Query.
+	Patterns []string
+	Exclude  []string
+}
+
+// File is one copy of a duplicated file. Path is in the namespace of its
+// source's client, not relative to the root.
+type File struct {
+	Source  string    `json:"source"`
+	Path    string    `json:"path"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Set is a group of files with identical content. Files are ordered by
+// source, in the order the sources were given, then by path; the first one
+// is kept by Apply.
+type Set struct {
+	Size  int64  `json:"size"`
+	Hash  string `json:"hash"`
+	Files []File `json:"files"`
+}
+
+// Wasted returns the bytes taken by all copies but one.
+func (s Set) Wasted() int64 {
+	return s.Size * int64(len(s.Files)-1)
+}
+
+// Report lists the duplicate sets found by Find, largest files first.
+type Report struct {
+	Algorithm client.HashAlgorithm `json:"algorithm"`
+	// Scanned counts the files considered.
+	Scanned int   `json:"scanned"`
+	Sets    []Set `json:"sets"`
+	// Wasted is the sum of Set.Wasted over all sets.
+	Wasted int64 `json:"wasted"`
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// candidate is a scanned file and the digest of its current pass.
+type candidate struct {
+	file   File
+	source int
+	size   int64
+	sum    string
+}
+
+// Find scans the sources and returns the files whose content is identical
+// to another one, within a source or across sources. Symbolic links are
+// neither followed nor reported. Files that are already hard links of each
+// other are reported like any other copy, since listings do not identify
+// inodes. Sources whose roots overlap on the same client report each file
+// once.
+func Find(ctx context.Context, sources []Source, opts Options) (*Report, error) {
+	if opts.PartialSize <= 0 {
+		opts.PartialSize = DefaultPartialSize
+	}
+	if opts.Algorithm == "" {
+		opts.Algorithm = client.HashSHA256
+	}
+	if _, err := checksum.New(opts.Algorithm); err != nil {
+		return nil, err
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+	if err := validate(sources); err != nil {
+		return nil, err
+	}
+
+	bySize := make(map[int64][]*candidate)
+	seen := make(map[fileRef]bool)
+	report := &Report{Algorithm: opts.Algorithm, Sets: []Set{}}
+	for i, src := range sources {
+		q := search.Query{
+			Patterns: opts.Patterns,
+			Exclude:  opts.Exclude,
+			MinSize:  max(opts.MinSize, 1),
+			Type:     search.TypeFile,
+		}
+		for m, err := range search.Search(ctx, src.Client, src.Root, q) {
+			if err != nil {
+				return nil, fmt.Errorf("failed to scan %s: %w", src.Name, err)
+			}
+			p := client.JoinPath(src.Root, m.Path)
+			ref := fileRef{client: firstClient(sources, i), path: cleanPath(p)}
+			if seen[ref] {
+				continue
+			}
+			seen[ref] = true
+			report.Scanned++
+			bySize[m.Info.Size] = append(bySize[m.Info.Size], &candidate{
+				file:   File{Source: src.Name, Path: p, ModTime: m.Info.ModTime},
+				source: i,
+				size:   m.Info.Size,
+			})
+		}
+	}
+
+	var groups [][]*candidate
+	for _, g := range bySize {
+		if len(g) > 1 {
+			groups = append(groups, g)
+		}
+	}
+	h := &hasher{sources: sources, opts: opts}
+
+	// Files no longer than PartialSize are fully digested by the first
+	// pass and need no second one.
+	groups, err := h.regroup(ctx, groups, true)
+	if err != nil {
+		return nil, err
+	}
+	var small, large [][]*candidate
+	for _, g := range groups {
+		if g[0].size <= opts.PartialSize {
+			small = append(small, g)
+		} else {
+			large = append(large, g)
+		}
+	}
+	if large, err = h.regroup(ctx, large, false); err != nil {
+		return nil, err
+	}
+
+	for _, g := range append(small, large...) {
+		sort.Slice(g, func(i, j int) bool {
+			if g[i].source != g[j].source {
+				return g[i].source < g[j].source
+			}
+			return g[i].file.Path < g[j].file.Path
+		})
+		set := Set{Size: g[0].size, Hash: g[0].sum}
+		for _, c := range g {
+			set.Files = append(set.Files, c.file)
+		}
+		report.Sets = append(report.Sets, set)
+		report.Wasted += set.Wasted()
+	}
+	sort.Slice(report.Sets, func(i, j int) bool {
+		a, b := report.Sets[i], report.Sets[j]
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+		return a.Hash < b.Hash
+	})
+	return report, nil
+}
+
+// fileRef names a file by the index of the first source sharing its
+// client and its cleaned path.
+type fileRef struct {
+	client int
+	path   string
+}
+
+// firstClient returns the index of the first source using the client of
+// sources[i].
+func firstClient(sources []Source, i int) int {
+	for j := range sources[:i] {
+		if sameClient(sources[j].Client, sources[i].Client) {
+			return j
+		}
+	}
+	return i
+}
+
+// sameClient reports whether a and b are the same client value. Values of
+// types that cannot be compared are never the same.
+func sameClient(a, b client.Client) bool {
+	t := reflect.TypeOf(a)
+	return t == reflect.TypeOf(b) && t.Comparable() && a == b
+}
+
+// cleanPath normalises p so that "media/a", "/media/a" and "media//a"
+// compare equal.
+func cleanPath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// validate checks that every source has a client and a unique name.
+func validate(sources []Source) error {
+	seen := make(map[string]bool, len(sources))
+	for i, src := range sources {
+		if src.Client == nil {
+			return fmt.Errorf("source %d has no client", i)
+		}
+		if src.Name == "" {
+			return fmt.Errorf("source %d has no name", i)
+		}
+		if seen[src.Name] {
+			return fmt.Errorf("duplicate source name %q", src.Name)
+		}
+		seen[src.Name] = true
+	}
+	return nil
+}
+
+// hasher digests candidates with bounded concurrency.
+type hasher struct {
+	sources []Source
+	opts    Options
+}
+
+// regroup digests every candidate of groups, the leading bytes only when
+// partial is set, and splits each group by digest, dropping candidates
+// left without a match. The first failure cancels the remaining reads.
+func (h *hasher) regroup(ctx context.Context, groups [][]*candidate, partial bool) ([][]*candidate, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sem := make(chan struct{}, h.opts.Concurrency)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	for _, g := range groups {
+		for _, c := range g {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			wg.Add(1)
+			go func(c *candidate) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				sum, err := h.sum(ctx, c, partial)
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					cancel()
+					return
+				}
+				c.sum = sum
+			}(c)
+		}
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var out [][]*candidate
+	for _, g := range groups {
+		bySum := make(map[string][]*candidate)
+		var order []string
+		for _, c := range g {
+			if _, ok := bySum[c.sum]; !ok {
+				order = append(order, c.sum)
+			}
+			bySum[c.sum] = append(bySum[c.sum], c)
+		}
+		for _, sum := range order {
+			if len(bySum[sum]) > 1 {
+				out = append(out, bySum[sum])
+			}
+		}
+	}
+	return out, nil
+}
+
+// sum digests the leading PartialSize bytes of c, or the whole file.
+func (h *hasher) sum(ctx context.Context, c *candidate, partial bool) (string, error) {
+	cl := h.sources[c.source].Client
+	if !partial {
+		return checksum.Sum(ctx, cl, c.file.Path, h.opts.Algorithm)
+	}
+	r, err := cl.ReadFile(ctx, c.file.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", c.file.Path, err)
+	}
+	defer r.Close()
+	sum, err := checksum.SumReader(io.LimitReader(r, h.opts.PartialSize), h.opts.Algorithm)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", c.file.Path, err)
+	}
+	return sum, nil
+}
+
+// Action is what Apply does with the redundant copies of a set.
+type Action string
+
+const (
+	// ActionLink replaces each copy with a hard link to the kept file.
+	// Only copies on the same source as the kept file can be linked, and
+	// only where the client implements client.Linker.
+	ActionLink Action = "hardlink"
+	// ActionDelete deletes each copy.
+	ActionDelete Action = "delete"
+)
+
+// ErrChanged is reported for a copy or kept file whose size or
+// modification time differs from the report.
+var ErrChanged = errors.New("file changed since it was scanned")
+
+// ErrSameFile is reported for a copy that is the kept file itself, under
+// the same path on the same client or, by client.FileInfo.FileID, under
+// another name. Such copies are skipped.
+var ErrSameFile = errors.New("copy is the kept file")
+
+// Result is the outcome of one copy handled by Apply.
+type Result struct {
+	Action Action `json:"action"`
+	File   File   `json:"file"`
+	Kept   File   `json:"kept"`
+	Size   int64  `json:"size"`
+	Error  error  `json:"-"`
+}
+
+// ApplyReport summarises an Apply call.
+type ApplyReport struct {
+	Results []Result
+	Linked  int
+	Deleted int
+	Skipped int
+	Failed  int
+	// Freed is the size of the copies linked or deleted.
+	Freed int64
+}
+
+// Err joins the errors of all failed copies, or returns nil.
+func (r *ApplyReport) Err() error {
+	var errs []error
+	for _, res := range r.Results {
+		if res.Error != nil {
+			errs = append(errs, fmt.Errorf("%s %s:%s: %w", res.Action, res.File.Source, res.File.Path, res.Error))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Apply keeps the first file of every set of report and links or deletes
+// the others. Both files are checked against the report first, so copies
+// that changed since the scan are left alone (ErrChanged). Copies that are
+// the kept file itself (ErrSameFile) and copies that cannot be linked, on
+// another source or a backend without hard links, are skipped; the latter
+// are recorded with an error wrapping client.ErrNotSupported.
+// Failures do not stop the run; the returned error is reserved for invalid
+// arguments and cancellation.
+func Apply(ctx context.Context, sources []Source, report *Report, action Action) (*ApplyReport, error) {
+	if action != ActionLink && action != ActionDelete {
+		return nil, fmt.Errorf("unknown action %q", action)
+	}
+	if err := validate(sources); err != nil {
+		return nil, err
+	}
+	byName := make(map[string]Source, len(sources))
+	for _, src := range sources {
+		byName[src.Name] = src
+	}
+
+	out := &ApplyReport{}
+	for _, set := range report.Sets {
+		if len(set.Files) < 2 {
+			continue
+		}
+		kept := set.Files[0]
+		keptSrc, ok := byName[kept.Source]
+		if !ok {
+			return out, fmt.Errorf("unknown source %q", kept.Source)
+		}
+		for _, f := range set.Files[1:] {
+			if err := ctx.Err(); err != nil {
+				return out, err
+			}
+			src, ok := byName[f.Source]
+			if !ok {
+				return out, fmt.Errorf("unknown source %q", f.Source)
+			}
+			res := Result{Action: action, File: f, Kept: kept, Size: set.Size}
+			res.Error = apply(ctx, action, keptSrc, kept, src, f, set.Size)
+			out.Results = append(out.Results, res)
+			switch {
+			case errors.Is(res.Error, client.ErrNotSupported), errors.Is(res.Error, ErrSameFile):
+				out.Skipped++
+			case res.Error != nil:
+				out.Failed++
+			case action == ActionLink:
+				out.Linked++
+				out.Freed += set.Size
+			default:
+				out.Deleted++
+				out.Freed += set.Size
+			}
+		}
+	}
+	return out, nil
+}
+
+// apply links or deletes the copy f after checking both files.
+func apply(ctx context.Context, action Action, keptSrc Source, kept File, src Source, f File, size int64) error {
+	var linker client.Linker
+	if action == ActionLink {
+		if src.Name != keptSrc.Name {
+			return fmt.Errorf("cannot link across sources %s and %s: %w", keptSrc.Name, src.Name, client.ErrNotSupported)
+		}
+		l, ok := src.Client.(client.Linker)
+		if !ok {
+			return fmt.Errorf("source %s has no hard links: %w", src.Name, client.ErrNotSupported)
+		}
+		linker = l
+	}
+	if sameClient(keptSrc.Client, src.Client) && cleanPath(kept.Path) == cleanPath(f.Path) {
+		return fmt.Errorf("%w: %s", ErrSameFile, f.Path)
+	}
+	keptInfo, err := unchanged(ctx, keptSrc.Client, kept, size)
+	if err != nil {
+		return err
+	}
+	info, err := unchanged(ctx, src.Client, f, size)
+	if err != nil {
+		return err
+	}
+	if info.FileID != "" && info.FileID == keptInfo.FileID {
+		return fmt.Errorf("%w: %s and %s", ErrSameFile, kept.Path, f.Path)
+	}
+	if action == ActionDelete {
+		return src.Client.DeleteFile(ctx, f.Path)
+	}
+	return link(ctx, src.Client, linker, kept.Path, f.Path)
+}
+
+// link replaces p with a hard link to target. A temporary link proves the
+// backend can link in p's directory before p is deleted; should the final
+// link still fail, p is restored as a copy of target.
+func link(ctx context.Context, c client.Client, l client.Linker, target, p string) error {
+	tmp := client.AtomicTempName(p)
+	if err := l.Link(ctx, target, tmp); err != nil {
+		return err
+	}
+	if err := c.DeleteFile(ctx, p); err != nil {
+		_ = c.DeleteFile(ctx, tmp)
+		return err
+	}
+	if err := l.Link(ctx, target, p); err != nil {
+		_ = c.DeleteFile(ctx, tmp)
+		if cerr := c.CopyFile(ctx, target, p); cerr != nil {
+			return errors.Join(err, fmt.Errorf("failed to restore %s: %w", p, cerr))
+		}
+		return err
+	}
+	if err := c.DeleteFile(ctx, tmp); err != nil {
+		return fmt.Errorf("failed to remove temporary link %s: %w", tmp, err)
+	}
+	return nil
+}
+
+// unchanged checks f against the size and modification time in the report
+// and returns its current FileInfo.
+func unchanged(ctx context.Context, c client.Client, f File, size int64) (*client.FileInfo, error) {
+	info, err := c.GetFileInfo(ctx, f.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", f.Path, err)
+	}
+	if info.Size != size || !info.ModTime.Equal(f.ModTime) {
+		return nil, fmt.Errorf("%w: %s", ErrChanged, f.Path)
+	}
+	return info, nil
+}
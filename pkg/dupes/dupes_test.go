@@ -0,0 +1,291 @@
+package dupes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"digital.vasic.filesystem/internal/testutil"
+	"digital.vasic.filesystem/pkg/client"
+	"digital.vasic.filesystem/pkg/local"
+)
+
+func write(t *testing.T, dir, name string, data []byte) {
+	t.Helper()
+	p := filepath.Join(dir, filepath.FromSlash(name))
+	require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+	require.NoError(t, os.WriteFile(p, data, 0644))
+}
+
+// fill returns n bytes of b.
+func fill(b byte, n int) []byte {
+	return bytes.Repeat([]byte{b}, n)
+}
+
+// paths returns "source:path" for every file of s.
+func paths(s Set) []string {
+	var out []string
+	for _, f := range s.Files {
+		out = append(out, f.Source+":"+f.Path)
+	}
+	return out
+}
+
+// reads records how many bytes of each file were read through it.
+type reads struct {
+	client.Client
+	mu    sync.Mutex
+	bytes map[string]int64
+}
+
+func (r *reads) ReadFile(ctx context.Context, path string) (io.ReadCloser, error) {
+	rc, err := r.Client.ReadFile(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return &counted{ReadCloser: rc, r: r, path: path}, nil
+}
+
+type counted struct {
+	io.ReadCloser
+	r    *reads
+	path string
+}
+
+func (c *counted) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.r.mu.Lock()
+	c.r.bytes[c.path] += int64(n)
+	c.r.mu.Unlock()
+	return n, err
+}
+
+// writeLibrary creates two libraries sharing some files:
+//
+//	a: movies/one.mkv, movies/copy.mkv (3 KiB, equal)
+//	   movies/same-head.mkv (3 KiB, same first 2 KiB)
+//	   notes.txt "hello", unique.txt, two empty files, link.mkv -> movies/one.mkv
+//	b: backup/one.mkv (equal to a's), backup/notes.txt "hello",
+//	   backup/other.txt "jello"
+func writeLibrary(t *testing.T) (a, b *local.Client, dirA, dirB string) {
+	t.Helper()
+	a, dirA = testutil.NewLocal(t)
+	b, dirB = testutil.NewLocal(t)
+	big := fill('x', 3*1024)
+	write(t, dirA, "movies/one.mkv", big)
+	write(t, dirA, "movies/copy.mkv", big)
+	write(t, dirA, "movies/same-head.mkv", append(fill('x', 2*1024), fill('y', 1024)...))
+	write(t, dirA, "notes.txt", []byte("hello"))
+	write(t, dirA, "unique.txt", []byte("world!"))
+	write(t, dirA, "empty1", nil)
+	write(t, dirA, "empty2", nil)
+	write(t, dirB, "backup/one.mkv", big)
+	write(t, dirB, "backup/notes.txt", []byte("hello"))
+	write(t, dirB, "backup/other.txt", []byte("jello"))
+	if err := os.Symlink("movies/one.mkv", filepath.Join(dirA, "link.mkv")); err != nil {
+		t.Skip("symlinks not supported on this filesystem")
+	}
+	return a, b, dirA, dirB
+}
+
+func TestFind(t *testing.T) {
+	a, b, _, _ := writeLibrary(t)
+	counter := &reads{Client: a, bytes: map[string]int64{}}
+	sources := []Source{{Name: "a", Client: counter}, {Name: "b", Client: b, Root: "backup"}}
+
+	report, err := Find(context.Background(), sources, Options{PartialSize: 1024})
+	require.NoError(t, err)
+
+	assert.Equal(t, client.HashSHA256, report.Algorithm)
+	assert.Equal(t, 8, report.Scanned, "empty files and symlinks are not scanned")
+	require.Len(t, report.Sets, 2)
+	assert.Equal(t, []string{"a:movies/copy.mkv", "a:movies/one.mkv", "b:backup/one.mkv"}, paths(report.Sets[0]),
+		"largest first; the file with the same size and head is told apart by the full hash")
+	assert.Equal(t, int64(3*1024), report.Sets[0].Size)
+	assert.Equal(t, []string{"a:notes.txt", "b:backup/notes.txt"}, paths(report.Sets[1]))
+	assert.Equal(t, int64(2*3*1024+5), report.Wasted)
+
+	assert.Zero(t, counter.bytes["unique.txt"], "files of a unique size are not read")
+	assert.Equal(t, int64(5), counter.bytes["notes.txt"], "small files are read once")
+	assert.Equal(t, int64(1024+3*1024), counter.bytes["movies/one.mkv"], "head, then the whole file")
+
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteJSON(&buf))
+	var decoded Report
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, report.Wasted, decoded.Wasted)
+	assert.Equal(t, paths(report.Sets[1]), paths(decoded.Sets[1]))
+	assert.Contains(t, buf.String(), `"path": "backup/notes.txt"`)
+
+	report, err = Find(context.Background(), sources, Options{MinSize: 100, Exclude: []string{"movies"}})
+	require.NoError(t, err)
+	assert.Empty(t, report.Sets)
+	assert.JSONEq(t, `{"algorithm":"sha256","scanned":1,"sets":[],"wasted":0}`, jsonString(t, report))
+}
+
+func jsonString(t *testing.T, r *Report) string {
+	t.Helper()
+	data, err := json.Marshal(r)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestFind_Errors(t *testing.T) {
+	a, b, _, _ := writeLibrary(t)
+	ctx := context.Background()
+
+	for _, sources := range [][]Source{
+		{{Name: "a", Client: a}, {Name: "a", Client: b}},
+		{{Client: a}},
+		{{Name: "a"}},
+	} {
+		_, err := Find(ctx, sources, Options{})
+		assert.Error(t, err)
+	}
+	_, err := Find(ctx, []Source{{Name: "a", Client: a}}, Options{Algorithm: "crc7"})
+	assert.Error(t, err)
+	_, err = Find(ctx, []Source{{Name: "a", Client: a, Root: "missing"}}, Options{})
+	assert.Error(t, err)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = Find(cancelled, []Source{{Name: "a", Client: a}}, Options{})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func sameFile(t *testing.T, a, b string) bool {
+	t.Helper()
+	ia, err := os.Stat(a)
+	require.NoError(t, err)
+	ib, err := os.Stat(b)
+	require.NoError(t, err)
+	return os.SameFile(ia, ib)
+}
+
+func TestApply_Link(t *testing.T) {
+	a, b, dirA, dirB := writeLibrary(t)
+	sources := []Source{{Name: "a", Client: a}, {Name: "b", Client: b, Root: "backup"}}
+	ctx := context.Background()
+
+	report, err := Find(ctx, sources, Options{})
+	require.NoError(t, err)
+	applied, err := Apply(ctx, sources, report, ActionLink)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, applied.Linked)
+	assert.Equal(t, 2, applied.Skipped, "copies on another source cannot be linked")
+	assert.Zero(t, applied.Failed)
+	assert.Equal(t, int64(3*1024), applied.Freed)
+	assert.ErrorIs(t, applied.Err(), client.ErrNotSupported)
+
+	assert.True(t, sameFile(t, filepath.Join(dirA, "movies", "copy.mkv"), filepath.Join(dirA, "movies", "one.mkv")))
+	assert.FileExists(t, filepath.Join(dirB, "backup", "one.mkv"))
+	entries, err := os.ReadDir(filepath.Join(dirA, "movies"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 3, "no temporary links are left behind")
+}
+
+func TestApply_Delete(t *testing.T) {
+	a, b, dirA, dirB := writeLibrary(t)
+	sources := []Source{{Name: "a", Client: a}, {Name: "b", Client: b, Root: "backup"}}
+	ctx := context.Background()
+
+	report, err := Find(ctx, sources, Options{})
+	require.NoError(t, err)
+	write(t, dirB, "backup/notes.txt", []byte("HELLO"))
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dirB, "backup", "notes.txt"), later, later))
+
+	applied, err := Apply(ctx, sources, report, ActionDelete)
+	require.NoError(t, err)
+	assert.Equal(t, 2, applied.Deleted)
+	assert.Equal(t, 1, applied.Failed)
+	assert.ErrorIs(t, applied.Err(), ErrChanged)
+	assert.Equal(t, int64(2*3*1024), applied.Freed)
+
+	assert.FileExists(t, filepath.Join(dirA, "movies", "copy.mkv"), "the first file of a set is kept")
+	assert.NoFileExists(t, filepath.Join(dirA, "movies", "one.mkv"))
+	assert.NoFileExists(t, filepath.Join(dirB, "backup", "one.mkv"))
+	assert.FileExists(t, filepath.Join(dirB, "backup", "notes.txt"), "a changed copy is left alone")
+}
+
+func TestApply_SameFile(t *testing.T) {
+	c, dir := testutil.NewLocal(t)
+	write(t, dir, "media/movies/only.mkv", fill('o', 2048))
+	ctx := context.Background()
+
+	overlapping := []Source{{Name: "all", Client: c, Root: "media"}, {Name: "movies", Client: c, Root: "/media/movies"}}
+	report, err := Find(ctx, overlapping, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Scanned, "a file under both roots is scanned once")
+	assert.Empty(t, report.Sets)
+
+	info, err := c.GetFileInfo(ctx, "media/movies/only.mkv")
+	require.NoError(t, err)
+	self := &Report{Sets: []Set{{Size: 2048, Files: []File{
+		{Source: "all", Path: "media/movies/only.mkv", ModTime: info.ModTime},
+		{Source: "movies", Path: "/media/movies/only.mkv", ModTime: info.ModTime},
+	}}}}
+	applied, err := Apply(ctx, overlapping, self, ActionDelete)
+	require.NoError(t, err)
+	assert.Zero(t, applied.Deleted)
+	assert.Equal(t, 1, applied.Skipped)
+	assert.ErrorIs(t, applied.Err(), ErrSameFile)
+	assert.FileExists(t, filepath.Join(dir, "media", "movies", "only.mkv"))
+
+	// A second client on the same directory and a hard link reach the file
+	// under other names; FileID tells them apart from real copies.
+	other := local.NewLocalClient(&local.Config{BasePath: dir})
+	require.NoError(t, other.Connect(ctx))
+	require.NoError(t, c.Link(ctx, "media/movies/only.mkv", "media/movies/link.mkv"))
+	sources := []Source{{Name: "all", Client: c, Root: "media"}, {Name: "other", Client: other, Root: "media/movies"}}
+	report, err = Find(ctx, sources, Options{})
+	require.NoError(t, err)
+	require.Len(t, report.Sets, 1)
+	assert.Len(t, report.Sets[0].Files, 4)
+
+	applied, err = Apply(ctx, sources, report, ActionDelete)
+	require.NoError(t, err)
+	assert.Zero(t, applied.Deleted)
+	assert.Equal(t, 3, applied.Skipped)
+	assert.ErrorIs(t, applied.Err(), ErrSameFile)
+	assert.FileExists(t, filepath.Join(dir, "media", "movies", "only.mkv"))
+	assert.FileExists(t, filepath.Join(dir, "media", "movies", "link.mkv"))
+}
+
+// noLinks hides the Linker of the wrapped client.
+type noLinks struct{ client.Client }
+
+func TestApply_Errors(t *testing.T) {
+	a, _, dirA, _ := writeLibrary(t)
+	ctx := context.Background()
+
+	report, err := Find(ctx, []Source{{Name: "a", Client: a}}, Options{})
+	require.NoError(t, err)
+
+	_, err = Apply(ctx, []Source{{Name: "a", Client: a}}, report, "move")
+	assert.Error(t, err)
+	_, err = Apply(ctx, []Source{{Name: "other", Client: a}}, report, ActionDelete)
+	assert.Error(t, err, "sources must match the report")
+
+	applied, err := Apply(ctx, []Source{{Name: "a", Client: noLinks{a}}}, report, ActionLink)
+	require.NoError(t, err)
+	assert.Equal(t, 1, applied.Skipped)
+	assert.ErrorIs(t, applied.Err(), client.ErrNotSupported)
+	assert.FileExists(t, filepath.Join(dirA, "movies", "one.mkv"))
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = Apply(cancelled, []Source{{Name: "a", Client: a}}, report, ActionDelete)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.FileExists(t, filepath.Join(dirA, "movies", "one.mkv"))
+}
@@ -4,6 +4,8 @@ package factory
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	"digital.vasic.filesystem/pkg/client"
 	"digital.vasic.filesystem/pkg/ftp"
@@ -13,34 +15,53 @@ import (
 )
 
 // DefaultFactory implements client.Factory for all supported protocols.
-type DefaultFactory struct{}
+type DefaultFactory struct {
+	resolvers map[string]client.SecretResolver
+}
 
 // NewDefaultFactory creates a new default client factory.
+// Setting values of the form "env:NAME" and "file:/path" are resolved
+// when a client is created; see RegisterSecretResolver for other schemes.
 func NewDefaultFactory() *DefaultFactory {
-	return &DefaultFactory{}
+	f := &DefaultFactory{}
+	f.RegisterSecretResolver("env", EnvSecretResolver{})
+	f.RegisterSecretResolver("file", FileSecretResolver{})
+	return f
 }
 
 // CreateClient creates a filesystem client based on the storage configuration.
+// Secret references in config.Settings are resolved first; config itself is
+// left unchanged.
 func (f *DefaultFactory) CreateClient(config *client.StorageConfig) (client.Client, error) {
+	settings, err := f.ResolveSettings(config.Settings)
+	if err != nil {
+		return nil, err
+	}
+	resolved := *config
+	resolved.Settings = settings
+	config = &resolved
+
 	switch config.Protocol {
 	case "smb":
 		smbConfig := &smb.Config{
-			Host:     GetStringSetting(config.Settings, "host", ""),
-			Port:     GetIntSetting(config.Settings, "port", 445),
-			Share:    GetStringSetting(config.Settings, "share", ""),
-			Username: GetStringSetting(config.Settings, "username", ""),
-			Password: GetStringSetting(config.Settings, "password", ""),
-			Domain:   GetStringSetting(config.Settings, "domain", "WORKGROUP"),
+			Host:         GetStringSetting(config.Settings, "host", ""),
+			Port:         GetIntSetting(config.Settings, "port", 445),
+			Share:        GetStringSetting(config.Settings, "share", ""),
+			Username:     GetStringSetting(config.Settings, "username", ""),
+			Password:     GetStringSetting(config.Settings, "password", ""),
+			Domain:       GetStringSetting(config.Settings, "domain", "WORKGROUP"),
+			AtomicWrites: GetBoolSetting(config.Settings, "atomic_writes", false),
 		}
 		return NewSMBClient(smbConfig), nil
 
 	case "ftp":
 		ftpConfig := &ftp.Config{
-			Host:     GetStringSetting(config.Settings, "host", ""),
-			Port:     GetIntSetting(config.Settings, "port", 21),
-			Username: GetStringSetting(config.Settings, "username", ""),
-			Password: GetStringSetting(config.Settings, "password", ""),
-			Path:     GetStringSetting(config.Settings, "path", ""),
+			Host:         GetStringSetting(config.Settings, "host", ""),
+			Port:         GetIntSetting(config.Settings, "port", 21),
+			Username:     GetStringSetting(config.Settings, "username", ""),
+			Password:     GetStringSetting(config.Settings, "password", ""),
+			Path:         GetStringSetting(config.Settings, "path", ""),
+			AtomicWrites: GetBoolSetting(config.Settings, "atomic_writes", false),
 		}
 		return ftp.NewFTPClient(ftpConfig), nil
 
@@ -58,7 +79,9 @@ func (f *DefaultFactory) CreateClient(config *client.StorageConfig) (client.Clie
 
 	case "local":
 		localConfig := &local.Config{
-			BasePath: GetStringSetting(config.Settings, "base_path", ""),
+			BasePath:     GetStringSetting(config.Settings, "base_path", ""),
+			AtomicWrites: GetBoolSetting(config.Settings, "atomic_writes", false),
+			Symlinks:     GetStringSetting(config.Settings, "symlinks", ""),
 		}
 		return local.NewLocalClient(localConfig), nil
 
@@ -87,7 +110,8 @@ func GetStringSetting(settings map[string]interface{}, key, defaultValue string)
 	return defaultValue
 }
 
-// GetIntSetting extracts an int setting from a settings map.
+// GetIntSetting extracts an int setting from a settings map. Numeric strings,
+// as loaded from .properties catalogs, are accepted as well.
 func GetIntSetting(settings map[string]interface{}, key string, defaultValue int) int {
 	if val, ok := settings[key]; ok {
 		if num, ok := val.(int); ok {
@@ -96,6 +120,33 @@ func GetIntSetting(settings map[string]interface{}, key string, defaultValue int
 		if floatNum, ok := val.(float64); ok {
 			return int(floatNum)
 		}
+		if str, ok := val.(string); ok {
+			if num, err := strconv.Atoi(strings.TrimSpace(str)); err == nil {
+				return num
+			}
+		}
+	}
+	return defaultValue
+}
+
+// GetBoolSetting extracts a bool setting from a settings map. Strings such
+// as "true", "1" or "no" are parsed with strconv.ParseBool.
+func GetBoolSetting(settings map[string]interface{}, key string, defaultValue bool) bool {
+	if val, ok := settings[key]; ok {
+		if b, ok := val.(bool); ok {
+			return b
+		}
+		if str, ok := val.(string); ok {
+			switch strings.ToLower(strings.TrimSpace(str)) {
+			case "yes", "on":
+				return true
+			case "no", "off":
+				return false
+			}
+			if b, err := strconv.ParseBool(strings.TrimSpace(str)); err == nil {
+				return b
+			}
+		}
 	}
 	return defaultValue
 }
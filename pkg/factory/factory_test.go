@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"digital.vasic.filesystem/pkg/client"
+	"digital.vasic.filesystem/pkg/local"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -148,12 +149,59 @@ func TestGetIntSetting(t *testing.T) {
 		"port":       445,
 		"float_port": float64(8080),
 		"text":       "not a number",
+		"str_port":   "2121",
 	}
 
 	assert.Equal(t, 445, GetIntSetting(settings, "port", 0))
 	assert.Equal(t, 8080, GetIntSetting(settings, "float_port", 0))
 	assert.Equal(t, 99, GetIntSetting(settings, "missing", 99))
 	assert.Equal(t, 0, GetIntSetting(settings, "text", 0))
+	assert.Equal(t, 2121, GetIntSetting(settings, "str_port", 0))
+}
+
+func TestGetBoolSetting(t *testing.T) {
+	settings := map[string]interface{}{
+		"flag":    true,
+		"str_yes": "yes",
+		"str_one": "1",
+		"str_off": "off",
+		"text":    "maybe",
+		"number":  1,
+	}
+
+	assert.True(t, GetBoolSetting(settings, "flag", false))
+	assert.True(t, GetBoolSetting(settings, "str_yes", false))
+	assert.True(t, GetBoolSetting(settings, "str_one", false))
+	assert.False(t, GetBoolSetting(settings, "str_off", true))
+	assert.True(t, GetBoolSetting(settings, "text", true))
+	assert.False(t, GetBoolSetting(settings, "number", false))
+	assert.True(t, GetBoolSetting(settings, "missing", true))
+}
+
+func TestDefaultFactory_CreateClient_AtomicWrites(t *testing.T) {
+	f := NewDefaultFactory()
+
+	c, err := f.CreateClient(&client.StorageConfig{
+		Protocol: "local",
+		Settings: map[string]interface{}{"base_path": "/tmp", "atomic_writes": "true"},
+	})
+	require.NoError(t, err)
+	cfg, ok := c.GetConfig().(*local.Config)
+	require.True(t, ok)
+	assert.True(t, cfg.AtomicWrites)
+}
+
+func TestDefaultFactory_CreateClient_Symlinks(t *testing.T) {
+	f := NewDefaultFactory()
+
+	c, err := f.CreateClient(&client.StorageConfig{
+		Protocol: "local",
+		Settings: map[string]interface{}{"base_path": "/tmp", "symlinks": "refuse"},
+	})
+	require.NoError(t, err)
+	cfg, ok := c.GetConfig().(*local.Config)
+	require.True(t, ok)
+	assert.Equal(t, "refuse", cfg.Symlinks)
 }
 
 // Verify DefaultFactory implements client.Factory interface.
@@ -13,10 +13,12 @@ import (
 // createNFSClient creates an NFS client (Linux implementation).
 func (f *DefaultFactory) createNFSClient(config *client.StorageConfig) (client.Client, error) {
 	nfsConfig := nfs.Config{
-		Host:       GetStringSetting(config.Settings, "host", ""),
-		Path:       GetStringSetting(config.Settings, "path", ""),
-		MountPoint: GetStringSetting(config.Settings, "mount_point", ""),
-		Options:    GetStringSetting(config.Settings, "options", "vers=3"),
+		Host:         GetStringSetting(config.Settings, "host", ""),
+		Path:         GetStringSetting(config.Settings, "path", ""),
+		MountPoint:   GetStringSetting(config.Settings, "mount_point", ""),
+		Options:      GetStringSetting(config.Settings, "options", "vers=3"),
+		AtomicWrites: GetBoolSetting(config.Settings, "atomic_writes", false),
+		Symlinks:     GetStringSetting(config.Settings, "symlinks", ""),
 	}
 	c, err := nfs.NewNFSClient(nfsConfig)
 	if err != nil {
@@ -0,0 +1,78 @@
+package factory
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// EnvSecretResolver resolves "env:NAME" references from environment variables.
+type EnvSecretResolver struct{}
+
+// ResolveSecret returns the value of the environment variable ref.
+func (EnvSecretResolver) ResolveSecret(ref string) (string, error) {
+	val, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", ref)
+	}
+	return val, nil
+}
+
+// FileSecretResolver resolves "file:/path" references by reading the file,
+// trimming a single trailing newline as written by most secret stores.
+type FileSecretResolver struct{}
+
+// ResolveSecret returns the contents of the file at ref.
+func (FileSecretResolver) ResolveSecret(ref string) (string, error) {
+	data, err := os.ReadFile(ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file %s: %w", ref, err)
+	}
+	val := strings.TrimSuffix(string(data), "\n")
+	return strings.TrimSuffix(val, "\r"), nil
+}
+
+// RegisterSecretResolver registers a resolver for references of the form
+// "<scheme>:<ref>". Registering an existing scheme replaces its resolver;
+// a nil resolver removes the scheme.
+func (f *DefaultFactory) RegisterSecretResolver(scheme string, resolver client.SecretResolver) {
+	if f.resolvers == nil {
+		f.resolvers = make(map[string]client.SecretResolver)
+	}
+	if resolver == nil {
+		delete(f.resolvers, scheme)
+		return
+	}
+	f.resolvers[scheme] = resolver
+}
+
+// ResolveSettings returns a copy of settings with every string value that
+// references a registered scheme replaced by the resolved secret. Values
+// whose prefix is not a registered scheme (such as "http://...") are kept
+// literally.
+func (f *DefaultFactory) ResolveSettings(settings map[string]interface{}) (map[string]interface{}, error) {
+	resolved := make(map[string]interface{}, len(settings))
+	for key, val := range settings {
+		resolved[key] = val
+		str, ok := val.(string)
+		if !ok {
+			continue
+		}
+		scheme, ref, found := strings.Cut(str, ":")
+		if !found {
+			continue
+		}
+		resolver, ok := f.resolvers[scheme]
+		if !ok {
+			continue
+		}
+		secret, err := resolver.ResolveSecret(ref)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve setting %s: %w", key, err)
+		}
+		resolved[key] = secret
+	}
+	return resolved, nil
+}
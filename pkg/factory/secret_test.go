@@ -0,0 +1,107 @@
+package factory
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"digital.vasic.filesystem/pkg/client"
+	"digital.vasic.filesystem/pkg/smb"
+)
+
+func TestEnvSecretResolver(t *testing.T) {
+	t.Setenv("FILESYSTEM_TEST_SECRET", "from-env")
+
+	val, err := EnvSecretResolver{}.ResolveSecret("FILESYSTEM_TEST_SECRET")
+	require.NoError(t, err)
+	assert.Equal(t, "from-env", val)
+
+	_, err = EnvSecretResolver{}.ResolveSecret("FILESYSTEM_TEST_SECRET_MISSING")
+	assert.Error(t, err)
+}
+
+func TestFileSecretResolver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(path, []byte("from-file\n"), 0600))
+
+	val, err := FileSecretResolver{}.ResolveSecret(path)
+	require.NoError(t, err)
+	assert.Equal(t, "from-file", val)
+
+	_, err = FileSecretResolver{}.ResolveSecret(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+func TestDefaultFactory_ResolveSettings(t *testing.T) {
+	t.Setenv("FILESYSTEM_TEST_SMB_PASS", "hunter2")
+	f := NewDefaultFactory()
+
+	settings := map[string]interface{}{
+		"password": "env:FILESYSTEM_TEST_SMB_PASS",
+		"url":      "http://localhost/webdav",
+		"port":     445,
+	}
+	resolved, err := f.ResolveSettings(settings)
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", resolved["password"])
+	assert.Equal(t, "http://localhost/webdav", resolved["url"])
+	assert.Equal(t, 445, resolved["port"])
+	assert.Equal(t, "env:FILESYSTEM_TEST_SMB_PASS", settings["password"], "original settings must not be modified")
+}
+
+func TestDefaultFactory_RegisterSecretResolver(t *testing.T) {
+	f := NewDefaultFactory()
+	f.RegisterSecretResolver("vault", client.SecretResolverFunc(func(ref string) (string, error) {
+		if ref == "smb/nas" {
+			return "from-vault", nil
+		}
+		return "", errors.New("unknown secret")
+	}))
+
+	resolved, err := f.ResolveSettings(map[string]interface{}{"password": "vault:smb/nas"})
+	require.NoError(t, err)
+	assert.Equal(t, "from-vault", resolved["password"])
+
+	_, err = f.ResolveSettings(map[string]interface{}{"password": "vault:other"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "password")
+
+	f.RegisterSecretResolver("vault", nil)
+	resolved, err = f.ResolveSettings(map[string]interface{}{"password": "vault:smb/nas"})
+	require.NoError(t, err)
+	assert.Equal(t, "vault:smb/nas", resolved["password"])
+}
+
+func TestDefaultFactory_CreateClient_ResolvesSecrets(t *testing.T) {
+	t.Setenv("FILESYSTEM_TEST_SMB_PASS", "hunter2")
+	f := NewDefaultFactory()
+	config := &client.StorageConfig{
+		Protocol: "smb",
+		Settings: map[string]interface{}{
+			"host":     "localhost",
+			"share":    "media",
+			"password": "env:FILESYSTEM_TEST_SMB_PASS",
+		},
+	}
+
+	c, err := f.CreateClient(config)
+	require.NoError(t, err)
+
+	got := c.GetConfig().(*smb.Config)
+	assert.Equal(t, client.RedactedSecret, got.Password)
+	assert.Equal(t, "env:FILESYSTEM_TEST_SMB_PASS", config.Settings["password"])
+}
+
+func TestDefaultFactory_CreateClient_UnresolvableSecret(t *testing.T) {
+	f := NewDefaultFactory()
+	c, err := f.CreateClient(&client.StorageConfig{
+		Protocol: "smb",
+		Settings: map[string]interface{}{"password": "env:FILESYSTEM_TEST_UNSET_VARIABLE"},
+	})
+	assert.Error(t, err)
+	assert.Nil(t, c)
+}
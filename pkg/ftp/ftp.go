@@ -3,15 +3,19 @@ package ftp
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"iter"
 	"net"
+	"os"
 	"path/filepath"
 	"time"
 
 	goftp "github.com/jlaffaye/ftp"
 
 	"digital.vasic.filesystem/pkg/client"
+	"digital.vasic.filesystem/pkg/watch"
 )
 
 // Config contains FTP connection configuration.
@@ -21,6 +25,15 @@ type Config struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 	Path     string `json:"path"`
+	// AtomicWrites makes WriteFile behave like WriteFileAtomic.
+	AtomicWrites bool `json:"atomic_writes,omitempty"`
+}
+
+// MarshalJSON encodes the configuration with the password redacted.
+func (c Config) MarshalJSON() ([]byte, error) {
+	type plain Config
+	c.Password = client.RedactSecret(c.Password)
+	return json.Marshal(plain(c))
 }
 
 // Client implements client.Client for FTP protocol.
@@ -118,6 +131,9 @@ func (c *Client) WriteFile(ctx context.Context, path string, data io.Reader) err
 	if !c.IsConnected() {
 		return fmt.Errorf("not connected")
 	}
+	if c.config.AtomicWrites {
+		return c.WriteFileAtomic(ctx, path, data)
+	}
 	fullPath := c.resolvePath(path)
 
 	dir := filepath.Dir(fullPath)
@@ -132,6 +148,75 @@ func (c *Client) WriteFile(ctx context.Context, path string, data io.Reader) err
 	return nil
 }
 
+// Create returns a writer that streams into a STOR upload. The control
+// connection is busy until the writer is closed, so other operations on the
+// client must wait for Close.
+func (c *Client) Create(ctx context.Context, path string) (io.WriteCloser, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+	fullPath := c.resolvePath(path)
+
+	dir := filepath.Dir(fullPath)
+	if dir != "." && dir != "/" {
+		_ = c.client.MakeDir(dir)
+	}
+
+	return client.NewPipeWriter(func(r io.Reader) error {
+		if err := c.client.Stor(fullPath, r); err != nil {
+			return fmt.Errorf("failed to store FTP file %s: %w", fullPath, err)
+		}
+		return nil
+	}), nil
+}
+
+// OpenAppend returns a writer that streams into an APPE upload, with the
+// same connection caveat as Create.
+func (c *Client) OpenAppend(ctx context.Context, path string) (io.WriteCloser, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+	fullPath := c.resolvePath(path)
+
+	return client.NewPipeWriter(func(r io.Reader) error {
+		if err := c.client.Append(fullPath, r); err != nil {
+			return fmt.Errorf("failed to append to FTP file %s: %w", fullPath, err)
+		}
+		return nil
+	}), nil
+}
+
+// WriteFileAtomic uploads data under a hidden temporary name next to path
+// and renames it into place with RNFR/RNTO. Whether the rename replaces an
+// existing file atomically depends on the server; on common Unix servers it
+// does.
+func (c *Client) WriteFileAtomic(ctx context.Context, path string, data io.Reader) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	fullPath := c.resolvePath(path)
+
+	dir := filepath.Dir(fullPath)
+	if dir != "." && dir != "/" {
+		_ = c.client.MakeDir(dir)
+	}
+
+	tmpPath := client.AtomicTempName(fullPath)
+	err := c.client.Stor(tmpPath, data)
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		_ = c.client.Delete(tmpPath)
+		return fmt.Errorf("failed to store FTP file %s: %w", fullPath, err)
+	}
+	if err := c.client.Rename(tmpPath, fullPath); err != nil {
+		_ = c.client.Delete(tmpPath)
+		return fmt.Errorf("failed to rename FTP file into %s: %w", fullPath, err)
+	}
+	return nil
+}
+
 // GetFileInfo gets information about a file.
 func (c *Client) GetFileInfo(ctx context.Context, path string) (*client.FileInfo, error) {
 	if !c.IsConnected() {
@@ -161,34 +246,50 @@ func (c *Client) GetFileInfo(ctx context.Context, path string) (*client.FileInfo
 
 // ListDirectory lists files in a directory.
 func (c *Client) ListDirectory(ctx context.Context, path string) ([]*client.FileInfo, error) {
-	if !c.IsConnected() {
-		return nil, fmt.Errorf("not connected")
-	}
-	fullPath := c.resolvePath(path)
+	return client.CollectFiles(c.StreamDirectory(ctx, path))
+}
 
-	entries, err := c.client.List(fullPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list FTP directory %s: %w", fullPath, err)
-	}
+// StreamDirectory yields the entries of a directory in server order.
+// jlaffaye/ftp reads the whole MLSD or LIST response before returning and
+// exposes no raw data connection, so the entries are converted lazily but
+// the listing itself is still buffered.
+func (c *Client) StreamDirectory(ctx context.Context, path string) iter.Seq2[*client.FileInfo, error] {
+	return func(yield func(*client.FileInfo, error) bool) {
+		if !c.IsConnected() {
+			yield(nil, fmt.Errorf("not connected"))
+			return
+		}
+		fullPath := c.resolvePath(path)
 
-	var files []*client.FileInfo
-	for _, entry := range entries {
-		size := int64(entry.Size)
-		if entry.Size > uint64(1<<63-1) {
-			size = 1<<63 - 1
+		entries, err := c.client.List(fullPath)
+		if err != nil {
+			yield(nil, fmt.Errorf("failed to list FTP directory %s: %w", fullPath, err))
+			return
 		}
 
-		files = append(files, &client.FileInfo{
-			Name:    entry.Name,
-			Size:    size,
-			ModTime: entry.Time,
-			IsDir:   entry.Type == goftp.EntryTypeFolder,
-			Mode:    0644,
-			Path:    path + "/" + entry.Name,
-		})
-	}
+		for _, entry := range entries {
+			size := int64(entry.Size)
+			if entry.Size > uint64(1<<63-1) {
+				size = 1<<63 - 1
+			}
 
-	return files, nil
+			fi := &client.FileInfo{
+				Name:    entry.Name,
+				Size:    size,
+				ModTime: entry.Time,
+				IsDir:   entry.Type == goftp.EntryTypeFolder,
+				Mode:    0644,
+				Path:    path + "/" + entry.Name,
+			}
+			if entry.Type == goftp.EntryTypeLink {
+				fi.LinkType = client.LinkSymlink
+				fi.LinkTarget = entry.Target
+			}
+			if !yield(fi, nil) {
+				return
+			}
+		}
+	}
 }
 
 // FileExists checks if a file exists.
@@ -283,12 +384,71 @@ func (c *Client) CopyFile(ctx context.Context, srcPath, dstPath string) error {
 	return nil
 }
 
+// Chmod returns client.ErrNotSupported: SITE CHMOD needs a raw command,
+// which jlaffaye/ftp does not expose.
+func (c *Client) Chmod(ctx context.Context, path string, mode os.FileMode) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	return fmt.Errorf("failed to chmod FTP file %s: %w", path, client.ErrNotSupported)
+}
+
+// Chtimes sets the modification time with MFMT (or vsftpd's writable MDTM)
+// when the server advertises it. FTP has no access time, so atime is
+// ignored.
+func (c *Client) Chtimes(ctx context.Context, path string, atime, mtime time.Time) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	if mtime.IsZero() {
+		return nil
+	}
+	if !c.client.IsSetTimeSupported() {
+		return fmt.Errorf("FTP server cannot set the time of %s: %w", path, client.ErrNotSupported)
+	}
+	fullPath := c.resolvePath(path)
+	if err := c.client.SetTime(fullPath, mtime); err != nil {
+		return fmt.Errorf("failed to set time of FTP file %s: %w", fullPath, err)
+	}
+	return nil
+}
+
+// Chown returns client.ErrNotSupported; FTP has no ownership command.
+func (c *Client) Chown(ctx context.Context, path string, uid, gid int) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	return fmt.Errorf("failed to chown FTP file %s: %w", path, client.ErrNotSupported)
+}
+
+// GetSpace returns client.ErrNotSupported: AVBL (draft-peterson-streamlined-
+// ftp-command-extensions) needs a raw command, which jlaffaye/ftp does not
+// expose.
+func (c *Client) GetSpace(ctx context.Context, path string) (*client.SpaceInfo, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+	return nil, fmt.Errorf("failed to query free space of FTP path %s: %w", path, client.ErrNotSupported)
+}
+
+// Watch reports changes below path by polling directory listings. The
+// polls share the control connection, so callers that use the client
+// concurrently must serialise access as for any other operation.
+func (c *Client) Watch(ctx context.Context, path string, recursive bool) (<-chan client.Event, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+	return watch.Poll(ctx, c, path, recursive, watch.DefaultPollInterval)
+}
+
 // GetProtocol returns the protocol name.
 func (c *Client) GetProtocol() string {
 	return "ftp"
 }
 
-// GetConfig returns the FTP configuration.
+// GetConfig returns a copy of the FTP configuration with the password redacted.
 func (c *Client) GetConfig() interface{} {
-	return c.config
+	config := *c.config
+	config.Password = client.RedactSecret(config.Password)
+	return &config
 }
@@ -2,7 +2,10 @@ package ftp
 
 import (
 	"context"
+	"encoding/json"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -10,8 +13,16 @@ import (
 	"digital.vasic.filesystem/pkg/client"
 )
 
-// Verify FTP Client implements client.Client interface.
-var _ client.Client = (*Client)(nil)
+// Verify FTP Client implements the client.Client and client.Watcher interfaces.
+var (
+	_ client.Client            = (*Client)(nil)
+	_ client.Watcher           = (*Client)(nil)
+	_ client.WritableClient    = (*Client)(nil)
+	_ client.AtomicWriter      = (*Client)(nil)
+	_ client.AttributeSetter   = (*Client)(nil)
+	_ client.SpaceReporter     = (*Client)(nil)
+	_ client.DirectoryStreamer = (*Client)(nil)
+)
 
 func TestNewFTPClient(t *testing.T) {
 	config := &Config{
@@ -42,7 +53,20 @@ func TestFTPClient_GetConfig(t *testing.T) {
 		Path:     "/files",
 	}
 	c := NewFTPClient(config)
-	assert.Equal(t, config, c.GetConfig())
+	got, ok := c.GetConfig().(*Config)
+	require.True(t, ok)
+	assert.Equal(t, client.RedactedSecret, got.Password)
+	assert.Equal(t, "secret", config.Password, "original config must not be modified")
+	expected := *config
+	expected.Password = client.RedactedSecret
+	assert.Equal(t, &expected, got)
+}
+
+func TestConfig_MarshalJSON_RedactsPassword(t *testing.T) {
+	data, err := json.Marshal(Config{Username: "admin", Password: "s3cret"})
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "s3cret")
+	assert.Contains(t, string(data), client.RedactedSecret)
 }
 
 func TestFTPClient_IsConnected_NotConnected(t *testing.T) {
@@ -187,3 +211,46 @@ func TestFTPConfig_Fields(t *testing.T) {
 	assert.Equal(t, "s3cret", config.Password)
 	assert.Equal(t, "/uploads", config.Path)
 }
+
+func TestFTPClient_Create_NotConnected(t *testing.T) {
+	c := NewFTPClient(&Config{})
+	w, err := c.Create(context.Background(), "test.txt")
+	assert.Error(t, err)
+	assert.Nil(t, w)
+	assert.Contains(t, err.Error(), "not connected")
+}
+
+func TestFTPClient_OpenAppend_NotConnected(t *testing.T) {
+	c := NewFTPClient(&Config{})
+	w, err := c.OpenAppend(context.Background(), "test.txt")
+	assert.Error(t, err)
+	assert.Nil(t, w)
+	assert.Contains(t, err.Error(), "not connected")
+}
+
+func TestFTPClient_WriteFileAtomic_NotConnected(t *testing.T) {
+	c := NewFTPClient(&Config{})
+	err := c.WriteFileAtomic(context.Background(), "test.txt", strings.NewReader("data"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not connected")
+}
+
+func TestFTPClient_Attributes_NotConnected(t *testing.T) {
+	c := NewFTPClient(&Config{})
+	ctx := context.Background()
+	assert.EqualError(t, c.Chmod(ctx, "a", 0644), "not connected")
+	assert.EqualError(t, c.Chtimes(ctx, "a", time.Time{}, time.Now()), "not connected")
+	assert.EqualError(t, c.Chown(ctx, "a", 0, 0), "not connected")
+}
+
+func TestFTPClient_GetSpace_NotConnected(t *testing.T) {
+	c := NewFTPClient(&Config{})
+	_, err := c.GetSpace(context.Background(), "")
+	assert.EqualError(t, err, "not connected")
+}
+
+func TestFTPClient_StreamDirectory_NotConnected(t *testing.T) {
+	c := NewFTPClient(&Config{})
+	_, err := client.CollectFiles(c.StreamDirectory(context.Background(), ""))
+	assert.EqualError(t, err, "not connected")
+}
@@ -0,0 +1,54 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Chmod sets the permission bits of a local file.
+func (c *Client) Chmod(ctx context.Context, path string, mode os.FileMode) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	fullPath, err := c.resolvePath(path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(fullPath, mode); err != nil {
+		return fmt.Errorf("failed to chmod local file %s: %w", fullPath, err)
+	}
+	return nil
+}
+
+// Chtimes sets the access and modification times of a local file.
+func (c *Client) Chtimes(ctx context.Context, path string, atime, mtime time.Time) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	fullPath, err := c.resolvePath(path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chtimes(fullPath, atime, mtime); err != nil {
+		return fmt.Errorf("failed to set times of local file %s: %w", fullPath, err)
+	}
+	return nil
+}
+
+// Chown sets the numeric owner and group of a local file. It is not
+// supported on Windows.
+func (c *Client) Chown(ctx context.Context, path string, uid, gid int) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	fullPath, err := c.resolvePath(path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chown(fullPath, uid, gid); err != nil {
+		return fmt.Errorf("failed to chown local file %s: %w", fullPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+//go:build !windows
+// +build !windows
+
+package local
+
+import (
+	"os"
+	"syscall"
+)
+
+// hardLinks returns the link count of info.
+func hardLinks(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Nlink)
+	}
+	return 1
+}
+
+// fileKey identifies a file independently of the names linking to it.
+type fileKey struct{ dev, ino uint64 }
+
+// fileID returns the device and inode of info.
+func fileID(info os.FileInfo) (fileKey, bool) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return fileKey{uint64(st.Dev), uint64(st.Ino)}, true
+	}
+	return fileKey{}, false
+}
@@ -0,0 +1,19 @@
+//go:build windows
+// +build windows
+
+package local
+
+import "os"
+
+// hardLinks returns 1; the link count is not part of os.FileInfo on Windows.
+func hardLinks(info os.FileInfo) uint64 {
+	return 1
+}
+
+// fileKey identifies a file independently of the names linking to it.
+type fileKey struct{ dev, ino uint64 }
+
+// fileID reports false; os.FileInfo carries no file index on Windows.
+func fileID(info os.FileInfo) (fileKey, bool) {
+	return fileKey{}, false
+}
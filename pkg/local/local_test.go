@@ -3,12 +3,18 @@ package local
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"digital.vasic.filesystem/pkg/client"
+	"digital.vasic.filesystem/pkg/confine"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -435,5 +441,481 @@ func TestLocalClient_GetConfig(t *testing.T) {
 	assert.Equal(t, "/tmp/test", retrievedConfig.BasePath)
 }
 
-// Verify the Client type implements client.Client interface.
-var _ client.Client = (*Client)(nil)
+// Verify the Client type implements the client.Client and client.Watcher interfaces.
+var (
+	_ client.Client            = (*Client)(nil)
+	_ client.Watcher           = (*Client)(nil)
+	_ client.WritableClient    = (*Client)(nil)
+	_ client.AtomicWriter      = (*Client)(nil)
+	_ client.Linker            = (*Client)(nil)
+	_ client.AttributeSetter   = (*Client)(nil)
+	_ client.SpaceReporter     = (*Client)(nil)
+	_ client.DirectoryStreamer = (*Client)(nil)
+	_ client.UsageReporter     = (*Client)(nil)
+	_ client.MetadataStore     = (*Client)(nil)
+)
+
+func TestLocalClient_Create(t *testing.T) {
+	tempDir := t.TempDir()
+	c := NewLocalClient(&Config{BasePath: tempDir})
+	require.NoError(t, c.Connect(context.Background()))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "old.txt"), []byte("previous content"), 0644))
+
+	w, err := c.Create(context.Background(), "nested/dir/new.txt")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("hello "))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("world"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	data, err := os.ReadFile(filepath.Join(tempDir, "nested", "dir", "new.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+
+	w, err = c.Create(context.Background(), "old.txt")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("new"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	data, err = os.ReadFile(filepath.Join(tempDir, "old.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+}
+
+func TestLocalClient_OpenAppend(t *testing.T) {
+	tempDir := t.TempDir()
+	c := NewLocalClient(&Config{BasePath: tempDir})
+	require.NoError(t, c.Connect(context.Background()))
+
+	for _, line := range []string{"first\n", "second\n"} {
+		w, err := c.OpenAppend(context.Background(), "app.log")
+		require.NoError(t, err)
+		_, err = w.Write([]byte(line))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+	}
+
+	data, err := os.ReadFile(filepath.Join(tempDir, "app.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "first\nsecond\n", string(data))
+}
+
+func TestLocalClient_Create_NotConnected(t *testing.T) {
+	c := NewLocalClient(&Config{BasePath: t.TempDir()})
+	_, err := c.Create(context.Background(), "a.txt")
+	assert.EqualError(t, err, "not connected")
+	_, err = c.OpenAppend(context.Background(), "a.txt")
+	assert.EqualError(t, err, "not connected")
+}
+
+// failingReader returns some data and then an error, like an upload whose
+// source connection drops.
+type failingReader struct{ sent bool }
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.sent {
+		return 0, errors.New("connection reset")
+	}
+	r.sent = true
+	return copy(p, "partial"), nil
+}
+
+func TestLocalClient_WriteFileAtomic(t *testing.T) {
+	tempDir := t.TempDir()
+	c := NewLocalClient(&Config{BasePath: tempDir})
+	require.NoError(t, c.Connect(context.Background()))
+	target := filepath.Join(tempDir, "data.txt")
+	require.NoError(t, os.WriteFile(target, []byte("original"), 0600))
+
+	err := c.WriteFileAtomic(context.Background(), "data.txt", &failingReader{})
+	assert.Error(t, err)
+	data, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, "original", string(data), "failed write must leave the old file untouched")
+
+	require.NoError(t, c.WriteFileAtomic(context.Background(), "data.txt", strings.NewReader("replaced")))
+	data, err = os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, "replaced", string(data))
+	info, err := os.Stat(target)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	entries, err := os.ReadDir(tempDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "no temporary files may remain")
+}
+
+func TestLocalClient_WriteFileAtomic_Cancelled(t *testing.T) {
+	tempDir := t.TempDir()
+	c := NewLocalClient(&Config{BasePath: tempDir})
+	require.NoError(t, c.Connect(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := c.WriteFileAtomic(ctx, "new/file.txt", strings.NewReader("data"))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NoFileExists(t, filepath.Join(tempDir, "new", "file.txt"))
+	entries, err := os.ReadDir(filepath.Join(tempDir, "new"))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestLocalClient_WriteFile_AtomicConfig(t *testing.T) {
+	tempDir := t.TempDir()
+	c := NewLocalClient(&Config{BasePath: tempDir, AtomicWrites: true})
+	require.NoError(t, c.Connect(context.Background()))
+	target := filepath.Join(tempDir, "data.txt")
+	require.NoError(t, os.WriteFile(target, []byte("original"), 0644))
+
+	err := c.WriteFile(context.Background(), "data.txt", &failingReader{})
+	assert.Error(t, err)
+	data, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, "original", string(data))
+}
+
+func TestLocalClient_WriteFileAtomic_NotConnected(t *testing.T) {
+	c := NewLocalClient(&Config{BasePath: t.TempDir()})
+	err := c.WriteFileAtomic(context.Background(), "a.txt", strings.NewReader("x"))
+	assert.EqualError(t, err, "not connected")
+}
+
+func TestLocalClient_PathConfinement(t *testing.T) {
+	parent := t.TempDir()
+	base := filepath.Join(parent, "base")
+	require.NoError(t, os.MkdirAll(filepath.Join(base, "a..b"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(base, "a..b", "file..txt"), []byte("dots"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(parent, "secret.txt"), []byte("secret"), 0644))
+	if err := os.Symlink("..", filepath.Join(base, "parent")); err != nil {
+		t.Skip("symlinks not supported on this filesystem")
+	}
+
+	c := NewLocalClient(&Config{BasePath: base})
+	require.NoError(t, c.Connect(context.Background()))
+	ctx := context.Background()
+
+	reader, err := c.ReadFile(ctx, "a..b/file..txt")
+	require.NoError(t, err)
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	assert.Equal(t, "dots", string(data), "names containing dots must not be mangled")
+
+	_, err = c.ReadFile(ctx, "../secret.txt")
+	assert.ErrorIs(t, err, confine.ErrEscape)
+	_, err = c.ReadFile(ctx, "parent/secret.txt")
+	assert.ErrorIs(t, err, confine.ErrEscape)
+	err = c.WriteFile(ctx, "parent/planted.txt", strings.NewReader("x"))
+	assert.ErrorIs(t, err, confine.ErrEscape)
+	assert.NoFileExists(t, filepath.Join(parent, "planted.txt"))
+
+	follow := NewLocalClient(&Config{BasePath: base, Symlinks: "follow"})
+	require.NoError(t, follow.Connect(ctx))
+	reader, err = follow.ReadFile(ctx, "parent/secret.txt")
+	require.NoError(t, err)
+	reader.Close()
+	_, err = follow.ReadFile(ctx, "../secret.txt")
+	assert.ErrorIs(t, err, confine.ErrEscape, "follow still rejects lexical escapes")
+
+	refuse := NewLocalClient(&Config{BasePath: base, Symlinks: "refuse"})
+	require.NoError(t, refuse.Connect(ctx))
+	_, err = refuse.ListDirectory(ctx, "parent")
+	assert.ErrorIs(t, err, confine.ErrSymlink)
+}
+
+func TestLocalClient_Connect_InvalidSymlinkPolicy(t *testing.T) {
+	c := NewLocalClient(&Config{BasePath: t.TempDir(), Symlinks: "sometimes"})
+	err := c.Connect(context.Background())
+	assert.Error(t, err)
+	assert.False(t, c.IsConnected())
+}
+
+func TestLocalClient_Links(t *testing.T) {
+	tempDir := t.TempDir()
+	c := NewLocalClient(&Config{BasePath: tempDir})
+	require.NoError(t, c.Connect(context.Background()))
+	ctx := context.Background()
+	require.NoError(t, os.MkdirAll(filepath.Join(tempDir, "dir"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "dir", "file.txt"), []byte("content"), 0644))
+
+	if err := c.Symlink(ctx, "dir/file.txt", "link.txt"); err != nil {
+		t.Skip("symlinks not supported on this filesystem")
+	}
+	target, err := c.Readlink(ctx, "link.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "dir/file.txt", target)
+
+	info, err := c.GetFileInfo(ctx, "link.txt")
+	require.NoError(t, err)
+	assert.Equal(t, client.LinkSymlink, info.LinkType)
+	assert.Equal(t, "dir/file.txt", info.LinkTarget)
+	assert.Equal(t, int64(7), info.Size, "GetFileInfo describes the target")
+
+	require.NoError(t, c.Link(ctx, "dir/file.txt", "hard.txt"))
+	info, err = c.GetFileInfo(ctx, "hard.txt")
+	require.NoError(t, err)
+	assert.Equal(t, client.LinkHard, info.LinkType)
+	assert.Empty(t, info.LinkTarget)
+	orig, err := c.GetFileInfo(ctx, "dir/file.txt")
+	require.NoError(t, err)
+	assert.NotEmpty(t, info.FileID)
+	assert.Equal(t, orig.FileID, info.FileID, "hard links share a FileID")
+	dir, err := c.GetFileInfo(ctx, "dir")
+	require.NoError(t, err)
+	assert.NotEqual(t, orig.FileID, dir.FileID)
+
+	files, err := c.ListDirectory(ctx, ".")
+	require.NoError(t, err)
+	types := map[string]client.LinkType{}
+	for _, f := range files {
+		types[f.Name] = f.LinkType
+	}
+	assert.Equal(t, map[string]client.LinkType{
+		"dir":      client.LinkNone,
+		"hard.txt": client.LinkHard,
+		"link.txt": client.LinkSymlink,
+	}, types)
+}
+
+func TestLocalClient_Links_Confined(t *testing.T) {
+	parent := t.TempDir()
+	base := filepath.Join(parent, "base")
+	require.NoError(t, os.MkdirAll(base, 0755))
+	c := NewLocalClient(&Config{BasePath: base})
+	require.NoError(t, c.Connect(context.Background()))
+	ctx := context.Background()
+
+	err := c.Symlink(ctx, "../outside", "escape")
+	assert.ErrorIs(t, err, confine.ErrEscape)
+	err = c.Symlink(ctx, "/etc/passwd", "escape")
+	assert.ErrorIs(t, err, confine.ErrEscape)
+
+	// A link planted from outside can be inspected and removed, not followed.
+	if err := os.Symlink("/etc", filepath.Join(base, "planted")); err != nil {
+		t.Skip("symlinks not supported on this filesystem")
+	}
+	target, err := c.Readlink(ctx, "planted")
+	require.NoError(t, err)
+	assert.Equal(t, "/etc", target)
+	info, err := c.GetFileInfo(ctx, "planted")
+	require.NoError(t, err)
+	assert.Equal(t, client.LinkSymlink, info.LinkType)
+	assert.False(t, info.IsDir, "an escaping link is described by itself")
+	_, err = c.ListDirectory(ctx, "planted")
+	assert.ErrorIs(t, err, confine.ErrEscape)
+	require.NoError(t, c.DeleteFile(ctx, "planted"))
+	assert.NoFileExists(t, filepath.Join(base, "planted"))
+
+	follow := NewLocalClient(&Config{BasePath: base, Symlinks: "follow"})
+	require.NoError(t, follow.Connect(ctx))
+	assert.NoError(t, follow.Symlink(ctx, "../outside", "escape"))
+}
+
+func TestLocalClient_Sub_SymlinkChain(t *testing.T) {
+	base := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(base, "tenantA"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(base, "tenantB"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(base, "tenantB", "secret"), []byte("B"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(base, "tenantA", "file.txt"), []byte("A"), 0644))
+	c := NewLocalClient(&Config{BasePath: base})
+	ctx := context.Background()
+	require.NoError(t, c.Connect(ctx))
+	view := client.Sub(c, "tenantA")
+	links := view.(client.Linker)
+
+	// x -> . followed by esc -> x/.. would let the kernel resolve ".."
+	// after the link and land in the parent of the view.
+	assert.ErrorIs(t, links.Symlink(ctx, ".", "x"), confine.ErrEscape)
+	assert.ErrorIs(t, links.Symlink(ctx, "x/..", "esc"), confine.ErrEscape)
+	_, err := view.ReadFile(ctx, "esc/tenantB/secret")
+	assert.Error(t, err)
+	_, err = os.Lstat(filepath.Join(base, "tenantA", "x"))
+	assert.True(t, os.IsNotExist(err))
+
+	if err := links.Symlink(ctx, "file.txt", "alias"); err != nil {
+		t.Skip("symlinks not supported on this filesystem")
+	}
+	rc, err := view.ReadFile(ctx, "alias")
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "A", string(data))
+}
+
+func TestLocalClient_Links_NotConnected(t *testing.T) {
+	c := NewLocalClient(&Config{BasePath: t.TempDir()})
+	ctx := context.Background()
+	assert.EqualError(t, c.Symlink(ctx, "a", "b"), "not connected")
+	_, err := c.Readlink(ctx, "b")
+	assert.EqualError(t, err, "not connected")
+	assert.EqualError(t, c.Link(ctx, "a", "b"), "not connected")
+}
+
+func TestLocalClient_Attributes(t *testing.T) {
+	tempDir := t.TempDir()
+	c := NewLocalClient(&Config{BasePath: tempDir})
+	require.NoError(t, c.Connect(context.Background()))
+	ctx := context.Background()
+	target := filepath.Join(tempDir, "file.txt")
+	require.NoError(t, os.WriteFile(target, []byte("x"), 0644))
+
+	require.NoError(t, c.Chmod(ctx, "file.txt", 0600))
+	info, err := os.Stat(target)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	mtime := time.Date(2020, 5, 17, 8, 0, 0, 0, time.UTC)
+	require.NoError(t, c.Chtimes(ctx, "file.txt", time.Time{}, mtime))
+	info, err = os.Stat(target)
+	require.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(mtime))
+
+	if runtime.GOOS != "windows" {
+		require.NoError(t, c.Chown(ctx, "file.txt", os.Getuid(), os.Getgid()))
+	}
+	assert.Error(t, c.Chmod(ctx, "missing.txt", 0600))
+}
+
+func TestLocalClient_Attributes_NotConnected(t *testing.T) {
+	c := NewLocalClient(&Config{BasePath: t.TempDir()})
+	ctx := context.Background()
+	assert.EqualError(t, c.Chmod(ctx, "a", 0644), "not connected")
+	assert.EqualError(t, c.Chtimes(ctx, "a", time.Time{}, time.Now()), "not connected")
+	assert.EqualError(t, c.Chown(ctx, "a", 0, 0), "not connected")
+}
+
+func TestLocalClient_Metadata(t *testing.T) {
+	tempDir := t.TempDir()
+	c := NewLocalClient(&Config{BasePath: tempDir})
+	require.NoError(t, c.Connect(context.Background()))
+	ctx := context.Background()
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "clip.mov"), []byte("x"), 0644))
+
+	err := c.SetMetadata(ctx, "clip.mov", map[string]string{"job": "ingest-42", "sha256": "abc"})
+	if errors.Is(err, client.ErrNotSupported) {
+		t.Skip("user extended attributes not supported on this filesystem")
+	}
+	require.NoError(t, err)
+
+	meta, err := c.GetMetadata(ctx, "clip.mov")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"job": "ingest-42", "sha256": "abc"}, meta)
+
+	require.NoError(t, c.SetMetadata(ctx, "clip.mov", map[string]string{"job": "ingest-43"}))
+	require.NoError(t, c.DeleteMetadata(ctx, "clip.mov", "sha256", "never-set"))
+	meta, err = c.GetMetadata(ctx, "clip.mov")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"job": "ingest-43"}, meta)
+
+	assert.ErrorIs(t, c.SetMetadata(ctx, "clip.mov", map[string]string{"bad key": "x"}), client.ErrInvalidMetadataKey)
+	_, err = c.GetMetadata(ctx, "missing.mov")
+	assert.Error(t, err)
+}
+
+func TestLocalClient_Metadata_NotConnected(t *testing.T) {
+	c := NewLocalClient(&Config{BasePath: t.TempDir()})
+	ctx := context.Background()
+	_, err := c.GetMetadata(ctx, "a")
+	assert.EqualError(t, err, "not connected")
+	assert.EqualError(t, c.SetMetadata(ctx, "a", map[string]string{"k": "v"}), "not connected")
+	assert.EqualError(t, c.DeleteMetadata(ctx, "a", "k"), "not connected")
+}
+
+func TestLocalClient_GetSpace(t *testing.T) {
+	tempDir := t.TempDir()
+	c := NewLocalClient(&Config{BasePath: tempDir})
+	require.NoError(t, c.Connect(context.Background()))
+	ctx := context.Background()
+
+	space, err := c.GetSpace(ctx, "")
+	require.NoError(t, err)
+	assert.Greater(t, space.Total, int64(0))
+	assert.LessOrEqual(t, space.Free, space.Total)
+	assert.LessOrEqual(t, space.Used, space.Total)
+	assert.Zero(t, space.Quota)
+
+	_, err = c.GetSpace(ctx, "missing")
+	assert.Error(t, err)
+	_, err = c.GetSpace(ctx, "../outside")
+	assert.Error(t, err)
+}
+
+func TestLocalClient_GetSpace_NotConnected(t *testing.T) {
+	c := NewLocalClient(&Config{BasePath: t.TempDir()})
+	_, err := c.GetSpace(context.Background(), "")
+	assert.EqualError(t, err, "not connected")
+}
+
+func TestLocalClient_DirUsage(t *testing.T) {
+	tempDir := t.TempDir()
+	c := NewLocalClient(&Config{BasePath: tempDir})
+	require.NoError(t, c.Connect(context.Background()))
+	ctx := context.Background()
+	require.NoError(t, os.MkdirAll(filepath.Join(tempDir, "a", "b"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "a", "one.txt"), []byte("1"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "a", "b", "two.txt"), []byte("22"), 0644))
+
+	usage, err := c.DirUsage(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, &client.DirUsage{Bytes: 3, Files: 2, Dirs: 1}, usage)
+
+	_, err = c.DirUsage(ctx, "a/one.txt")
+	assert.Error(t, err, "files are not directories")
+	_, err = c.DirUsage(ctx, "missing")
+	assert.Error(t, err)
+}
+
+func TestLocalClient_DirUsage_NotConnected(t *testing.T) {
+	c := NewLocalClient(&Config{BasePath: t.TempDir()})
+	_, err := c.DirUsage(context.Background(), "")
+	assert.EqualError(t, err, "not connected")
+}
+
+func TestLocalClient_StreamDirectory(t *testing.T) {
+	tempDir := t.TempDir()
+	c := NewLocalClient(&Config{BasePath: tempDir})
+	require.NoError(t, c.Connect(context.Background()))
+	ctx := context.Background()
+	const n = listBatch + 100
+	for i := 0; i < n; i++ {
+		require.NoError(t, os.WriteFile(filepath.Join(tempDir, fmt.Sprintf("f%05d.jpg", i)), nil, 0644))
+	}
+
+	seen := make(map[string]bool)
+	for f, err := range c.StreamDirectory(ctx, "") {
+		require.NoError(t, err)
+		seen[f.Name] = true
+	}
+	assert.Len(t, seen, n, "entries span several batches")
+
+	count := 0
+	for _, err := range c.StreamDirectory(ctx, "") {
+		require.NoError(t, err)
+		if count++; count == 3 {
+			break
+		}
+	}
+	assert.Equal(t, 3, count)
+
+	files, err := c.ListDirectory(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, files, n)
+	assert.Equal(t, "f00000.jpg", files[0].Name, "ListDirectory stays sorted")
+	assert.Equal(t, fmt.Sprintf("f%05d.jpg", n-1), files[n-1].Name)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = client.CollectFiles(c.StreamDirectory(cancelled, ""))
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = client.CollectFiles(c.StreamDirectory(ctx, "missing"))
+	assert.Error(t, err)
+}
+
+func TestLocalClient_StreamDirectory_NotConnected(t *testing.T) {
+	c := NewLocalClient(&Config{BasePath: t.TempDir()})
+	_, err := client.CollectFiles(c.StreamDirectory(context.Background(), ""))
+	assert.EqualError(t, err, "not connected")
+}
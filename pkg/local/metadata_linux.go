@@ -0,0 +1,124 @@
+//go:build linux
+// +build linux
+
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// xattrPrefix is the extended attribute namespace holding metadata.
+const xattrPrefix = "user."
+
+// GetMetadata returns the "user." extended attributes of a local file.
+func (c *Client) GetMetadata(ctx context.Context, path string) (map[string]string, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+	fullPath, err := c.resolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := getXattrs(fullPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata of local file %s: %w", fullPath, xattrError(err))
+	}
+	return meta, nil
+}
+
+// SetMetadata stores meta as "user." extended attributes of a local file.
+func (c *Client) SetMetadata(ctx context.Context, path string, meta map[string]string) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	fullPath, err := c.resolvePath(path)
+	if err != nil {
+		return err
+	}
+	for key, value := range meta {
+		if err := client.ValidMetadataKey(key); err != nil {
+			return err
+		}
+		if err := unix.Setxattr(fullPath, xattrPrefix+key, []byte(value), 0); err != nil {
+			return fmt.Errorf("failed to set metadata %s of local file %s: %w", key, fullPath, xattrError(err))
+		}
+	}
+	return nil
+}
+
+// DeleteMetadata removes "user." extended attributes of a local file.
+func (c *Client) DeleteMetadata(ctx context.Context, path string, keys ...string) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	fullPath, err := c.resolvePath(path)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		err := unix.Removexattr(fullPath, xattrPrefix+key)
+		if err != nil && !errors.Is(err, unix.ENODATA) {
+			return fmt.Errorf("failed to delete metadata %s of local file %s: %w", key, fullPath, xattrError(err))
+		}
+	}
+	return nil
+}
+
+// getXattrs reads every "user." attribute of fullPath.
+func getXattrs(fullPath string) (map[string]string, error) {
+	names, err := xattrRead(func(buf []byte) (int, error) { return unix.Listxattr(fullPath, buf) })
+	if err != nil {
+		return nil, err
+	}
+	meta := make(map[string]string)
+	for _, name := range strings.Split(string(names), "\x00") {
+		key, ok := strings.CutPrefix(name, xattrPrefix)
+		if !ok || key == "" {
+			continue
+		}
+		value, err := xattrRead(func(buf []byte) (int, error) { return unix.Getxattr(fullPath, name, buf) })
+		if errors.Is(err, unix.ENODATA) {
+			continue // removed since listing
+		}
+		if err != nil {
+			return nil, err
+		}
+		meta[key] = string(value)
+	}
+	return meta, nil
+}
+
+// xattrRead calls read with a buffer sized by a first call with an empty
+// one, retrying when the attribute grows in between.
+func xattrRead(read func([]byte) (int, error)) ([]byte, error) {
+	for {
+		size, err := read(nil)
+		if err != nil || size == 0 {
+			return nil, err
+		}
+		buf := make([]byte, size)
+		n, err := read(buf)
+		if errors.Is(err, unix.ERANGE) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+}
+
+// xattrError marks filesystems without user xattrs as unsupported.
+func xattrError(err error) error {
+	if errors.Is(err, unix.ENOTSUP) {
+		return fmt.Errorf("%w: %w", client.ErrNotSupported, err)
+	}
+	return err
+}
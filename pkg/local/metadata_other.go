@@ -0,0 +1,36 @@
+//go:build !linux
+// +build !linux
+
+package local
+
+import (
+	"context"
+	"fmt"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// GetMetadata returns client.ErrNotSupported; user metadata is stored in
+// extended attributes, implemented on Linux only.
+func (c *Client) GetMetadata(ctx context.Context, path string) (map[string]string, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+	return nil, fmt.Errorf("failed to read metadata of local file %s: %w", path, client.ErrNotSupported)
+}
+
+// SetMetadata returns client.ErrNotSupported; see GetMetadata.
+func (c *Client) SetMetadata(ctx context.Context, path string, meta map[string]string) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	return fmt.Errorf("failed to set metadata of local file %s: %w", path, client.ErrNotSupported)
+}
+
+// DeleteMetadata returns client.ErrNotSupported; see GetMetadata.
+func (c *Client) DeleteMetadata(ctx context.Context, path string, keys ...string) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	return fmt.Errorf("failed to delete metadata of local file %s: %w", path, client.ErrNotSupported)
+}
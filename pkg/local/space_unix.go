@@ -0,0 +1,36 @@
+//go:build !windows
+// +build !windows
+
+package local
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// GetSpace reports the filesystem holding path with statfs. Free counts
+// only blocks available to unprivileged users; per-user disk quotas are
+// not consulted.
+func (c *Client) GetSpace(ctx context.Context, path string) (*client.SpaceInfo, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+	fullPath, err := c.resolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	var st unix.Statfs_t
+	if err := unix.Statfs(fullPath, &st); err != nil {
+		return nil, fmt.Errorf("failed to statfs local path %s: %w", fullPath, err)
+	}
+	bsize := int64(st.Bsize)
+	return &client.SpaceInfo{
+		Total: int64(st.Blocks) * bsize,
+		Free:  int64(st.Bavail) * bsize,
+		Used:  int64(st.Blocks-st.Bfree) * bsize,
+	}, nil
+}
@@ -0,0 +1,38 @@
+//go:build windows
+// +build windows
+
+package local
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/sys/windows"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// GetSpace reports the volume holding path with GetDiskFreeSpaceEx, whose
+// caller-available figure already honours NTFS quotas.
+func (c *Client) GetSpace(ctx context.Context, path string) (*client.SpaceInfo, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+	fullPath, err := c.resolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := windows.UTF16PtrFromString(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	var avail, total, free uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &avail, &total, &free); err != nil {
+		return nil, fmt.Errorf("failed to query free space of local path %s: %w", fullPath, err)
+	}
+	return &client.SpaceInfo{
+		Total: int64(total),
+		Free:  int64(avail),
+		Used:  int64(total - free),
+	}, nil
+}
@@ -0,0 +1,64 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// DirUsage totals the tree below path in one du-style walk. Files with
+// several hard links inside the tree are counted once; symbolic links are
+// counted as files of zero bytes and never followed.
+func (c *Client) DirUsage(ctx context.Context, path string) (*client.DirUsage, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+	fullPath, err := c.resolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &client.DirUsage{}
+	seen := make(map[fileKey]bool)
+	err = filepath.WalkDir(fullPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if p == fullPath {
+			if !d.IsDir() {
+				return fmt.Errorf("not a directory")
+			}
+			return nil
+		}
+		switch {
+		case d.IsDir():
+			usage.Dirs++
+		case d.Type()&fs.ModeSymlink != 0:
+			usage.Files++
+		default:
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if key, ok := fileID(info); ok && hardLinks(info) > 1 {
+				if seen[key] {
+					return nil
+				}
+				seen[key] = true
+			}
+			usage.Files++
+			usage.Bytes += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk local directory %s: %w", fullPath, err)
+	}
+	return usage, nil
+}
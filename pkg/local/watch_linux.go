@@ -0,0 +1,326 @@
+//go:build linux
+// +build linux
+
+package local
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// inotifyMask selects the inotify events translated into client.Events.
+// IN_CLOSE_WRITE rather than IN_MODIFY is used so a single write produces a
+// single modify event.
+const inotifyMask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// moveTimeout is how long an IN_MOVED_FROM that ends a read batch waits for
+// its IN_MOVED_TO before it is reported as a delete.
+const moveTimeout = 10 * time.Millisecond
+
+// Watch reports changes below path using inotify. With recursive set every
+// subdirectory is watched, including directories created later. Event paths
+// are joined onto path as given. The channel is closed when ctx is
+// cancelled or the watched directory is removed.
+func (c *Client) Watch(ctx context.Context, path string, recursive bool) (<-chan client.Event, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+	fullPath, err := c.resolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat local directory %s: %w", fullPath, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("local path %s is not a directory", fullPath)
+	}
+
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialise inotify: %w", err)
+	}
+	w := &inotifyWatcher{
+		file:      os.NewFile(uintptr(fd), "inotify"),
+		fd:        fd,
+		base:      fullPath,
+		root:      path,
+		recursive: recursive,
+		dirs:      make(map[int]string),
+		events:    make(chan client.Event, 64),
+		done:      make(chan struct{}),
+	}
+	if err := w.add(""); err != nil {
+		w.file.Close()
+		return nil, err
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			w.file.Close()
+		case <-w.done:
+		}
+	}()
+	go w.run(ctx)
+	return w.events, nil
+}
+
+// inotifyWatcher translates raw inotify events into client.Events.
+type inotifyWatcher struct {
+	file      *os.File
+	fd        int
+	base      string
+	root      string
+	recursive bool
+	// dirs maps watch descriptors to directories relative to base.
+	dirs   map[int]string
+	events chan client.Event
+	done   chan struct{}
+	// pending is an IN_MOVED_FROM whose IN_MOVED_TO has not been seen yet.
+	// It is kept across read batches, since the kernel may split the pair.
+	pending *pendingMove
+}
+
+// pendingMove is an IN_MOVED_FROM waiting for its IN_MOVED_TO.
+type pendingMove struct {
+	cookie uint32
+	rel    string
+	isDir  bool
+}
+
+// add watches the directory rel and, in recursive mode, its subdirectories.
+func (w *inotifyWatcher) add(rel string) error {
+	dir := filepath.Join(w.base, filepath.FromSlash(rel))
+	wd, err := syscall.InotifyAddWatch(w.fd, dir, inotifyMask)
+	if err != nil {
+		return fmt.Errorf("failed to watch local directory %s: %w", dir, err)
+	}
+	w.dirs[wd] = rel
+	if !w.recursive {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to list local directory %s: %w", dir, err)
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			if err := w.add(path.Join(rel, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// run reads the inotify descriptor until it is closed.
+func (w *inotifyWatcher) run(ctx context.Context) {
+	defer close(w.events)
+	defer close(w.done)
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := w.file.Read(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			// No IN_MOVED_TO followed in time.
+			if !w.flush(ctx) {
+				w.file.Close()
+				return
+			}
+			_ = w.file.SetReadDeadline(time.Time{})
+			continue
+		}
+		if err != nil {
+			if ctx.Err() == nil && !errors.Is(err, os.ErrClosed) {
+				w.send(ctx, client.Event{Type: client.EventError, Path: w.root, Err: fmt.Errorf("failed to read inotify events: %w", err)})
+			}
+			return
+		}
+		if !w.handle(ctx, buf[:n]) {
+			w.file.Close()
+			return
+		}
+		if w.pending != nil && w.file.SetReadDeadline(time.Now().Add(moveTimeout)) != nil {
+			if !w.flush(ctx) {
+				w.file.Close()
+				return
+			}
+		}
+	}
+}
+
+// flush reports a pending IN_MOVED_FROM without a matching IN_MOVED_TO as
+// a delete. A directory moved out of the tree loses its watches, and those
+// of its subdirectories, so changes inside it are no longer reported.
+func (w *inotifyWatcher) flush(ctx context.Context) bool {
+	p := w.pending
+	if p == nil {
+		return true
+	}
+	w.pending = nil
+	if p.isDir {
+		w.remove(p.rel)
+	}
+	return w.send(ctx, client.Event{Type: client.EventDelete, Path: w.path(p.rel), IsDir: p.isDir})
+}
+
+// handle processes one read batch. It returns false once the watcher should
+// stop, either because ctx is done or no watches remain.
+func (w *inotifyWatcher) handle(ctx context.Context, buf []byte) bool {
+	for off := 0; off+syscall.SizeofInotifyEvent <= len(buf); {
+		raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+		nameStart := off + syscall.SizeofInotifyEvent
+		nameEnd := nameStart + int(raw.Len)
+		if nameEnd > len(buf) {
+			break
+		}
+		name := string(bytes.TrimRight(buf[nameStart:nameEnd], "\x00"))
+		off = nameEnd
+
+		mask := raw.Mask
+		isDir := mask&syscall.IN_ISDIR != 0
+		if mask&syscall.IN_Q_OVERFLOW != 0 {
+			if !w.flush(ctx) || !w.send(ctx, client.Event{Type: client.EventError, Path: w.root, Err: fmt.Errorf("inotify event queue overflowed")}) {
+				return false
+			}
+			continue
+		}
+		// Flush before looking up the directory: a directory moved out of
+		// the tree loses its watches here.
+		if w.pending != nil && !(mask&syscall.IN_MOVED_TO != 0 && raw.Cookie == w.pending.cookie) {
+			if !w.flush(ctx) {
+				return false
+			}
+		}
+		dir, ok := w.dirs[int(raw.Wd)]
+		if !ok {
+			continue
+		}
+		if mask&syscall.IN_IGNORED != 0 {
+			delete(w.dirs, int(raw.Wd))
+			if len(w.dirs) == 0 {
+				return false
+			}
+			continue
+		}
+		rel := path.Join(dir, name)
+
+		var ev client.Event
+		switch {
+		case mask&syscall.IN_MOVED_FROM != 0:
+			w.pending = &pendingMove{cookie: raw.Cookie, rel: rel, isDir: isDir}
+			continue
+		case mask&syscall.IN_MOVED_TO != 0 && w.pending != nil:
+			ev = client.Event{Type: client.EventRename, Path: w.path(rel), OldPath: w.path(w.pending.rel), IsDir: isDir}
+			if isDir {
+				w.move(w.pending.rel, rel)
+			}
+			w.pending = nil
+		case mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+			ev = client.Event{Type: client.EventCreate, Path: w.path(rel), IsDir: isDir}
+			if isDir && w.recursive {
+				if !w.send(ctx, ev) || !w.addNew(ctx, rel) {
+					return false
+				}
+				continue
+			}
+		case mask&syscall.IN_CLOSE_WRITE != 0:
+			ev = client.Event{Type: client.EventModify, Path: w.path(rel)}
+		case mask&syscall.IN_DELETE != 0:
+			ev = client.Event{Type: client.EventDelete, Path: w.path(rel), IsDir: isDir}
+		case mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF) != 0:
+			if dir != "" {
+				// Reported by the parent directory's watch.
+				continue
+			}
+			ev = client.Event{Type: client.EventDelete, Path: w.root, IsDir: true}
+		default:
+			continue
+		}
+		if !w.send(ctx, ev) {
+			return false
+		}
+	}
+	return true
+}
+
+// addNew watches a directory created after the watch started and reports
+// entries that appeared in it before its watch was in place.
+func (w *inotifyWatcher) addNew(ctx context.Context, rel string) bool {
+	if err := w.add(rel); err != nil {
+		if errors.Is(err, syscall.ENOENT) {
+			return true
+		}
+		return w.send(ctx, client.Event{Type: client.EventError, Path: w.path(rel), Err: err})
+	}
+	dir := filepath.Join(w.base, filepath.FromSlash(rel))
+	ok := true
+	_ = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == dir {
+			return nil
+		}
+		sub, relErr := filepath.Rel(w.base, p)
+		if relErr != nil {
+			return nil
+		}
+		if !w.send(ctx, client.Event{Type: client.EventCreate, Path: w.path(filepath.ToSlash(sub)), IsDir: d.IsDir()}) {
+			ok = false
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return ok
+}
+
+// move updates watched directories after a directory rename.
+func (w *inotifyWatcher) move(oldRel, newRel string) {
+	for wd, rel := range w.dirs {
+		if rel == oldRel {
+			w.dirs[wd] = newRel
+		} else if strings.HasPrefix(rel, oldRel+"/") {
+			w.dirs[wd] = newRel + strings.TrimPrefix(rel, oldRel)
+		}
+	}
+}
+
+// remove stops watching the directory rel and its subdirectories.
+func (w *inotifyWatcher) remove(rel string) {
+	for wd, r := range w.dirs {
+		if r == rel || strings.HasPrefix(r, rel+"/") {
+			_, _ = syscall.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.dirs, wd)
+		}
+	}
+}
+
+// path converts a base-relative path into the caller's namespace.
+func (w *inotifyWatcher) path(rel string) string {
+	if rel == "" {
+		return w.root
+	}
+	return path.Join(w.root, rel)
+}
+
+// send delivers ev unless ctx is cancelled first.
+func (w *inotifyWatcher) send(ctx context.Context, ev client.Event) bool {
+	select {
+	case w.events <- ev:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,192 @@
+//go:build linux
+// +build linux
+
+package local
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"digital.vasic.filesystem/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func waitEvent(t *testing.T, events <-chan client.Event, typ client.EventType, path string) client.Event {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev, ok := <-events:
+			require.True(t, ok, "event channel closed")
+			if ev.Type == typ && ev.Path == path {
+				return ev
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s %s", typ, path)
+			return client.Event{}
+		}
+	}
+}
+
+func TestLocalClient_Watch(t *testing.T) {
+	tempDir := t.TempDir()
+	c := NewLocalClient(&Config{BasePath: tempDir})
+	require.NoError(t, c.Connect(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := c.Watch(ctx, "/", false)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("a"), 0644))
+	waitEvent(t, events, client.EventCreate, "/a.txt")
+	waitEvent(t, events, client.EventModify, "/a.txt")
+
+	require.NoError(t, os.Rename(filepath.Join(tempDir, "a.txt"), filepath.Join(tempDir, "b.txt")))
+	ev := waitEvent(t, events, client.EventRename, "/b.txt")
+	assert.Equal(t, "/a.txt", ev.OldPath)
+
+	require.NoError(t, os.Remove(filepath.Join(tempDir, "b.txt")))
+	waitEvent(t, events, client.EventDelete, "/b.txt")
+
+	require.NoError(t, os.Mkdir(filepath.Join(tempDir, "dir"), 0755))
+	ev = waitEvent(t, events, client.EventCreate, "/dir")
+	assert.True(t, ev.IsDir)
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestLocalClient_Watch_Recursive(t *testing.T) {
+	tempDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(tempDir, "root", "existing"), 0755))
+	c := NewLocalClient(&Config{BasePath: tempDir})
+	require.NoError(t, c.Connect(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := c.Watch(ctx, "root", true)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "root", "existing", "f.txt"), []byte("x"), 0644))
+	waitEvent(t, events, client.EventCreate, "root/existing/f.txt")
+
+	require.NoError(t, os.Mkdir(filepath.Join(tempDir, "root", "new"), 0755))
+	waitEvent(t, events, client.EventCreate, "root/new")
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "root", "new", "g.txt"), []byte("y"), 0644))
+	waitEvent(t, events, client.EventCreate, "root/new/g.txt")
+
+	require.NoError(t, os.Rename(filepath.Join(tempDir, "root", "new"), filepath.Join(tempDir, "root", "moved")))
+	waitEvent(t, events, client.EventRename, "root/moved")
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "root", "moved", "h.txt"), []byte("z"), 0644))
+	waitEvent(t, events, client.EventCreate, "root/moved/h.txt")
+}
+
+func TestLocalClient_Watch_MovedOut(t *testing.T) {
+	tempDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(tempDir, "root", "sub", "deep"), 0755))
+	c := NewLocalClient(&Config{BasePath: tempDir})
+	require.NoError(t, c.Connect(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := c.Watch(ctx, "root", true)
+	require.NoError(t, err)
+
+	require.NoError(t, os.Rename(filepath.Join(tempDir, "root", "sub"), filepath.Join(tempDir, "out")))
+	ev := waitEvent(t, events, client.EventDelete, "root/sub")
+	assert.True(t, ev.IsDir)
+
+	// Changes in the moved-away tree must not surface under old paths.
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "out", "a.txt"), []byte("a"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "out", "deep", "b.txt"), []byte("b"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "root", "marker.txt"), []byte("m"), 0644))
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-events:
+			assert.NotContains(t, ev.Path, "root/sub", "event %s %s", ev.Type, ev.Path)
+			if ev.Path == "root/marker.txt" {
+				return
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for root/marker.txt")
+		}
+	}
+}
+
+// rawEvent encodes an inotify event as read(2) returns it.
+func rawEvent(wd int32, mask, cookie uint32, name string) []byte {
+	n := (len(name) + 1 + 15) &^ 15
+	buf := make([]byte, syscall.SizeofInotifyEvent+n)
+	binary.NativeEndian.PutUint32(buf[0:], uint32(wd))
+	binary.NativeEndian.PutUint32(buf[4:], mask)
+	binary.NativeEndian.PutUint32(buf[8:], cookie)
+	binary.NativeEndian.PutUint32(buf[12:], uint32(n))
+	copy(buf[syscall.SizeofInotifyEvent:], name)
+	return buf
+}
+
+func TestInotifyWatcher_MoveAcrossBatches(t *testing.T) {
+	w := &inotifyWatcher{
+		root:      "root",
+		recursive: true,
+		dirs:      map[int]string{1: "", 2: "a"},
+		events:    make(chan client.Event, 4),
+	}
+	ctx := context.Background()
+	require.True(t, w.handle(ctx, rawEvent(1, syscall.IN_MOVED_FROM|syscall.IN_ISDIR, 7, "a")))
+	assert.Empty(t, w.events, "MOVED_FROM must wait for the next batch")
+	require.True(t, w.handle(ctx, rawEvent(1, syscall.IN_MOVED_TO|syscall.IN_ISDIR, 7, "b")))
+
+	ev := <-w.events
+	assert.Equal(t, client.EventRename, ev.Type)
+	assert.Equal(t, "root/b", ev.Path)
+	assert.Equal(t, "root/a", ev.OldPath)
+	assert.Equal(t, "b", w.dirs[2])
+	assert.Nil(t, w.pending)
+}
+
+func TestLocalClient_Watch_RootRemoved(t *testing.T) {
+	tempDir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(tempDir, "root"), 0755))
+	c := NewLocalClient(&Config{BasePath: tempDir})
+	require.NoError(t, c.Connect(context.Background()))
+
+	events, err := c.Watch(context.Background(), "root", false)
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(filepath.Join(tempDir, "root")))
+	ev := waitEvent(t, events, client.EventDelete, "root")
+	assert.True(t, ev.IsDir)
+
+	select {
+	case _, ok := <-events:
+		for ok {
+			_, ok = <-events
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("channel not closed after root removal")
+	}
+}
+
+func TestLocalClient_Watch_Errors(t *testing.T) {
+	tempDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "file.txt"), []byte("x"), 0644))
+	c := NewLocalClient(&Config{BasePath: tempDir})
+
+	_, err := c.Watch(context.Background(), "/", false)
+	assert.EqualError(t, err, "not connected")
+
+	require.NoError(t, c.Connect(context.Background()))
+	_, err = c.Watch(context.Background(), "missing", false)
+	assert.Error(t, err)
+	_, err = c.Watch(context.Background(), "file.txt", false)
+	assert.Error(t, err)
+}
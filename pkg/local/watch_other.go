@@ -0,0 +1,20 @@
+//go:build !linux
+// +build !linux
+
+package local
+
+import (
+	"context"
+	"fmt"
+
+	"digital.vasic.filesystem/pkg/client"
+	"digital.vasic.filesystem/pkg/watch"
+)
+
+// Watch reports changes below path by polling; inotify is only used on Linux.
+func (c *Client) Watch(ctx context.Context, path string, recursive bool) (<-chan client.Event, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+	return watch.Poll(ctx, c, path, recursive, watch.DefaultPollInterval)
+}
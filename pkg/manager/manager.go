@@ -0,0 +1,365 @@
+// Package manager provides StorageManager, which owns many named
+// filesystem clients, connects them lazily, tracks their health and shuts
+// them down together.
+package manager
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// State is the health state of a managed storage.
+type State string
+
+// Storage states reported by StorageManager.
+const (
+	// StateIdle means the storage has not been used yet and is not connected.
+	StateIdle State = "idle"
+	// StateConnected means the last connect or health check succeeded in time.
+	StateConnected State = "connected"
+	// StateDegraded means the last health check was slow or failed fewer
+	// than FailureThreshold times in a row.
+	StateDegraded State = "degraded"
+	// StateFailed means connecting failed or FailureThreshold consecutive
+	// health checks failed. Health checks keep trying to reconnect.
+	StateFailed State = "failed"
+)
+
+// Status is a snapshot of a managed storage's health.
+type Status struct {
+	ID                  string        `json:"id"`
+	Name                string        `json:"name"`
+	Protocol            string        `json:"protocol"`
+	State               State         `json:"state"`
+	LastError           string        `json:"last_error,omitempty"`
+	LastErrorAt         time.Time     `json:"last_error_at,omitempty"`
+	LastCheck           time.Time     `json:"last_check,omitempty"`
+	Latency             time.Duration `json:"latency"`
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+}
+
+// Options configures a StorageManager. Zero values select the defaults.
+type Options struct {
+	// HealthInterval is the period between health checks in Run (default 30s).
+	HealthInterval time.Duration
+	// HealthTimeout bounds each connect and TestConnection call (default 10s).
+	HealthTimeout time.Duration
+	// DegradedLatency marks a successful check slower than this as degraded
+	// (default 2s).
+	DegradedLatency time.Duration
+	// FailureThreshold is the number of consecutive failed checks after which
+	// a storage is reported as failed (default 3).
+	FailureThreshold int
+}
+
+const (
+	defaultHealthInterval   = 30 * time.Second
+	defaultHealthTimeout    = 10 * time.Second
+	defaultDegradedLatency  = 2 * time.Second
+	defaultFailureThreshold = 3
+)
+
+// StorageManager owns one client per storage configuration.
+// It is safe for concurrent use.
+type StorageManager struct {
+	factory client.Factory
+	opts    Options
+
+	mu      sync.RWMutex
+	order   []string
+	entries map[string]*entry
+}
+
+// entry is a managed storage. mu serializes connect, health check and
+// disconnect of the client and guards status.
+type entry struct {
+	mu     sync.Mutex
+	config *client.StorageConfig
+	client client.Client
+	status Status
+}
+
+// NewStorageManager creates a manager that builds clients through factory.
+func NewStorageManager(factory client.Factory, opts Options) *StorageManager {
+	if opts.HealthInterval <= 0 {
+		opts.HealthInterval = defaultHealthInterval
+	}
+	if opts.HealthTimeout <= 0 {
+		opts.HealthTimeout = defaultHealthTimeout
+	}
+	if opts.DegradedLatency <= 0 {
+		opts.DegradedLatency = defaultDegradedLatency
+	}
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = defaultFailureThreshold
+	}
+	return &StorageManager{
+		factory: factory,
+		opts:    opts,
+		entries: make(map[string]*entry),
+	}
+}
+
+// Add creates the client for config without connecting it.
+func (m *StorageManager) Add(config *client.StorageConfig) error {
+	if config.ID == "" {
+		return fmt.Errorf("storage id is required")
+	}
+	c, err := m.factory.CreateClient(config)
+	if err != nil {
+		return fmt.Errorf("failed to create client for storage %s: %w", config.ID, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.entries[config.ID]; ok {
+		return fmt.Errorf("storage %s already exists", config.ID)
+	}
+	m.entries[config.ID] = &entry{
+		config: config,
+		client: c,
+		status: Status{
+			ID:       config.ID,
+			Name:     config.Name,
+			Protocol: config.Protocol,
+			State:    StateIdle,
+		},
+	}
+	m.order = append(m.order, config.ID)
+	return nil
+}
+
+// Remove disconnects and forgets the storage with the given ID.
+func (m *StorageManager) Remove(ctx context.Context, id string) error {
+	m.mu.Lock()
+	e, ok := m.entries[id]
+	if ok {
+		delete(m.entries, id)
+		for i, existing := range m.order {
+			if existing == id {
+				m.order = append(m.order[:i:i], m.order[i+1:]...)
+				break
+			}
+		}
+	}
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("storage %s not found", id)
+	}
+	return e.disconnect(ctx)
+}
+
+// IDs returns the IDs of all managed storages in the order they were added.
+func (m *StorageManager) IDs() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]string(nil), m.order...)
+}
+
+// Client returns the connected client for the storage with the given ID,
+// connecting it on first use or after it was disconnected.
+func (m *StorageManager) Client(ctx context.Context, id string) (client.Client, error) {
+	e, err := m.entry(id)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.client.IsConnected() {
+		return e.client, nil
+	}
+	if err := m.connect(ctx, e); err != nil {
+		return nil, fmt.Errorf("failed to connect storage %s: %w", id, err)
+	}
+	return e.client, nil
+}
+
+// Status returns the health snapshot of the storage with the given ID.
+func (m *StorageManager) Status(id string) (Status, bool) {
+	e, err := m.entry(id)
+	if err != nil {
+		return Status{}, false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.status, true
+}
+
+// Statuses returns the health snapshots of all storages in the order they
+// were added.
+func (m *StorageManager) Statuses() []Status {
+	m.mu.RLock()
+	entries := make([]*entry, 0, len(m.order))
+	for _, id := range m.order {
+		entries = append(entries, m.entries[id])
+	}
+	m.mu.RUnlock()
+
+	statuses := make([]Status, 0, len(entries))
+	for _, e := range entries {
+		e.mu.Lock()
+		statuses = append(statuses, e.status)
+		e.mu.Unlock()
+	}
+	return statuses
+}
+
+// CheckHealth runs one health check on every storage that has been used.
+// Connected storages are probed with TestConnection; failed storages are
+// reconnected. Idle storages are left alone so that connecting stays lazy.
+func (m *StorageManager) CheckHealth(ctx context.Context) {
+	m.mu.RLock()
+	entries := make([]*entry, 0, len(m.entries))
+	for _, e := range m.entries {
+		entries = append(entries, e)
+	}
+	m.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, e := range entries {
+		wg.Add(1)
+		go func(e *entry) {
+			defer wg.Done()
+			m.check(ctx, e)
+		}(e)
+	}
+	wg.Wait()
+}
+
+// Run calls CheckHealth every HealthInterval until ctx is cancelled.
+func (m *StorageManager) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.opts.HealthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			m.CheckHealth(ctx)
+		}
+	}
+}
+
+// Close disconnects every storage. The storages stay registered and
+// reconnect lazily if used again.
+func (m *StorageManager) Close(ctx context.Context) error {
+	m.mu.RLock()
+	ids := append([]string(nil), m.order...)
+	entries := make([]*entry, 0, len(ids))
+	for _, id := range ids {
+		entries = append(entries, m.entries[id])
+	}
+	m.mu.RUnlock()
+
+	var errs []error
+	for i, e := range entries {
+		if err := e.disconnect(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("storage %s: %w", ids[i], err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("errors closing storages: %v", errs)
+	}
+	return nil
+}
+
+func (m *StorageManager) entry(id string) (*entry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.entries[id]
+	if !ok {
+		return nil, fmt.Errorf("storage %s not found", id)
+	}
+	return e, nil
+}
+
+// connect connects e.client and records the outcome. e.mu must be held.
+func (m *StorageManager) connect(ctx context.Context, e *entry) error {
+	ctx, cancel := context.WithTimeout(ctx, m.opts.HealthTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := e.client.Connect(ctx)
+	latency := time.Since(start)
+	if err != nil {
+		e.recordFailure(err, latency, m.opts.FailureThreshold)
+		e.status.State = StateFailed
+		return err
+	}
+	e.recordSuccess(latency, m.opts.DegradedLatency)
+	return nil
+}
+
+// check runs one health check on e.
+func (m *StorageManager) check(ctx context.Context, e *entry) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch e.status.State {
+	case StateIdle:
+		return
+	case StateFailed:
+		if e.client.IsConnected() {
+			_ = e.client.Disconnect(ctx)
+		}
+		_ = m.connect(ctx, e)
+		return
+	}
+
+	if !e.client.IsConnected() {
+		_ = m.connect(ctx, e)
+		return
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, m.opts.HealthTimeout)
+	defer cancel()
+	start := time.Now()
+	err := e.client.TestConnection(checkCtx)
+	latency := time.Since(start)
+	if err != nil {
+		e.recordFailure(err, latency, m.opts.FailureThreshold)
+		return
+	}
+	e.recordSuccess(latency, m.opts.DegradedLatency)
+}
+
+// disconnect disconnects e.client and marks the storage idle.
+func (e *entry) disconnect(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.status.State = StateIdle
+	if !e.client.IsConnected() {
+		return nil
+	}
+	return e.client.Disconnect(ctx)
+}
+
+func (e *entry) recordSuccess(latency, degradedLatency time.Duration) {
+	e.status.LastCheck = time.Now()
+	e.status.Latency = latency
+	e.status.ConsecutiveFailures = 0
+	if latency > degradedLatency {
+		e.status.State = StateDegraded
+	} else {
+		e.status.State = StateConnected
+	}
+}
+
+func (e *entry) recordFailure(err error, latency time.Duration, threshold int) {
+	now := time.Now()
+	e.status.LastCheck = now
+	e.status.Latency = latency
+	e.status.LastError = err.Error()
+	e.status.LastErrorAt = now
+	e.status.ConsecutiveFailures++
+	if e.status.ConsecutiveFailures >= threshold {
+		e.status.State = StateFailed
+	} else {
+		e.status.State = StateDegraded
+	}
+}
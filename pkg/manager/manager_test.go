@@ -0,0 +1,296 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"digital.vasic.filesystem/pkg/client"
+	"digital.vasic.filesystem/pkg/factory"
+)
+
+// fakeClient is a client.Client whose connection behaviour is scripted.
+type fakeClient struct {
+	mu         sync.Mutex
+	connected  bool
+	connectErr error
+	testErr    error
+	testDelay  time.Duration
+	connects   int
+}
+
+func (f *fakeClient) Connect(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.connects++
+	if f.connectErr != nil {
+		return f.connectErr
+	}
+	f.connected = true
+	return nil
+}
+
+func (f *fakeClient) Disconnect(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.connected = false
+	return nil
+}
+
+func (f *fakeClient) IsConnected() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.connected
+}
+
+func (f *fakeClient) TestConnection(ctx context.Context) error {
+	f.mu.Lock()
+	delay, err := f.testDelay, f.testErr
+	f.mu.Unlock()
+	time.Sleep(delay)
+	return err
+}
+
+func (f *fakeClient) set(fn func(f *fakeClient)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn(f)
+}
+
+func (f *fakeClient) ReadFile(ctx context.Context, path string) (io.ReadCloser, error) {
+	return nil, errors.New("not implemented")
+}
+func (f *fakeClient) WriteFile(ctx context.Context, path string, data io.Reader) error {
+	return errors.New("not implemented")
+}
+func (f *fakeClient) GetFileInfo(ctx context.Context, path string) (*client.FileInfo, error) {
+	return nil, errors.New("not implemented")
+}
+func (f *fakeClient) FileExists(ctx context.Context, path string) (bool, error) {
+	return false, errors.New("not implemented")
+}
+func (f *fakeClient) DeleteFile(ctx context.Context, path string) error {
+	return errors.New("not implemented")
+}
+func (f *fakeClient) CopyFile(ctx context.Context, srcPath, dstPath string) error {
+	return errors.New("not implemented")
+}
+func (f *fakeClient) ListDirectory(ctx context.Context, path string) ([]*client.FileInfo, error) {
+	return nil, errors.New("not implemented")
+}
+func (f *fakeClient) CreateDirectory(ctx context.Context, path string) error {
+	return errors.New("not implemented")
+}
+func (f *fakeClient) DeleteDirectory(ctx context.Context, path string) error {
+	return errors.New("not implemented")
+}
+func (f *fakeClient) GetProtocol() string    { return "fake" }
+func (f *fakeClient) GetConfig() interface{} { return nil }
+
+// fakeFactory hands out fakeClients by storage ID.
+type fakeFactory struct {
+	clients map[string]*fakeClient
+}
+
+func (f *fakeFactory) CreateClient(config *client.StorageConfig) (client.Client, error) {
+	c, ok := f.clients[config.ID]
+	if !ok {
+		return nil, fmt.Errorf("unsupported protocol: %s", config.Protocol)
+	}
+	return c, nil
+}
+
+func (f *fakeFactory) SupportedProtocols() []string { return []string{"fake"} }
+
+func newFakeManager(opts Options, ids ...string) (*StorageManager, map[string]*fakeClient) {
+	clients := make(map[string]*fakeClient)
+	for _, id := range ids {
+		clients[id] = &fakeClient{}
+	}
+	m := NewStorageManager(&fakeFactory{clients: clients}, opts)
+	for _, id := range ids {
+		if err := m.Add(&client.StorageConfig{ID: id, Name: "Storage " + id, Protocol: "fake"}); err != nil {
+			panic(err)
+		}
+	}
+	return m, clients
+}
+
+func TestNewStorageManager_Defaults(t *testing.T) {
+	m := NewStorageManager(factory.NewDefaultFactory(), Options{})
+	assert.Equal(t, defaultHealthInterval, m.opts.HealthInterval)
+	assert.Equal(t, defaultHealthTimeout, m.opts.HealthTimeout)
+	assert.Equal(t, defaultDegradedLatency, m.opts.DegradedLatency)
+	assert.Equal(t, defaultFailureThreshold, m.opts.FailureThreshold)
+}
+
+func TestStorageManager_Add(t *testing.T) {
+	m := NewStorageManager(factory.NewDefaultFactory(), Options{})
+
+	err := m.Add(&client.StorageConfig{ID: "a", Protocol: "local", Settings: map[string]interface{}{"base_path": t.TempDir()}})
+	require.NoError(t, err)
+
+	err = m.Add(&client.StorageConfig{ID: "a", Protocol: "local"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "already exists")
+
+	err = m.Add(&client.StorageConfig{Protocol: "local"})
+	assert.Error(t, err)
+
+	err = m.Add(&client.StorageConfig{ID: "b", Protocol: "gopher"})
+	assert.Error(t, err)
+
+	assert.Equal(t, []string{"a"}, m.IDs())
+	status, ok := m.Status("a")
+	require.True(t, ok)
+	assert.Equal(t, StateIdle, status.State)
+}
+
+func TestStorageManager_Client_LazyConnect(t *testing.T) {
+	ctx := context.Background()
+	m := NewStorageManager(factory.NewDefaultFactory(), Options{})
+	require.NoError(t, m.Add(&client.StorageConfig{
+		ID: "media", Protocol: "local",
+		Settings: map[string]interface{}{"base_path": t.TempDir()},
+	}))
+
+	c, err := m.Client(ctx, "media")
+	require.NoError(t, err)
+	assert.True(t, c.IsConnected())
+
+	again, err := m.Client(ctx, "media")
+	require.NoError(t, err)
+	assert.Same(t, c, again)
+
+	status, _ := m.Status("media")
+	assert.Equal(t, StateConnected, status.State)
+	assert.Equal(t, "local", status.Protocol)
+
+	_, err = m.Client(ctx, "missing")
+	assert.Error(t, err)
+
+	require.NoError(t, m.Close(ctx))
+	assert.False(t, c.IsConnected())
+}
+
+func TestStorageManager_Client_ConnectFailure(t *testing.T) {
+	m, clients := newFakeManager(Options{}, "nas")
+	clients["nas"].connectErr = errors.New("connection refused")
+
+	_, err := m.Client(context.Background(), "nas")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "connection refused")
+
+	status, _ := m.Status("nas")
+	assert.Equal(t, StateFailed, status.State)
+	assert.Equal(t, "connection refused", status.LastError)
+	assert.False(t, status.LastErrorAt.IsZero())
+}
+
+func TestStorageManager_CheckHealth_States(t *testing.T) {
+	ctx := context.Background()
+	m, clients := newFakeManager(Options{FailureThreshold: 2, DegradedLatency: 20 * time.Millisecond}, "a", "idle")
+	fc := clients["a"]
+
+	_, err := m.Client(ctx, "a")
+	require.NoError(t, err)
+
+	m.CheckHealth(ctx)
+	status, _ := m.Status("a")
+	assert.Equal(t, StateConnected, status.State)
+	assert.False(t, status.LastCheck.IsZero())
+
+	fc.set(func(f *fakeClient) { f.testDelay = 40 * time.Millisecond })
+	m.CheckHealth(ctx)
+	status, _ = m.Status("a")
+	assert.Equal(t, StateDegraded, status.State, "slow check is degraded")
+	assert.GreaterOrEqual(t, status.Latency, 40*time.Millisecond)
+
+	fc.set(func(f *fakeClient) { f.testDelay = 0; f.testErr = errors.New("timeout") })
+	m.CheckHealth(ctx)
+	status, _ = m.Status("a")
+	assert.Equal(t, StateDegraded, status.State, "first failure is degraded")
+	assert.Equal(t, 1, status.ConsecutiveFailures)
+
+	m.CheckHealth(ctx)
+	status, _ = m.Status("a")
+	assert.Equal(t, StateFailed, status.State)
+	assert.Equal(t, "timeout", status.LastError)
+
+	fc.set(func(f *fakeClient) { f.testErr = nil })
+	m.CheckHealth(ctx)
+	status, _ = m.Status("a")
+	assert.Equal(t, StateConnected, status.State, "failed storage reconnects")
+	assert.Equal(t, 0, status.ConsecutiveFailures)
+	assert.Equal(t, 2, fc.connects)
+
+	idle, _ := m.Status("idle")
+	assert.Equal(t, StateIdle, idle.State)
+	assert.Equal(t, 0, clients["idle"].connects, "idle storages are not connected by health checks")
+}
+
+func TestStorageManager_Run(t *testing.T) {
+	m, clients := newFakeManager(Options{HealthInterval: 5 * time.Millisecond}, "a")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err := m.Client(ctx, "a")
+	require.NoError(t, err)
+	clients["a"].set(func(f *fakeClient) { f.testErr = errors.New("gone") })
+
+	done := make(chan error, 1)
+	go func() { done <- m.Run(ctx) }()
+
+	require.Eventually(t, func() bool {
+		s, _ := m.Status("a")
+		return s.State == StateFailed
+	}, 2*time.Second, 5*time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestStorageManager_Remove(t *testing.T) {
+	ctx := context.Background()
+	m, clients := newFakeManager(Options{}, "a", "b", "c")
+	_, err := m.Client(ctx, "b")
+	require.NoError(t, err)
+
+	require.NoError(t, m.Remove(ctx, "b"))
+	assert.False(t, clients["b"].IsConnected())
+	assert.Equal(t, []string{"a", "c"}, m.IDs())
+	_, ok := m.Status("b")
+	assert.False(t, ok)
+
+	assert.Error(t, m.Remove(ctx, "b"))
+}
+
+func TestStorageManager_Statuses(t *testing.T) {
+	m, _ := newFakeManager(Options{}, "b", "a")
+	statuses := m.Statuses()
+	require.Len(t, statuses, 2)
+	assert.Equal(t, "b", statuses[0].ID)
+	assert.Equal(t, "Storage a", statuses[1].Name)
+}
+
+func TestStorageManager_Close_Reconnects(t *testing.T) {
+	ctx := context.Background()
+	m, clients := newFakeManager(Options{}, "a")
+	_, err := m.Client(ctx, "a")
+	require.NoError(t, err)
+
+	require.NoError(t, m.Close(ctx))
+	status, _ := m.Status("a")
+	assert.Equal(t, StateIdle, status.State)
+	assert.False(t, clients["a"].IsConnected())
+
+	_, err = m.Client(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, 2, clients["a"].connects)
+}
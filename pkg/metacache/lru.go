@@ -0,0 +1,93 @@
+package metacache
+
+import (
+	"container/list"
+	"time"
+)
+
+// lru is a size-bounded cache whose entries also expire after a TTL.
+// It is not safe for concurrent use; Client serializes access.
+type lru[V any] struct {
+	maxEntries int
+	ttl        time.Duration
+	ll         *list.List
+	items      map[string]*list.Element
+	evictions  uint64
+}
+
+type lruEntry[V any] struct {
+	key     string
+	value   V
+	expires time.Time
+}
+
+func newLRU[V any](maxEntries int, ttl time.Duration) *lru[V] {
+	return &lru[V]{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// get returns the value for key if present and not expired.
+func (c *lru[V]) get(key string, now time.Time) (V, bool) {
+	var zero V
+	el, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+	entry := el.Value.(*lruEntry[V])
+	if now.After(entry.expires) {
+		c.removeElement(el)
+		return zero, false
+	}
+	c.ll.MoveToFront(el)
+	return entry.value, true
+}
+
+// put stores value for key, evicting the least recently used entry if the
+// cache is full.
+func (c *lru[V]) put(key string, value V, now time.Time) {
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*lruEntry[V])
+		entry.value = value
+		entry.expires = now.Add(c.ttl)
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry[V]{key: key, value: value, expires: now.Add(c.ttl)})
+	for c.maxEntries > 0 && c.ll.Len() > c.maxEntries {
+		c.removeElement(c.ll.Back())
+		c.evictions++
+	}
+}
+
+func (c *lru[V]) remove(key string) {
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+// removeFunc removes every entry whose key satisfies match.
+func (c *lru[V]) removeFunc(match func(key string) bool) {
+	for key, el := range c.items {
+		if match(key) {
+			c.removeElement(el)
+		}
+	}
+}
+
+func (c *lru[V]) clear() {
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+func (c *lru[V]) len() int {
+	return c.ll.Len()
+}
+
+func (c *lru[V]) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*lruEntry[V]).key)
+}
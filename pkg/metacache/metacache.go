@@ -0,0 +1,328 @@
+// Package metacache provides a client.Client decorator that caches
+// directory listings and file metadata, so that repeated browsing over
+// slow protocols (WebDAV PROPFIND, FTP LIST) does not hit the server for
+// every call.
+package metacache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// Options configures the cache. Zero values select the defaults.
+type Options struct {
+	// TTL is how long an entry stays valid (default 30s).
+	TTL time.Duration
+	// MaxEntries bounds each of the listing, info and existence caches
+	// (default 10000). The least recently used entry is evicted first.
+	MaxEntries int
+}
+
+const (
+	defaultTTL        = 30 * time.Second
+	defaultMaxEntries = 10000
+)
+
+// Stats reports cache effectiveness.
+type Stats struct {
+	ListHits     uint64
+	ListMisses   uint64
+	InfoHits     uint64
+	InfoMisses   uint64
+	ExistsHits   uint64
+	ExistsMisses uint64
+	Evictions    uint64
+	Entries      int
+}
+
+// Hits returns the total number of cache hits.
+func (s Stats) Hits() uint64 {
+	return s.ListHits + s.InfoHits + s.ExistsHits
+}
+
+// Misses returns the total number of cache misses.
+func (s Stats) Misses() uint64 {
+	return s.ListMisses + s.InfoMisses + s.ExistsMisses
+}
+
+// Client wraps a client.Client and caches ListDirectory, GetFileInfo and
+// FileExists results. Mutating calls made through the Client invalidate the
+// affected entries; changes made by other clients become visible after TTL.
+type Client struct {
+	client.Client
+
+	mu     sync.Mutex
+	now    func() time.Time
+	lists  *lru[[]*client.FileInfo]
+	infos  *lru[*client.FileInfo]
+	exists *lru[bool]
+	stats  Stats
+	// gen is bumped on every invalidation so that results fetched while a
+	// mutation was in flight are not cached.
+	gen uint64
+}
+
+// New wraps c with a metadata cache.
+func New(c client.Client, opts Options) *Client {
+	if opts.TTL <= 0 {
+		opts.TTL = defaultTTL
+	}
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = defaultMaxEntries
+	}
+	return &Client{
+		Client: c,
+		now:    time.Now,
+		lists:  newLRU[[]*client.FileInfo](opts.MaxEntries, opts.TTL),
+		infos:  newLRU[*client.FileInfo](opts.MaxEntries, opts.TTL),
+		exists: newLRU[bool](opts.MaxEntries, opts.TTL),
+	}
+}
+
+// Unwrap returns the wrapped client.
+func (c *Client) Unwrap() client.Client {
+	return c.Client
+}
+
+// Stats returns a snapshot of the cache statistics.
+func (c *Client) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Evictions = c.lists.evictions + c.infos.evictions + c.exists.evictions
+	stats.Entries = c.lists.len() + c.infos.len() + c.exists.len()
+	return stats
+}
+
+// Purge drops every cached entry.
+func (c *Client) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.lists.clear()
+	c.infos.clear()
+	c.exists.clear()
+}
+
+// Invalidate drops the cached entries for p, everything below it, and the
+// listings of its ancestors.
+func (c *Client) Invalidate(p string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidateTree(cacheKey(p))
+}
+
+// Disconnect purges the cache and disconnects the wrapped client.
+func (c *Client) Disconnect(ctx context.Context) error {
+	c.Purge()
+	return c.Client.Disconnect(ctx)
+}
+
+// ListDirectory returns the cached listing of path or lists it through the
+// wrapped client. A fresh listing also fills the info cache for its entries.
+func (c *Client) ListDirectory(ctx context.Context, path string) ([]*client.FileInfo, error) {
+	key := cacheKey(path)
+	c.mu.Lock()
+	if files, ok := c.lists.get(key, c.now()); ok {
+		c.stats.ListHits++
+		c.mu.Unlock()
+		return copyInfos(files), nil
+	}
+	c.stats.ListMisses++
+	gen := c.gen
+	c.mu.Unlock()
+
+	files, err := c.Client.ListDirectory(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return files, nil
+	}
+	now := c.now()
+	c.lists.put(key, copyInfos(files), now)
+	for _, f := range files {
+		childKey := joinKey(key, f.Name)
+		info := *f
+		c.infos.put(childKey, &info, now)
+		c.exists.put(childKey, true, now)
+	}
+	return files, nil
+}
+
+// GetFileInfo returns the cached info for path or fetches it through the
+// wrapped client.
+func (c *Client) GetFileInfo(ctx context.Context, path string) (*client.FileInfo, error) {
+	key := cacheKey(path)
+	c.mu.Lock()
+	if info, ok := c.infos.get(key, c.now()); ok {
+		c.stats.InfoHits++
+		c.mu.Unlock()
+		result := *info
+		return &result, nil
+	}
+	c.stats.InfoMisses++
+	gen := c.gen
+	c.mu.Unlock()
+
+	info, err := c.Client.GetFileInfo(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen == c.gen {
+		now := c.now()
+		cached := *info
+		c.infos.put(key, &cached, now)
+		c.exists.put(key, true, now)
+	}
+	return info, nil
+}
+
+// FileExists answers from the existence or info cache, or asks the wrapped
+// client. Negative answers are cached as well.
+func (c *Client) FileExists(ctx context.Context, path string) (bool, error) {
+	key := cacheKey(path)
+	c.mu.Lock()
+	now := c.now()
+	if exists, ok := c.exists.get(key, now); ok {
+		c.stats.ExistsHits++
+		c.mu.Unlock()
+		return exists, nil
+	}
+	if _, ok := c.infos.get(key, now); ok {
+		c.stats.ExistsHits++
+		c.mu.Unlock()
+		return true, nil
+	}
+	c.stats.ExistsMisses++
+	gen := c.gen
+	c.mu.Unlock()
+
+	exists, err := c.Client.FileExists(ctx, path)
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen == c.gen {
+		c.exists.put(key, exists, c.now())
+	}
+	return exists, nil
+}
+
+// WriteFile writes through the wrapped client and invalidates path.
+func (c *Client) WriteFile(ctx context.Context, path string, data io.Reader) error {
+	defer c.invalidate(path)
+	return c.Client.WriteFile(ctx, path, data)
+}
+
+// DeleteFile deletes through the wrapped client and invalidates path.
+func (c *Client) DeleteFile(ctx context.Context, path string) error {
+	defer c.invalidate(path)
+	return c.Client.DeleteFile(ctx, path)
+}
+
+// CopyFile copies through the wrapped client and invalidates dstPath.
+func (c *Client) CopyFile(ctx context.Context, srcPath, dstPath string) error {
+	defer c.invalidate(dstPath)
+	return c.Client.CopyFile(ctx, srcPath, dstPath)
+}
+
+// CreateDirectory creates through the wrapped client and invalidates path.
+func (c *Client) CreateDirectory(ctx context.Context, path string) error {
+	defer c.invalidate(path)
+	return c.Client.CreateDirectory(ctx, path)
+}
+
+// DeleteDirectory deletes through the wrapped client and invalidates path
+// and everything below it.
+func (c *Client) DeleteDirectory(ctx context.Context, path string) error {
+	defer c.Invalidate(path)
+	return c.Client.DeleteDirectory(ctx, path)
+}
+
+// OpenSeekable forwards to the wrapped client if it is a client.SeekableClient.
+func (c *Client) OpenSeekable(ctx context.Context, path string) (client.ReadSeekCloser, error) {
+	sc, ok := c.Client.(client.SeekableClient)
+	if !ok {
+		return nil, fmt.Errorf("open seekable %s: %w", path, client.ErrNotSupported)
+	}
+	return sc.OpenSeekable(ctx, path)
+}
+
+// invalidate drops the entries for p and the listings and infos of its
+// ancestors, whose contents and modification times change with p.
+func (c *Client) invalidate(p string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	key := cacheKey(p)
+	c.lists.remove(key)
+	c.infos.remove(key)
+	c.exists.remove(key)
+	c.invalidateAncestors(key)
+}
+
+// invalidateTree drops key, all keys below it and the ancestors' entries.
+// c.mu must be held.
+func (c *Client) invalidateTree(key string) {
+	c.gen++
+	prefix := key + "/"
+	if key == "/" {
+		prefix = "/"
+	}
+	match := func(k string) bool {
+		return k == key || strings.HasPrefix(k, prefix)
+	}
+	c.lists.removeFunc(match)
+	c.infos.removeFunc(match)
+	c.exists.removeFunc(match)
+	c.invalidateAncestors(key)
+}
+
+// invalidateAncestors drops the listings and infos of every ancestor of key.
+// Ancestors may have been created implicitly, so their negative existence
+// entries are dropped too. c.mu must be held.
+func (c *Client) invalidateAncestors(key string) {
+	for key != "/" {
+		key = path.Dir(key)
+		c.lists.remove(key)
+		c.infos.remove(key)
+		c.exists.remove(key)
+	}
+}
+
+// cacheKey normalizes p so that "a/b", "/a/b" and "a//b/" share an entry.
+func cacheKey(p string) string {
+	return path.Clean("/" + strings.ReplaceAll(p, "\\", "/"))
+}
+
+func joinKey(dir, name string) string {
+	return path.Join(dir, name)
+}
+
+func copyInfos(files []*client.FileInfo) []*client.FileInfo {
+	if files == nil {
+		return nil
+	}
+	copied := make([]*client.FileInfo, len(files))
+	for i, f := range files {
+		info := *f
+		copied[i] = &info
+	}
+	return copied
+}
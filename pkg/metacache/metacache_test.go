@@ -0,0 +1,280 @@
+package metacache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"digital.vasic.filesystem/pkg/client"
+	"digital.vasic.filesystem/pkg/local"
+)
+
+// Verify Client implements the interfaces it decorates.
+var (
+	_ client.Client         = (*Client)(nil)
+	_ client.SeekableClient = (*Client)(nil)
+)
+
+// countingClient counts the metadata calls that reach the backend.
+type countingClient struct {
+	client.Client
+	lists, infos, exists int
+}
+
+func (c *countingClient) ListDirectory(ctx context.Context, path string) ([]*client.FileInfo, error) {
+	c.lists++
+	return c.Client.ListDirectory(ctx, path)
+}
+
+func (c *countingClient) GetFileInfo(ctx context.Context, path string) (*client.FileInfo, error) {
+	c.infos++
+	return c.Client.GetFileInfo(ctx, path)
+}
+
+func (c *countingClient) FileExists(ctx context.Context, path string) (bool, error) {
+	c.exists++
+	return c.Client.FileExists(ctx, path)
+}
+
+func newCachedLocal(t *testing.T, opts Options) (*Client, *countingClient) {
+	t.Helper()
+	lc := local.NewLocalClient(&local.Config{BasePath: t.TempDir()})
+	require.NoError(t, lc.Connect(context.Background()))
+	counting := &countingClient{Client: lc}
+	return New(counting, opts), counting
+}
+
+func write(t *testing.T, c client.Client, path, content string) {
+	t.Helper()
+	require.NoError(t, c.WriteFile(context.Background(), path, bytes.NewReader([]byte(content))))
+}
+
+func TestNew_Defaults(t *testing.T) {
+	c := New(&countingClient{}, Options{})
+	assert.Equal(t, defaultTTL, c.lists.ttl)
+	assert.Equal(t, defaultMaxEntries, c.infos.maxEntries)
+}
+
+func TestClient_ListDirectory_Cached(t *testing.T) {
+	ctx := context.Background()
+	c, backend := newCachedLocal(t, Options{})
+	write(t, c, "movies/a.mkv", "aaaa")
+	write(t, c, "movies/b.mkv", "bb")
+
+	first, err := c.ListDirectory(ctx, "movies")
+	require.NoError(t, err)
+	require.Len(t, first, 2)
+
+	second, err := c.ListDirectory(ctx, "/movies/")
+	require.NoError(t, err)
+	assert.Len(t, second, 2)
+	assert.Equal(t, 1, backend.lists, "second listing is served from cache")
+
+	second[0].Name = "mutated"
+	third, err := c.ListDirectory(ctx, "movies")
+	require.NoError(t, err)
+	assert.NotEqual(t, "mutated", third[0].Name, "callers get copies")
+
+	stats := c.Stats()
+	assert.Equal(t, uint64(2), stats.ListHits)
+	assert.Equal(t, uint64(1), stats.ListMisses)
+}
+
+func TestClient_ListDirectory_FillsInfoCache(t *testing.T) {
+	ctx := context.Background()
+	c, backend := newCachedLocal(t, Options{})
+	write(t, c, "movies/a.mkv", "aaaa")
+
+	_, err := c.ListDirectory(ctx, "movies")
+	require.NoError(t, err)
+
+	info, err := c.GetFileInfo(ctx, "movies/a.mkv")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), info.Size)
+
+	exists, err := c.FileExists(ctx, "movies/a.mkv")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	assert.Equal(t, 0, backend.infos)
+	assert.Equal(t, 0, backend.exists)
+}
+
+func TestClient_FileExists_CachesNegative(t *testing.T) {
+	ctx := context.Background()
+	c, backend := newCachedLocal(t, Options{})
+
+	for i := 0; i < 3; i++ {
+		exists, err := c.FileExists(ctx, "missing.txt")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	}
+	assert.Equal(t, 1, backend.exists)
+
+	write(t, c, "missing.txt", "now here")
+	exists, err := c.FileExists(ctx, "missing.txt")
+	require.NoError(t, err)
+	assert.True(t, exists, "write invalidates the negative entry")
+}
+
+func TestClient_TTLExpiry(t *testing.T) {
+	ctx := context.Background()
+	c, backend := newCachedLocal(t, Options{TTL: time.Minute})
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	write(t, c, "a.txt", "a")
+
+	_, err := c.GetFileInfo(ctx, "a.txt")
+	require.NoError(t, err)
+	_, err = c.GetFileInfo(ctx, "a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, 1, backend.infos)
+
+	now = now.Add(2 * time.Minute)
+	_, err = c.GetFileInfo(ctx, "a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, 2, backend.infos)
+}
+
+func TestClient_MaxEntriesEvicts(t *testing.T) {
+	ctx := context.Background()
+	c, backend := newCachedLocal(t, Options{MaxEntries: 2})
+	for _, name := range []string{"a", "b", "c"} {
+		write(t, c, name, name)
+		_, err := c.GetFileInfo(ctx, name)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 3, backend.infos)
+
+	_, err := c.GetFileInfo(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, 4, backend.infos, "oldest entry was evicted")
+	assert.NotZero(t, c.Stats().Evictions)
+}
+
+func TestClient_Invalidation(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		mutate func(c *Client) error
+		check  string
+	}{
+		{"WriteFile", func(c *Client) error {
+			return c.WriteFile(ctx, "dir/new.txt", bytes.NewReader([]byte("n")))
+		}, "dir"},
+		{"DeleteFile", func(c *Client) error { return c.DeleteFile(ctx, "dir/a.txt") }, "dir"},
+		{"CopyFile", func(c *Client) error { return c.CopyFile(ctx, "dir/a.txt", "dir/copy.txt") }, "dir"},
+		{"CreateDirectory", func(c *Client) error { return c.CreateDirectory(ctx, "dir/sub/deeper") }, "dir"},
+		{"DeleteDirectory", func(c *Client) error { return c.DeleteDirectory(ctx, "dir") }, "/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, backend := newCachedLocal(t, Options{})
+			write(t, c, "dir/a.txt", "a")
+
+			_, err := c.ListDirectory(ctx, tt.check)
+			require.NoError(t, err)
+			_, err = c.ListDirectory(ctx, tt.check)
+			require.NoError(t, err)
+			require.Equal(t, 1, backend.lists)
+
+			require.NoError(t, tt.mutate(c))
+
+			_, err = c.ListDirectory(ctx, tt.check)
+			require.NoError(t, err)
+			assert.Equal(t, 2, backend.lists, "listing of %s must be refetched", tt.check)
+		})
+	}
+}
+
+func TestClient_DeleteDirectory_InvalidatesSubtree(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newCachedLocal(t, Options{})
+	write(t, c, "dir/sub/a.txt", "a")
+
+	_, err := c.GetFileInfo(ctx, "dir/sub/a.txt")
+	require.NoError(t, err)
+	require.NoError(t, c.DeleteDirectory(ctx, "dir"))
+
+	_, err = c.GetFileInfo(ctx, "dir/sub/a.txt")
+	assert.Error(t, err)
+}
+
+func TestClient_InvalidateAndPurge(t *testing.T) {
+	ctx := context.Background()
+	c, backend := newCachedLocal(t, Options{})
+	write(t, c, "a.txt", "a")
+
+	_, err := c.GetFileInfo(ctx, "a.txt")
+	require.NoError(t, err)
+	c.Invalidate("a.txt")
+	_, err = c.GetFileInfo(ctx, "a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, 2, backend.infos)
+
+	c.Purge()
+	assert.Equal(t, 0, c.Stats().Entries)
+}
+
+func TestClient_ErrorsNotCached(t *testing.T) {
+	ctx := context.Background()
+	c, backend := newCachedLocal(t, Options{})
+	for i := 0; i < 2; i++ {
+		_, err := c.GetFileInfo(ctx, "missing")
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 2, backend.infos)
+}
+
+func TestClient_OpenSeekable(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newCachedLocal(t, Options{})
+	write(t, c, "video.bin", "0123456789")
+
+	// countingClient hides local's OpenSeekable, so unwrap one level.
+	seekable := New(c.Unwrap().(*countingClient).Client, Options{})
+	r, err := seekable.OpenSeekable(ctx, "video.bin")
+	require.NoError(t, err)
+	defer r.Close()
+	_, err = r.Seek(5, io.SeekStart)
+	require.NoError(t, err)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "56789", string(data))
+
+	_, err = c.OpenSeekable(ctx, "video.bin")
+	assert.True(t, errors.Is(err, client.ErrNotSupported))
+}
+
+func TestClient_Disconnect_Purges(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newCachedLocal(t, Options{})
+	write(t, c, "a.txt", "a")
+	_, err := c.GetFileInfo(ctx, "a.txt")
+	require.NoError(t, err)
+
+	require.NoError(t, c.Disconnect(ctx))
+	assert.Equal(t, 0, c.Stats().Entries)
+	assert.False(t, c.IsConnected())
+}
+
+func TestCacheKey(t *testing.T) {
+	for input, expected := range map[string]string{
+		"":        "/",
+		".":       "/",
+		"a/b":     "/a/b",
+		"/a/b/":   "/a/b",
+		"a//b":    "/a/b",
+		`a\b`:     "/a/b",
+		"a/../b":  "/b",
+		"../../x": "/x",
+	} {
+		assert.Equal(t, expected, cacheKey(input), input)
+	}
+}
@@ -0,0 +1,44 @@
+package mirror
+
+import (
+	"fmt"
+
+	"github.com/bmatcuk/doublestar/v4"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// Filter selects paths with include and exclude globs. Patterns use
+// doublestar syntax ("**" spans directories) and are matched against paths
+// relative to the sync root, without a leading slash. A pattern without a
+// "/" also matches the base name at any depth, so "*.tmp" excludes temporary
+// files everywhere.
+type Filter struct {
+	Include []string
+	Exclude []string
+}
+
+// Validate reports the first malformed pattern.
+func (f Filter) Validate() error {
+	for _, p := range append(append([]string{}, f.Include...), f.Exclude...) {
+		if !doublestar.ValidatePattern(p) {
+			return fmt.Errorf("invalid glob pattern %q", p)
+		}
+	}
+	return nil
+}
+
+// Excluded reports whether rel matches an exclude pattern. Excluded
+// directories are not descended into.
+func (f Filter) Excluded(rel string) bool {
+	return client.MatchPath(f.Exclude, rel)
+}
+
+// Match reports whether the file rel is selected: it must not be excluded
+// and, when include patterns are set, must match one of them.
+func (f Filter) Match(rel string) bool {
+	if f.Excluded(rel) {
+		return false
+	}
+	return len(f.Include) == 0 || client.MatchPath(f.Include, rel)
+}
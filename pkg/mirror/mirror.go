@@ -0,0 +1,400 @@
+// Package mirror implements one-way synchronisation: it makes a destination
+// tree on one client.Client match a source tree on another, copying new and
+// changed files and optionally deleting files that no longer exist in the
+// source.
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"digital.vasic.filesystem/pkg/checksum"
+	"digital.vasic.filesystem/pkg/client"
+	"digital.vasic.filesystem/pkg/transfer"
+)
+
+// CompareMode selects how changed files are detected.
+type CompareMode string
+
+const (
+	// CompareSizeModTime treats a file as changed when the sizes differ or
+	// the source is newer than the destination.
+	CompareSizeModTime CompareMode = "size_mtime"
+	// CompareChecksum treats a file as changed when the sizes or the content
+	// digests differ. Server-side digests are used where available (see
+	// checksum.Compare); otherwise the files are read in full.
+	CompareChecksum CompareMode = "checksum"
+)
+
+// DefaultModTimeWindow absorbs the coarse timestamps of FTP and FAT-backed
+// SMB shares when comparing by modification time.
+const DefaultModTimeWindow = 2 * time.Second
+
+// Options configures a mirror run.
+type Options struct {
+	// Compare defaults to CompareSizeModTime.
+	Compare CompareMode
+	// ModTimeWindow is the tolerance for CompareSizeModTime. Zero uses
+	// DefaultModTimeWindow; a negative value compares exactly.
+	ModTimeWindow time.Duration
+	// Delete removes destination entries missing from the source. Excluded
+	// destination entries are never deleted.
+	Delete bool
+	// Filter selects the paths taking part in the mirror.
+	Filter Filter
+	// DryRun computes the plan without changing the destination.
+	DryRun bool
+	// PreserveAttributes copies permissions and modification times to the
+	// destination (see transfer.Preserve), so unchanged files compare equal
+	// by size and time on the next run.
+	PreserveAttributes bool
+}
+
+// ActionType is the kind of change a plan makes to the destination.
+type ActionType string
+
+const (
+	ActionMkdir  ActionType = "mkdir"
+	ActionCopy   ActionType = "copy"
+	ActionUpdate ActionType = "update"
+	ActionDelete ActionType = "delete"
+)
+
+// Action is a single planned change. Path is relative to the roots; an
+// empty Path refers to the destination root itself.
+type Action struct {
+	Type   ActionType `json:"type"`
+	Path   string     `json:"path"`
+	IsDir  bool       `json:"is_dir,omitempty"`
+	Size   int64      `json:"size"`
+	Reason string     `json:"reason,omitempty"`
+}
+
+// String formats the action as a line of plan output.
+func (a Action) String() string {
+	p := a.Path
+	if p == "" {
+		p = "."
+	}
+	s := fmt.Sprintf("%-6s %s", a.Type, p)
+	if a.Type == ActionCopy || a.Type == ActionUpdate {
+		s += fmt.Sprintf(" (%d bytes)", a.Size)
+	}
+	if a.Reason != "" {
+		s += " [" + a.Reason + "]"
+	}
+	return s
+}
+
+// Plan lists the actions that bring the destination up to date, in
+// execution order: deletions (deepest first), directory creation (parents
+// first), then copies.
+type Plan struct {
+	Actions []Action `json:"actions"`
+	// Unchanged counts source files already up to date.
+	Unchanged int `json:"unchanged"`
+	// Conflicts lists paths that are a file on one side and a directory on
+	// the other. They are only replaced when Options.Delete is set.
+	Conflicts []string `json:"conflicts,omitempty"`
+}
+
+// SpaceNeeded estimates the bytes the plan adds to the destination: the
+// size of every copy and update, less the files it deletes. Replaced
+// contents are not subtracted, so updates are counted in full.
+func (p *Plan) SpaceNeeded() int64 {
+	var n int64
+	for _, a := range p.Actions {
+		switch a.Type {
+		case ActionCopy, ActionUpdate:
+			n += a.Size
+		case ActionDelete:
+			if !a.IsDir {
+				n -= a.Size
+			}
+		}
+	}
+	return n
+}
+
+// WriteTo writes the plan as human-readable text, one action per line.
+func (p *Plan) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	for _, a := range p.Actions {
+		b.WriteString(a.String())
+		b.WriteByte('\n')
+	}
+	for _, c := range p.Conflicts {
+		fmt.Fprintf(&b, "skip   %s [file/directory conflict]\n", c)
+	}
+	fmt.Fprintf(&b, "%d action(s), %d unchanged\n", len(p.Actions), p.Unchanged)
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// Result is the outcome of one executed action.
+type Result struct {
+	Action
+	client.CopyResult
+}
+
+// Report summarises a mirror run.
+type Report struct {
+	Plan        *Plan
+	DryRun      bool
+	Results     []Result
+	Copied      int
+	Updated     int
+	Deleted     int
+	DirsCreated int
+	Failed      int
+	BytesCopied int64
+	TimeTaken   time.Duration
+}
+
+// Err joins the errors of all failed actions, or returns nil.
+func (r *Report) Err() error {
+	var errs []error
+	for _, res := range r.Results {
+		if res.Error != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", res.Type, res.Path, res.Error))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Mirror copies SourceRoot on Source to DestinationRoot on Destination.
+type Mirror struct {
+	Source          client.Client
+	SourceRoot      string
+	Destination     client.Client
+	DestinationRoot string
+	Options         Options
+}
+
+// New creates a Mirror from srcRoot on src to dstRoot on dst. A missing
+// dstRoot is created, but its parent must exist.
+func New(src client.Client, srcRoot string, dst client.Client, dstRoot string, opts Options) *Mirror {
+	return &Mirror{
+		Source:          src,
+		SourceRoot:      srcRoot,
+		Destination:     dst,
+		DestinationRoot: dstRoot,
+		Options:         opts,
+	}
+}
+
+// Plan compares both trees and returns the actions a run would perform.
+func (m *Mirror) Plan(ctx context.Context) (*Plan, error) {
+	if err := m.Options.Filter.Validate(); err != nil {
+		return nil, err
+	}
+	src, err := ListTree(ctx, m.Source, m.SourceRoot, m.Options.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list source: %w", err)
+	}
+	dst, err := ListTree(ctx, m.Destination, m.DestinationRoot, m.Options.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list destination: %w", err)
+	}
+
+	plan := &Plan{}
+	var deletes, mkdirs, copies []Action
+	if m.DestinationRoot != "" && m.DestinationRoot != "/" {
+		exists, err := m.Destination.FileExists(ctx, m.DestinationRoot)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check destination root: %w", err)
+		}
+		if !exists {
+			mkdirs = append(mkdirs, Action{Type: ActionMkdir, IsDir: true})
+		}
+	}
+	replaced := make(map[string]bool)
+	for _, rel := range sortedKeys(src) {
+		s := src[rel]
+		d, ok := dst[rel]
+		if ok && s.IsDir != d.IsDir {
+			if !m.Options.Delete {
+				plan.Conflicts = append(plan.Conflicts, rel)
+				continue
+			}
+			replaced[rel] = true
+			ok = false
+		}
+		switch {
+		case s.IsDir && !ok:
+			mkdirs = append(mkdirs, Action{Type: ActionMkdir, Path: rel, IsDir: true})
+		case s.IsDir:
+		case !ok:
+			copies = append(copies, Action{Type: ActionCopy, Path: rel, Size: s.Size})
+		default:
+			reason, err := m.changed(ctx, rel, s, d)
+			if err != nil {
+				return nil, err
+			}
+			if reason == "" {
+				plan.Unchanged++
+				continue
+			}
+			copies = append(copies, Action{Type: ActionUpdate, Path: rel, Size: s.Size, Reason: reason})
+		}
+	}
+
+	if m.Options.Delete {
+		for rel, d := range dst {
+			if _, ok := src[rel]; ok && !replaced[rel] {
+				continue
+			}
+			deletes = append(deletes, Action{Type: ActionDelete, Path: rel, IsDir: d.IsDir, Size: d.Size})
+		}
+		sort.Slice(deletes, func(i, j int) bool {
+			di, dj := strings.Count(deletes[i].Path, "/"), strings.Count(deletes[j].Path, "/")
+			if di != dj {
+				return di > dj
+			}
+			if deletes[i].IsDir != deletes[j].IsDir {
+				return !deletes[i].IsDir
+			}
+			return deletes[i].Path < deletes[j].Path
+		})
+	}
+
+	plan.Actions = append(append(deletes, mkdirs...), copies...)
+	return plan, nil
+}
+
+// Run plans the mirror and, unless DryRun is set, executes the plan. Failed
+// actions are recorded in the report and do not stop the run; the returned
+// error is reserved for listing failures, cancellation and plans that do
+// not fit into the destination (transfer.ErrInsufficientSpace), which are
+// refused before any action runs.
+func (m *Mirror) Run(ctx context.Context) (*Report, error) {
+	start := time.Now()
+	plan, err := m.Plan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{Plan: plan, DryRun: m.Options.DryRun}
+	if m.Options.DryRun {
+		report.TimeTaken = time.Since(start)
+		return report, nil
+	}
+
+	if err := transfer.CheckSpace(ctx, m.Destination, m.DestinationRoot, plan.SpaceNeeded()); err != nil {
+		report.TimeTaken = time.Since(start)
+		return report, err
+	}
+	for _, a := range plan.Actions {
+		if err := ctx.Err(); err != nil {
+			report.TimeTaken = time.Since(start)
+			return report, err
+		}
+		res := Result{Action: a, CopyResult: *m.execute(ctx, a)}
+		report.Results = append(report.Results, res)
+		if !res.Success {
+			report.Failed++
+			continue
+		}
+		report.BytesCopied += res.BytesCopied
+		switch a.Type {
+		case ActionCopy:
+			report.Copied++
+		case ActionUpdate:
+			report.Updated++
+		case ActionDelete:
+			report.Deleted++
+		case ActionMkdir:
+			report.DirsCreated++
+		}
+	}
+	report.TimeTaken = time.Since(start)
+	return report, nil
+}
+
+// execute performs a single action against the destination.
+func (m *Mirror) execute(ctx context.Context, a Action) *client.CopyResult {
+	dstPath := client.JoinPath(m.DestinationRoot, a.Path)
+	switch a.Type {
+	case ActionCopy, ActionUpdate:
+		return transfer.Copy(ctx, m.Source, m.Destination, client.CopyOperation{
+			SourcePath:         client.JoinPath(m.SourceRoot, a.Path),
+			DestinationPath:    dstPath,
+			OverwriteExisting:  true,
+			PreserveAttributes: m.Options.PreserveAttributes,
+		})
+	}
+
+	start := time.Now()
+	var err error
+	switch a.Type {
+	case ActionMkdir:
+		err = m.Destination.CreateDirectory(ctx, dstPath)
+	case ActionDelete:
+		if a.IsDir {
+			err = m.deleteEmptyDirectory(ctx, dstPath)
+		} else {
+			err = m.Destination.DeleteFile(ctx, dstPath)
+		}
+	default:
+		err = fmt.Errorf("unknown action %s", a.Type)
+	}
+	return &client.CopyResult{Success: err == nil, Error: err, TimeTaken: time.Since(start)}
+}
+
+// deleteEmptyDirectory deletes a directory whose planned children have
+// already been removed. A directory still holding entries (excluded ones,
+// or ones created since planning) is kept, because some backends delete
+// recursively.
+func (m *Mirror) deleteEmptyDirectory(ctx context.Context, dir string) error {
+	files, err := m.Destination.ListDirectory(ctx, dir)
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %w", dir, err)
+	}
+	for _, f := range files {
+		if f.Name != "" && f.Name != "." && f.Name != ".." {
+			return fmt.Errorf("directory %s is not empty", dir)
+		}
+	}
+	return m.Destination.DeleteDirectory(ctx, dir)
+}
+
+// changed returns why the destination file differs from the source, or ""
+// when it is up to date.
+func (m *Mirror) changed(ctx context.Context, rel string, s, d *client.FileInfo) (string, error) {
+	if s.Size != d.Size {
+		return "size changed", nil
+	}
+	if m.Options.Compare == CompareChecksum {
+		same, err := checksum.Compare(ctx, m.Source, client.JoinPath(m.SourceRoot, rel), m.Destination, client.JoinPath(m.DestinationRoot, rel), "")
+		if err != nil {
+			return "", err
+		}
+		if !same {
+			return "checksum differs", nil
+		}
+		return "", nil
+	}
+	window := m.Options.ModTimeWindow
+	if window == 0 {
+		window = DefaultModTimeWindow
+	} else if window < 0 {
+		window = 0
+	}
+	if s.ModTime.After(d.ModTime.Add(window)) {
+		return "source newer", nil
+	}
+	return "", nil
+}
+
+func sortedKeys(t Tree) []string {
+	keys := make([]string, 0, len(t))
+	for k := range t {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
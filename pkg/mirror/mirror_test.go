@@ -0,0 +1,268 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"digital.vasic.filesystem/internal/testutil"
+	"digital.vasic.filesystem/pkg/client"
+	"digital.vasic.filesystem/pkg/transfer"
+)
+
+func writeFile(t *testing.T, dir, rel, content string, mtime time.Time) {
+	t.Helper()
+	p := filepath.Join(dir, filepath.FromSlash(rel))
+	require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+	require.NoError(t, os.WriteFile(p, []byte(content), 0644))
+	require.NoError(t, os.Chtimes(p, mtime, mtime))
+}
+
+func readFile(t *testing.T, dir, rel string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(rel)))
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestFilter(t *testing.T) {
+	f := Filter{Include: []string{"**/*.jpg", "docs/**"}, Exclude: []string{"*.tmp", "cache"}}
+	require.NoError(t, f.Validate())
+
+	assert.True(t, f.Match("a.jpg"))
+	assert.True(t, f.Match("photos/2024/a.jpg"))
+	assert.True(t, f.Match("docs/readme.md"))
+	assert.False(t, f.Match("notes.txt"))
+	assert.False(t, f.Match("docs/draft.tmp"))
+	assert.True(t, f.Excluded("photos/cache"))
+	assert.False(t, f.Excluded("photos"))
+
+	assert.True(t, Filter{}.Match("anything"))
+	assert.Error(t, Filter{Exclude: []string{"[unterminated"}}.Validate())
+}
+
+func TestMirror_Run(t *testing.T) {
+	src, srcDir := testutil.NewLocal(t)
+	dst, dstDir := testutil.NewLocal(t)
+	old := time.Now().Add(-time.Hour)
+	now := time.Now()
+
+	writeFile(t, srcDir, "same.txt", "same", old)
+	writeFile(t, srcDir, "changed.txt", "new content", now)
+	writeFile(t, srcDir, "newer.txt", "abcd", now)
+	writeFile(t, srcDir, "dir/nested.txt", "nested", now)
+	require.NoError(t, os.Mkdir(filepath.Join(srcDir, "empty"), 0755))
+
+	writeFile(t, dstDir, "same.txt", "same", old)
+	writeFile(t, dstDir, "changed.txt", "old", old)
+	writeFile(t, dstDir, "newer.txt", "wxyz", old)
+	writeFile(t, dstDir, "extra.txt", "extra", old)
+	writeFile(t, dstDir, "stale/deep.txt", "stale", old)
+
+	m := New(src, "/", dst, "/", Options{Delete: true})
+	report, err := m.Run(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, report.Err())
+
+	assert.Equal(t, 1, report.Copied)
+	assert.Equal(t, 2, report.Updated)
+	assert.Equal(t, 3, report.Deleted)
+	assert.Equal(t, 2, report.DirsCreated)
+	assert.Equal(t, 1, report.Plan.Unchanged)
+	assert.Equal(t, int64(len("new content")+len("abcd")+len("nested")), report.BytesCopied)
+
+	assert.Equal(t, "new content", readFile(t, dstDir, "changed.txt"))
+	assert.Equal(t, "abcd", readFile(t, dstDir, "newer.txt"))
+	assert.Equal(t, "nested", readFile(t, dstDir, "dir/nested.txt"))
+	assert.DirExists(t, filepath.Join(dstDir, "empty"))
+	assert.NoFileExists(t, filepath.Join(dstDir, "extra.txt"))
+	assert.NoDirExists(t, filepath.Join(dstDir, "stale"))
+
+	// A second run finds nothing to do.
+	report, err = m.Run(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, report.Plan.Actions)
+}
+
+func TestMirror_NoDeleteByDefault(t *testing.T) {
+	src, _ := testutil.NewLocal(t)
+	dst, dstDir := testutil.NewLocal(t)
+	writeFile(t, dstDir, "extra.txt", "extra", time.Now())
+
+	report, err := New(src, "/", dst, "/", Options{}).Run(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, report.Plan.Actions)
+	assert.FileExists(t, filepath.Join(dstDir, "extra.txt"))
+}
+
+func TestMirror_Checksum(t *testing.T) {
+	src, srcDir := testutil.NewLocal(t)
+	dst, dstDir := testutil.NewLocal(t)
+	mtime := time.Now().Add(-time.Hour)
+	writeFile(t, srcDir, "a.txt", "aaaa", mtime)
+	writeFile(t, dstDir, "a.txt", "bbbb", mtime)
+	writeFile(t, srcDir, "b.txt", "same", time.Now())
+	writeFile(t, dstDir, "b.txt", "same", mtime)
+
+	plan, err := New(src, "/", dst, "/", Options{}).Plan(context.Background())
+	require.NoError(t, err)
+	require.Len(t, plan.Actions, 1)
+	assert.Equal(t, "b.txt", plan.Actions[0].Path)
+	assert.Equal(t, "source newer", plan.Actions[0].Reason)
+
+	plan, err = New(src, "/", dst, "/", Options{Compare: CompareChecksum}).Plan(context.Background())
+	require.NoError(t, err)
+	require.Len(t, plan.Actions, 1)
+	assert.Equal(t, "a.txt", plan.Actions[0].Path)
+	assert.Equal(t, "checksum differs", plan.Actions[0].Reason)
+}
+
+func TestMirror_DryRun(t *testing.T) {
+	src, srcDir := testutil.NewLocal(t)
+	dst, dstDir := testutil.NewLocal(t)
+	writeFile(t, srcDir, "a.txt", "hello", time.Now())
+	writeFile(t, dstDir, "gone.txt", "bye", time.Now())
+
+	report, err := New(src, "/", dst, "/", Options{Delete: true, DryRun: true}).Run(context.Background())
+	require.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Empty(t, report.Results)
+	require.Len(t, report.Plan.Actions, 2)
+	assert.NoFileExists(t, filepath.Join(dstDir, "a.txt"))
+	assert.FileExists(t, filepath.Join(dstDir, "gone.txt"))
+
+	var buf bytes.Buffer
+	_, err = report.Plan.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, "delete gone.txt\ncopy   a.txt (5 bytes)\n2 action(s), 0 unchanged\n", buf.String())
+}
+
+func TestMirror_Filters(t *testing.T) {
+	src, srcDir := testutil.NewLocal(t)
+	dst, dstDir := testutil.NewLocal(t)
+	now := time.Now()
+	writeFile(t, srcDir, "keep.jpg", "jpg", now)
+	writeFile(t, srcDir, "skip.txt", "txt", now)
+	writeFile(t, srcDir, "cache/x.jpg", "cached", now)
+	writeFile(t, dstDir, "local.tmp", "tmp", now)
+
+	opts := Options{Delete: true, Filter: Filter{Include: []string{"*.jpg"}, Exclude: []string{"cache", "*.tmp"}}}
+	report, err := New(src, "/", dst, "/", opts).Run(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, report.Err())
+
+	assert.FileExists(t, filepath.Join(dstDir, "keep.jpg"))
+	assert.NoFileExists(t, filepath.Join(dstDir, "skip.txt"))
+	assert.NoDirExists(t, filepath.Join(dstDir, "cache"))
+	assert.FileExists(t, filepath.Join(dstDir, "local.tmp"), "excluded destination files are never deleted")
+}
+
+func TestMirror_Subtrees(t *testing.T) {
+	src, srcDir := testutil.NewLocal(t)
+	dst, dstDir := testutil.NewLocal(t)
+	writeFile(t, srcDir, "share/a/b.txt", "b", time.Now())
+
+	report, err := New(src, "share", dst, "backup", Options{}).Run(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, report.Err())
+	assert.Equal(t, "b", readFile(t, dstDir, "backup/a/b.txt"))
+	assert.Equal(t, ActionMkdir, report.Plan.Actions[0].Type)
+	assert.Equal(t, "", report.Plan.Actions[0].Path)
+}
+
+func TestMirror_Conflicts(t *testing.T) {
+	src, srcDir := testutil.NewLocal(t)
+	dst, dstDir := testutil.NewLocal(t)
+	writeFile(t, srcDir, "x", "file", time.Now())
+	writeFile(t, dstDir, "x/inner.txt", "dir", time.Now())
+
+	plan, err := New(src, "/", dst, "/", Options{}).Plan(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"x"}, plan.Conflicts)
+	assert.Empty(t, plan.Actions)
+
+	report, err := New(src, "/", dst, "/", Options{Delete: true}).Run(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, report.Err())
+	assert.Equal(t, "file", readFile(t, dstDir, "x"))
+}
+
+func TestMirror_DeleteKeepsNonEmptyDirectory(t *testing.T) {
+	src, _ := testutil.NewLocal(t)
+	dst, dstDir := testutil.NewLocal(t)
+	writeFile(t, dstDir, "old/a.txt", "a", time.Now())
+	writeFile(t, dstDir, "old/keep.tmp", "tmp", time.Now())
+
+	opts := Options{Delete: true, Filter: Filter{Exclude: []string{"*.tmp"}}}
+	report, err := New(src, "/", dst, "/", opts).Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Failed)
+	assert.Error(t, report.Err())
+	assert.FileExists(t, filepath.Join(dstDir, "old", "keep.tmp"))
+	assert.NoFileExists(t, filepath.Join(dstDir, "old", "a.txt"))
+}
+
+func TestMirror_PreserveAttributes(t *testing.T) {
+	src, srcDir := testutil.NewLocal(t)
+	dst, dstDir := testutil.NewLocal(t)
+	old := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	writeFile(t, srcDir, "a.txt", "alpha", old)
+	require.NoError(t, os.Chmod(filepath.Join(srcDir, "a.txt"), 0600))
+
+	m := New(src, "/", dst, "/", Options{ModTimeWindow: -1, PreserveAttributes: true})
+	report, err := m.Run(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, report.Err())
+	assert.Equal(t, 1, report.Copied)
+
+	info, err := os.Stat(filepath.Join(dstDir, "a.txt"))
+	require.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(old))
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// Exact time comparison still finds nothing to do.
+	report, err = m.Run(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, report.Plan.Actions)
+}
+
+// fixedSpace reports a fixed amount of free space for every path.
+type fixedSpace struct {
+	client.Client
+	free int64
+}
+
+func (f fixedSpace) GetSpace(ctx context.Context, path string) (*client.SpaceInfo, error) {
+	return &client.SpaceInfo{Free: f.free}, nil
+}
+
+func TestMirror_InsufficientSpace(t *testing.T) {
+	src, srcDir := testutil.NewLocal(t)
+	dst, dstDir := testutil.NewLocal(t)
+	now := time.Now()
+	writeFile(t, srcDir, "a.txt", "alpha", now)
+	writeFile(t, srcDir, "b.txt", "bravo", now)
+	writeFile(t, dstDir, "stale.txt", "xyz", now)
+
+	m := New(src, "/", fixedSpace{Client: dst, free: 6}, "/", Options{Delete: true})
+	plan, err := m.Plan(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), plan.SpaceNeeded())
+
+	report, err := m.Run(context.Background())
+	assert.ErrorIs(t, err, transfer.ErrInsufficientSpace)
+	require.NotNil(t, report)
+	assert.Empty(t, report.Results, "no action runs")
+	assert.FileExists(t, filepath.Join(dstDir, "stale.txt"))
+
+	m.Destination = fixedSpace{Client: dst, free: 7}
+	report, err = m.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Copied)
+}
@@ -0,0 +1,58 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// Tree maps paths relative to a root (joined with "/", no leading slash) to
+// their file information.
+type Tree map[string]*client.FileInfo
+
+// ListTree lists root recursively on c. Excluded directories are skipped
+// entirely; excluded or non-included files are left out. A missing root
+// yields an empty tree so a first mirror run can start from nothing.
+func ListTree(ctx context.Context, c client.Client, root string, filter Filter) (Tree, error) {
+	tree := make(Tree)
+	exists, err := c.FileExists(ctx, root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check %s: %w", root, err)
+	}
+	if !exists {
+		return tree, nil
+	}
+
+	dirs := []string{""}
+	for len(dirs) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		rel := dirs[0]
+		dirs = dirs[1:]
+		files, err := c.ListDirectory(ctx, client.JoinPath(root, rel))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", client.JoinPath(root, rel), err)
+		}
+		for _, f := range files {
+			if f.Name == "" || f.Name == "." || f.Name == ".." {
+				continue
+			}
+			child := path.Join(rel, f.Name)
+			if f.IsDir {
+				if filter.Excluded(child) {
+					continue
+				}
+				tree[child] = f
+				dirs = append(dirs, child)
+				continue
+			}
+			if filter.Match(child) {
+				tree[child] = f
+			}
+		}
+	}
+	return tree, nil
+}
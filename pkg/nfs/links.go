@@ -0,0 +1,85 @@
+//go:build linux
+// +build linux
+
+package nfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"syscall"
+
+	"digital.vasic.filesystem/pkg/client"
+	"digital.vasic.filesystem/pkg/confine"
+)
+
+// Symlink creates a symbolic link at path pointing to target. Unless the
+// symlink policy is "follow", targets leading outside the mount point are
+// refused.
+func (c *Client) Symlink(ctx context.Context, target, path string) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	fullPath, err := c.resolveLink(path)
+	if err != nil {
+		return err
+	}
+	if c.symlinks != confine.SymlinkFollow {
+		if err := confine.CheckLink(c.mountPoint, path, target); err != nil {
+			return err
+		}
+	}
+	if err := os.Symlink(target, fullPath); err != nil {
+		return fmt.Errorf("failed to create NFS symlink %s: %w", fullPath, err)
+	}
+	return nil
+}
+
+// Readlink returns the target of the symbolic link at path.
+func (c *Client) Readlink(ctx context.Context, path string) (string, error) {
+	if !c.IsConnected() {
+		return "", fmt.Errorf("not connected")
+	}
+	fullPath, err := c.resolveLink(path)
+	if err != nil {
+		return "", err
+	}
+	target, err := os.Readlink(fullPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read NFS symlink %s: %w", fullPath, err)
+	}
+	return target, nil
+}
+
+// Link creates path as a hard link to the existing file target.
+func (c *Client) Link(ctx context.Context, target, path string) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	targetPath, err := c.resolveLink(target)
+	if err != nil {
+		return err
+	}
+	fullPath, err := c.resolveLink(path)
+	if err != nil {
+		return err
+	}
+	if err := os.Link(targetPath, fullPath); err != nil {
+		return fmt.Errorf("failed to create NFS hard link %s: %w", fullPath, err)
+	}
+	return nil
+}
+
+// linkInfo sets the link fields of info from lstat, the unfollowed
+// FileInfo of fullPath.
+func linkInfo(info *client.FileInfo, fullPath string, lstat os.FileInfo) {
+	switch {
+	case lstat.Mode()&os.ModeSymlink != 0:
+		info.LinkType = client.LinkSymlink
+		info.LinkTarget, _ = os.Readlink(fullPath)
+	case lstat.Mode().IsRegular():
+		if st, ok := lstat.Sys().(*syscall.Stat_t); ok && st.Nlink > 1 {
+			info.LinkType = client.LinkHard
+		}
+	}
+}
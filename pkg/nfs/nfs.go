@@ -8,12 +8,15 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"iter"
 	"os"
 	"path/filepath"
-	"strings"
+	"sort"
 	"syscall"
 
 	"digital.vasic.filesystem/pkg/client"
+	"digital.vasic.filesystem/pkg/confine"
+	"digital.vasic.filesystem/pkg/watch"
 )
 
 // Config contains NFS connection configuration.
@@ -22,6 +25,11 @@ type Config struct {
 	Path       string `json:"path"`
 	MountPoint string `json:"mount_point"`
 	Options    string `json:"options"`
+	// AtomicWrites makes WriteFile behave like WriteFileAtomic.
+	AtomicWrites bool `json:"atomic_writes,omitempty"`
+	// Symlinks is the symlink policy: "confine" (default), "follow" or
+	// "refuse".
+	Symlinks string `json:"symlinks,omitempty"`
 }
 
 // Client implements client.Client for NFS protocol.
@@ -30,6 +38,7 @@ type Client struct {
 	mounted    bool
 	connected  bool
 	mountPoint string
+	symlinks   confine.SymlinkPolicy
 }
 
 // NewNFSClient creates a new NFS client.
@@ -47,6 +56,11 @@ func NewNFSClient(config Config) (*Client, error) {
 
 // Connect establishes the NFS connection by mounting the filesystem.
 func (c *Client) Connect(ctx context.Context) error {
+	policy, err := confine.ParsePolicy(c.config.Symlinks)
+	if err != nil {
+		return err
+	}
+	c.symlinks = policy
 	if c.isMounted() {
 		c.connected = true
 		return nil
@@ -62,7 +76,7 @@ func (c *Client) Connect(ctx context.Context) error {
 		options = c.config.Options
 	}
 
-	err := syscall.Mount(source, c.mountPoint, "nfs", 0, options)
+	err = syscall.Mount(source, c.mountPoint, "nfs", 0, options)
 	if err != nil {
 		return fmt.Errorf("failed to mount NFS share %s to %s: %w", source, c.mountPoint, err)
 	}
@@ -109,13 +123,22 @@ func (c *Client) isMounted() bool {
 	return true
 }
 
-// resolvePath resolves a relative path within the NFS mount point.
-func (c *Client) resolvePath(path string) string {
-	cleanPath := filepath.Clean(path)
-	if strings.Contains(cleanPath, "..") {
-		cleanPath = strings.ReplaceAll(cleanPath, "..", "")
-	}
-	return filepath.Join(c.mountPoint, cleanPath)
+// resolvePath resolves a relative path within the NFS mount point,
+// rejecting paths that escape it under the symlink policy.
+func (c *Client) resolvePath(path string) (string, error) {
+	return confine.Join(c.mountPoint, path, c.symlinks)
+}
+
+// resolveLink resolves path without following a link in its last element,
+// for operations on the link itself.
+func (c *Client) resolveLink(path string) (string, error) {
+	return confine.JoinLink(c.mountPoint, path, c.symlinks)
+}
+
+// openFile opens path like os.OpenFile, enforcing the symlink policy in the
+// open itself so that a link swapped in after resolvePath is not followed.
+func (c *Client) openFile(path string, flag int, perm os.FileMode) (*os.File, error) {
+	return confine.OpenFile(c.mountPoint, path, c.symlinks, flag, perm)
 }
 
 // ReadFile reads a file from the NFS mount.
@@ -123,8 +146,11 @@ func (c *Client) ReadFile(ctx context.Context, path string) (io.ReadCloser, erro
 	if !c.IsConnected() {
 		return nil, fmt.Errorf("not connected")
 	}
-	fullPath := c.resolvePath(path)
-	file, err := os.Open(fullPath)
+	fullPath, err := c.resolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := c.openFile(path, os.O_RDONLY, 0)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open NFS file %s: %w", fullPath, err)
 	}
@@ -136,14 +162,20 @@ func (c *Client) WriteFile(ctx context.Context, path string, data io.Reader) err
 	if !c.IsConnected() {
 		return fmt.Errorf("not connected")
 	}
-	fullPath := c.resolvePath(path)
+	if c.config.AtomicWrites {
+		return c.WriteFileAtomic(ctx, path, data)
+	}
+	fullPath, err := c.resolvePath(path)
+	if err != nil {
+		return err
+	}
 
 	dir := filepath.Dir(fullPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return fmt.Errorf("failed to create directory %s: %w", dir, err)
 	}
 
-	file, err := os.Create(fullPath)
+	file, err := c.openFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
 		return fmt.Errorf("failed to create NFS file %s: %w", fullPath, err)
 	}
@@ -157,55 +189,206 @@ func (c *Client) WriteFile(ctx context.Context, path string, data io.Reader) err
 	return nil
 }
 
-// GetFileInfo gets information about a file.
+// Create opens a file for writing, truncating it if it exists.
+func (c *Client) Create(ctx context.Context, path string) (io.WriteCloser, error) {
+	return c.openWriter(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+}
+
+// OpenAppend opens a file for writing at its end, creating it if missing.
+func (c *Client) OpenAppend(ctx context.Context, path string) (io.WriteCloser, error) {
+	return c.openWriter(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND)
+}
+
+// openWriter opens a file with flag after creating its parent directories.
+func (c *Client) openWriter(path string, flag int) (io.WriteCloser, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+	fullPath, err := c.resolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Dir(fullPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+
+	file, err := c.openFile(path, flag, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open NFS file %s for writing: %w", fullPath, err)
+	}
+	return file, nil
+}
+
+// WriteFileAtomic writes data to a hidden temporary file next to path,
+// syncs it and renames it into place, so readers see either the old or the
+// new contents. An existing file keeps its permissions.
+func (c *Client) WriteFileAtomic(ctx context.Context, path string, data io.Reader) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	fullPath, err := c.resolvePath(path)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(fullPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(fullPath); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(fullPath)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file in %s: %w", dir, err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err := io.Copy(tmp, data); err != nil {
+		return fmt.Errorf("failed to write NFS file %s: %w", fullPath, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		return fmt.Errorf("failed to set mode of NFS file %s: %w", fullPath, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync NFS file %s: %w", fullPath, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close NFS file %s: %w", fullPath, err)
+	}
+	if err := os.Rename(tmp.Name(), fullPath); err != nil {
+		return fmt.Errorf("failed to rename NFS file into %s: %w", fullPath, err)
+	}
+	committed = true
+
+	// Persist the rename; not every platform can sync a directory.
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// GetFileInfo gets information about a file. A symlink is described by its
+// target when that is reachable under the symlink policy, by the link itself
+// otherwise; either way LinkType and LinkTarget are set.
 func (c *Client) GetFileInfo(ctx context.Context, path string) (*client.FileInfo, error) {
 	if !c.IsConnected() {
 		return nil, fmt.Errorf("not connected")
 	}
-	fullPath := c.resolvePath(path)
-	stat, err := os.Stat(fullPath)
+	fullPath, err := c.resolveLink(path)
+	if err != nil {
+		return nil, err
+	}
+	lstat, err := os.Lstat(fullPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to stat NFS file %s: %w", fullPath, err)
 	}
+	stat := lstat
+	if lstat.Mode()&os.ModeSymlink != 0 {
+		if _, err := c.resolvePath(path); err == nil {
+			if target, err := os.Stat(fullPath); err == nil {
+				stat = target
+			}
+		}
+	}
 
-	return &client.FileInfo{
+	info := &client.FileInfo{
 		Name:    stat.Name(),
 		Size:    stat.Size(),
 		ModTime: stat.ModTime(),
 		IsDir:   stat.IsDir(),
 		Mode:    stat.Mode(),
 		Path:    path,
-	}, nil
+	}
+	linkInfo(info, fullPath, lstat)
+	if st, ok := stat.Sys().(*syscall.Stat_t); ok {
+		info.FileID = fmt.Sprintf("%d:%d", st.Dev, st.Ino)
+	}
+	return info, nil
 }
 
-// ListDirectory lists files in a directory.
+// listBatch is the number of directory entries read per call while
+// streaming a listing.
+const listBatch = 1024
+
+// ListDirectory lists files in a directory, sorted by name.
 func (c *Client) ListDirectory(ctx context.Context, path string) ([]*client.FileInfo, error) {
-	if !c.IsConnected() {
-		return nil, fmt.Errorf("not connected")
-	}
-	fullPath := c.resolvePath(path)
-	entries, err := os.ReadDir(fullPath)
+	files, err := client.CollectFiles(c.StreamDirectory(ctx, path))
 	if err != nil {
-		return nil, fmt.Errorf("failed to list NFS directory %s: %w", fullPath, err)
+		return nil, err
 	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
 
-	var files []*client.FileInfo
-	for _, entry := range entries {
-		info, err := entry.Info()
+// StreamDirectory yields the entries of a directory in directory order,
+// reading them listBatch at a time.
+func (c *Client) StreamDirectory(ctx context.Context, path string) iter.Seq2[*client.FileInfo, error] {
+	return func(yield func(*client.FileInfo, error) bool) {
+		if !c.IsConnected() {
+			yield(nil, fmt.Errorf("not connected"))
+			return
+		}
+		fullPath, err := c.resolvePath(path)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		dir, err := c.openFile(path, os.O_RDONLY, 0)
 		if err != nil {
-			continue
+			yield(nil, fmt.Errorf("failed to list NFS directory %s: %w", fullPath, err))
+			return
+		}
+		defer dir.Close()
+
+		for {
+			entries, err := dir.ReadDir(listBatch)
+			for _, entry := range entries {
+				info, err := entry.Info()
+				if err != nil {
+					continue
+				}
+				fi := &client.FileInfo{
+					Name:    entry.Name(),
+					Size:    info.Size(),
+					ModTime: info.ModTime(),
+					IsDir:   entry.IsDir(),
+					Mode:    info.Mode(),
+					Path:    filepath.Join(path, entry.Name()),
+				}
+				linkInfo(fi, filepath.Join(fullPath, entry.Name()), info)
+				if !yield(fi, nil) {
+					return
+				}
+			}
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(nil, fmt.Errorf("failed to list NFS directory %s: %w", fullPath, err))
+				return
+			}
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
 		}
-		files = append(files, &client.FileInfo{
-			Name:    entry.Name(),
-			Size:    info.Size(),
-			ModTime: info.ModTime(),
-			IsDir:   entry.IsDir(),
-			Mode:    info.Mode(),
-			Path:    filepath.Join(path, entry.Name()),
-		})
 	}
-
-	return files, nil
 }
 
 // FileExists checks if a file exists.
@@ -213,8 +396,11 @@ func (c *Client) FileExists(ctx context.Context, path string) (bool, error) {
 	if !c.IsConnected() {
 		return false, fmt.Errorf("not connected")
 	}
-	fullPath := c.resolvePath(path)
-	_, err := os.Stat(fullPath)
+	fullPath, err := c.resolvePath(path)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(fullPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return false, nil
@@ -229,8 +415,11 @@ func (c *Client) CreateDirectory(ctx context.Context, path string) error {
 	if !c.IsConnected() {
 		return fmt.Errorf("not connected")
 	}
-	fullPath := c.resolvePath(path)
-	err := os.MkdirAll(fullPath, 0755)
+	fullPath, err := c.resolvePath(path)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(fullPath, 0755)
 	if err != nil {
 		return fmt.Errorf("failed to create NFS directory %s: %w", fullPath, err)
 	}
@@ -242,21 +431,28 @@ func (c *Client) DeleteDirectory(ctx context.Context, path string) error {
 	if !c.IsConnected() {
 		return fmt.Errorf("not connected")
 	}
-	fullPath := c.resolvePath(path)
-	err := os.RemoveAll(fullPath)
+	fullPath, err := c.resolvePath(path)
+	if err != nil {
+		return err
+	}
+	err = os.RemoveAll(fullPath)
 	if err != nil {
 		return fmt.Errorf("failed to delete NFS directory %s: %w", fullPath, err)
 	}
 	return nil
 }
 
-// DeleteFile deletes a file.
+// DeleteFile deletes a file. A symlink is removed itself, wherever it
+// points.
 func (c *Client) DeleteFile(ctx context.Context, path string) error {
 	if !c.IsConnected() {
 		return fmt.Errorf("not connected")
 	}
-	fullPath := c.resolvePath(path)
-	err := os.Remove(fullPath)
+	fullPath, err := c.resolveLink(path)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(fullPath)
 	if err != nil {
 		return fmt.Errorf("failed to delete NFS file %s: %w", fullPath, err)
 	}
@@ -268,21 +464,27 @@ func (c *Client) CopyFile(ctx context.Context, srcPath, dstPath string) error {
 	if !c.IsConnected() {
 		return fmt.Errorf("not connected")
 	}
-	srcFullPath := c.resolvePath(srcPath)
-	dstFullPath := c.resolvePath(dstPath)
+	srcFullPath, err := c.resolvePath(srcPath)
+	if err != nil {
+		return err
+	}
+	dstFullPath, err := c.resolvePath(dstPath)
+	if err != nil {
+		return err
+	}
 
 	dstDir := filepath.Dir(dstFullPath)
 	if err := os.MkdirAll(dstDir, 0755); err != nil {
 		return fmt.Errorf("failed to create destination directory %s: %w", dstDir, err)
 	}
 
-	srcFile, err := os.Open(srcFullPath)
+	srcFile, err := c.openFile(srcPath, os.O_RDONLY, 0)
 	if err != nil {
 		return fmt.Errorf("failed to open source file %s: %w", srcFullPath, err)
 	}
 	defer srcFile.Close()
 
-	dstFile, err := os.Create(dstFullPath)
+	dstFile, err := c.openFile(dstPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
 		return fmt.Errorf("failed to create destination file %s: %w", dstFullPath, err)
 	}
@@ -296,6 +498,15 @@ func (c *Client) CopyFile(ctx context.Context, srcPath, dstPath string) error {
 	return nil
 }
 
+// Watch reports changes below path by polling the mount, since inotify does
+// not see changes made by other NFS clients.
+func (c *Client) Watch(ctx context.Context, path string, recursive bool) (<-chan client.Event, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+	return watch.Poll(ctx, c, path, recursive, watch.DefaultPollInterval)
+}
+
 // GetProtocol returns the protocol name.
 func (c *Client) GetProtocol() string {
 	return "nfs"
@@ -5,16 +5,29 @@ package nfs
 
 import (
 	"context"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"digital.vasic.filesystem/pkg/client"
+	"digital.vasic.filesystem/pkg/confine"
 )
 
-// Verify NFS Client implements client.Client interface.
-var _ client.Client = (*Client)(nil)
+// Verify NFS Client implements the client.Client and client.Watcher interfaces.
+var (
+	_ client.Client            = (*Client)(nil)
+	_ client.Watcher           = (*Client)(nil)
+	_ client.WritableClient    = (*Client)(nil)
+	_ client.AtomicWriter      = (*Client)(nil)
+	_ client.AttributeSetter   = (*Client)(nil)
+	_ client.SpaceReporter     = (*Client)(nil)
+	_ client.DirectoryStreamer = (*Client)(nil)
+	_ client.MetadataStore     = (*Client)(nil)
+	_ client.Linker            = (*Client)(nil)
+)
 
 func TestNewNFSClient(t *testing.T) {
 	config := Config{
@@ -63,28 +76,38 @@ func TestNFSClient_GetConfig(t *testing.T) {
 
 func TestNFSClient_ResolvePath_Simple(t *testing.T) {
 	c, _ := NewNFSClient(Config{MountPoint: "/mnt/nfs"})
-	assert.Equal(t, "/mnt/nfs/subdir/file.txt", c.resolvePath("subdir/file.txt"))
+	resolved, err := c.resolvePath("subdir/file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "/mnt/nfs/subdir/file.txt", resolved)
 }
 
 func TestNFSClient_ResolvePath_PathTraversal(t *testing.T) {
 	c, _ := NewNFSClient(Config{MountPoint: "/mnt/nfs"})
-	resolved := c.resolvePath("../../../etc/passwd")
-	assert.NotContains(t, resolved, "..")
+	_, err := c.resolvePath("../../../etc/passwd")
+	assert.ErrorIs(t, err, confine.ErrEscape)
 }
 
 func TestNFSClient_ResolvePath_DotDot(t *testing.T) {
 	c, _ := NewNFSClient(Config{MountPoint: "/mnt/nfs"})
-	resolved := c.resolvePath("subdir/../test.txt")
-	// filepath.Clean resolves this, then we strip any remaining ..
-	assert.NotContains(t, resolved, "..")
+	resolved, err := c.resolvePath("subdir/../test.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "/mnt/nfs/test.txt", resolved)
 }
 
 func TestNFSClient_ResolvePath_CurrentDir(t *testing.T) {
 	c, _ := NewNFSClient(Config{MountPoint: "/mnt/nfs"})
-	resolved := c.resolvePath(".")
+	resolved, err := c.resolvePath(".")
+	require.NoError(t, err)
 	assert.Equal(t, "/mnt/nfs", resolved)
 }
 
+func TestNFSClient_Connect_InvalidSymlinkPolicy(t *testing.T) {
+	c, err := NewNFSClient(Config{MountPoint: "/mnt/nfs", Symlinks: "sometimes"})
+	require.NoError(t, err)
+	assert.Error(t, c.Connect(context.Background()))
+	assert.False(t, c.IsConnected())
+}
+
 func TestNFSClient_IsConnected_NotConnected(t *testing.T) {
 	c, _ := NewNFSClient(Config{MountPoint: "/mnt/nfs"})
 	assert.False(t, c.IsConnected())
@@ -183,3 +206,64 @@ func TestNFSConfig_Fields(t *testing.T) {
 	assert.Equal(t, "/mnt/media", config.MountPoint)
 	assert.Equal(t, "vers=4,rsize=8192", config.Options)
 }
+
+func TestNFSClient_Create_NotConnected(t *testing.T) {
+	c, _ := NewNFSClient(Config{MountPoint: "/mnt/test"})
+	w, err := c.Create(context.Background(), "test.txt")
+	assert.Error(t, err)
+	assert.Nil(t, w)
+	assert.Contains(t, err.Error(), "not connected")
+}
+
+func TestNFSClient_OpenAppend_NotConnected(t *testing.T) {
+	c, _ := NewNFSClient(Config{MountPoint: "/mnt/test"})
+	w, err := c.OpenAppend(context.Background(), "test.txt")
+	assert.Error(t, err)
+	assert.Nil(t, w)
+	assert.Contains(t, err.Error(), "not connected")
+}
+
+func TestNFSClient_WriteFileAtomic_NotConnected(t *testing.T) {
+	c, _ := NewNFSClient(Config{MountPoint: "/mnt/test"})
+	err := c.WriteFileAtomic(context.Background(), "test.txt", strings.NewReader("data"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not connected")
+}
+
+func TestNFSClient_Links_NotConnected(t *testing.T) {
+	c, _ := NewNFSClient(Config{MountPoint: "/mnt/test"})
+	ctx := context.Background()
+	assert.EqualError(t, c.Symlink(ctx, "a", "b"), "not connected")
+	_, err := c.Readlink(ctx, "b")
+	assert.EqualError(t, err, "not connected")
+	assert.EqualError(t, c.Link(ctx, "a", "b"), "not connected")
+}
+
+func TestNFSClient_Attributes_NotConnected(t *testing.T) {
+	c, _ := NewNFSClient(Config{MountPoint: "/mnt/test"})
+	ctx := context.Background()
+	assert.EqualError(t, c.Chmod(ctx, "a", 0644), "not connected")
+	assert.EqualError(t, c.Chtimes(ctx, "a", time.Time{}, time.Now()), "not connected")
+	assert.EqualError(t, c.Chown(ctx, "a", 0, 0), "not connected")
+}
+
+func TestNFSClient_Metadata_NotConnected(t *testing.T) {
+	c, _ := NewNFSClient(Config{MountPoint: "/mnt/test"})
+	ctx := context.Background()
+	_, err := c.GetMetadata(ctx, "a")
+	assert.EqualError(t, err, "not connected")
+	assert.EqualError(t, c.SetMetadata(ctx, "a", map[string]string{"k": "v"}), "not connected")
+	assert.EqualError(t, c.DeleteMetadata(ctx, "a", "k"), "not connected")
+}
+
+func TestNFSClient_GetSpace_NotConnected(t *testing.T) {
+	c, _ := NewNFSClient(Config{MountPoint: "/mnt/test"})
+	_, err := c.GetSpace(context.Background(), "")
+	assert.EqualError(t, err, "not connected")
+}
+
+func TestNFSClient_StreamDirectory_NotConnected(t *testing.T) {
+	c, _ := NewNFSClient(Config{MountPoint: "/mnt/test"})
+	_, err := client.CollectFiles(c.StreamDirectory(context.Background(), ""))
+	assert.EqualError(t, err, "not connected")
+}
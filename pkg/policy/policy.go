@@ -0,0 +1,403 @@
+// Package policy provides a client.Client decorator that enforces a
+// read-only flag and per-operation allow/deny path globs before calls reach
+// the wrapped client. Denied calls fail with a *PermissionError and are
+// logged with log/slog.
+package policy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+
+	"digital.vasic.filesystem/pkg/client"
+	"digital.vasic.filesystem/pkg/confine"
+	"digital.vasic.filesystem/pkg/factory"
+)
+
+// Operation is a class of client calls governed by one Rule.
+type Operation string
+
+// Operations checked by the Client.
+const (
+	// OpRead covers ReadFile, OpenSeekable, GetFileInfo, FileExists and the
+	// source of CopyFile.
+	OpRead Operation = "read"
+	// OpList covers ListDirectory.
+	OpList Operation = "list"
+	// OpWrite covers WriteFile, CreateDirectory and the destination of
+	// CopyFile.
+	OpWrite Operation = "write"
+	// OpDelete covers DeleteFile and DeleteDirectory. Since directories
+	// are deleted with their contents, DeleteDirectory also needs every
+	// path below to be allowed: no deny pattern may match anything there
+	// and, with an Allow list, one pattern must cover the whole subtree.
+	OpDelete Operation = "delete"
+)
+
+// Operations lists every Operation in the order settings are read.
+var Operations = []Operation{OpRead, OpList, OpWrite, OpDelete}
+
+// Rule restricts the paths an operation may touch. Patterns are doublestar
+// globs matched against the path relative to the client root, without a
+// leading slash; a pattern without "/" matches the base name. Deny wins over
+// Allow, and an empty Allow allows every path not denied.
+type Rule struct {
+	Allow []string
+	Deny  []string
+}
+
+// Options configures the policy.
+type Options struct {
+	// ReadOnly denies every OpWrite and OpDelete call.
+	ReadOnly bool
+	// Rules holds the path rules per operation. Operations without a rule
+	// are allowed unless ReadOnly forbids them.
+	Rules map[Operation]Rule
+	// Storage names the storage in log records, usually the
+	// StorageConfig ID.
+	Storage string
+	// Logger receives a warning for every denial (default slog.Default()).
+	Logger *slog.Logger
+}
+
+// PermissionError is returned for calls the policy denies. It matches
+// fs.ErrPermission with errors.Is.
+type PermissionError struct {
+	Storage string
+	Op      Operation
+	// Method is the client method that was called, such as "WriteFile".
+	Method string
+	Path   string
+	Reason string
+}
+
+func (e *PermissionError) Error() string {
+	msg := fmt.Sprintf("%s %s: permission denied by policy: %s", e.Method, e.Path, e.Reason)
+	if e.Storage != "" {
+		return e.Storage + ": " + msg
+	}
+	return msg
+}
+
+// Is reports whether target is fs.ErrPermission.
+func (e *PermissionError) Is(target error) bool {
+	return target == fs.ErrPermission
+}
+
+// OptionsFromConfig reads the policy from cfg.Settings:
+//
+//	read_only                  bool
+//	allow_read, deny_read      globs for OpRead
+//	allow_list, deny_list      globs for OpList
+//	allow_write, deny_write    globs for OpWrite
+//	allow_delete, deny_delete  globs for OpDelete
+//
+// Glob settings are lists of strings or, as loaded from .properties
+// catalogs, comma-separated strings. Storage is set to cfg.ID.
+func OptionsFromConfig(cfg *client.StorageConfig) (Options, error) {
+	opts := Options{
+		ReadOnly: factory.GetBoolSetting(cfg.Settings, "read_only", false),
+		Storage:  cfg.ID,
+	}
+	for _, op := range Operations {
+		allow, err := globSetting(cfg.Settings, "allow_"+string(op))
+		if err != nil {
+			return Options{}, err
+		}
+		deny, err := globSetting(cfg.Settings, "deny_"+string(op))
+		if err != nil {
+			return Options{}, err
+		}
+		if len(allow) == 0 && len(deny) == 0 {
+			continue
+		}
+		if opts.Rules == nil {
+			opts.Rules = make(map[Operation]Rule)
+		}
+		opts.Rules[op] = Rule{Allow: allow, Deny: deny}
+	}
+	return opts, nil
+}
+
+// globSetting reads a list of globs from settings.
+func globSetting(settings map[string]interface{}, key string) ([]string, error) {
+	switch v := settings[key].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		var globs []string
+		for _, g := range strings.Split(v, ",") {
+			if g = strings.TrimSpace(g); g != "" {
+				globs = append(globs, g)
+			}
+		}
+		return globs, nil
+	case []string:
+		return v, nil
+	case []interface{}:
+		globs := make([]string, 0, len(v))
+		for _, g := range v {
+			s, ok := g.(string)
+			if !ok {
+				return nil, fmt.Errorf("policy setting %s: %v is not a string", key, g)
+			}
+			globs = append(globs, s)
+		}
+		return globs, nil
+	default:
+		return nil, fmt.Errorf("policy setting %s: expected a list of globs, got %T", key, v)
+	}
+}
+
+// Client wraps a client.Client and rejects calls the policy does not allow.
+// Optional extensions other than client.SeekableClient are not exposed, so
+// they cannot be used to bypass the policy.
+type Client struct {
+	client.Client
+
+	opts Options
+	log  *slog.Logger
+}
+
+// New wraps c with the policy in opts.
+func New(c client.Client, opts Options) (*Client, error) {
+	for op, rule := range opts.Rules {
+		known := false
+		for _, o := range Operations {
+			known = known || o == op
+		}
+		if !known {
+			return nil, fmt.Errorf("policy: unknown operation %q", op)
+		}
+		for _, p := range append(append([]string{}, rule.Allow...), rule.Deny...) {
+			if !doublestar.ValidatePattern(strings.TrimPrefix(p, "/")) {
+				return nil, fmt.Errorf("policy: invalid %s pattern %q", op, p)
+			}
+		}
+	}
+	log := opts.Logger
+	if log == nil {
+		log = slog.Default()
+	}
+	return &Client{Client: c, opts: opts, log: log}, nil
+}
+
+// Unwrap returns the wrapped client.
+func (c *Client) Unwrap() client.Client {
+	return c.Client
+}
+
+// Allowed reports whether op may touch path, with the reason when it may
+// not. Nothing is logged.
+func (c *Client) Allowed(op Operation, path string) (bool, string) {
+	rel, err := confine.Clean(path)
+	if err != nil {
+		return false, "path escapes the root"
+	}
+	if c.opts.ReadOnly && (op == OpWrite || op == OpDelete) {
+		return false, "storage is read-only"
+	}
+	rule, ok := c.opts.Rules[op]
+	if !ok {
+		return true, ""
+	}
+	if client.MatchPath(rule.Deny, rel) {
+		return false, fmt.Sprintf("path matches deny_%s", op)
+	}
+	if len(rule.Allow) > 0 && !client.MatchPath(rule.Allow, rel) {
+		return false, fmt.Sprintf("path does not match allow_%s", op)
+	}
+	return true, ""
+}
+
+// check returns a *PermissionError, after logging it, when op may not
+// touch path.
+func (c *Client) check(ctx context.Context, op Operation, method, path string) error {
+	ok, reason := c.Allowed(op, path)
+	if ok {
+		return nil
+	}
+	return c.deny(ctx, op, method, path, reason)
+}
+
+// deny logs and returns the *PermissionError for a denied call.
+func (c *Client) deny(ctx context.Context, op Operation, method, path, reason string) error {
+	c.log.WarnContext(ctx, "storage operation denied by policy",
+		"storage", c.opts.Storage, "op", string(op), "method", method, "path", path, "reason", reason)
+	return &PermissionError{Storage: c.opts.Storage, Op: op, Method: method, Path: path, Reason: reason}
+}
+
+// ReadFile reads path when OpRead allows it.
+func (c *Client) ReadFile(ctx context.Context, path string) (io.ReadCloser, error) {
+	if err := c.check(ctx, OpRead, "ReadFile", path); err != nil {
+		return nil, err
+	}
+	return c.Client.ReadFile(ctx, path)
+}
+
+// OpenSeekable opens path when OpRead allows it. The wrapped client must be
+// a client.SeekableClient.
+func (c *Client) OpenSeekable(ctx context.Context, path string) (client.ReadSeekCloser, error) {
+	if err := c.check(ctx, OpRead, "OpenSeekable", path); err != nil {
+		return nil, err
+	}
+	sc, ok := c.Client.(client.SeekableClient)
+	if !ok {
+		return nil, fmt.Errorf("open seekable %s: %w", path, client.ErrNotSupported)
+	}
+	return sc.OpenSeekable(ctx, path)
+}
+
+// GetFileInfo stats path when OpRead allows it.
+func (c *Client) GetFileInfo(ctx context.Context, path string) (*client.FileInfo, error) {
+	if err := c.check(ctx, OpRead, "GetFileInfo", path); err != nil {
+		return nil, err
+	}
+	return c.Client.GetFileInfo(ctx, path)
+}
+
+// FileExists checks path when OpRead allows it.
+func (c *Client) FileExists(ctx context.Context, path string) (bool, error) {
+	if err := c.check(ctx, OpRead, "FileExists", path); err != nil {
+		return false, err
+	}
+	return c.Client.FileExists(ctx, path)
+}
+
+// ListDirectory lists path when OpList allows it.
+func (c *Client) ListDirectory(ctx context.Context, path string) ([]*client.FileInfo, error) {
+	if err := c.check(ctx, OpList, "ListDirectory", path); err != nil {
+		return nil, err
+	}
+	return c.Client.ListDirectory(ctx, path)
+}
+
+// WriteFile writes path when OpWrite allows it.
+func (c *Client) WriteFile(ctx context.Context, path string, data io.Reader) error {
+	if err := c.check(ctx, OpWrite, "WriteFile", path); err != nil {
+		return err
+	}
+	return c.Client.WriteFile(ctx, path, data)
+}
+
+// CopyFile copies when OpRead allows srcPath and OpWrite allows dstPath.
+func (c *Client) CopyFile(ctx context.Context, srcPath, dstPath string) error {
+	if err := c.check(ctx, OpRead, "CopyFile", srcPath); err != nil {
+		return err
+	}
+	if err := c.check(ctx, OpWrite, "CopyFile", dstPath); err != nil {
+		return err
+	}
+	return c.Client.CopyFile(ctx, srcPath, dstPath)
+}
+
+// CreateDirectory creates path when OpWrite allows it.
+func (c *Client) CreateDirectory(ctx context.Context, path string) error {
+	if err := c.check(ctx, OpWrite, "CreateDirectory", path); err != nil {
+		return err
+	}
+	return c.Client.CreateDirectory(ctx, path)
+}
+
+// DeleteFile deletes path when OpDelete allows it.
+func (c *Client) DeleteFile(ctx context.Context, path string) error {
+	if err := c.check(ctx, OpDelete, "DeleteFile", path); err != nil {
+		return err
+	}
+	return c.Client.DeleteFile(ctx, path)
+}
+
+// DeleteDirectory deletes path when OpDelete allows it and every path
+// below it.
+func (c *Client) DeleteDirectory(ctx context.Context, path string) error {
+	if err := c.check(ctx, OpDelete, "DeleteDirectory", path); err != nil {
+		return err
+	}
+	if ok, reason := c.allowedTree(path); !ok {
+		return c.deny(ctx, OpDelete, "DeleteDirectory", path, reason)
+	}
+	return c.Client.DeleteDirectory(ctx, path)
+}
+
+// allowedTree reports whether OpDelete allows every path below the
+// directory p, which Allowed has accepted.
+func (c *Client) allowedTree(p string) (bool, string) {
+	rule, ok := c.opts.Rules[OpDelete]
+	if !ok {
+		return true, ""
+	}
+	rel, _ := confine.Clean(p)
+	for _, pattern := range rule.Deny {
+		if mayMatchBelow(pattern, rel) {
+			return false, "a path below may match deny_delete"
+		}
+	}
+	if len(rule.Allow) == 0 {
+		return true, ""
+	}
+	for _, pattern := range rule.Allow {
+		if coversTree(pattern, rel) {
+			return true, ""
+		}
+	}
+	return false, "paths below do not all match allow_delete"
+}
+
+// mayMatchBelow reports whether pattern could match a path below the
+// directory rel. It errs towards true: a base-name pattern may match a
+// file at any depth, and braces are not analysed.
+func mayMatchBelow(pattern, rel string) bool {
+	pattern = strings.TrimPrefix(pattern, "/")
+	if !strings.Contains(pattern, "/") || strings.Contains(pattern, "{") {
+		return true
+	}
+	segs := strings.Split(pattern, "/")
+	for i, name := range pathSegments(rel) {
+		if i >= len(segs) {
+			return false
+		}
+		if segs[i] == "**" {
+			return true
+		}
+		if ok, _ := doublestar.Match(segs[i], name); !ok {
+			return false
+		}
+	}
+	return len(segs) > len(pathSegments(rel))
+}
+
+// coversTree reports whether pattern matches every path below the
+// directory rel: "**", a base-name "*", or "dir/**" for rel or one of its
+// ancestors.
+func coversTree(pattern, rel string) bool {
+	pattern = strings.TrimPrefix(pattern, "/")
+	if pattern == "**" || pattern == "*" {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(pattern, "/**")
+	if !ok {
+		return false
+	}
+	dir := ""
+	for _, name := range pathSegments(rel) {
+		dir = client.JoinPath(dir, name)
+		if ok, _ := doublestar.Match(prefix, dir); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// pathSegments splits a cleaned relative path into its elements; the
+// root has none.
+func pathSegments(rel string) []string {
+	if rel == "." || rel == "" {
+		return nil
+	}
+	return strings.Split(rel, "/")
+}
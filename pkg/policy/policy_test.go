@@ -0,0 +1,237 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"digital.vasic.filesystem/internal/testutil"
+	"digital.vasic.filesystem/pkg/catalog"
+	"digital.vasic.filesystem/pkg/client"
+	"digital.vasic.filesystem/pkg/local"
+)
+
+var _ client.SeekableClient = (*Client)(nil)
+
+// newPolicy wraps l with opts, logging denials to the returned buffer.
+func newPolicy(t *testing.T, l client.Client, opts Options) (*Client, *bytes.Buffer) {
+	t.Helper()
+	var logs bytes.Buffer
+	opts.Logger = slog.New(slog.NewJSONHandler(&logs, nil))
+	c, err := New(l, opts)
+	require.NoError(t, err)
+	return c, &logs
+}
+
+func requireDenied(t *testing.T, err error, op Operation, method, p string) {
+	t.Helper()
+	require.Error(t, err)
+	assert.ErrorIs(t, err, fs.ErrPermission)
+	var perr *PermissionError
+	require.True(t, errors.As(err, &perr), "%v", err)
+	assert.Equal(t, op, perr.Op)
+	assert.Equal(t, method, perr.Method)
+	assert.Equal(t, p, perr.Path)
+}
+
+func TestClient_ReadOnly(t *testing.T) {
+	l, _ := testutil.NewLocal(t)
+	c, logs := newPolicy(t, l, Options{ReadOnly: true, Storage: "nas"})
+	ctx := context.Background()
+	require.NoError(t, l.WriteFile(ctx, "a.txt", strings.NewReader("data")))
+
+	rc, err := c.ReadFile(ctx, "a.txt")
+	require.NoError(t, err)
+	rc.Close()
+	_, err = c.ListDirectory(ctx, "")
+	require.NoError(t, err)
+	exists, err := c.FileExists(ctx, "a.txt")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	requireDenied(t, c.WriteFile(ctx, "b.txt", strings.NewReader("x")), OpWrite, "WriteFile", "b.txt")
+	requireDenied(t, c.CreateDirectory(ctx, "dir"), OpWrite, "CreateDirectory", "dir")
+	requireDenied(t, c.CopyFile(ctx, "a.txt", "c.txt"), OpWrite, "CopyFile", "c.txt")
+	requireDenied(t, c.DeleteFile(ctx, "a.txt"), OpDelete, "DeleteFile", "a.txt")
+	requireDenied(t, c.DeleteDirectory(ctx, "dir"), OpDelete, "DeleteDirectory", "dir")
+
+	exists, err = l.FileExists(ctx, "a.txt")
+	require.NoError(t, err)
+	assert.True(t, exists, "denied calls never reach the wrapped client")
+	exists, err = l.FileExists(ctx, "b.txt")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	assert.Len(t, lines, 5, "every denial is logged")
+	assert.Contains(t, lines[0], `"level":"WARN"`)
+	assert.Contains(t, lines[0], `"storage":"nas"`)
+	assert.Contains(t, lines[0], `"method":"WriteFile"`)
+	assert.Contains(t, lines[0], `"reason":"storage is read-only"`)
+
+	err = c.WriteFile(ctx, "b.txt", strings.NewReader("x"))
+	assert.Equal(t, "nas: WriteFile b.txt: permission denied by policy: storage is read-only", err.Error())
+}
+
+func TestClient_Rules(t *testing.T) {
+	l, _ := testutil.NewLocal(t)
+	c, logs := newPolicy(t, l, Options{Rules: map[Operation]Rule{
+		OpWrite:  {Allow: []string{"/uploads/**"}, Deny: []string{"*.exe"}},
+		OpRead:   {Deny: []string{"secrets/**"}},
+		OpList:   {Deny: []string{"secrets"}},
+		OpDelete: {Allow: []string{"uploads/tmp/**"}},
+	}})
+	ctx := context.Background()
+	require.NoError(t, l.WriteFile(ctx, "secrets/key", strings.NewReader("k")))
+
+	require.NoError(t, c.WriteFile(ctx, "uploads/a/photo.jpg", strings.NewReader("jpg")))
+	require.NoError(t, c.WriteFile(ctx, "/uploads/b.txt", strings.NewReader("b")))
+	require.NoError(t, c.CreateDirectory(ctx, "uploads/tmp"))
+	requireDenied(t, c.WriteFile(ctx, "uploads/setup.exe", strings.NewReader("x")), OpWrite, "WriteFile", "uploads/setup.exe")
+	requireDenied(t, c.WriteFile(ctx, "docs/readme", strings.NewReader("x")), OpWrite, "WriteFile", "docs/readme")
+	requireDenied(t, c.WriteFile(ctx, "uploads/../docs/readme", strings.NewReader("x")), OpWrite, "WriteFile", "uploads/../docs/readme")
+	requireDenied(t, c.WriteFile(ctx, "../outside", strings.NewReader("x")), OpWrite, "WriteFile", "../outside")
+
+	_, err := c.ReadFile(ctx, "secrets/key")
+	requireDenied(t, err, OpRead, "ReadFile", "secrets/key")
+	_, err = c.GetFileInfo(ctx, "secrets/key")
+	requireDenied(t, err, OpRead, "GetFileInfo", "secrets/key")
+	_, err = c.OpenSeekable(ctx, "secrets/key")
+	requireDenied(t, err, OpRead, "OpenSeekable", "secrets/key")
+	_, err = c.ListDirectory(ctx, "secrets")
+	requireDenied(t, err, OpList, "ListDirectory", "secrets")
+	requireDenied(t, c.CopyFile(ctx, "secrets/key", "uploads/key"), OpRead, "CopyFile", "secrets/key")
+	require.NoError(t, c.CopyFile(ctx, "uploads/b.txt", "uploads/tmp/b.txt"))
+
+	files, err := c.ListDirectory(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+	r, err := c.OpenSeekable(ctx, "uploads/b.txt")
+	require.NoError(t, err)
+	r.Close()
+
+	require.NoError(t, c.DeleteFile(ctx, "uploads/tmp/b.txt"))
+	requireDenied(t, c.DeleteFile(ctx, "uploads/b.txt"), OpDelete, "DeleteFile", "uploads/b.txt")
+	assert.Contains(t, logs.String(), `"reason":"path matches deny_write"`)
+	assert.Contains(t, logs.String(), `"reason":"path does not match allow_write"`)
+	assert.Contains(t, logs.String(), `"reason":"path escapes the root"`)
+
+	ok, reason := c.Allowed(OpWrite, "uploads/x")
+	assert.True(t, ok)
+	assert.Empty(t, reason)
+}
+
+func TestClient_DeleteDirectory(t *testing.T) {
+	l, _ := testutil.NewLocal(t)
+	c, _ := newPolicy(t, l, Options{Rules: map[Operation]Rule{
+		OpDelete: {Deny: []string{"data/keep/**"}},
+	}})
+	ctx := context.Background()
+	require.NoError(t, l.WriteFile(ctx, "data/keep/x", strings.NewReader("x")))
+	require.NoError(t, l.WriteFile(ctx, "data/tmp/y", strings.NewReader("y")))
+
+	requireDenied(t, c.DeleteFile(ctx, "data/keep/x"), OpDelete, "DeleteFile", "data/keep/x")
+	requireDenied(t, c.DeleteDirectory(ctx, "data"), OpDelete, "DeleteDirectory", "data")
+	requireDenied(t, c.DeleteDirectory(ctx, "/"), OpDelete, "DeleteDirectory", "/")
+	exists, err := l.FileExists(ctx, "data/keep/x")
+	require.NoError(t, err)
+	assert.True(t, exists, "deleting an ancestor cannot bypass a deny rule")
+	require.NoError(t, c.DeleteDirectory(ctx, "data/tmp"))
+
+	l, _ = testutil.NewLocal(t)
+	c, logs := newPolicy(t, l, Options{Rules: map[Operation]Rule{
+		OpDelete: {Allow: []string{"uploads/tmp/**", "*.cache"}},
+	}})
+	require.NoError(t, l.WriteFile(ctx, "uploads/tmp/a/b", strings.NewReader("b")))
+	require.NoError(t, l.WriteFile(ctx, "x.cache/keep.txt", strings.NewReader("k")))
+	requireDenied(t, c.DeleteDirectory(ctx, "uploads"), OpDelete, "DeleteDirectory", "uploads")
+	requireDenied(t, c.DeleteDirectory(ctx, "x.cache"), OpDelete, "DeleteDirectory", "x.cache")
+	assert.Contains(t, logs.String(), `"reason":"paths below do not all match allow_delete"`)
+	require.NoError(t, c.DeleteDirectory(ctx, "uploads/tmp/a"))
+	require.NoError(t, c.DeleteDirectory(ctx, "uploads/tmp"))
+
+	l, _ = testutil.NewLocal(t)
+	c, _ = newPolicy(t, l, Options{Rules: map[Operation]Rule{OpDelete: {Deny: []string{"*.lock"}}}})
+	require.NoError(t, l.CreateDirectory(ctx, "empty"))
+	requireDenied(t, c.DeleteDirectory(ctx, "empty"), OpDelete, "DeleteDirectory", "empty")
+}
+
+func TestMayMatchBelow(t *testing.T) {
+	tests := []struct {
+		pattern, rel string
+		want         bool
+	}{
+		{"data/keep/**", "data", true},
+		{"data/keep/**", ".", true},
+		{"data/keep/**", "data/tmp", false},
+		{"data/keep/**", "other", false},
+		{"data/*/secret", "data", true},
+		{"data/*/secret", "data/a", true},
+		{"data/*/secret", "data/a/b", false},
+		{"**/secret", "anything/at/all", true},
+		{"/data/keep", "data", true},
+		{"data/keep", "data/keep", false},
+		{"*.exe", "data", true},
+		{"{a,b}/c", "x", true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, mayMatchBelow(tt.pattern, tt.rel), "%s below %s", tt.pattern, tt.rel)
+	}
+}
+
+func TestOptionsFromConfig(t *testing.T) {
+	configs, err := catalog.Parse([]byte(`
+storage.media.protocol=local
+storage.media.settings.read_only=yes
+storage.media.settings.deny_read=secrets/**, *.key
+`), catalog.FormatProperties)
+	require.NoError(t, err)
+	opts, err := OptionsFromConfig(configs[0])
+	require.NoError(t, err)
+	assert.True(t, opts.ReadOnly)
+	assert.Equal(t, "media", opts.Storage)
+	assert.Equal(t, map[Operation]Rule{OpRead: {Deny: []string{"secrets/**", "*.key"}}}, opts.Rules)
+
+	configs, err = catalog.Parse([]byte(`{"storages": [{"id": "inbox", "protocol": "local",
+		"settings": {"allow_write": ["uploads/**"], "deny_delete": ["**"]}}]}`), catalog.FormatJSON)
+	require.NoError(t, err)
+	opts, err = OptionsFromConfig(configs[0])
+	require.NoError(t, err)
+	assert.False(t, opts.ReadOnly)
+	assert.Equal(t, map[Operation]Rule{
+		OpWrite:  {Allow: []string{"uploads/**"}},
+		OpDelete: {Deny: []string{"**"}},
+	}, opts.Rules)
+
+	opts, err = OptionsFromConfig(&client.StorageConfig{ID: "plain"})
+	require.NoError(t, err)
+	assert.Nil(t, opts.Rules)
+
+	_, err = OptionsFromConfig(&client.StorageConfig{Settings: map[string]interface{}{"allow_read": 3}})
+	assert.Error(t, err)
+	_, err = OptionsFromConfig(&client.StorageConfig{Settings: map[string]interface{}{"allow_read": []interface{}{"a", 3}}})
+	assert.Error(t, err)
+}
+
+func TestNew_Errors(t *testing.T) {
+	l := local.NewLocalClient(&local.Config{BasePath: t.TempDir()})
+	_, err := New(l, Options{Rules: map[Operation]Rule{"rename": {}}})
+	assert.Error(t, err)
+	_, err = New(l, Options{Rules: map[Operation]Rule{OpRead: {Allow: []string{"[unclosed"}}}})
+	assert.Error(t, err)
+
+	c, err := New(plainOnly{l}, Options{})
+	require.NoError(t, err)
+	_, err = c.OpenSeekable(context.Background(), "f")
+	assert.ErrorIs(t, err, client.ErrNotSupported)
+}
+
+// plainOnly hides the SeekableClient of the wrapped client.
+type plainOnly struct{ client.Client }
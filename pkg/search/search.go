@@ -0,0 +1,304 @@
+// Package search finds files below a root on any client.Client by glob,
+// size, modification time, type and depth, streaming matches as they are
+// found. Backends implementing client.Searcher are asked first.
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// Type selects the kind of entries a query matches.
+type Type string
+
+const (
+	// TypeAny matches every entry.
+	TypeAny Type = ""
+	// TypeFile matches regular files.
+	TypeFile Type = "file"
+	// TypeDir matches directories.
+	TypeDir Type = "dir"
+	// TypeSymlink matches symbolic links.
+	TypeSymlink Type = "symlink"
+)
+
+// Query selects entries below a root. Zero fields impose no condition.
+type Query struct {
+	// Patterns are doublestar globs ("**" spans directories) matched
+	// against paths relative to the root, without a leading slash. A
+	// pattern without a "/" matches the base name at any depth. An entry
+	// matches when any pattern does.
+	Patterns []string
+	// Exclude skips matching entries; excluded directories are not
+	// descended into.
+	Exclude []string
+	// MinSize and MaxSize bound file sizes in bytes. Setting either
+	// limits matches to regular files.
+	MinSize int64
+	MaxSize int64
+	// ModifiedAfter matches entries modified at or after the time,
+	// ModifiedBefore those modified before it.
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	Type           Type
+	// MaxDepth limits how far below the root entries may lie; 1 means
+	// direct children only.
+	MaxDepth int
+}
+
+// Validate reports malformed patterns and contradictory bounds.
+func (q Query) Validate() error {
+	for _, p := range append(append([]string{}, q.Patterns...), q.Exclude...) {
+		if !doublestar.ValidatePattern(p) {
+			return fmt.Errorf("invalid glob pattern %q", p)
+		}
+	}
+	switch q.Type {
+	case TypeAny, TypeFile, TypeDir, TypeSymlink:
+	default:
+		return fmt.Errorf("unknown entry type %q", q.Type)
+	}
+	if q.MinSize < 0 || q.MaxSize < 0 || q.MaxDepth < 0 {
+		return fmt.Errorf("size and depth limits must not be negative")
+	}
+	if q.MaxSize > 0 && q.MinSize > q.MaxSize {
+		return fmt.Errorf("minimum size %d exceeds maximum size %d", q.MinSize, q.MaxSize)
+	}
+	return nil
+}
+
+// Match is an entry found by Search. Path is relative to the root, joined
+// with "/".
+type Match struct {
+	Path string
+	Info *client.FileInfo
+}
+
+// Search streams the entries below root on c that match q. When every
+// pattern starts with the same literal directories (as in
+// "media/2024/**/*.mkv"), only that subtree is searched; a missing subtree
+// yields nothing. A client.Searcher is asked first and its results are
+// checked against q again; if it reports client.ErrNotSupported the tree
+// is walked with listings instead. Symbolic links are never followed. A
+// failure is yielded once and ends the sequence.
+func Search(ctx context.Context, c client.Client, root string, q Query) iter.Seq2[Match, error] {
+	return func(yield func(Match, error) bool) {
+		if err := q.Validate(); err != nil {
+			yield(Match{}, err)
+			return
+		}
+		prefix := q.prefix()
+		start := client.JoinPath(root, prefix)
+		if prefix != "" {
+			exists, err := c.FileExists(ctx, start)
+			if err != nil {
+				yield(Match{}, fmt.Errorf("failed to check %s: %w", start, err))
+				return
+			}
+			if !exists {
+				return
+			}
+		}
+
+		if s, ok := c.(client.Searcher); ok {
+			done, err := q.server(ctx, s, start, prefix, yield)
+			if err != nil && (done || !errors.Is(err, client.ErrNotSupported)) {
+				yield(Match{}, err)
+				return
+			}
+			if done {
+				return
+			}
+		}
+		if err := q.walk(ctx, c, start, prefix, yield); err != nil && err != errStop {
+			yield(Match{}, err)
+		}
+	}
+}
+
+// server runs the search on s. It reports done once the results have been
+// consumed or the caller stopped; an error before the first result leaves
+// done false so the caller can fall back to walking.
+func (q Query) server(ctx context.Context, s client.Searcher, start, prefix string, yield func(Match, error) bool) (bool, error) {
+	started := false
+	for f, err := range s.Search(ctx, start, q.criteria(prefix)) {
+		if err != nil {
+			if started {
+				return true, err
+			}
+			return false, err
+		}
+		started = true
+		rel := client.JoinPath(prefix, strings.Trim(f.Path, "/"))
+		if q.excludedAncestor(rel) || !q.Match(rel, f) {
+			continue
+		}
+		if !yield(Match{Path: rel, Info: f}, nil) {
+			return true, nil
+		}
+	}
+	return true, nil
+}
+
+// walk lists the tree below dir depth-first. A directory's listing is
+// finished before its subdirectories are visited, so no more than one
+// listing per level is open.
+func (q Query) walk(ctx context.Context, c client.Client, dir, rel string, yield func(Match, error) bool) error {
+	depth := segments(rel)
+	var subdirs []string
+	for f, err := range client.StreamDirectory(ctx, c, dir) {
+		if err != nil {
+			return err
+		}
+		if f.Name == "" || f.Name == "." || f.Name == ".." {
+			continue
+		}
+		child := client.JoinPath(rel, f.Name)
+		if client.MatchPath(q.Exclude, child) {
+			continue
+		}
+		if q.Match(child, f) && !yield(Match{Path: child, Info: f}, nil) {
+			return errStop
+		}
+		if f.IsDir && f.LinkType != client.LinkSymlink && (q.MaxDepth == 0 || depth+1 < q.MaxDepth) {
+			subdirs = append(subdirs, f.Name)
+		}
+	}
+	for _, name := range subdirs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := q.walk(ctx, c, client.JoinPath(dir, name), client.JoinPath(rel, name), yield); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errStop unwinds a walk the caller stopped; Search never yields it.
+var errStop = errors.New("search stopped")
+
+// Match reports whether the entry f at rel (relative to the root)
+// satisfies the patterns, filters and depth of q. Exclusions of its
+// ancestors are not checked.
+func (q Query) Match(rel string, f *client.FileInfo) bool {
+	if q.MaxDepth > 0 && segments(rel) > q.MaxDepth {
+		return false
+	}
+	if client.MatchPath(q.Exclude, rel) {
+		return false
+	}
+	if len(q.Patterns) > 0 && !client.MatchPath(q.Patterns, rel) {
+		return false
+	}
+	symlink := f.LinkType == client.LinkSymlink
+	switch q.Type {
+	case TypeFile:
+		if f.IsDir || symlink {
+			return false
+		}
+	case TypeDir:
+		if !f.IsDir || symlink {
+			return false
+		}
+	case TypeSymlink:
+		if !symlink {
+			return false
+		}
+	}
+	if q.MinSize > 0 || q.MaxSize > 0 {
+		if f.IsDir || symlink || f.Size < q.MinSize || (q.MaxSize > 0 && f.Size > q.MaxSize) {
+			return false
+		}
+	}
+	if !q.ModifiedAfter.IsZero() && f.ModTime.Before(q.ModifiedAfter) {
+		return false
+	}
+	if !q.ModifiedBefore.IsZero() && !f.ModTime.Before(q.ModifiedBefore) {
+		return false
+	}
+	return true
+}
+
+// excludedAncestor reports whether a directory above rel is excluded.
+func (q Query) excludedAncestor(rel string) bool {
+	for dir := path.Dir(rel); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if client.MatchPath(q.Exclude, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// criteria translates q for a Searcher rooted at prefix below the root.
+// Only base-name patterns of "*", "?" and literals are passed on; anything
+// else is checked on the results.
+func (q Query) criteria(prefix string) client.SearchCriteria {
+	c := client.SearchCriteria{
+		MinSize:        q.MinSize,
+		MaxSize:        q.MaxSize,
+		ModifiedAfter:  q.ModifiedAfter,
+		ModifiedBefore: q.ModifiedBefore,
+		FilesOnly:      q.Type == TypeFile || q.MinSize > 0 || q.MaxSize > 0,
+		DirsOnly:       q.Type == TypeDir,
+	}
+	if q.MaxDepth > 0 {
+		c.MaxDepth = q.MaxDepth - segments(prefix)
+	}
+	for _, p := range q.Patterns {
+		if strings.ContainsAny(p, "/[{\\") || strings.Contains(p, "**") {
+			c.Names = nil
+			break
+		}
+		c.Names = append(c.Names, p)
+	}
+	return c
+}
+
+// prefix returns the literal leading directories shared by all patterns,
+// or "" when a pattern may match anywhere.
+func (q Query) prefix() string {
+	var common []string
+	for i, p := range q.Patterns {
+		p = strings.TrimPrefix(p, "/")
+		if !strings.Contains(p, "/") {
+			return ""
+		}
+		parts := strings.Split(p, "/")
+		parts = parts[:len(parts)-1]
+		var literal []string
+		for _, part := range parts {
+			if strings.ContainsAny(part, "*?[{\\") {
+				break
+			}
+			literal = append(literal, part)
+		}
+		if i == 0 {
+			common = literal
+			continue
+		}
+		n := 0
+		for n < len(common) && n < len(literal) && common[n] == literal[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	return strings.Join(common, "/")
+}
+
+// segments counts the elements of a relative path.
+func segments(rel string) int {
+	if rel == "" {
+		return 0
+	}
+	return strings.Count(rel, "/") + 1
+}
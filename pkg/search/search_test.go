@@ -0,0 +1,238 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"digital.vasic.filesystem/internal/testutil"
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// old is the modification time of every file writeTree creates except
+// the recent ones.
+var old = time.Now().Add(-72 * time.Hour).Truncate(time.Second)
+
+// writeTree creates:
+//
+//	a.mkv (10)            recent
+//	notes.txt (1)
+//	media/2024/b.mkv (100)
+//	media/2024/c.MKV (1000)
+//	media/2025/d.mkv (5)  recent
+//	media/cache/e.mkv (1)
+//	link -> media
+func writeTree(t *testing.T, dir string) {
+	t.Helper()
+	files := map[string]int{
+		"a.mkv": 10, "notes.txt": 1, "media/2024/b.mkv": 100, "media/2024/c.MKV": 1000,
+		"media/2025/d.mkv": 5, "media/cache/e.mkv": 1,
+	}
+	for name, size := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, os.WriteFile(p, make([]byte, size), 0644))
+		mtime := old
+		if name == "a.mkv" || name == "media/2025/d.mkv" {
+			mtime = time.Now()
+		}
+		require.NoError(t, os.Chtimes(p, mtime, mtime))
+	}
+	if err := os.Symlink("media", filepath.Join(dir, "link")); err != nil {
+		t.Skip("symlinks not supported on this filesystem")
+	}
+}
+
+// paths collects the sorted match paths of seq, failing on errors.
+func paths(t *testing.T, seq iter.Seq2[Match, error]) []string {
+	t.Helper()
+	var out []string
+	for m, err := range seq {
+		require.NoError(t, err)
+		out = append(out, m.Path)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestSearch(t *testing.T) {
+	c, dir := testutil.NewLocal(t)
+	writeTree(t, dir)
+	ctx := context.Background()
+	dayAgo := time.Now().Add(-24 * time.Hour)
+
+	tests := []struct {
+		name string
+		q    Query
+		want []string
+	}{
+		{"base name anywhere", Query{Patterns: []string{"*.mkv"}},
+			[]string{"a.mkv", "media/2024/b.mkv", "media/2025/d.mkv", "media/cache/e.mkv"}},
+		{"several patterns", Query{Patterns: []string{"*.mkv", "*.MKV"}, Exclude: []string{"cache"}},
+			[]string{"a.mkv", "media/2024/b.mkv", "media/2024/c.MKV", "media/2025/d.mkv"}},
+		{"path glob", Query{Patterns: []string{"media/**/*.mkv"}},
+			[]string{"media/2024/b.mkv", "media/2025/d.mkv", "media/cache/e.mkv"}},
+		{"size", Query{MinSize: 5, MaxSize: 100},
+			[]string{"a.mkv", "media/2024/b.mkv", "media/2025/d.mkv"}},
+		{"modified in the last day", Query{ModifiedAfter: dayAgo, Type: TypeFile},
+			[]string{"a.mkv", "media/2025/d.mkv"}},
+		{"modified before", Query{Patterns: []string{"*.mkv"}, ModifiedBefore: dayAgo},
+			[]string{"media/2024/b.mkv", "media/cache/e.mkv"}},
+		{"directories", Query{Type: TypeDir},
+			[]string{"media", "media/2024", "media/2025", "media/cache"}},
+		{"symlinks", Query{Type: TypeSymlink}, []string{"link"}},
+		{"depth", Query{MaxDepth: 2, Type: TypeFile}, []string{"a.mkv", "notes.txt"}},
+		{"depth of directories", Query{MaxDepth: 2, Type: TypeDir},
+			[]string{"media", "media/2024", "media/2025", "media/cache"}},
+		{"missing subtree", Query{Patterns: []string{"video/**/*.mkv"}}, nil},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, paths(t, Search(ctx, c, "", tt.q)), tt.name)
+	}
+
+	assert.Equal(t, []string{"2024/b.mkv", "2025/d.mkv", "cache/e.mkv"},
+		paths(t, Search(ctx, c, "media", Query{Patterns: []string{"*.mkv"}})), "paths are relative to the root")
+}
+
+// recorder records the directories listed through it.
+type recorder struct {
+	client.Client
+	mu     sync.Mutex
+	listed []string
+}
+
+func (r *recorder) ListDirectory(ctx context.Context, path string) ([]*client.FileInfo, error) {
+	r.mu.Lock()
+	r.listed = append(r.listed, path)
+	r.mu.Unlock()
+	return r.Client.ListDirectory(ctx, path)
+}
+
+func TestSearch_PrefixNarrowing(t *testing.T) {
+	c, dir := testutil.NewLocal(t)
+	writeTree(t, dir)
+	r := &recorder{Client: c}
+
+	got := paths(t, Search(context.Background(), r, "", Query{Patterns: []string{"media/2024/*.mkv", "media/2025/*.mkv"}}))
+	assert.Equal(t, []string{"media/2024/b.mkv", "media/2025/d.mkv"}, got)
+	assert.NotContains(t, r.listed, "", "the root is not listed")
+	assert.Contains(t, r.listed, "media")
+}
+
+func TestSearch_Stop(t *testing.T) {
+	c, dir := testutil.NewLocal(t)
+	writeTree(t, dir)
+
+	n := 0
+	for _, err := range Search(context.Background(), c, "", Query{Patterns: []string{"*.mkv"}}) {
+		require.NoError(t, err)
+		if n++; n == 2 {
+			break
+		}
+	}
+	assert.Equal(t, 2, n)
+}
+
+func TestSearch_Errors(t *testing.T) {
+	c, dir := testutil.NewLocal(t)
+	writeTree(t, dir)
+	ctx := context.Background()
+
+	for _, q := range []Query{
+		{Patterns: []string{"[unclosed"}},
+		{Type: "socket"},
+		{MinSize: 10, MaxSize: 5},
+		{MaxDepth: -1},
+	} {
+		for _, err := range Search(ctx, c, "", q) {
+			assert.Error(t, err, "%+v", q)
+		}
+	}
+
+	var errs []error
+	for _, err := range Search(ctx, c, "missing", Query{}) {
+		errs = append(errs, err)
+	}
+	require.Len(t, errs, 1)
+	assert.Error(t, errs[0])
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	var last error
+	for _, err := range Search(cancelled, c, "", Query{}) {
+		last = err
+	}
+	assert.ErrorIs(t, last, context.Canceled)
+}
+
+// fakeSearcher answers Search with fixed results or an error.
+type fakeSearcher struct {
+	client.Client
+	results  []*client.FileInfo
+	err      error
+	criteria []client.SearchCriteria
+	roots    []string
+}
+
+func (f *fakeSearcher) Search(ctx context.Context, root string, criteria client.SearchCriteria) iter.Seq2[*client.FileInfo, error] {
+	f.roots = append(f.roots, root)
+	f.criteria = append(f.criteria, criteria)
+	return func(yield func(*client.FileInfo, error) bool) {
+		for _, r := range f.results {
+			if !yield(r, nil) {
+				return
+			}
+		}
+		if f.err != nil {
+			yield(nil, f.err)
+		}
+	}
+}
+
+func TestSearch_Searcher(t *testing.T) {
+	c, dir := testutil.NewLocal(t)
+	writeTree(t, dir)
+	ctx := context.Background()
+	now := time.Now()
+
+	s := &fakeSearcher{Client: c, results: []*client.FileInfo{
+		{Name: "x.mkv", Path: "2024/x.mkv", Size: 50, ModTime: now},
+		{Name: "y.txt", Path: "2024/y.txt", Size: 50, ModTime: now},
+		{Name: "z.mkv", Path: "cache/z.mkv", Size: 50, ModTime: now},
+		{Name: "big.mkv", Path: "2024/big.mkv", Size: 5000, ModTime: now},
+	}}
+	q := Query{Patterns: []string{"media/**/*.mkv"}, Exclude: []string{"cache"}, MaxSize: 1000, MaxDepth: 4}
+	got := paths(t, Search(ctx, s, "", q))
+	assert.Equal(t, []string{"media/2024/x.mkv"}, got, "server results are checked again")
+	require.Len(t, s.criteria, 1)
+	assert.Equal(t, []string{"media"}, s.roots, "the search is narrowed to the literal prefix")
+	assert.Equal(t, client.SearchCriteria{MaxSize: 1000, FilesOnly: true, MaxDepth: 3}, s.criteria[0],
+		"path globs are not passed on")
+
+	s = &fakeSearcher{Client: c}
+	Search(ctx, s, "", Query{Patterns: []string{"*.mkv", "b?.MKV"}, Type: TypeDir})(func(Match, error) bool { return true })
+	assert.Equal(t, []string{"*.mkv", "b?.MKV"}, s.criteria[0].Names)
+	assert.True(t, s.criteria[0].DirsOnly)
+
+	unsupported := &fakeSearcher{Client: c, err: client.ErrNotSupported}
+	got = paths(t, Search(ctx, unsupported, "", Query{Patterns: []string{"*.MKV"}}))
+	assert.Equal(t, []string{"media/2024/c.MKV"}, got, "falls back to walking")
+
+	failing := &fakeSearcher{Client: c, results: []*client.FileInfo{{Name: "x.mkv", Path: "x.mkv"}}, err: errors.New("connection reset")}
+	var errs []error
+	for _, err := range Search(ctx, failing, "", Query{}) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	assert.Len(t, errs, 1, "failures after the first result are reported")
+}
@@ -0,0 +1,131 @@
+package smb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hirochachacha/go-smb2"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// metadataStream is the alternate data stream holding a file's metadata as
+// a JSON object. go-smb2 cannot enumerate streams, so one stream holds all
+// keys.
+const metadataStream = ":filesystem.metadata"
+
+// statusObjectNameInvalid is the NTSTATUS returned for stream names by
+// shares without stream support.
+const statusObjectNameInvalid = 0xC0000033
+
+// GetMetadata reads the metadata stream of path.
+func (c *Client) GetMetadata(ctx context.Context, path string) (map[string]string, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+	meta, err := c.readMetadata(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata of SMB file %s: %w", path, err)
+	}
+	return meta, nil
+}
+
+// SetMetadata merges meta into the metadata stream of path.
+func (c *Client) SetMetadata(ctx context.Context, path string, meta map[string]string) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	for key := range meta {
+		if err := client.ValidMetadataKey(key); err != nil {
+			return err
+		}
+	}
+	current, err := c.readMetadata(path)
+	if err != nil {
+		return fmt.Errorf("failed to read metadata of SMB file %s: %w", path, err)
+	}
+	for key, value := range meta {
+		current[key] = value
+	}
+	if err := c.writeMetadata(path, current); err != nil {
+		return fmt.Errorf("failed to set metadata of SMB file %s: %w", path, err)
+	}
+	return nil
+}
+
+// DeleteMetadata removes keys from the metadata stream of path, and the
+// stream itself once it is empty.
+func (c *Client) DeleteMetadata(ctx context.Context, path string, keys ...string) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	current, err := c.readMetadata(path)
+	if err != nil {
+		return fmt.Errorf("failed to read metadata of SMB file %s: %w", path, err)
+	}
+	for _, key := range keys {
+		delete(current, key)
+	}
+	if err := c.writeMetadata(path, current); err != nil {
+		return fmt.Errorf("failed to delete metadata of SMB file %s: %w", path, err)
+	}
+	return nil
+}
+
+// readMetadata decodes the metadata stream; a missing stream is empty.
+func (c *Client) readMetadata(path string) (map[string]string, error) {
+	meta := make(map[string]string)
+	f, err := c.share.Open(path + metadataStream)
+	if errors.Is(err, os.ErrNotExist) {
+		if _, err := c.share.Stat(path); err != nil {
+			return nil, err
+		}
+		return meta, nil
+	}
+	if err != nil {
+		return nil, streamError(err)
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(&meta); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// writeMetadata replaces the metadata stream with meta, removing it when
+// meta is empty.
+func (c *Client) writeMetadata(path string, meta map[string]string) error {
+	if len(meta) == 0 {
+		err := c.share.Remove(path + metadataStream)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return streamError(err)
+		}
+		return nil
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	f, err := c.share.Create(path + metadataStream)
+	if err != nil {
+		return streamError(err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// streamError marks shares without alternate data streams as unsupported.
+func streamError(err error) error {
+	var re *smb2.ResponseError
+	if errors.As(err, &re) && re.Code == statusObjectNameInvalid {
+		return fmt.Errorf("%w: share has no alternate data streams: %w", client.ErrNotSupported, err)
+	}
+	return err
+}
@@ -3,14 +3,19 @@ package smb
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"iter"
 	"net"
+	"os"
+	"sort"
 	"time"
 
 	"github.com/hirochachacha/go-smb2"
 
 	"digital.vasic.filesystem/pkg/client"
+	"digital.vasic.filesystem/pkg/watch"
 )
 
 // defaultDialTimeout bounds the TCP connect phase of Connect() so
@@ -26,6 +31,15 @@ type Config struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 	Domain   string `json:"domain"`
+	// AtomicWrites makes WriteFile behave like WriteFileAtomic.
+	AtomicWrites bool `json:"atomic_writes,omitempty"`
+}
+
+// MarshalJSON encodes the configuration with the password redacted.
+func (c Config) MarshalJSON() ([]byte, error) {
+	type plain Config
+	c.Password = client.RedactSecret(c.Password)
+	return json.Marshal(plain(c))
 }
 
 // Client implements client.Client for SMB protocol.
@@ -158,6 +172,9 @@ func (c *Client) WriteFile(ctx context.Context, path string, data io.Reader) err
 	if !c.IsConnected() {
 		return fmt.Errorf("not connected")
 	}
+	if c.config.AtomicWrites {
+		return c.WriteFileAtomic(ctx, path, data)
+	}
 	file, err := c.share.Create(path)
 	if err != nil {
 		return fmt.Errorf("failed to create SMB file %s: %w", path, err)
@@ -172,6 +189,99 @@ func (c *Client) WriteFile(ctx context.Context, path string, data io.Reader) err
 	return nil
 }
 
+// Create opens a file on the share for writing, truncating it if it exists.
+func (c *Client) Create(ctx context.Context, path string) (io.WriteCloser, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+	file, err := c.share.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SMB file %s: %w", path, err)
+	}
+	return file, nil
+}
+
+// OpenAppend opens a file on the share for writing at its end, creating it
+// if missing.
+func (c *Client) OpenAppend(ctx context.Context, path string) (io.WriteCloser, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+	file, err := c.share.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SMB file %s for appending: %w", path, err)
+	}
+	return file, nil
+}
+
+// WriteFileAtomic writes data to a hidden temporary file next to path,
+// flushes it and renames it into place. go-smb2 cannot rename over an
+// existing file, so an old file is first renamed aside and removed after
+// the rename: readers may briefly find no file, but never a partial one.
+func (c *Client) WriteFileAtomic(ctx context.Context, path string, data io.Reader) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	tmpPath := client.AtomicTempName(path)
+	file, err := c.share.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create SMB file %s: %w", tmpPath, err)
+	}
+
+	_, err = io.Copy(file, data)
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = c.share.Remove(tmpPath)
+		return fmt.Errorf("failed to write SMB file %s: %w", path, err)
+	}
+
+	return replaceFile(c.share, tmpPath, path)
+}
+
+// renamer is the part of *smb2.Share used by replaceFile.
+type renamer interface {
+	Stat(name string) (os.FileInfo, error)
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+}
+
+// replaceFile renames tmpPath over path. An existing path is moved aside
+// first and restored if the rename fails, so a failure never loses both
+// versions; when even the restore fails, the error names where each is.
+func replaceFile(share renamer, tmpPath, path string) error {
+	oldPath := ""
+	if _, err := share.Stat(path); err == nil {
+		oldPath = client.AtomicTempName(path)
+		if err := share.Rename(path, oldPath); err != nil {
+			_ = share.Remove(tmpPath)
+			return fmt.Errorf("failed to replace SMB file %s: %w", path, err)
+		}
+	}
+	if err := share.Rename(tmpPath, path); err != nil {
+		if oldPath == "" {
+			_ = share.Remove(tmpPath)
+			return fmt.Errorf("failed to rename SMB file into %s: %w", path, err)
+		}
+		if restoreErr := share.Rename(oldPath, path); restoreErr != nil {
+			return fmt.Errorf("failed to rename SMB file into %s (new data kept in %s, old data in %s): %w", path, tmpPath, oldPath, err)
+		}
+		_ = share.Remove(tmpPath)
+		return fmt.Errorf("failed to rename SMB file into %s: %w", path, err)
+	}
+	if oldPath != "" {
+		_ = share.Remove(oldPath)
+	}
+	return nil
+}
+
 // GetFileInfo gets information about a file.
 func (c *Client) GetFileInfo(ctx context.Context, path string) (*client.FileInfo, error) {
 	if !c.IsConnected() {
@@ -182,39 +292,80 @@ func (c *Client) GetFileInfo(ctx context.Context, path string) (*client.FileInfo
 		return nil, fmt.Errorf("failed to stat SMB file %s: %w", path, err)
 	}
 
-	return &client.FileInfo{
+	info := &client.FileInfo{
 		Name:    stat.Name(),
 		Size:    stat.Size(),
 		ModTime: stat.ModTime(),
 		IsDir:   stat.IsDir(),
 		Mode:    stat.Mode(),
 		Path:    path,
-	}, nil
+	}
+	if lstat, err := c.share.Lstat(path); err == nil && lstat.Mode()&os.ModeSymlink != 0 {
+		c.linkInfo(info)
+	}
+	return info, nil
 }
 
-// ListDirectory lists files in a directory.
+// listBatch is the number of directory entries read per call while
+// streaming a listing.
+const listBatch = 1024
+
+// ListDirectory lists files in a directory, sorted by name.
 func (c *Client) ListDirectory(ctx context.Context, path string) ([]*client.FileInfo, error) {
-	if !c.IsConnected() {
-		return nil, fmt.Errorf("not connected")
-	}
-	entries, err := c.share.ReadDir(path)
+	files, err := client.CollectFiles(c.StreamDirectory(ctx, path))
 	if err != nil {
-		return nil, fmt.Errorf("failed to list SMB directory %s: %w", path, err)
+		return nil, err
 	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
 
-	var files []*client.FileInfo
-	for _, entry := range entries {
-		files = append(files, &client.FileInfo{
-			Name:    entry.Name(),
-			Size:    entry.Size(),
-			ModTime: entry.ModTime(),
-			IsDir:   entry.IsDir(),
-			Mode:    entry.Mode(),
-			Path:    path + "/" + entry.Name(),
-		})
+// StreamDirectory yields the entries of a directory in server order. go-smb2
+// fetches QUERY_DIRECTORY pages as listBatch entries are requested.
+func (c *Client) StreamDirectory(ctx context.Context, path string) iter.Seq2[*client.FileInfo, error] {
+	return func(yield func(*client.FileInfo, error) bool) {
+		if !c.IsConnected() {
+			yield(nil, fmt.Errorf("not connected"))
+			return
+		}
+		dir, err := c.share.Open(path)
+		if err != nil {
+			yield(nil, fmt.Errorf("failed to list SMB directory %s: %w", path, err))
+			return
+		}
+		defer dir.Close()
+
+		for {
+			entries, err := dir.Readdir(listBatch)
+			for _, entry := range entries {
+				fi := &client.FileInfo{
+					Name:    entry.Name(),
+					Size:    entry.Size(),
+					ModTime: entry.ModTime(),
+					IsDir:   entry.IsDir(),
+					Mode:    entry.Mode(),
+					Path:    path + "/" + entry.Name(),
+				}
+				if entry.Mode()&os.ModeSymlink != 0 {
+					c.linkInfo(fi)
+				}
+				if !yield(fi, nil) {
+					return
+				}
+			}
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(nil, fmt.Errorf("failed to list SMB directory %s: %w", path, err))
+				return
+			}
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+		}
 	}
-
-	return files, nil
 }
 
 // FileExists checks if a file exists.
@@ -293,14 +444,137 @@ func (c *Client) CopyFile(ctx context.Context, srcPath, dstPath string) error {
 	return nil
 }
 
+// Chmod maps mode onto the read-only attribute, the only permission SMB
+// exposes: a mode without owner write permission makes the file read-only.
+func (c *Client) Chmod(ctx context.Context, path string, mode os.FileMode) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	if err := c.share.Chmod(path, mode); err != nil {
+		return fmt.Errorf("failed to chmod SMB file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Chtimes sets the access and write times with SMB2 SET_INFO. A zero time
+// keeps the current value, which is read first.
+func (c *Client) Chtimes(ctx context.Context, path string, atime, mtime time.Time) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	if atime.IsZero() || mtime.IsZero() {
+		stat, err := c.share.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to stat SMB file %s: %w", path, err)
+		}
+		if fs, ok := stat.Sys().(*smb2.FileStat); ok {
+			if atime.IsZero() {
+				atime = fs.LastAccessTime
+			}
+			if mtime.IsZero() {
+				mtime = fs.LastWriteTime
+			}
+		}
+	}
+	if err := c.share.Chtimes(path, atime, mtime); err != nil {
+		return fmt.Errorf("failed to set times of SMB file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Chown returns client.ErrNotSupported; SMB ownership lives in security
+// descriptors, which go-smb2 does not expose.
+func (c *Client) Chown(ctx context.Context, path string, uid, gid int) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	return fmt.Errorf("failed to chown SMB file %s: %w", path, client.ErrNotSupported)
+}
+
+// GetSpace reports the volume behind path from FileFsFullSizeInformation.
+// Free is the caller-available figure, which honours NTFS quotas. path must
+// be a directory.
+func (c *Client) GetSpace(ctx context.Context, path string) (*client.SpaceInfo, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+	fi, err := c.share.Statfs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query free space of SMB path %s: %w", path, err)
+	}
+	return fsSpace(fi), nil
+}
+
+// fsSpace converts allocation units to bytes. go-smb2 reports bytes per
+// sector as BlockSize and sectors per allocation unit as FragmentSize.
+func fsSpace(fi smb2.FileFsInfo) *client.SpaceInfo {
+	unit := int64(fi.BlockSize() * fi.FragmentSize())
+	total := int64(fi.TotalBlockCount()) * unit
+	return &client.SpaceInfo{
+		Total: total,
+		Free:  int64(fi.AvailableBlockCount()) * unit,
+		Used:  total - int64(fi.FreeBlockCount())*unit,
+	}
+}
+
+// Symlink creates a symlink reparse point at path pointing to target. Samba
+// only accepts this with reparse point support enabled on the share.
+func (c *Client) Symlink(ctx context.Context, target, path string) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	if err := c.share.Symlink(target, path); err != nil {
+		return fmt.Errorf("failed to create SMB symlink %s: %w", path, err)
+	}
+	return nil
+}
+
+// Readlink returns the target of the symlink reparse point at path.
+func (c *Client) Readlink(ctx context.Context, path string) (string, error) {
+	if !c.IsConnected() {
+		return "", fmt.Errorf("not connected")
+	}
+	target, err := c.share.Readlink(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read SMB symlink %s: %w", path, err)
+	}
+	return target, nil
+}
+
+// Link returns client.ErrNotSupported; go-smb2 cannot create hard links.
+func (c *Client) Link(ctx context.Context, target, path string) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	return fmt.Errorf("failed to link SMB file %s: %w", path, client.ErrNotSupported)
+}
+
+// linkInfo marks info as a symlink and reads its target, which is left
+// empty for reparse points go-smb2 cannot decode.
+func (c *Client) linkInfo(info *client.FileInfo) {
+	info.LinkType = client.LinkSymlink
+	info.LinkTarget, _ = c.share.Readlink(info.Path)
+}
+
+// Watch reports changes below path by polling; go-smb2 does not expose
+// SMB2 CHANGE_NOTIFY.
+func (c *Client) Watch(ctx context.Context, path string, recursive bool) (<-chan client.Event, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+	return watch.Poll(ctx, c, path, recursive, watch.DefaultPollInterval)
+}
+
 // GetProtocol returns the protocol name.
 func (c *Client) GetProtocol() string {
 	return "smb"
 }
 
-// GetConfig returns the SMB configuration.
+// GetConfig returns a copy of the SMB configuration with the password redacted.
 func (c *Client) GetConfig() interface{} {
-	return c.config
+	config := *c.config
+	config.Password = client.RedactSecret(config.Password)
+	return &config
 }
 
 // isNotExistError checks if an error indicates that a file does not exist.
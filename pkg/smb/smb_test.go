@@ -2,17 +2,33 @@ package smb
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/hirochachacha/go-smb2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"digital.vasic.filesystem/pkg/client"
 )
 
-// Verify SMB Client implements client.Client interface.
-var _ client.Client = (*Client)(nil)
+// Verify SMB Client implements the client.Client and client.Watcher interfaces.
+var (
+	_ client.Client            = (*Client)(nil)
+	_ client.Watcher           = (*Client)(nil)
+	_ client.WritableClient    = (*Client)(nil)
+	_ client.AtomicWriter      = (*Client)(nil)
+	_ client.AttributeSetter   = (*Client)(nil)
+	_ client.SpaceReporter     = (*Client)(nil)
+	_ client.DirectoryStreamer = (*Client)(nil)
+	_ client.MetadataStore     = (*Client)(nil)
+	_ client.Linker            = (*Client)(nil)
+)
 
 func TestNewSMBClient(t *testing.T) {
 	config := &Config{
@@ -46,7 +62,20 @@ func TestSMBClient_GetConfig(t *testing.T) {
 		Domain:   "EXAMPLE",
 	}
 	c := NewSMBClient(config)
-	assert.Equal(t, config, c.GetConfig())
+	got, ok := c.GetConfig().(*Config)
+	require.True(t, ok)
+	assert.Equal(t, client.RedactedSecret, got.Password)
+	assert.Equal(t, "secret", config.Password, "original config must not be modified")
+	expected := *config
+	expected.Password = client.RedactedSecret
+	assert.Equal(t, &expected, got)
+}
+
+func TestConfig_MarshalJSON_RedactsPassword(t *testing.T) {
+	data, err := json.Marshal(Config{Username: "admin", Password: "s3cret"})
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "s3cret")
+	assert.Contains(t, string(data), client.RedactedSecret)
 }
 
 func TestSMBClient_IsConnected_NotConnected(t *testing.T) {
@@ -205,3 +234,154 @@ func TestSMBConfig_Fields(t *testing.T) {
 	assert.Equal(t, "s3cret", config.Password)
 	assert.Equal(t, "CORP", config.Domain)
 }
+
+func TestSMBClient_Create_NotConnected(t *testing.T) {
+	c := NewSMBClient(&Config{})
+	w, err := c.Create(context.Background(), "test.txt")
+	assert.Error(t, err)
+	assert.Nil(t, w)
+	assert.Contains(t, err.Error(), "not connected")
+}
+
+func TestSMBClient_OpenAppend_NotConnected(t *testing.T) {
+	c := NewSMBClient(&Config{})
+	w, err := c.OpenAppend(context.Background(), "test.txt")
+	assert.Error(t, err)
+	assert.Nil(t, w)
+	assert.Contains(t, err.Error(), "not connected")
+}
+
+func TestSMBClient_WriteFileAtomic_NotConnected(t *testing.T) {
+	c := NewSMBClient(&Config{})
+	err := c.WriteFileAtomic(context.Background(), "test.txt", strings.NewReader("data"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not connected")
+}
+
+// memShare is an in-memory renamer whose renames can be made to fail.
+type memShare struct {
+	files      map[string]string
+	failRename func(oldpath, newpath string) bool
+}
+
+func (m *memShare) Stat(name string) (os.FileInfo, error) {
+	if _, ok := m.files[name]; !ok {
+		return nil, os.ErrNotExist
+	}
+	return nil, nil
+}
+
+func (m *memShare) Rename(oldpath, newpath string) error {
+	if m.failRename != nil && m.failRename(oldpath, newpath) {
+		return errors.New("sharing violation")
+	}
+	data, ok := m.files[oldpath]
+	if !ok {
+		return os.ErrNotExist
+	}
+	if _, exists := m.files[newpath]; exists {
+		return os.ErrExist
+	}
+	delete(m.files, oldpath)
+	m.files[newpath] = data
+	return nil
+}
+
+func (m *memShare) Remove(name string) error {
+	delete(m.files, name)
+	return nil
+}
+
+func TestReplaceFile(t *testing.T) {
+	share := &memShare{files: map[string]string{"a.txt": "old", ".a.txt.tmp": "new"}}
+	require.NoError(t, replaceFile(share, ".a.txt.tmp", "a.txt"))
+	assert.Equal(t, map[string]string{"a.txt": "new"}, share.files)
+
+	share = &memShare{files: map[string]string{".b.txt.tmp": "new"}}
+	require.NoError(t, replaceFile(share, ".b.txt.tmp", "b.txt"))
+	assert.Equal(t, map[string]string{"b.txt": "new"}, share.files)
+
+	// The new file cannot be renamed into place: the old one is restored.
+	share = &memShare{
+		files:      map[string]string{"a.txt": "old", ".a.txt.tmp": "new"},
+		failRename: func(oldpath, newpath string) bool { return oldpath == ".a.txt.tmp" },
+	}
+	err := replaceFile(share, ".a.txt.tmp", "a.txt")
+	assert.ErrorContains(t, err, "sharing violation")
+	assert.Equal(t, map[string]string{"a.txt": "old"}, share.files)
+
+	// Nor can the old one be restored: both are kept and named.
+	share = &memShare{
+		files:      map[string]string{"a.txt": "old", ".a.txt.tmp": "new"},
+		failRename: func(oldpath, newpath string) bool { return newpath == "a.txt" },
+	}
+	err = replaceFile(share, ".a.txt.tmp", "a.txt")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), ".a.txt.tmp")
+	assert.Len(t, share.files, 2, "neither version is deleted")
+	for name, data := range share.files {
+		if data == "old" {
+			assert.Contains(t, err.Error(), name)
+		}
+	}
+}
+
+func TestSMBClient_Links_NotConnected(t *testing.T) {
+	c := NewSMBClient(&Config{})
+	ctx := context.Background()
+	assert.EqualError(t, c.Symlink(ctx, "a", "b"), "not connected")
+	_, err := c.Readlink(ctx, "b")
+	assert.EqualError(t, err, "not connected")
+	assert.EqualError(t, c.Link(ctx, "a", "b"), "not connected")
+}
+
+func TestSMBClient_Attributes_NotConnected(t *testing.T) {
+	c := NewSMBClient(&Config{})
+	ctx := context.Background()
+	assert.EqualError(t, c.Chmod(ctx, "a", 0644), "not connected")
+	assert.EqualError(t, c.Chtimes(ctx, "a", time.Time{}, time.Now()), "not connected")
+	assert.EqualError(t, c.Chown(ctx, "a", 0, 0), "not connected")
+}
+
+func TestSMBClient_Metadata_NotConnected(t *testing.T) {
+	c := NewSMBClient(&Config{})
+	ctx := context.Background()
+	_, err := c.GetMetadata(ctx, "a")
+	assert.EqualError(t, err, "not connected")
+	assert.EqualError(t, c.SetMetadata(ctx, "a", map[string]string{"k": "v"}), "not connected")
+	assert.EqualError(t, c.DeleteMetadata(ctx, "a", "k"), "not connected")
+}
+
+func TestStreamError(t *testing.T) {
+	err := streamError(&smb2.ResponseError{Code: statusObjectNameInvalid})
+	assert.ErrorIs(t, err, client.ErrNotSupported)
+
+	other := errors.New("boom")
+	assert.Equal(t, other, streamError(other))
+}
+
+func TestSMBClient_GetSpace_NotConnected(t *testing.T) {
+	c := NewSMBClient(&Config{})
+	_, err := c.GetSpace(context.Background(), "")
+	assert.EqualError(t, err, "not connected")
+}
+
+// fsInfo is a FileFsFullSizeInformation as go-smb2 exposes it.
+type fsInfo struct{ bytesPerSector, sectorsPerUnit, total, free, avail uint64 }
+
+func (f fsInfo) BlockSize() uint64           { return f.bytesPerSector }
+func (f fsInfo) FragmentSize() uint64        { return f.sectorsPerUnit }
+func (f fsInfo) TotalBlockCount() uint64     { return f.total }
+func (f fsInfo) FreeBlockCount() uint64      { return f.free }
+func (f fsInfo) AvailableBlockCount() uint64 { return f.avail }
+
+func TestFsSpace(t *testing.T) {
+	space := fsSpace(fsInfo{bytesPerSector: 512, sectorsPerUnit: 8, total: 1000, free: 400, avail: 300})
+	assert.Equal(t, &client.SpaceInfo{Total: 4096000, Free: 1228800, Used: 2457600}, space)
+}
+
+func TestSMBClient_StreamDirectory_NotConnected(t *testing.T) {
+	c := NewSMBClient(&Config{})
+	_, err := client.CollectFiles(c.StreamDirectory(context.Background(), ""))
+	assert.EqualError(t, err, "not connected")
+}
@@ -0,0 +1,161 @@
+// Package transfer copies files between two client.Client instances, which
+// may use different protocols (for example SMB to WebDAV).
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// ErrInsufficientSpace is returned for jobs larger than the free space the
+// destination reports.
+var ErrInsufficientSpace = errors.New("insufficient space")
+
+// Copy streams op.SourcePath from src to op.DestinationPath on dst. An
+// existing destination is only replaced when op.OverwriteExisting is set.
+// Files that do not fit into the free space of the destination directory
+// (see CheckSpace) are refused before any data is written. The full size
+// is required even when replacing a file, since atomic writes hold both
+// copies until the rename.
+// The returned result is never nil; on failure Success is false and Error
+// holds the cause.
+func Copy(ctx context.Context, src, dst client.Client, op client.CopyOperation) *client.CopyResult {
+	start := time.Now()
+	result := &client.CopyResult{}
+	n, err := copyFile(ctx, src, dst, op)
+	result.BytesCopied = n
+	result.Error = err
+	result.Success = err == nil
+	result.TimeTaken = time.Since(start)
+	return result
+}
+
+func copyFile(ctx context.Context, src, dst client.Client, op client.CopyOperation) (int64, error) {
+	if !op.OverwriteExisting {
+		exists, err := dst.FileExists(ctx, op.DestinationPath)
+		if err != nil {
+			return 0, fmt.Errorf("failed to check destination %s: %w", op.DestinationPath, err)
+		}
+		if exists {
+			return 0, fmt.Errorf("destination %s already exists", op.DestinationPath)
+		}
+	}
+
+	if _, ok := dst.(client.SpaceReporter); ok {
+		if info, err := src.GetFileInfo(ctx, op.SourcePath); err == nil && !info.IsDir {
+			if err := CheckSpace(ctx, dst, path.Dir(op.DestinationPath), info.Size); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	reader, err := src.ReadFile(ctx, op.SourcePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open source %s: %w", op.SourcePath, err)
+	}
+	defer reader.Close()
+
+	counter := &countingReader{ctx: ctx, r: reader}
+	if err := dst.WriteFile(ctx, op.DestinationPath, counter); err != nil {
+		return counter.n, fmt.Errorf("failed to write destination %s: %w", op.DestinationPath, err)
+	}
+	if op.PreserveAttributes {
+		if err := Preserve(ctx, src, op.SourcePath, dst, op.DestinationPath); err != nil {
+			return counter.n, err
+		}
+	}
+	return counter.n, nil
+}
+
+// Preserve sets the permission bits and modification time of dstPath on
+// dst to those of srcPath on src. What the destination cannot set is
+// skipped: a dst without client.AttributeSetter, or a method failing with
+// client.ErrNotSupported, is not an error. SMB and FTP report synthesised
+// modes, so copying from them sets 0666/0444 and 0644 respectively.
+func Preserve(ctx context.Context, src client.Client, srcPath string, dst client.Client, dstPath string) error {
+	setter, ok := dst.(client.AttributeSetter)
+	if !ok {
+		return nil
+	}
+	info, err := src.GetFileInfo(ctx, srcPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat source %s: %w", srcPath, err)
+	}
+	if perm := info.Mode.Perm(); perm != 0 {
+		if err := setter.Chmod(ctx, dstPath, perm); err != nil && !errors.Is(err, client.ErrNotSupported) {
+			return fmt.Errorf("failed to preserve mode of %s: %w", dstPath, err)
+		}
+	}
+	if !info.ModTime.IsZero() {
+		if err := setter.Chtimes(ctx, dstPath, time.Time{}, info.ModTime); err != nil && !errors.Is(err, client.ErrNotSupported) {
+			return fmt.Errorf("failed to preserve modification time of %s: %w", dstPath, err)
+		}
+	}
+	return nil
+}
+
+// CheckSpace fails with ErrInsufficientSpace when need bytes do not fit
+// into the free space dst reports for dir. A dir that does not exist yet
+// is measured at its nearest existing ancestor. Destinations without
+// client.SpaceReporter, or reporting client.ErrNotSupported, pass.
+func CheckSpace(ctx context.Context, dst client.Client, dir string, need int64) error {
+	reporter, ok := dst.(client.SpaceReporter)
+	if !ok || need <= 0 {
+		return nil
+	}
+	dir, err := existingAncestor(ctx, dst, dir)
+	if err != nil {
+		return err
+	}
+	space, err := reporter.GetSpace(ctx, dir)
+	if errors.Is(err, client.ErrNotSupported) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query free space at %s: %w", dir, err)
+	}
+	if need > space.Free {
+		return fmt.Errorf("%w: %d bytes needed, %d free", ErrInsufficientSpace, need, space.Free)
+	}
+	return nil
+}
+
+// existingAncestor returns dir or its nearest ancestor that exists on c,
+// and "" for the root.
+func existingAncestor(ctx context.Context, c client.Client, dir string) (string, error) {
+	dir = path.Clean(strings.ReplaceAll(dir, `\`, "/"))
+	for dir != "." && dir != "/" {
+		exists, err := c.FileExists(ctx, dir)
+		if err != nil {
+			return "", fmt.Errorf("failed to check destination %s: %w", dir, err)
+		}
+		if exists {
+			return dir, nil
+		}
+		dir = path.Dir(dir)
+	}
+	return "", nil
+}
+
+// countingReader counts bytes read and stops once ctx is cancelled.
+type countingReader struct {
+	ctx context.Context
+	r   io.Reader
+	n   int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
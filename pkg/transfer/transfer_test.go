@@ -0,0 +1,173 @@
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"digital.vasic.filesystem/internal/testutil"
+	"digital.vasic.filesystem/pkg/client"
+)
+
+func TestCopy(t *testing.T) {
+	src, srcDir := testutil.NewLocal(t)
+	dst, dstDir := testutil.NewLocal(t)
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("hello"), 0644))
+
+	result := Copy(context.Background(), src, dst, client.CopyOperation{SourcePath: "a.txt", DestinationPath: "sub/b.txt"})
+	require.NoError(t, result.Error)
+	assert.True(t, result.Success)
+	assert.Equal(t, int64(5), result.BytesCopied)
+
+	data, err := os.ReadFile(filepath.Join(dstDir, "sub", "b.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+}
+
+func TestCopy_RefusesOverwrite(t *testing.T) {
+	src, srcDir := testutil.NewLocal(t)
+	dst, dstDir := testutil.NewLocal(t)
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("new"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dstDir, "a.txt"), []byte("old"), 0644))
+
+	op := client.CopyOperation{SourcePath: "a.txt", DestinationPath: "a.txt"}
+	result := Copy(context.Background(), src, dst, op)
+	assert.False(t, result.Success)
+	assert.Error(t, result.Error)
+
+	op.OverwriteExisting = true
+	result = Copy(context.Background(), src, dst, op)
+	require.NoError(t, result.Error)
+	data, err := os.ReadFile(filepath.Join(dstDir, "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+}
+
+func TestCopy_MissingSource(t *testing.T) {
+	src, _ := testutil.NewLocal(t)
+	dst, _ := testutil.NewLocal(t)
+
+	result := Copy(context.Background(), src, dst, client.CopyOperation{SourcePath: "missing", DestinationPath: "x"})
+	assert.False(t, result.Success)
+	assert.Error(t, result.Error)
+	assert.Zero(t, result.BytesCopied)
+}
+
+func TestCopy_Cancelled(t *testing.T) {
+	src, srcDir := testutil.NewLocal(t)
+	dst, _ := testutil.NewLocal(t)
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte(strings.Repeat("x", 1024)), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result := Copy(ctx, src, dst, client.CopyOperation{SourcePath: "a.txt", DestinationPath: "a.txt", OverwriteExisting: true})
+	assert.False(t, result.Success)
+	assert.ErrorIs(t, result.Error, context.Canceled)
+}
+
+func TestCopy_PreserveAttributes(t *testing.T) {
+	src, srcDir := testutil.NewLocal(t)
+	dst, dstDir := testutil.NewLocal(t)
+	srcFile := filepath.Join(srcDir, "a.txt")
+	require.NoError(t, os.WriteFile(srcFile, []byte("hello"), 0640))
+	require.NoError(t, os.Chmod(srcFile, 0640))
+	mtime := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, os.Chtimes(srcFile, mtime, mtime))
+
+	result := Copy(context.Background(), src, dst, client.CopyOperation{
+		SourcePath:         "a.txt",
+		DestinationPath:    "b.txt",
+		PreserveAttributes: true,
+	})
+	require.NoError(t, result.Error)
+
+	info, err := os.Stat(filepath.Join(dstDir, "b.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+	assert.True(t, info.ModTime().Equal(mtime))
+}
+
+// noAttributes hides the AttributeSetter of the wrapped client.
+type noAttributes struct{ client.Client }
+
+// unsupportedAttributes refuses every attribute change.
+type unsupportedAttributes struct{ client.Client }
+
+func (unsupportedAttributes) Chmod(ctx context.Context, path string, mode os.FileMode) error {
+	return client.ErrNotSupported
+}
+
+func (unsupportedAttributes) Chtimes(ctx context.Context, path string, atime, mtime time.Time) error {
+	return fmt.Errorf("no times: %w", client.ErrNotSupported)
+}
+
+func (unsupportedAttributes) Chown(ctx context.Context, path string, uid, gid int) error {
+	return client.ErrNotSupported
+}
+
+func TestPreserve_Unsupported(t *testing.T) {
+	src, srcDir := testutil.NewLocal(t)
+	dst, _ := testutil.NewLocal(t)
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("hello"), 0644))
+	ctx := context.Background()
+
+	assert.NoError(t, Preserve(ctx, src, "a.txt", noAttributes{dst}, "a.txt"))
+	assert.NoError(t, Preserve(ctx, src, "a.txt", unsupportedAttributes{dst}, "a.txt"))
+	assert.Error(t, Preserve(ctx, src, "missing.txt", dst, "a.txt"))
+	assert.Error(t, Preserve(ctx, src, "a.txt", dst, "missing.txt"), "real failures are reported")
+}
+
+// fixedSpace reports a fixed amount of free space for every path.
+type fixedSpace struct {
+	client.Client
+	free int64
+	err  error
+	dirs []string
+}
+
+func (f *fixedSpace) GetSpace(ctx context.Context, path string) (*client.SpaceInfo, error) {
+	f.dirs = append(f.dirs, path)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &client.SpaceInfo{Free: f.free}, nil
+}
+
+func TestCopy_InsufficientSpace(t *testing.T) {
+	src, srcDir := testutil.NewLocal(t)
+	dst, dstDir := testutil.NewLocal(t)
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("hello"), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dstDir, "sub"), 0755))
+
+	small := &fixedSpace{Client: dst, free: 4}
+	result := Copy(context.Background(), src, small, client.CopyOperation{SourcePath: "a.txt", DestinationPath: "sub/new/b.txt"})
+	assert.False(t, result.Success)
+	assert.ErrorIs(t, result.Error, ErrInsufficientSpace)
+	assert.Equal(t, []string{"sub"}, small.dirs, "measured at the nearest existing directory")
+	_, err := os.Stat(filepath.Join(dstDir, "sub", "new", "b.txt"))
+	assert.True(t, os.IsNotExist(err), "nothing is written")
+
+	exact := &fixedSpace{Client: dst, free: 5}
+	result = Copy(context.Background(), src, exact, client.CopyOperation{SourcePath: "a.txt", DestinationPath: "b.txt"})
+	require.NoError(t, result.Error)
+	assert.Equal(t, []string{""}, exact.dirs)
+}
+
+func TestCheckSpace(t *testing.T) {
+	dst, _ := testutil.NewLocal(t)
+	ctx := context.Background()
+
+	assert.NoError(t, CheckSpace(ctx, dst, "", 1), "local reports real free space")
+	assert.ErrorIs(t, CheckSpace(ctx, dst, "", 1<<62), ErrInsufficientSpace)
+	assert.NoError(t, CheckSpace(ctx, noAttributes{dst}, "", 1<<62), "no SpaceReporter")
+	assert.NoError(t, CheckSpace(ctx, &fixedSpace{Client: dst, err: client.ErrNotSupported}, "", 1<<62))
+	assert.Error(t, CheckSpace(ctx, &fixedSpace{Client: dst, err: fmt.Errorf("boom")}, "", 1))
+	assert.NoError(t, CheckSpace(ctx, &fixedSpace{Client: dst}, "", 0), "nothing needed")
+}
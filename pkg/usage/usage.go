@@ -0,0 +1,215 @@
+// Package usage computes recursive directory sizes and entry counts over
+// any client.Client, listing subdirectories in parallel and using
+// client.UsageReporter where a backend can total a tree itself.
+package usage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// DefaultConcurrency is the number of directory listings in flight when
+// Options.Concurrency is zero.
+const DefaultConcurrency = 8
+
+// Options configures DiskUsage.
+type Options struct {
+	// Depth adds a Breakdown entry for every directory up to this many
+	// levels below the root, like du -d. Zero reports the total only.
+	Depth int
+	// Concurrency bounds parallel ListDirectory calls and the goroutines
+	// walking subdirectories. Zero uses DefaultConcurrency.
+	Concurrency int
+	// SizeOnly accepts byte totals without file and directory counts,
+	// which lets WebDAV answer from quota-used-bytes in one request. The
+	// counts of such subtrees are -1.
+	SizeOnly bool
+}
+
+// Entry is the usage of one directory of the breakdown. Path is relative
+// to the root, joined with "/".
+type Entry struct {
+	Path  string `json:"path"`
+	Depth int    `json:"depth"`
+	client.DirUsage
+}
+
+// Report is the usage of a tree.
+type Report struct {
+	client.DirUsage
+	// Breakdown lists the directories down to Options.Depth, sorted by
+	// path.
+	Breakdown []Entry `json:"breakdown,omitempty"`
+}
+
+// DiskUsage totals the files and directories below root on c. Symbolic
+// links are counted as files of zero bytes and never followed. Where c
+// implements client.UsageReporter, subtrees below the breakdown depth are
+// totalled by the backend instead of being listed; hard links are then
+// deduplicated within each such subtree only. The first failing listing
+// cancels the others and is returned.
+func DiskUsage(ctx context.Context, c client.Client, root string, opts Options) (*Report, error) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := &walker{
+		c:       c,
+		opts:    opts,
+		sem:     make(chan struct{}, opts.Concurrency),
+		workers: make(chan struct{}, opts.Concurrency),
+		cancel:  cancel,
+	}
+	w.reporter, _ = c.(client.UsageReporter)
+	total, err := w.dir(ctx, root, "", 0)
+	if err != nil {
+		if w.err != nil {
+			return nil, w.err
+		}
+		return nil, err
+	}
+	sort.Slice(w.breakdown, func(i, j int) bool { return w.breakdown[i].Path < w.breakdown[j].Path })
+	return &Report{DirUsage: total, Breakdown: w.breakdown}, nil
+}
+
+// walker holds the state shared by the goroutines of one DiskUsage call.
+type walker struct {
+	c        client.Client
+	reporter client.UsageReporter
+	opts     Options
+	sem      chan struct{}
+	// workers bounds the goroutines walking subdirectories; once all are
+	// busy a directory walks its subdirectories itself.
+	workers chan struct{}
+	cancel  context.CancelFunc
+
+	mu        sync.Mutex
+	breakdown []Entry
+	err       error
+}
+
+// fail records the first error of the walk and cancels the rest.
+func (w *walker) fail(err error) {
+	w.mu.Lock()
+	if w.err == nil {
+		w.err = err
+	}
+	w.mu.Unlock()
+	w.cancel()
+}
+
+// dir totals the directory p, which is rel below the root at the given
+// depth.
+func (w *walker) dir(ctx context.Context, p, rel string, depth int) (client.DirUsage, error) {
+	if w.reporter != nil && depth >= w.opts.Depth {
+		u, err := w.reporter.DirUsage(ctx, p)
+		switch {
+		case err == nil && (u.Files >= 0 || w.opts.SizeOnly):
+			return *u, nil
+		case err != nil && !errors.Is(err, client.ErrNotSupported):
+			return client.DirUsage{}, err
+		}
+	}
+
+	files, err := w.list(ctx, p)
+	if err != nil {
+		return client.DirUsage{}, err
+	}
+	var total client.DirUsage
+	var subdirs []string
+	for _, f := range files {
+		if f.Name == "" || f.Name == "." || f.Name == ".." {
+			continue
+		}
+		switch {
+		case f.LinkType == client.LinkSymlink:
+			total.Files++
+		case f.IsDir:
+			subdirs = append(subdirs, f.Name)
+		default:
+			total.Files++
+			total.Bytes += f.Size
+		}
+	}
+
+	results := make([]client.DirUsage, len(subdirs))
+	errs := make([]error, len(subdirs))
+	var wg sync.WaitGroup
+	for i, name := range subdirs {
+		select {
+		case w.workers <- struct{}{}:
+			wg.Add(1)
+			go func(i int, name string) {
+				defer wg.Done()
+				defer func() { <-w.workers }()
+				results[i], errs[i] = w.child(ctx, p, rel, name, depth+1)
+			}(i, name)
+		default:
+			results[i], errs[i] = w.child(ctx, p, rel, name, depth+1)
+		}
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return client.DirUsage{}, err
+		}
+	}
+	for _, u := range results {
+		total = add(total, u)
+		total = add(total, client.DirUsage{Dirs: 1})
+	}
+	return total, nil
+}
+
+// child totals the subdirectory name of p and records it in the breakdown.
+func (w *walker) child(ctx context.Context, p, rel, name string, depth int) (client.DirUsage, error) {
+	childRel := client.JoinPath(rel, name)
+	u, err := w.dir(ctx, client.JoinPath(p, name), childRel, depth)
+	if err != nil {
+		w.fail(err)
+		return client.DirUsage{}, err
+	}
+	if depth <= w.opts.Depth {
+		w.mu.Lock()
+		w.breakdown = append(w.breakdown, Entry{Path: childRel, Depth: depth, DirUsage: u})
+		w.mu.Unlock()
+	}
+	return u, nil
+}
+
+// list lists p once a slot is free.
+func (w *walker) list(ctx context.Context, p string) ([]*client.FileInfo, error) {
+	select {
+	case w.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-w.sem }()
+	files, err := w.c.ListDirectory(ctx, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", p, err)
+	}
+	return files, nil
+}
+
+// add sums two usages; an unknown (-1) count stays unknown.
+func add(a, b client.DirUsage) client.DirUsage {
+	a.Bytes += b.Bytes
+	a.Files = addCount(a.Files, b.Files)
+	a.Dirs = addCount(a.Dirs, b.Dirs)
+	return a
+}
+
+func addCount(a, b int64) int64 {
+	if a < 0 || b < 0 {
+		return -1
+	}
+	return a + b
+}
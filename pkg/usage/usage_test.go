@@ -0,0 +1,184 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"digital.vasic.filesystem/internal/testutil"
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// writeTree creates a.txt (1), docs/b.txt (10), docs/old/c.txt (100),
+// media/d.bin (1000) and an empty directory media/empty.
+func writeTree(t *testing.T, dir string) {
+	t.Helper()
+	files := map[string]int{"a.txt": 1, "docs/b.txt": 10, "docs/old/c.txt": 100, "media/d.bin": 1000}
+	for name, size := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, os.WriteFile(p, make([]byte, size), 0644))
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "media", "empty"), 0755))
+}
+
+// listOnly hides the UsageReporter of the wrapped client.
+type listOnly struct{ client.Client }
+
+func TestDiskUsage(t *testing.T) {
+	c, dir := testutil.NewLocal(t)
+	writeTree(t, dir)
+	want := client.DirUsage{Bytes: 1111, Files: 4, Dirs: 4}
+
+	for name, cl := range map[string]client.Client{"reporter": c, "listing": listOnly{c}} {
+		report, err := DiskUsage(context.Background(), cl, "", Options{})
+		require.NoError(t, err, name)
+		assert.Equal(t, want, report.DirUsage, name)
+		assert.Empty(t, report.Breakdown, name)
+
+		report, err = DiskUsage(context.Background(), cl, "", Options{Depth: 2, Concurrency: 1})
+		require.NoError(t, err, name)
+		assert.Equal(t, want, report.DirUsage, name)
+		assert.Equal(t, []Entry{
+			{Path: "docs", Depth: 1, DirUsage: client.DirUsage{Bytes: 110, Files: 2, Dirs: 1}},
+			{Path: "docs/old", Depth: 2, DirUsage: client.DirUsage{Bytes: 100, Files: 1}},
+			{Path: "media", Depth: 1, DirUsage: client.DirUsage{Bytes: 1000, Files: 1, Dirs: 1}},
+			{Path: "media/empty", Depth: 2},
+		}, report.Breakdown, name)
+
+		report, err = DiskUsage(context.Background(), cl, "docs", Options{})
+		require.NoError(t, err, name)
+		assert.Equal(t, client.DirUsage{Bytes: 110, Files: 2, Dirs: 1}, report.DirUsage, name)
+	}
+}
+
+func TestDiskUsage_Links(t *testing.T) {
+	c, dir := testutil.NewLocal(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.bin"), make([]byte, 100), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0755))
+	if err := os.Link(filepath.Join(dir, "a.bin"), filepath.Join(dir, "sub", "b.bin")); err != nil {
+		t.Skip("hard links not supported on this filesystem")
+	}
+	require.NoError(t, os.Symlink("sub", filepath.Join(dir, "link")))
+
+	report, err := DiskUsage(context.Background(), c, "", Options{})
+	require.NoError(t, err)
+	assert.Equal(t, client.DirUsage{Bytes: 100, Files: 2, Dirs: 1}, report.DirUsage,
+		"the hard link is counted once and the symlink is not followed")
+
+	report, err = DiskUsage(context.Background(), listOnly{c}, "", Options{})
+	require.NoError(t, err)
+	assert.Equal(t, client.DirUsage{Bytes: 200, Files: 3, Dirs: 1}, report.DirUsage,
+		"listings cannot tell hard links apart")
+}
+
+// sizeOnly reports a fixed byte total without counts.
+type sizeOnly struct {
+	client.Client
+	bytes int64
+}
+
+func (s sizeOnly) DirUsage(ctx context.Context, path string) (*client.DirUsage, error) {
+	return &client.DirUsage{Bytes: s.bytes, Files: -1, Dirs: -1}, nil
+}
+
+func TestDiskUsage_SizeOnly(t *testing.T) {
+	c, dir := testutil.NewLocal(t)
+	writeTree(t, dir)
+	cl := sizeOnly{Client: listOnly{c}, bytes: 5000}
+
+	report, err := DiskUsage(context.Background(), cl, "", Options{})
+	require.NoError(t, err)
+	assert.Equal(t, client.DirUsage{Bytes: 1111, Files: 4, Dirs: 4}, report.DirUsage, "counts are required by default")
+
+	report, err = DiskUsage(context.Background(), cl, "", Options{SizeOnly: true})
+	require.NoError(t, err)
+	assert.Equal(t, client.DirUsage{Bytes: 5000, Files: -1, Dirs: -1}, report.DirUsage)
+
+	report, err = DiskUsage(context.Background(), cl, "", Options{SizeOnly: true, Depth: 1})
+	require.NoError(t, err)
+	assert.Equal(t, client.DirUsage{Bytes: 10001, Files: -1, Dirs: -1}, report.DirUsage, "a.txt plus two reported subtrees")
+	assert.Len(t, report.Breakdown, 2)
+}
+
+// slowLister records the peak number of concurrent listings and of live
+// goroutines.
+type slowLister struct {
+	client.Client
+	mu         sync.Mutex
+	active     int
+	peak       int
+	goroutines int
+}
+
+func (s *slowLister) ListDirectory(ctx context.Context, path string) ([]*client.FileInfo, error) {
+	s.mu.Lock()
+	s.active++
+	if s.active > s.peak {
+		s.peak = s.active
+	}
+	if n := runtime.NumGoroutine(); n > s.goroutines {
+		s.goroutines = n
+	}
+	s.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	defer func() {
+		s.mu.Lock()
+		s.active--
+		s.mu.Unlock()
+	}()
+	return s.Client.ListDirectory(ctx, path)
+}
+
+func TestDiskUsage_Concurrency(t *testing.T) {
+	c, dir := testutil.NewLocal(t)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, string(rune('a'+i)), "x"), 0755))
+	}
+	lister := &slowLister{Client: listOnly{c}}
+
+	report, err := DiskUsage(context.Background(), lister, "", Options{Concurrency: 3})
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), report.Dirs)
+	assert.LessOrEqual(t, lister.peak, 3)
+	assert.Greater(t, lister.peak, 1, "listings run in parallel")
+}
+
+func TestDiskUsage_BoundedGoroutines(t *testing.T) {
+	c, dir := testutil.NewLocal(t)
+	for i := 0; i < 100; i++ {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, fmt.Sprintf("d%03d", i), "x"), 0755))
+	}
+	lister := &slowLister{Client: listOnly{c}}
+	before := runtime.NumGoroutine()
+
+	report, err := DiskUsage(context.Background(), lister, "", Options{Concurrency: 2})
+	require.NoError(t, err)
+	assert.Equal(t, int64(200), report.Dirs)
+	assert.LessOrEqual(t, lister.goroutines-before, 2, "one goroutine per directory")
+}
+
+func TestDiskUsage_Errors(t *testing.T) {
+	c, dir := testutil.NewLocal(t)
+	writeTree(t, dir)
+
+	_, err := DiskUsage(context.Background(), listOnly{c}, "missing", Options{})
+	assert.Error(t, err)
+	_, err = DiskUsage(context.Background(), c, "missing", Options{})
+	assert.Error(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = DiskUsage(ctx, listOnly{c}, "", Options{})
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = DiskUsage(ctx, c, "", Options{})
+	assert.ErrorIs(t, err, context.Canceled)
+}
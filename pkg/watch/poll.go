@@ -0,0 +1,195 @@
+// Package watch implements change watching by polling: it lists a
+// directory tree with client.Client.ListDirectory at a fixed interval and
+// diffs successive snapshots into client.Events. Backends without native
+// change notification (FTP, WebDAV, NFS, SMB) use it for client.Watcher.
+package watch
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// DefaultPollInterval is the interval used by backends that implement
+// client.Watcher by polling.
+const DefaultPollInterval = 5 * time.Second
+
+// entry is the state of one path in a snapshot.
+type entry struct {
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+// snapshot maps paths to their state.
+type snapshot map[string]entry
+
+// Poll watches root on c by listing it every interval. The first snapshot
+// is taken before Poll returns, so an unreadable root is reported as an
+// error. Listing errors during polling are sent as EventError and the
+// previous snapshot is kept.
+func Poll(ctx context.Context, c client.Client, root string, recursive bool, interval time.Duration) (<-chan client.Event, error) {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	prev, err := take(ctx, c, root, recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan client.Event, 64)
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			next, err := take(ctx, c, root, recursive)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				if !send(ctx, events, client.Event{Type: client.EventError, Path: root, Err: err}) {
+					return
+				}
+				continue
+			}
+			for _, ev := range Diff(prev, next) {
+				if !send(ctx, events, ev) {
+					return
+				}
+			}
+			prev = next
+		}
+	}()
+	return events, nil
+}
+
+// Diff returns the events that turn old into new. A file that disappears
+// while a file with the same size and modification time appears is reported
+// as a rename. Directory modification times are ignored because several
+// servers do not report them reliably; their changes surface as events for
+// their children.
+func Diff(old, new snapshot) []client.Event {
+	var created, deleted, modified []string
+	for p, n := range new {
+		o, ok := old[p]
+		switch {
+		case !ok:
+			created = append(created, p)
+		case o.isDir != n.isDir:
+			deleted = append(deleted, p)
+			created = append(created, p)
+		case !n.isDir && (o.size != n.size || !o.modTime.Equal(n.modTime)):
+			modified = append(modified, p)
+		}
+	}
+	for p := range old {
+		if _, ok := new[p]; !ok {
+			deleted = append(deleted, p)
+		}
+	}
+	sort.Strings(created)
+	sort.Strings(deleted)
+	sort.Strings(modified)
+
+	var events []client.Event
+	renamedTo := make(map[string]bool)
+	for _, d := range deleted {
+		o := old[d]
+		renamed := false
+		if !o.isDir {
+			for _, c := range created {
+				n := new[c]
+				if renamedTo[c] || n.isDir || n.size != o.size || !n.modTime.Equal(o.modTime) {
+					continue
+				}
+				if _, existed := old[c]; existed {
+					continue
+				}
+				events = append(events, client.Event{Type: client.EventRename, Path: c, OldPath: d})
+				renamedTo[c] = true
+				renamed = true
+				break
+			}
+		}
+		if !renamed {
+			events = append(events, client.Event{Type: client.EventDelete, Path: d, IsDir: o.isDir})
+		}
+	}
+	for _, c := range created {
+		if !renamedTo[c] {
+			events = append(events, client.Event{Type: client.EventCreate, Path: c, IsDir: new[c].isDir})
+		}
+	}
+	for _, m := range modified {
+		events = append(events, client.Event{Type: client.EventModify, Path: m})
+	}
+	return events
+}
+
+// take lists root (recursively if requested) into a snapshot keyed by
+// paths joined from root and entry names.
+func take(ctx context.Context, c client.Client, root string, recursive bool) (snapshot, error) {
+	snap := make(snapshot)
+	dirs := []string{root}
+	for len(dirs) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		dir := dirs[0]
+		dirs = dirs[1:]
+		files, err := c.ListDirectory(ctx, dir)
+		if err != nil {
+			if dir != root && vanished(ctx, c, dir, err) {
+				// A subdirectory vanished between listings; its deletion is
+				// reported through its parent's snapshot.
+				continue
+			}
+			// Any other failure would drop the subtree and report its
+			// files as deleted, so the whole snapshot fails instead.
+			return nil, err
+		}
+		for _, f := range files {
+			if f.Name == "" || f.Name == "." || f.Name == ".." {
+				continue
+			}
+			p := path.Join(dir, f.Name)
+			snap[p] = entry{size: f.Size, modTime: f.ModTime, isDir: f.IsDir}
+			if recursive && f.IsDir {
+				dirs = append(dirs, p)
+			}
+		}
+	}
+	return snap, nil
+}
+
+// vanished reports whether listing dir failed with err because dir no
+// longer exists. Backends that do not wrap fs.ErrNotExist are asked with
+// FileExists.
+func vanished(ctx context.Context, c client.Client, dir string, err error) bool {
+	if errors.Is(err, fs.ErrNotExist) {
+		return true
+	}
+	exists, existsErr := c.FileExists(ctx, dir)
+	return existsErr == nil && !exists
+}
+
+// send delivers ev unless ctx is cancelled first.
+func send(ctx context.Context, events chan<- client.Event, ev client.Event) bool {
+	select {
+	case events <- ev:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,181 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"digital.vasic.filesystem/internal/testutil"
+	"digital.vasic.filesystem/pkg/client"
+)
+
+func TestDiff(t *testing.T) {
+	mtime := time.Unix(1700000000, 0)
+	old := snapshot{
+		"/a.txt":   {size: 1, modTime: mtime},
+		"/b.txt":   {size: 2, modTime: mtime},
+		"/c.txt":   {size: 3, modTime: mtime},
+		"/dir":     {isDir: true, modTime: mtime},
+		"/gone":    {isDir: true, modTime: mtime},
+		"/old.txt": {size: 42, modTime: mtime},
+	}
+	new := snapshot{
+		"/a.txt":   {size: 1, modTime: mtime},
+		"/b.txt":   {size: 5, modTime: mtime},
+		"/dir":     {isDir: true, modTime: mtime.Add(time.Hour)},
+		"/new.txt": {size: 42, modTime: mtime},
+		"/d.txt":   {size: 7, modTime: mtime},
+	}
+
+	events := Diff(old, new)
+	assert.ElementsMatch(t, []client.Event{
+		{Type: client.EventDelete, Path: "/c.txt"},
+		{Type: client.EventDelete, Path: "/gone", IsDir: true},
+		{Type: client.EventRename, Path: "/new.txt", OldPath: "/old.txt"},
+		{Type: client.EventCreate, Path: "/d.txt"},
+		{Type: client.EventModify, Path: "/b.txt"},
+	}, events)
+}
+
+func TestDiff_TypeChange(t *testing.T) {
+	old := snapshot{"/x": {size: 1}}
+	new := snapshot{"/x": {isDir: true}}
+
+	events := Diff(old, new)
+	assert.Equal(t, []client.Event{
+		{Type: client.EventDelete, Path: "/x"},
+		{Type: client.EventCreate, Path: "/x", IsDir: true},
+	}, events)
+}
+
+func TestDiff_NoChanges(t *testing.T) {
+	snap := snapshot{"/a": {size: 1}}
+	assert.Empty(t, Diff(snap, snap))
+}
+
+func next(t *testing.T, events <-chan client.Event) client.Event {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		require.True(t, ok, "event channel closed")
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+		return client.Event{}
+	}
+}
+
+func TestPoll(t *testing.T) {
+	c, dir := testutil.NewLocal(t)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "a.txt"), []byte("a"), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := Poll(ctx, c, "sub", true, 20*time.Millisecond)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "b.txt"), []byte("b"), 0644))
+	ev := next(t, events)
+	assert.Equal(t, client.EventCreate, ev.Type)
+	assert.Equal(t, "sub/b.txt", ev.Path)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "b.txt"), []byte("bigger"), 0644))
+	ev = next(t, events)
+	assert.Equal(t, client.EventModify, ev.Type)
+	assert.Equal(t, "sub/b.txt", ev.Path)
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub", "nested"), 0755))
+	ev = next(t, events)
+	assert.Equal(t, client.EventCreate, ev.Type)
+	assert.Equal(t, "sub/nested", ev.Path)
+	assert.True(t, ev.IsDir)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "nested", "c.txt"), []byte("c"), 0644))
+	ev = next(t, events)
+	assert.Equal(t, client.EventCreate, ev.Type)
+	assert.Equal(t, "sub/nested/c.txt", ev.Path)
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "sub", "a.txt")))
+	ev = next(t, events)
+	assert.Equal(t, client.EventDelete, ev.Type)
+	assert.Equal(t, "sub/a.txt", ev.Path)
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestPoll_NonRecursive(t *testing.T) {
+	c, dir := testutil.NewLocal(t)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0755))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := Poll(ctx, c, "/", false, 20*time.Millisecond)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "ignored.txt"), []byte("x"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "top.txt"), []byte("x"), 0644))
+	ev := next(t, events)
+	assert.Equal(t, client.EventCreate, ev.Type)
+	assert.Equal(t, "/top.txt", ev.Path)
+}
+
+func TestPoll_MissingRoot(t *testing.T) {
+	c, _ := testutil.NewLocal(t)
+	_, err := Poll(context.Background(), c, "missing", false, time.Second)
+	assert.Error(t, err)
+}
+
+func TestPoll_ClosesOnCancel(t *testing.T) {
+	c, _ := testutil.NewLocal(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := Poll(ctx, c, "/", false, 10*time.Millisecond)
+	require.NoError(t, err)
+	cancel()
+
+	select {
+	case _, ok := <-events:
+		assert.False(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("channel not closed after cancel")
+	}
+}
+
+// failingLister fails to list one directory with a non-existence error.
+type failingLister struct {
+	client.Client
+	dir string
+}
+
+func (f failingLister) ListDirectory(ctx context.Context, p string) ([]*client.FileInfo, error) {
+	if p == f.dir {
+		return nil, errors.New("i/o timeout")
+	}
+	return f.Client.ListDirectory(ctx, p)
+}
+
+func TestTake_SubdirectoryErrors(t *testing.T) {
+	c, dir := testutil.NewLocal(t)
+	ctx := context.Background()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub", "nested"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "nested", "a.txt"), []byte("a"), 0644))
+
+	_, err := take(ctx, failingLister{c, "sub/nested"}, "sub", true)
+	assert.Error(t, err, "a failed listing must not drop the subtree")
+
+	assert.False(t, vanished(ctx, c, "sub/nested", errors.New("i/o timeout")))
+
+	require.NoError(t, os.RemoveAll(filepath.Join(dir, "sub", "nested")))
+	assert.True(t, vanished(ctx, c, "sub/nested", errors.New("550 no such directory")),
+		"backends without fs.ErrNotExist are checked with FileExists")
+	assert.True(t, vanished(ctx, c, "sub/nested", fs.ErrNotExist))
+}
@@ -0,0 +1,50 @@
+package webdav
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// Chmod returns client.ErrNotSupported; WebDAV has no permission bits.
+func (c *Client) Chmod(ctx context.Context, path string, mode os.FileMode) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	return fmt.Errorf("failed to chmod WebDAV file %s: %w", path, client.ErrNotSupported)
+}
+
+// Chtimes sets the modification time with a PROPPATCH of getlastmodified.
+// Many servers treat it as a protected live property; their refusal is
+// reported as client.ErrNotSupported. WebDAV has no access time, so atime
+// is ignored.
+func (c *Client) Chtimes(ctx context.Context, path string, atime, mtime time.Time) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	if mtime.IsZero() {
+		return nil
+	}
+
+	body := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8" ?>
+<D:propertyupdate xmlns:D="DAV:">
+	<D:set>
+		<D:prop>
+			<D:getlastmodified>%s</D:getlastmodified>
+		</D:prop>
+	</D:set>
+</D:propertyupdate>`, mtime.UTC().Format(http.TimeFormat))
+	return c.proppatch(ctx, path, body)
+}
+
+// Chown returns client.ErrNotSupported; WebDAV has no ownership.
+func (c *Client) Chown(ctx context.Context, path string, uid, gid int) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	return fmt.Errorf("failed to chown WebDAV file %s: %w", path, client.ErrNotSupported)
+}
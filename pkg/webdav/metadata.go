@@ -0,0 +1,96 @@
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// metadataNS is the XML namespace of the dead properties holding metadata.
+const metadataNS = "urn:digital.vasic.filesystem:metadata"
+
+// GetMetadata returns the dead properties in the metadata namespace, read
+// with an allprop PROPFIND.
+func (c *Client) GetMetadata(ctx context.Context, path string) (map[string]string, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+
+	body := `<?xml version="1.0" encoding="utf-8" ?>
+<D:propfind xmlns:D="DAV:">
+	<D:allprop/>
+</D:propfind>`
+	ms, err := c.propfind(ctx, path, "0", body)
+	if err != nil {
+		return nil, err
+	}
+	meta := make(map[string]string)
+	for _, r := range ms.Responses {
+		for _, ps := range r.Propstats {
+			if !ps.ok() {
+				continue
+			}
+			for _, p := range ps.Prop.Other {
+				if p.XMLName.Space == metadataNS {
+					meta[p.XMLName.Local] = p.Value
+				}
+			}
+		}
+	}
+	return meta, nil
+}
+
+// SetMetadata stores meta as dead properties with a PROPPATCH set.
+func (c *Client) SetMetadata(ctx context.Context, path string, meta map[string]string) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	if len(meta) == 0 {
+		return nil
+	}
+	var props strings.Builder
+	for key, value := range meta {
+		if err := client.ValidMetadataKey(key); err != nil {
+			return err
+		}
+		fmt.Fprintf(&props, "\t\t\t<m:%s>", key)
+		if err := xml.EscapeText(&props, []byte(value)); err != nil {
+			return err
+		}
+		fmt.Fprintf(&props, "</m:%s>\n", key)
+	}
+	return c.proppatch(ctx, path, metadataUpdate("set", props.String()))
+}
+
+// DeleteMetadata removes dead properties with a PROPPATCH remove.
+func (c *Client) DeleteMetadata(ctx context.Context, path string, keys ...string) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	var props strings.Builder
+	for _, key := range keys {
+		if err := client.ValidMetadataKey(key); err != nil {
+			return err
+		}
+		fmt.Fprintf(&props, "\t\t\t<m:%s/>\n", key)
+	}
+	return c.proppatch(ctx, path, metadataUpdate("remove", props.String()))
+}
+
+// metadataUpdate wraps props in a propertyupdate with the given
+// instruction, "set" or "remove".
+func metadataUpdate(instruction, props string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="utf-8" ?>
+<D:propertyupdate xmlns:D="DAV:" xmlns:m="%s">
+	<D:%s>
+		<D:prop>
+%s		</D:prop>
+	</D:%s>
+</D:propertyupdate>`, metadataNS, instruction, props, instruction)
+}
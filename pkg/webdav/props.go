@@ -0,0 +1,243 @@
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// multistatus is a PROPFIND response decoded with encoding/xml, used by the
+// requests that need namespaced properties.
+type multistatus struct {
+	Responses []davResponse `xml:"DAV: response"`
+}
+
+type davResponse struct {
+	Href      string        `xml:"DAV: href"`
+	Propstats []davPropstat `xml:"DAV: propstat"`
+}
+
+type davPropstat struct {
+	Prop   davProp `xml:"DAV: prop"`
+	Status string  `xml:"DAV: status"`
+}
+
+type davProp struct {
+	DisplayName    string           `xml:"DAV: displayname"`
+	ContentLength  string           `xml:"DAV: getcontentlength"`
+	LastModified   string           `xml:"DAV: getlastmodified"`
+	ResourceType   *davResourceType `xml:"DAV: resourcetype"`
+	Checksums      []string         `xml:"http://owncloud.org/ns checksums>checksum"`
+	QuotaAvailable string           `xml:"DAV: quota-available-bytes"`
+	QuotaUsed      string           `xml:"DAV: quota-used-bytes"`
+	// Other collects the properties without a field of their own.
+	Other []davAnyProp `xml:",any"`
+}
+
+// davResourceType marks collections; some servers say directory instead.
+type davResourceType struct {
+	Collection *struct{} `xml:"DAV: collection"`
+	Directory  *struct{} `xml:"DAV: directory"`
+}
+
+// davAnyProp is a property decoded by name, such as a dead property.
+type davAnyProp struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+// props merges the properties of the successful propstats of r.
+func (r davResponse) props() davProp {
+	var prop davProp
+	for _, ps := range r.Propstats {
+		if !ps.ok() {
+			continue
+		}
+		if ps.Prop.DisplayName != "" {
+			prop.DisplayName = ps.Prop.DisplayName
+		}
+		if ps.Prop.ContentLength != "" {
+			prop.ContentLength = ps.Prop.ContentLength
+		}
+		if ps.Prop.LastModified != "" {
+			prop.LastModified = ps.Prop.LastModified
+		}
+		if ps.Prop.ResourceType != nil {
+			prop.ResourceType = ps.Prop.ResourceType
+		}
+	}
+	return prop
+}
+
+// fileInfo describes the resource with the given name and path from its
+// live properties.
+func (p davProp) fileInfo(name, path string) *client.FileInfo {
+	var size int64
+	if s, err := strconv.ParseInt(strings.TrimSpace(p.ContentLength), 10, 64); err == nil {
+		size = s
+	}
+
+	modTime := time.Now()
+	if modStr := strings.TrimSpace(p.LastModified); modStr != "" {
+		if t, err := time.Parse(time.RFC1123, modStr); err == nil {
+			modTime = t
+		} else if t, err := time.Parse("Mon, 2 Jan 2006 15:04:05 MST", modStr); err == nil {
+			modTime = t
+		}
+	}
+
+	return &client.FileInfo{
+		Name:    name,
+		Size:    size,
+		ModTime: modTime,
+		IsDir:   p.ResourceType != nil && (p.ResourceType.Collection != nil || p.ResourceType.Directory != nil),
+		Mode:    0644,
+		Path:    path,
+	}
+}
+
+// ok reports whether the propstat carries found properties. A missing
+// status is treated as success.
+func (p davPropstat) ok() bool {
+	return p.Status == "" || strings.Contains(p.Status, " 200 ")
+}
+
+// propfind sends a PROPFIND for path with the given depth and request body
+// and decodes the multistatus response.
+func (c *Client) propfind(ctx context.Context, path, depth, body string) (*multistatus, error) {
+	return c.propRequest(ctx, "PROPFIND", path, depth, body)
+}
+
+// propRequest sends a property method (PROPFIND or PROPPATCH) and decodes
+// the multistatus response. The Depth header is omitted when depth is
+// empty. Servers rejecting the method itself yield client.ErrNotSupported.
+func (c *Client) propRequest(ctx context.Context, method, path, depth, body string) (*multistatus, error) {
+	fullURL, err := c.resolveURL(path)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, fullURL, strings.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s request: %w", method, err)
+	}
+
+	if c.config.Username != "" {
+		req.SetBasicAuth(c.config.Username, c.config.Password)
+	}
+	if depth != "" {
+		req.Header.Set("Depth", depth)
+	}
+	req.Header.Set("Content-Type", "application/xml")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send %s for %s: %w", method, fullURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented {
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("WebDAV server does not allow %s on %s: %w", method, fullURL, client.ErrNotSupported)
+	}
+	if resp.StatusCode != http.StatusMultiStatus {
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("WebDAV server returned status %d for %s", resp.StatusCode, fullURL)
+	}
+
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("failed to parse WebDAV response: %w", err)
+	}
+	return &ms, nil
+}
+
+// proppatch sends a PROPPATCH with the given propertyupdate body. Servers
+// refusing any of the properties yield client.ErrNotSupported.
+func (c *Client) proppatch(ctx context.Context, path, body string) error {
+	ms, err := c.propRequest(ctx, "PROPPATCH", path, "", body)
+	if err != nil {
+		return err
+	}
+	for _, r := range ms.Responses {
+		for _, ps := range r.Propstats {
+			if !ps.ok() {
+				return fmt.Errorf("WebDAV server refused properties of %s (%s): %w", path, ps.Status, client.ErrNotSupported)
+			}
+		}
+	}
+	return nil
+}
+
+// checksumNames maps algorithms to their oc:checksums prefixes.
+var checksumNames = map[client.HashAlgorithm]string{
+	client.HashSHA256: "SHA256",
+	client.HashSHA1:   "SHA1",
+	client.HashMD5:    "MD5",
+}
+
+// Hash returns a server-side digest from the ownCloud/Nextcloud
+// oc:checksums property ("SHA1:... MD5:..."). getetag is not used because
+// most servers derive it from metadata rather than contents.
+func (c *Client) Hash(ctx context.Context, path string, algo client.HashAlgorithm) (string, error) {
+	if !c.IsConnected() {
+		return "", fmt.Errorf("not connected")
+	}
+	if _, ok := checksumNames[algo]; !ok {
+		return "", fmt.Errorf("WebDAV has no %s checksums: %w", algo, client.ErrNotSupported)
+	}
+	sums, err := c.Hashes(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	if sum, ok := sums[algo]; ok {
+		return sum, nil
+	}
+	return "", fmt.Errorf("WebDAV server has no %s checksum for %s: %w", algo, path, client.ErrNotSupported)
+}
+
+// Hashes returns every digest in the oc:checksums property of path with a
+// single PROPFIND. Servers without the property yield an empty map.
+func (c *Client) Hashes(ctx context.Context, path string) (map[client.HashAlgorithm]string, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+	body := `<?xml version="1.0" encoding="utf-8" ?>
+<D:propfind xmlns:D="DAV:" xmlns:oc="http://owncloud.org/ns">
+	<D:prop>
+		<oc:checksums/>
+	</D:prop>
+</D:propfind>`
+	ms, err := c.propfind(ctx, path, "0", body)
+	if err != nil {
+		return nil, err
+	}
+	sums := make(map[client.HashAlgorithm]string)
+	for _, r := range ms.Responses {
+		for _, ps := range r.Propstats {
+			if !ps.ok() {
+				continue
+			}
+			for _, list := range ps.Prop.Checksums {
+				for _, field := range strings.Fields(list) {
+					prefix, sum, found := strings.Cut(field, ":")
+					if !found {
+						continue
+					}
+					for algo, name := range checksumNames {
+						if strings.EqualFold(prefix, name) {
+							sums[algo] = strings.ToLower(sum)
+						}
+					}
+				}
+			}
+		}
+	}
+	return sums, nil
+}
@@ -0,0 +1,203 @@
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// Search runs an RFC 5323 basicsearch scoped to root. Sizes and times
+// become comparisons on getcontentlength and getlastmodified, and the type
+// an is-collection test. Names are matched here against the last element
+// of each href: displayname is optional and often differs from the file
+// name, so a like condition on it would lose real matches. The scope
+// depth is 1 for MaxDepth 1 and infinity otherwise, so deeper limits are
+// left to the caller. Servers without DASL support (most answer 405 or
+// 501) yield client.ErrNotSupported.
+func (c *Client) Search(ctx context.Context, root string, criteria client.SearchCriteria) iter.Seq2[*client.FileInfo, error] {
+	return func(yield func(*client.FileInfo, error) bool) {
+		if !c.IsConnected() {
+			yield(nil, fmt.Errorf("not connected"))
+			return
+		}
+
+		fullURL, err := c.resolveURL(root)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		body, err := searchRequest(fullURL, criteria)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		req, err := http.NewRequestWithContext(ctx, "SEARCH", fullURL, strings.NewReader(body))
+		if err != nil {
+			yield(nil, fmt.Errorf("failed to create SEARCH request: %w", err))
+			return
+		}
+		if c.config.Username != "" {
+			req.SetBasicAuth(c.config.Username, c.config.Password)
+		}
+		req.Header.Set("Content-Type", "application/xml")
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			yield(nil, fmt.Errorf("failed to search WebDAV directory %s: %w", fullURL, err))
+			return
+		}
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusMultiStatus:
+		case http.StatusMethodNotAllowed, http.StatusNotImplemented, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity:
+			io.Copy(io.Discard, resp.Body)
+			yield(nil, fmt.Errorf("WebDAV server does not allow SEARCH on %s: %w", fullURL, client.ErrNotSupported))
+			return
+		default:
+			io.Copy(io.Discard, resp.Body)
+			yield(nil, fmt.Errorf("WebDAV server returned status %d for SEARCH on %s", resp.StatusCode, fullURL))
+			return
+		}
+
+		rootPath := fullURL
+		if u, err := url.Parse(fullURL); err == nil {
+			rootPath = u.Path
+		}
+		err = decodeResponses(resp.Body, func(r davResponse) bool {
+			rel := searchPath(r.Href, rootPath)
+			if rel == "" {
+				return true
+			}
+			if !matchName(criteria.Names, path.Base(rel)) {
+				return true
+			}
+			prop := r.props()
+			name := path.Base(rel)
+			if prop.DisplayName != "" {
+				name = prop.DisplayName
+			}
+			return yield(prop.fileInfo(name, rel), nil)
+		})
+		if err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// searchPath returns href relative to rootPath, unescaped, or "" for the
+// root itself and hrefs outside it.
+func searchPath(href, rootPath string) string {
+	p := href
+	if u, err := url.Parse(href); err == nil {
+		p = u.Path
+	}
+	root := strings.TrimSuffix(rootPath, "/")
+	if p != root && !strings.HasPrefix(p, root+"/") {
+		return ""
+	}
+	return strings.Trim(strings.TrimPrefix(p, root), "/")
+}
+
+// searchRequest builds the basicsearch body for criteria.
+func searchRequest(scope string, criteria client.SearchCriteria) (string, error) {
+	depth := "infinity"
+	if criteria.MaxDepth == 1 {
+		depth = "1"
+	}
+
+	var conds []string
+	if criteria.MinSize > 0 {
+		conds = append(conds, compare("gte", "getcontentlength", strconv.FormatInt(criteria.MinSize, 10)))
+	}
+	if criteria.MaxSize > 0 {
+		conds = append(conds, compare("lte", "getcontentlength", strconv.FormatInt(criteria.MaxSize, 10)))
+	}
+	if !criteria.ModifiedAfter.IsZero() {
+		conds = append(conds, compare("gte", "getlastmodified", criteria.ModifiedAfter.UTC().Format(time.RFC3339)))
+	}
+	if !criteria.ModifiedBefore.IsZero() {
+		conds = append(conds, compare("lt", "getlastmodified", criteria.ModifiedBefore.UTC().Format(time.RFC3339)))
+	}
+	switch {
+	case criteria.DirsOnly:
+		conds = append(conds, "<D:is-collection/>")
+	case criteria.FilesOnly:
+		conds = append(conds, "<D:not><D:is-collection/></D:not>")
+	}
+
+	href, err := escapeXML(scope)
+	if err != nil {
+		return "", err
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = "\n\t\t<D:where>" + combine("and", conds) + "</D:where>"
+	}
+	return fmt.Sprintf(`<?xml version="1.0" encoding="utf-8" ?>
+<D:searchrequest xmlns:D="DAV:">
+	<D:basicsearch>
+		<D:select>
+			<D:prop>
+				<D:displayname/>
+				<D:getcontentlength/>
+				<D:getlastmodified/>
+				<D:resourcetype/>
+			</D:prop>
+		</D:select>
+		<D:from>
+			<D:scope>
+				<D:href>%s</D:href>
+				<D:depth>%s</D:depth>
+			</D:scope>
+		</D:from>%s
+	</D:basicsearch>
+</D:searchrequest>`, href, depth, where), nil
+}
+
+// matchName reports whether name matches one of globs, or whether there
+// are none.
+func matchName(globs []string, name string) bool {
+	if len(globs) == 0 {
+		return true
+	}
+	for _, g := range globs {
+		if ok, _ := path.Match(g, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// compare builds a comparison of a DAV property with a literal.
+func compare(op, prop, literal string) string {
+	return fmt.Sprintf("<D:%s><D:prop><D:%s/></D:prop><D:literal>%s</D:literal></D:%s>", op, prop, literal, op)
+}
+
+// combine joins conditions with op ("and" or "or"), leaving a single
+// condition bare.
+func combine(op string, conds []string) string {
+	if len(conds) == 1 {
+		return conds[0]
+	}
+	return "<D:" + op + ">" + strings.Join(conds, "") + "</D:" + op + ">"
+}
+
+// escapeXML escapes s for use as character data.
+func escapeXML(s string) (string, error) {
+	var b strings.Builder
+	if err := xml.EscapeText(&b, []byte(s)); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,90 @@
+package webdav
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"digital.vasic.filesystem/pkg/client"
+)
+
+// GetSpace reports the RFC 4331 quota-available-bytes and quota-used-bytes
+// properties of path. WebDAV has no volume size, so Total is zero and
+// Quota is the sum of both. Servers without the properties, or reporting a
+// negative (unlimited or unknown) availability as Nextcloud does, yield
+// client.ErrNotSupported.
+func (c *Client) GetSpace(ctx context.Context, path string) (*client.SpaceInfo, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+
+	body := `<?xml version="1.0" encoding="utf-8" ?>
+<D:propfind xmlns:D="DAV:">
+	<D:prop>
+		<D:quota-available-bytes/>
+		<D:quota-used-bytes/>
+	</D:prop>
+</D:propfind>`
+	ms, err := c.propfind(ctx, path, "0", body)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range ms.Responses {
+		for _, ps := range r.Propstats {
+			if !ps.ok() || ps.Prop.QuotaAvailable == "" {
+				continue
+			}
+			avail, err := strconv.ParseInt(strings.TrimSpace(ps.Prop.QuotaAvailable), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse quota-available-bytes of %s: %w", path, err)
+			}
+			if avail < 0 {
+				break
+			}
+			var used int64
+			if v := strings.TrimSpace(ps.Prop.QuotaUsed); v != "" {
+				if used, err = strconv.ParseInt(v, 10, 64); err != nil {
+					return nil, fmt.Errorf("failed to parse quota-used-bytes of %s: %w", path, err)
+				}
+			}
+			return &client.SpaceInfo{Free: avail, Used: used, Quota: avail + used}, nil
+		}
+	}
+	return nil, fmt.Errorf("WebDAV server reports no quota for %s: %w", path, client.ErrNotSupported)
+}
+
+// DirUsage reports the quota-used-bytes property of the collection at
+// path. Only the byte total is known, so Files and Dirs are -1. Servers
+// such as Nextcloud report the size of the subtree; others (Apache
+// mod_dav) report the usage of the whole volume, so callers opt in with
+// usage.Options.SizeOnly.
+func (c *Client) DirUsage(ctx context.Context, path string) (*client.DirUsage, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+
+	body := `<?xml version="1.0" encoding="utf-8" ?>
+<D:propfind xmlns:D="DAV:">
+	<D:prop>
+		<D:quota-used-bytes/>
+	</D:prop>
+</D:propfind>`
+	ms, err := c.propfind(ctx, path, "0", body)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range ms.Responses {
+		for _, ps := range r.Propstats {
+			if !ps.ok() || ps.Prop.QuotaUsed == "" {
+				continue
+			}
+			used, err := strconv.ParseInt(strings.TrimSpace(ps.Prop.QuotaUsed), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse quota-used-bytes of %s: %w", path, err)
+			}
+			return &client.DirUsage{Bytes: used, Files: -1, Dirs: -1}, nil
+		}
+	}
+	return nil, fmt.Errorf("WebDAV server reports no quota-used-bytes for %s: %w", path, client.ErrNotSupported)
+}
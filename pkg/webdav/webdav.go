@@ -3,8 +3,11 @@ package webdav
 
 import (
 	"context"
+	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"io"
+	"iter"
 	"net/http"
 	"net/url"
 	"path/filepath"
@@ -13,6 +16,8 @@ import (
 	"time"
 
 	"digital.vasic.filesystem/pkg/client"
+	"digital.vasic.filesystem/pkg/confine"
+	"digital.vasic.filesystem/pkg/watch"
 )
 
 // Config contains WebDAV connection configuration.
@@ -23,6 +28,13 @@ type Config struct {
 	Path     string `json:"path"`
 }
 
+// MarshalJSON encodes the configuration with the password redacted.
+func (c Config) MarshalJSON() ([]byte, error) {
+	type plain Config
+	c.Password = client.RedactSecret(c.Password)
+	return json.Marshal(plain(c))
+}
+
 // Client implements client.Client for WebDAV protocol.
 type Client struct {
 	config    *Config
@@ -91,16 +103,17 @@ func (c *Client) TestConnection(ctx context.Context) error {
 	return c.Connect(ctx)
 }
 
-// resolveURL resolves a relative path to a full WebDAV URL.
-func (c *Client) resolveURL(path string) string {
-	cleanPath := filepath.Clean(path)
-	if strings.Contains(cleanPath, "..") {
-		cleanPath = strings.ReplaceAll(cleanPath, "..", "")
+// resolveURL resolves a relative path to a full WebDAV URL, rejecting paths
+// that escape the base path. Links are resolved by the server.
+func (c *Client) resolveURL(path string) (string, error) {
+	cleanPath, err := confine.Clean(path)
+	if err != nil {
+		return "", err
 	}
 
 	u := *c.baseURL
 	u.Path = filepath.Join(u.Path, cleanPath)
-	return u.String()
+	return u.String(), nil
 }
 
 // ReadFile reads a file from the WebDAV server.
@@ -109,7 +122,10 @@ func (c *Client) ReadFile(ctx context.Context, path string) (io.ReadCloser, erro
 		return nil, fmt.Errorf("not connected")
 	}
 
-	fullURL := c.resolveURL(path)
+	fullURL, err := c.resolveURL(path)
+	if err != nil {
+		return nil, err
+	}
 	req, err := http.NewRequestWithContext(ctx, "GET", fullURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create GET request: %w", err)
@@ -138,7 +154,10 @@ func (c *Client) WriteFile(ctx context.Context, path string, data io.Reader) err
 		return fmt.Errorf("not connected")
 	}
 
-	fullURL := c.resolveURL(path)
+	fullURL, err := c.resolveURL(path)
+	if err != nil {
+		return err
+	}
 	req, err := http.NewRequestWithContext(ctx, "PUT", fullURL, data)
 	if err != nil {
 		return fmt.Errorf("failed to create PUT request: %w", err)
@@ -161,13 +180,33 @@ func (c *Client) WriteFile(ctx context.Context, path string, data io.Reader) err
 	return nil
 }
 
+// Create returns a writer that streams into a PUT request with chunked
+// transfer encoding. The server's response is checked on Close.
+func (c *Client) Create(ctx context.Context, path string) (io.WriteCloser, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+	return client.NewPipeWriter(func(r io.Reader) error {
+		return c.WriteFile(ctx, path, r)
+	}), nil
+}
+
+// OpenAppend is not supported: WebDAV has no standard way to append to a
+// resource.
+func (c *Client) OpenAppend(ctx context.Context, path string) (io.WriteCloser, error) {
+	return nil, fmt.Errorf("WebDAV cannot append to %s: %w", path, client.ErrNotSupported)
+}
+
 // GetFileInfo gets information about a file.
 func (c *Client) GetFileInfo(ctx context.Context, path string) (*client.FileInfo, error) {
 	if !c.IsConnected() {
 		return nil, fmt.Errorf("not connected")
 	}
 
-	fullURL := c.resolveURL(path)
+	fullURL, err := c.resolveURL(path)
+	if err != nil {
+		return nil, err
+	}
 	req, err := http.NewRequestWithContext(ctx, "HEAD", fullURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create HEAD request: %w", err)
@@ -215,24 +254,37 @@ func (c *Client) GetFileInfo(ctx context.Context, path string) (*client.FileInfo
 
 // ListDirectory lists files in a directory.
 func (c *Client) ListDirectory(ctx context.Context, path string) ([]*client.FileInfo, error) {
-	if !c.IsConnected() {
-		return nil, fmt.Errorf("not connected")
-	}
+	return client.CollectFiles(c.StreamDirectory(ctx, path))
+}
 
-	fullURL := c.resolveURL(path)
-	req, err := http.NewRequestWithContext(ctx, "PROPFIND", fullURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create PROPFIND request: %w", err)
-	}
+// StreamDirectory yields the entries of a directory as the Depth 1
+// PROPFIND response is decoded, one D:response element at a time.
+func (c *Client) StreamDirectory(ctx context.Context, path string) iter.Seq2[*client.FileInfo, error] {
+	return func(yield func(*client.FileInfo, error) bool) {
+		if !c.IsConnected() {
+			yield(nil, fmt.Errorf("not connected"))
+			return
+		}
 
-	if c.config.Username != "" {
-		req.SetBasicAuth(c.config.Username, c.config.Password)
-	}
+		fullURL, err := c.resolveURL(path)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		req, err := http.NewRequestWithContext(ctx, "PROPFIND", fullURL, nil)
+		if err != nil {
+			yield(nil, fmt.Errorf("failed to create PROPFIND request: %w", err))
+			return
+		}
+
+		if c.config.Username != "" {
+			req.SetBasicAuth(c.config.Username, c.config.Password)
+		}
 
-	req.Header.Set("Depth", "1")
-	req.Header.Set("Content-Type", "application/xml")
+		req.Header.Set("Depth", "1")
+		req.Header.Set("Content-Type", "application/xml")
 
-	body := `<?xml version="1.0" encoding="utf-8" ?>
+		body := `<?xml version="1.0" encoding="utf-8" ?>
 <D:propfind xmlns:D="DAV:">
 	<D:prop>
 		<D:displayname/>
@@ -242,120 +294,96 @@ func (c *Client) ListDirectory(ctx context.Context, path string) ([]*client.File
 	</D:prop>
 </D:propfind>`
 
-	req.Body = io.NopCloser(strings.NewReader(body))
-	req.ContentLength = int64(len(body))
+		req.Body = io.NopCloser(strings.NewReader(body))
+		req.ContentLength = int64(len(body))
 
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list WebDAV directory %s: %w", fullURL, err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusMultiStatus {
-		return nil, fmt.Errorf("WebDAV server returned status %d for directory %s", resp.StatusCode, fullURL)
-	}
+		resp, err := c.client.Do(req)
+		if err != nil {
+			yield(nil, fmt.Errorf("failed to list WebDAV directory %s: %w", fullURL, err))
+			return
+		}
+		defer resp.Body.Close()
 
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read WebDAV response: %w", err)
-	}
+		if resp.StatusCode != http.StatusMultiStatus {
+			yield(nil, fmt.Errorf("WebDAV server returned status %d for directory %s", resp.StatusCode, fullURL))
+			return
+		}
 
-	var files []*client.FileInfo
+		// WebDAV HREFs come back as path-only (e.g., "/webdav/") not full
+		// URLs. Compute the request-path portion of fullURL so we can
+		// filter out the parent-directory self-reference that PROPFIND
+		// always includes.
+		requestPath := fullURL
+		if u, err := url.Parse(fullURL); err == nil {
+			requestPath = u.Path
+		}
 
-	// WebDAV HREFs come back as path-only (e.g., "/webdav/") not full
-	// URLs. Compute the request-path portion of fullURL so we can
-	// filter out the parent-directory self-reference that PROPFIND
-	// always includes.
-	requestPath := fullURL
-	if u, err := url.Parse(fullURL); err == nil {
-		requestPath = u.Path
+		err = decodeResponses(resp.Body, func(r davResponse) bool {
+			fi := listEntry(r, fullURL, requestPath)
+			return fi == nil || yield(fi, nil)
+		})
+		if err != nil {
+			yield(nil, err)
+		}
 	}
-	requestPathNoSlash := strings.TrimSuffix(requestPath, "/")
-
-	responseStr := string(bodyBytes)
-	responses := strings.Split(responseStr, "<D:response>")
-
-	for i := 1; i < len(responses); i++ {
-		response := responses[i]
+}
 
-		endIndex := strings.Index(response, "</D:response>")
-		if endIndex == -1 {
-			continue
+// decodeResponses decodes a multistatus body one D:response element at a
+// time, passing each to fn until it returns false.
+func decodeResponses(body io.Reader, fn func(davResponse) bool) error {
+	decoder := xml.NewDecoder(body)
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			return nil
 		}
-		response = response[:endIndex]
-
-		hrefStart := strings.Index(response, "<D:href>")
-		hrefEnd := strings.Index(response, "</D:href>")
-		if hrefStart == -1 || hrefEnd == -1 {
-			continue
+		if err != nil {
+			return fmt.Errorf("failed to read WebDAV response: %w", err)
 		}
-		href := response[hrefStart+8 : hrefEnd]
-
-		// Filter out the parent directory self-reference. PROPFIND
-		// with Depth: 1 always includes the queried directory itself
-		// as the first entry. Also compare against full-URL forms for
-		// servers that echo absolute hrefs.
-		hrefNoSlash := strings.TrimSuffix(href, "/")
-		if href == fullURL ||
-			href == strings.TrimSuffix(fullURL, "/") ||
-			href == requestPath ||
-			hrefNoSlash == requestPathNoSlash {
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Space != "DAV:" || start.Name.Local != "response" {
 			continue
 		}
-
-		displayName := filepath.Base(href)
-		nameStart := strings.Index(response, "<D:displayname>")
-		nameEnd := strings.Index(response, "</D:displayname>")
-		if nameStart != -1 && nameEnd != -1 {
-			displayName = response[nameStart+16 : nameEnd]
+		var r davResponse
+		if err := decoder.DecodeElement(&r, &start); err != nil {
+			return fmt.Errorf("failed to read WebDAV response: %w", err)
 		}
-
-		var size int64
-		sizeStart := strings.Index(response, "<D:getcontentlength>")
-		sizeEnd := strings.Index(response, "</D:getcontentlength>")
-		if sizeStart != -1 && sizeEnd != -1 {
-			sizeStr := response[sizeStart+20 : sizeEnd]
-			if s, err := strconv.ParseInt(sizeStr, 10, 64); err == nil {
-				size = s
-			}
-		}
-
-		modTime := time.Now()
-		modStart := strings.Index(response, "<D:getlastmodified>")
-		modEnd := strings.Index(response, "</D:getlastmodified>")
-		if modStart != -1 && modEnd != -1 {
-			modStr := response[modStart+20 : modEnd]
-			if t, err := time.Parse(time.RFC1123, modStr); err == nil {
-				modTime = t
-			} else if t, err := time.Parse("Mon, 2 Jan 2006 15:04:05 MST", modStr); err == nil {
-				modTime = t
-			}
+		if !fn(r) {
+			return nil
 		}
+	}
+}
 
-		isDir := false
-		if strings.Contains(response, "<D:resourcetype><D:collection/></D:resourcetype>") ||
-			strings.Contains(response, "<D:resourcetype><D:directory/></D:resourcetype>") {
-			isDir = true
-		}
+// listEntry converts one response of a directory listing, returning nil
+// for the directory itself.
+func listEntry(r davResponse, fullURL, requestPath string) *client.FileInfo {
+	href := r.Href
 
-		relPath := strings.TrimPrefix(href, fullURL)
-		if relPath == "" {
-			relPath = displayName
-		} else {
-			relPath = strings.TrimPrefix(relPath, "/")
-		}
+	// Filter out the parent directory self-reference. PROPFIND with
+	// Depth: 1 always includes the queried directory itself as the first
+	// entry. Also compare against full-URL forms for servers that echo
+	// absolute hrefs.
+	hrefNoSlash := strings.TrimSuffix(href, "/")
+	if href == fullURL ||
+		href == strings.TrimSuffix(fullURL, "/") ||
+		href == requestPath ||
+		hrefNoSlash == strings.TrimSuffix(requestPath, "/") {
+		return nil
+	}
 
-		files = append(files, &client.FileInfo{
-			Name:    displayName,
-			Size:    size,
-			ModTime: modTime,
-			IsDir:   isDir,
-			Mode:    0644,
-			Path:    relPath,
-		})
+	prop := r.props()
+	displayName := filepath.Base(href)
+	if prop.DisplayName != "" {
+		displayName = prop.DisplayName
 	}
 
-	return files, nil
+	relPath := strings.TrimPrefix(href, fullURL)
+	if relPath == "" {
+		relPath = displayName
+	} else {
+		relPath = strings.TrimPrefix(relPath, "/")
+	}
+	return prop.fileInfo(displayName, relPath)
 }
 
 // FileExists checks if a file exists.
@@ -364,7 +392,10 @@ func (c *Client) FileExists(ctx context.Context, path string) (bool, error) {
 		return false, fmt.Errorf("not connected")
 	}
 
-	fullURL := c.resolveURL(path)
+	fullURL, err := c.resolveURL(path)
+	if err != nil {
+		return false, err
+	}
 	req, err := http.NewRequestWithContext(ctx, "HEAD", fullURL, nil)
 	if err != nil {
 		return false, fmt.Errorf("failed to create HEAD request: %w", err)
@@ -389,7 +420,10 @@ func (c *Client) CreateDirectory(ctx context.Context, path string) error {
 		return fmt.Errorf("not connected")
 	}
 
-	fullURL := c.resolveURL(path)
+	fullURL, err := c.resolveURL(path)
+	if err != nil {
+		return err
+	}
 	req, err := http.NewRequestWithContext(ctx, "MKCOL", fullURL, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create MKCOL request: %w", err)
@@ -418,7 +452,10 @@ func (c *Client) DeleteDirectory(ctx context.Context, path string) error {
 		return fmt.Errorf("not connected")
 	}
 
-	fullURL := c.resolveURL(path)
+	fullURL, err := c.resolveURL(path)
+	if err != nil {
+		return err
+	}
 	req, err := http.NewRequestWithContext(ctx, "DELETE", fullURL, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create DELETE request: %w", err)
@@ -447,7 +484,10 @@ func (c *Client) DeleteFile(ctx context.Context, path string) error {
 		return fmt.Errorf("not connected")
 	}
 
-	fullURL := c.resolveURL(path)
+	fullURL, err := c.resolveURL(path)
+	if err != nil {
+		return err
+	}
 	req, err := http.NewRequestWithContext(ctx, "DELETE", fullURL, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create DELETE request: %w", err)
@@ -476,8 +516,14 @@ func (c *Client) CopyFile(ctx context.Context, srcPath, dstPath string) error {
 		return fmt.Errorf("not connected")
 	}
 
-	srcURL := c.resolveURL(srcPath)
-	dstURL := c.resolveURL(dstPath)
+	srcURL, err := c.resolveURL(srcPath)
+	if err != nil {
+		return err
+	}
+	dstURL, err := c.resolveURL(dstPath)
+	if err != nil {
+		return err
+	}
 
 	req, err := http.NewRequestWithContext(ctx, "COPY", srcURL, nil)
 	if err != nil {
@@ -503,12 +549,22 @@ func (c *Client) CopyFile(ctx context.Context, srcPath, dstPath string) error {
 	return nil
 }
 
+// Watch reports changes below path by polling PROPFIND listings.
+func (c *Client) Watch(ctx context.Context, path string, recursive bool) (<-chan client.Event, error) {
+	if !c.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+	return watch.Poll(ctx, c, path, recursive, watch.DefaultPollInterval)
+}
+
 // GetProtocol returns the protocol name.
 func (c *Client) GetProtocol() string {
 	return "webdav"
 }
 
-// GetConfig returns the WebDAV configuration.
+// GetConfig returns a copy of the WebDAV configuration with the password redacted.
 func (c *Client) GetConfig() interface{} {
-	return c.config
+	config := *c.config
+	config.Password = client.RedactSecret(config.Password)
+	return &config
 }
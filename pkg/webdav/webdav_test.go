@@ -2,21 +2,35 @@ package webdav
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"digital.vasic.filesystem/pkg/client"
+	"digital.vasic.filesystem/pkg/confine"
 )
 
-// Verify WebDAV Client implements client.Client interface.
-var _ client.Client = (*Client)(nil)
+// Verify WebDAV Client implements the client.Client interface and its extensions.
+var (
+	_ client.Client            = (*Client)(nil)
+	_ client.Watcher           = (*Client)(nil)
+	_ client.WritableClient    = (*Client)(nil)
+	_ client.Hasher            = (*Client)(nil)
+	_ client.AttributeSetter   = (*Client)(nil)
+	_ client.SpaceReporter     = (*Client)(nil)
+	_ client.DirectoryStreamer = (*Client)(nil)
+	_ client.Searcher          = (*Client)(nil)
+	_ client.UsageReporter     = (*Client)(nil)
+	_ client.MetadataStore     = (*Client)(nil)
+)
 
 func TestNewWebDAVClient(t *testing.T) {
 	config := &Config{
@@ -74,7 +88,20 @@ func TestWebDAVClient_GetConfig(t *testing.T) {
 		Path:     "/",
 	}
 	c := NewWebDAVClient(config)
-	assert.Equal(t, config, c.GetConfig())
+	got, ok := c.GetConfig().(*Config)
+	require.True(t, ok)
+	assert.Equal(t, client.RedactedSecret, got.Password)
+	assert.Equal(t, "secret", config.Password, "original config must not be modified")
+	expected := *config
+	expected.Password = client.RedactedSecret
+	assert.Equal(t, &expected, got)
+}
+
+func TestConfig_MarshalJSON_RedactsPassword(t *testing.T) {
+	data, err := json.Marshal(Config{Username: "admin", Password: "s3cret"})
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "s3cret")
+	assert.Contains(t, string(data), client.RedactedSecret)
 }
 
 func TestWebDAVClient_IsConnected_NotConnected(t *testing.T) {
@@ -166,21 +193,30 @@ func TestWebDAVClient_CopyFile_NotConnected(t *testing.T) {
 
 func TestWebDAVClient_ResolveURL(t *testing.T) {
 	c := NewWebDAVClient(&Config{URL: "http://localhost/webdav"})
-	resolved := c.resolveURL("test.txt")
+	resolved, err := c.resolveURL("test.txt")
+	require.NoError(t, err)
 	assert.Contains(t, resolved, "test.txt")
 	assert.Contains(t, resolved, "http://localhost")
 }
 
 func TestWebDAVClient_ResolveURL_PathTraversal(t *testing.T) {
 	c := NewWebDAVClient(&Config{URL: "http://localhost/webdav"})
-	resolved := c.resolveURL("../../../etc/passwd")
-	assert.NotContains(t, resolved, "..")
+	_, err := c.resolveURL("../../../etc/passwd")
+	assert.ErrorIs(t, err, confine.ErrEscape)
 }
 
 func TestWebDAVClient_ResolveURL_CleanPath(t *testing.T) {
 	c := NewWebDAVClient(&Config{URL: "http://localhost/webdav"})
-	resolved := c.resolveURL("./subdir/../test.txt")
-	assert.NotContains(t, resolved, "..")
+	resolved, err := c.resolveURL("./subdir/../test.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost/webdav/test.txt", resolved)
+}
+
+func TestWebDAVClient_ResolveURL_DotsInName(t *testing.T) {
+	c := NewWebDAVClient(&Config{URL: "http://localhost/webdav"})
+	resolved, err := c.resolveURL("a..b/file..txt")
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost/webdav/a..b/file..txt", resolved)
 }
 
 // httptest server tests
@@ -619,3 +655,466 @@ func TestWebDAVConfig_Fields(t *testing.T) {
 	assert.Equal(t, "s3cret", config.Password)
 	assert.Equal(t, "/media", config.Path)
 }
+
+func TestWebDAVClient_Hash(t *testing.T) {
+	ts := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PROPFIND" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		assert.Equal(t, "0", r.Header.Get("Depth"))
+		body, _ := io.ReadAll(r.Body)
+		assert.Contains(t, string(body), "checksums")
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprint(w, `<?xml version="1.0"?>
+<d:multistatus xmlns:d="DAV:" xmlns:oc="http://owncloud.org/ns">
+<d:response>
+<d:href>/remote.php/dav/files/u/doc.txt</d:href>
+<d:propstat><d:prop><oc:checksums><oc:checksum>SHA1:A94A8FE5CCB19BA61C4C0873D391E987982FBBD3 MD5:098f6bcd4621d373cade4e832627b4f6 ADLER32:045d01c1</oc:checksum></oc:checksums></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>
+</d:response>
+</d:multistatus>`)
+	})
+	defer ts.Close()
+
+	c := NewWebDAVClient(&Config{URL: ts.URL})
+	c.connected = true
+
+	sum, err := c.Hash(context.Background(), "doc.txt", client.HashSHA1)
+	require.NoError(t, err)
+	assert.Equal(t, "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3", sum)
+
+	sum, err = c.Hash(context.Background(), "doc.txt", client.HashMD5)
+	require.NoError(t, err)
+	assert.Equal(t, "098f6bcd4621d373cade4e832627b4f6", sum)
+
+	_, err = c.Hash(context.Background(), "doc.txt", client.HashSHA256)
+	assert.ErrorIs(t, err, client.ErrNotSupported)
+	_, err = c.Hash(context.Background(), "doc.txt", client.HashXXH64)
+	assert.ErrorIs(t, err, client.ErrNotSupported)
+
+	sums, err := c.Hashes(context.Background(), "doc.txt")
+	require.NoError(t, err)
+	assert.Equal(t, map[client.HashAlgorithm]string{
+		client.HashSHA1: "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3",
+		client.HashMD5:  "098f6bcd4621d373cade4e832627b4f6",
+	}, sums)
+}
+
+func TestWebDAVClient_Hash_ServerError(t *testing.T) {
+	ts := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	defer ts.Close()
+
+	c := NewWebDAVClient(&Config{URL: ts.URL})
+	c.connected = true
+
+	_, err := c.Hash(context.Background(), "missing.txt", client.HashSHA1)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, client.ErrNotSupported)
+	_, err = c.Hashes(context.Background(), "missing.txt")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, client.ErrNotSupported)
+}
+
+func TestWebDAVClient_Hash_NotConnected(t *testing.T) {
+	c := NewWebDAVClient(&Config{URL: "http://localhost"})
+	_, err := c.Hash(context.Background(), "doc.txt", client.HashSHA1)
+	assert.EqualError(t, err, "not connected")
+}
+
+func TestWebDAVClient_Create(t *testing.T) {
+	var got []byte
+	var chunked bool
+	ts := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		chunked = len(r.TransferEncoding) > 0 && r.TransferEncoding[0] == "chunked"
+		got, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	})
+	defer ts.Close()
+
+	c := NewWebDAVClient(&Config{URL: ts.URL})
+	c.connected = true
+
+	w, err := c.Create(context.Background(), "log.txt")
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := fmt.Fprintf(w, "line %d\n", i)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	assert.Equal(t, "line 0\nline 1\nline 2\n", string(got))
+	assert.True(t, chunked)
+}
+
+func TestWebDAVClient_Create_ServerError(t *testing.T) {
+	ts := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusInsufficientStorage)
+	})
+	defer ts.Close()
+
+	c := NewWebDAVClient(&Config{URL: ts.URL})
+	c.connected = true
+
+	w, err := c.Create(context.Background(), "big.bin")
+	require.NoError(t, err)
+	_, _ = w.Write([]byte("data"))
+	err = w.Close()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "507")
+}
+
+func TestWebDAVClient_Create_NotConnected(t *testing.T) {
+	c := NewWebDAVClient(&Config{URL: "http://localhost"})
+	w, err := c.Create(context.Background(), "test.txt")
+	assert.Error(t, err)
+	assert.Nil(t, w)
+}
+
+func TestWebDAVClient_OpenAppend_NotSupported(t *testing.T) {
+	c := NewWebDAVClient(&Config{URL: "http://localhost"})
+	c.connected = true
+	_, err := c.OpenAppend(context.Background(), "test.txt")
+	assert.ErrorIs(t, err, client.ErrNotSupported)
+}
+
+func TestWebDAVClient_Chtimes(t *testing.T) {
+	mtime := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	status := "HTTP/1.1 200 OK"
+	ts := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PROPPATCH" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		assert.Empty(t, r.Header.Get("Depth"))
+		body, _ := io.ReadAll(r.Body)
+		assert.Contains(t, string(body), "<D:getlastmodified>Fri, 01 Mar 2024 12:30:00 GMT</D:getlastmodified>")
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprintf(w, `<?xml version="1.0"?>
+<d:multistatus xmlns:d="DAV:">
+<d:response>
+<d:href>/doc.txt</d:href>
+<d:propstat><d:prop><d:getlastmodified/></d:prop><d:status>%s</d:status></d:propstat>
+</d:response>
+</d:multistatus>`, status)
+	})
+	defer ts.Close()
+
+	c := NewWebDAVClient(&Config{URL: ts.URL})
+	c.connected = true
+	ctx := context.Background()
+
+	require.NoError(t, c.Chtimes(ctx, "doc.txt", time.Time{}, mtime))
+
+	status = "HTTP/1.1 403 Forbidden"
+	err := c.Chtimes(ctx, "doc.txt", time.Time{}, mtime)
+	assert.ErrorIs(t, err, client.ErrNotSupported)
+	assert.Contains(t, err.Error(), "403")
+
+	assert.NoError(t, c.Chtimes(ctx, "doc.txt", time.Now(), time.Time{}), "nothing to set")
+	assert.ErrorIs(t, c.Chmod(ctx, "doc.txt", 0644), client.ErrNotSupported)
+	assert.ErrorIs(t, c.Chown(ctx, "doc.txt", 0, 0), client.ErrNotSupported)
+}
+
+func TestWebDAVClient_Chtimes_MethodNotAllowed(t *testing.T) {
+	ts := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	})
+	defer ts.Close()
+
+	c := NewWebDAVClient(&Config{URL: ts.URL})
+	c.connected = true
+
+	err := c.Chtimes(context.Background(), "doc.txt", time.Time{}, time.Now())
+	assert.ErrorIs(t, err, client.ErrNotSupported)
+}
+
+func TestWebDAVClient_Attributes_NotConnected(t *testing.T) {
+	c := NewWebDAVClient(&Config{URL: "http://localhost"})
+	ctx := context.Background()
+	assert.EqualError(t, c.Chmod(ctx, "a", 0644), "not connected")
+	assert.EqualError(t, c.Chtimes(ctx, "a", time.Time{}, time.Now()), "not connected")
+	assert.EqualError(t, c.Chown(ctx, "a", 0, 0), "not connected")
+}
+
+func TestWebDAVClient_Metadata(t *testing.T) {
+	var patches []string
+	ts := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch r.Method {
+		case "PROPFIND":
+			assert.Contains(t, string(body), "allprop")
+			w.WriteHeader(http.StatusMultiStatus)
+			fmt.Fprint(w, `<?xml version="1.0"?>
+<d:multistatus xmlns:d="DAV:" xmlns:m="urn:digital.vasic.filesystem:metadata" xmlns:x="urn:other">
+<d:response>
+<d:href>/clip.mov</d:href>
+<d:propstat><d:prop><d:getcontentlength>1</d:getcontentlength><m:job>ingest-42</m:job><m:note>a &amp; b</m:note><x:job>foreign</x:job></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>
+</d:response>
+</d:multistatus>`)
+		case "PROPPATCH":
+			patches = append(patches, string(body))
+			w.WriteHeader(http.StatusMultiStatus)
+			fmt.Fprint(w, `<?xml version="1.0"?>
+<d:multistatus xmlns:d="DAV:"><d:response><d:href>/clip.mov</d:href>
+<d:propstat><d:prop/><d:status>HTTP/1.1 200 OK</d:status></d:propstat>
+</d:response></d:multistatus>`)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	defer ts.Close()
+
+	c := NewWebDAVClient(&Config{URL: ts.URL})
+	c.connected = true
+	ctx := context.Background()
+
+	meta, err := c.GetMetadata(ctx, "clip.mov")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"job": "ingest-42", "note": "a & b"}, meta)
+
+	require.NoError(t, c.SetMetadata(ctx, "clip.mov", map[string]string{"note": "<x> & y"}))
+	require.NoError(t, c.DeleteMetadata(ctx, "clip.mov", "job"))
+	require.Len(t, patches, 2)
+	assert.Contains(t, patches[0], "<D:set>")
+	assert.Contains(t, patches[0], "<m:note>&lt;x&gt; &amp; y</m:note>")
+	assert.Contains(t, patches[1], "<D:remove>")
+	assert.Contains(t, patches[1], "<m:job/>")
+
+	assert.ErrorIs(t, c.SetMetadata(ctx, "clip.mov", map[string]string{"a b": "x"}), client.ErrInvalidMetadataKey)
+	assert.Len(t, patches, 2, "invalid keys are rejected before any request")
+}
+
+func TestWebDAVClient_Metadata_NotConnected(t *testing.T) {
+	c := NewWebDAVClient(&Config{URL: "http://localhost"})
+	ctx := context.Background()
+	_, err := c.GetMetadata(ctx, "a")
+	assert.EqualError(t, err, "not connected")
+	assert.EqualError(t, c.SetMetadata(ctx, "a", map[string]string{"k": "v"}), "not connected")
+	assert.EqualError(t, c.DeleteMetadata(ctx, "a", "k"), "not connected")
+}
+
+func TestWebDAVClient_GetSpace_NotConnected(t *testing.T) {
+	c := NewWebDAVClient(&Config{URL: "http://localhost"})
+	_, err := c.GetSpace(context.Background(), "")
+	assert.EqualError(t, err, "not connected")
+}
+
+func TestWebDAVClient_GetSpace(t *testing.T) {
+	available := "1000"
+	ts := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "PROPFIND", r.Method)
+		assert.Contains(t, string(body), "quota-available-bytes")
+		w.WriteHeader(http.StatusMultiStatus)
+		prop := ""
+		if available != "" {
+			prop = "<d:quota-available-bytes>" + available + "</d:quota-available-bytes><d:quota-used-bytes>250</d:quota-used-bytes>"
+		}
+		fmt.Fprintf(w, `<?xml version="1.0"?>
+<d:multistatus xmlns:d="DAV:"><d:response><d:href>/</d:href>
+<d:propstat><d:prop>%s</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>
+</d:response></d:multistatus>`, prop)
+	})
+	defer ts.Close()
+
+	c := NewWebDAVClient(&Config{URL: ts.URL})
+	c.connected = true
+	ctx := context.Background()
+
+	space, err := c.GetSpace(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, &client.SpaceInfo{Free: 1000, Used: 250, Quota: 1250}, space)
+
+	available = "-3"
+	_, err = c.GetSpace(ctx, "")
+	assert.ErrorIs(t, err, client.ErrNotSupported, "unlimited quota")
+
+	available = ""
+	_, err = c.GetSpace(ctx, "")
+	assert.ErrorIs(t, err, client.ErrNotSupported, "no RFC 4331 properties")
+
+	available = "lots"
+	_, err = c.GetSpace(ctx, "")
+	assert.Error(t, err)
+}
+
+func TestWebDAVClient_DirUsage(t *testing.T) {
+	used := "4096"
+	ts := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Contains(t, string(body), "quota-used-bytes")
+		assert.Equal(t, "0", r.Header.Get("Depth"))
+		w.WriteHeader(http.StatusMultiStatus)
+		prop := ""
+		if used != "" {
+			prop = "<d:quota-used-bytes>" + used + "</d:quota-used-bytes>"
+		}
+		fmt.Fprintf(w, `<?xml version="1.0"?>
+<d:multistatus xmlns:d="DAV:"><d:response><d:href>/photos/</d:href>
+<d:propstat><d:prop>%s</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>
+</d:response></d:multistatus>`, prop)
+	})
+	defer ts.Close()
+
+	c := NewWebDAVClient(&Config{URL: ts.URL})
+	c.connected = true
+
+	usage, err := c.DirUsage(context.Background(), "photos")
+	require.NoError(t, err)
+	assert.Equal(t, &client.DirUsage{Bytes: 4096, Files: -1, Dirs: -1}, usage)
+
+	used = ""
+	_, err = c.DirUsage(context.Background(), "photos")
+	assert.ErrorIs(t, err, client.ErrNotSupported)
+}
+
+func TestWebDAVClient_DirUsage_NotConnected(t *testing.T) {
+	c := NewWebDAVClient(&Config{URL: "http://localhost"})
+	_, err := c.DirUsage(context.Background(), "")
+	assert.EqualError(t, err, "not connected")
+}
+
+func TestWebDAVClient_StreamDirectory_NotConnected(t *testing.T) {
+	c := NewWebDAVClient(&Config{URL: "http://localhost"})
+	_, err := client.CollectFiles(c.StreamDirectory(context.Background(), ""))
+	assert.EqualError(t, err, "not connected")
+}
+
+func TestWebDAVClient_StreamDirectory(t *testing.T) {
+	release := make(chan struct{})
+	ts := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?>
+<d:multistatus xmlns:d="DAV:">
+<d:response><d:href>/dumps/</d:href>
+<d:propstat><d:prop><d:resourcetype><d:collection/></d:resourcetype></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>
+</d:response>
+<d:response><d:href>/dumps/IMG_0001.JPG</d:href>
+<d:propstat><d:prop><d:getcontentlength>2048</d:getcontentlength><d:resourcetype/></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>
+<d:propstat><d:prop><d:displayname/></d:prop><d:status>HTTP/1.1 404 Not Found</d:status></d:propstat>
+</d:response>
+`)
+		w.(http.Flusher).Flush()
+		<-release
+		fmt.Fprint(w, `<d:response><d:href>/dumps/raw/</d:href>
+<d:propstat><d:prop><d:displayname>raw</d:displayname><d:resourcetype><d:collection/></d:resourcetype></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>
+</d:response>
+</d:multistatus>`)
+	})
+	defer ts.Close()
+	defer close(release)
+
+	c := NewWebDAVClient(&Config{URL: ts.URL})
+	c.connected = true
+
+	var names []string
+	for f, err := range c.StreamDirectory(context.Background(), "dumps") {
+		require.NoError(t, err)
+		names = append(names, f.Name)
+		if len(names) == 1 {
+			assert.Equal(t, "IMG_0001.JPG", f.Name)
+			assert.Equal(t, int64(2048), f.Size)
+			assert.False(t, f.IsDir)
+			release <- struct{}{}
+		} else {
+			assert.True(t, f.IsDir)
+		}
+	}
+	assert.Equal(t, []string{"IMG_0001.JPG", "raw"}, names, "the first entry arrives before the response ends")
+}
+
+func TestWebDAVClient_StreamDirectory_Malformed(t *testing.T) {
+	ts := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprint(w, `<D:multistatus xmlns:D="DAV:"><D:response><D:href>/a.txt</D:href></D:response><D:response><D:href>`)
+	})
+	defer ts.Close()
+
+	c := NewWebDAVClient(&Config{URL: ts.URL})
+	c.connected = true
+
+	var names []string
+	var err error
+	for f, ferr := range c.StreamDirectory(context.Background(), "") {
+		if ferr != nil {
+			err = ferr
+			break
+		}
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"a.txt"}, names)
+	assert.Error(t, err)
+}
+
+func TestWebDAVClient_Search(t *testing.T) {
+	var body string
+	status := http.StatusMultiStatus
+	ts := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "SEARCH", r.Method)
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(status)
+		if status != http.StatusMultiStatus {
+			return
+		}
+		fmt.Fprint(w, `<?xml version="1.0"?>
+<d:multistatus xmlns:d="DAV:">
+<d:response><d:href>/media/</d:href>
+<d:propstat><d:prop><d:resourcetype><d:collection/></d:resourcetype></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>
+<d:response><d:href>/media/2024/My%20Film.mkv</d:href>
+<d:propstat><d:prop><d:getcontentlength>4096</d:getcontentlength><d:getlastmodified>Mon, 02 Jan 2006 15:04:05 GMT</d:getlastmodified><d:resourcetype/></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>
+<d:response><d:href>/media/2024/notes.txt</d:href>
+<d:propstat><d:prop><d:displayname>notes.mkv</d:displayname><d:getcontentlength>4096</d:getcontentlength><d:resourcetype/></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>
+<d:response><d:href>/elsewhere/x.mkv</d:href>
+<d:propstat><d:prop><d:resourcetype/></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>
+</d:multistatus>`)
+	})
+	defer ts.Close()
+
+	c := NewWebDAVClient(&Config{URL: ts.URL})
+	c.connected = true
+	ctx := context.Background()
+	after := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	files, err := client.CollectFiles(c.Search(ctx, "media", client.SearchCriteria{
+		Names: []string{"*.mkv", "100%_?"}, MinSize: 1024, ModifiedAfter: after, FilesOnly: true,
+	}))
+	require.NoError(t, err)
+	require.Len(t, files, 1, "the scope itself, hrefs outside it and other names are skipped")
+	assert.Equal(t, "My Film.mkv", files[0].Name)
+	assert.Equal(t, "2024/My Film.mkv", files[0].Path)
+	assert.Equal(t, int64(4096), files[0].Size)
+
+	assert.Contains(t, body, "<D:href>"+ts.URL+"/media</D:href>")
+	assert.Contains(t, body, "<D:depth>infinity</D:depth>")
+	assert.NotContains(t, body, "<D:like>", "names are matched on the client, not against displayname")
+	assert.Contains(t, body, "<D:gte><D:prop><D:getcontentlength/></D:prop><D:literal>1024</D:literal></D:gte>")
+	assert.Contains(t, body, "<D:literal>2024-05-01T00:00:00Z</D:literal>")
+	assert.Contains(t, body, "<D:not><D:is-collection/></D:not>")
+
+	_, err = client.CollectFiles(c.Search(ctx, "media", client.SearchCriteria{MaxDepth: 1}))
+	require.NoError(t, err)
+	assert.Contains(t, body, "<D:depth>1</D:depth>")
+	assert.NotContains(t, body, "<D:where>", "no conditions")
+
+	status = http.StatusNotImplemented
+	_, err = client.CollectFiles(c.Search(ctx, "media", client.SearchCriteria{}))
+	assert.ErrorIs(t, err, client.ErrNotSupported)
+
+	status = http.StatusInternalServerError
+	_, err = client.CollectFiles(c.Search(ctx, "media", client.SearchCriteria{}))
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, client.ErrNotSupported)
+}
+
+func TestWebDAVClient_Search_NotConnected(t *testing.T) {
+	c := NewWebDAVClient(&Config{URL: "http://localhost"})
+	_, err := client.CollectFiles(c.Search(context.Background(), "", client.SearchCriteria{}))
+	assert.EqualError(t, err, "not connected")
+}